@@ -0,0 +1,138 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+const apdexMetric = "apdex"
+
+// apdexRule rates the samples of a k6 metric, e.g.
+// "http_req_duration:500:2000": satisfied up to 500, tolerating up to 2000
+// and frustrated beyond. The tolerating bound defaults to four times the
+// satisfied one.
+type apdexRule struct {
+	metric     string
+	satisfied  float64
+	tolerating float64
+}
+
+var apdexRuleRe = regexp.MustCompile(`^\s*([A-Za-z0-9_.]+):([0-9.]+)(?::([0-9.]+))?\s*$`)
+
+func parseApdexRules(exprs []string) ([]apdexRule, error) {
+	rules := make([]apdexRule, 0, len(exprs))
+	for _, expr := range exprs {
+		match := apdexRuleRe.FindStringSubmatch(expr)
+		if match == nil {
+			return nil, fmt.Errorf("invalid apdex rule %q, expected metric:satisfied[:tolerating]", expr)
+		}
+		satisfied, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid apdex rule %q: %w", expr, err)
+		}
+		tolerating := 4 * satisfied
+		if match[3] != "" {
+			if tolerating, err = strconv.ParseFloat(match[3], 64); err != nil {
+				return nil, fmt.Errorf("invalid apdex rule %q: %w", expr, err)
+			}
+		}
+		if satisfied <= 0 || tolerating < satisfied {
+			return nil, fmt.Errorf("invalid apdex rule %q, expected 0 < satisfied <= tolerating", expr)
+		}
+		rules = append(rules, apdexRule{metric: match[1], satisfied: satisfied, tolerating: tolerating})
+	}
+	return rules, nil
+}
+
+type apdexKey struct {
+	metric   string
+	scenario string
+}
+
+// apdexScore counts the samples of a metric and scenario over a flush.
+type apdexScore struct {
+	satisfied  int
+	tolerating int
+	total      int
+}
+
+// apdexScores holds the scores of the flush, it is only touched by the
+// flushing goroutine.
+type apdexScores map[apdexKey]*apdexScore
+
+// observeApdex rates the sample against the apdex rule of its metric,
+// whatever the metric filters. The responses the script doesn't expect
+// are frustrated whatever their duration.
+func (o *Output) observeApdex(sample metrics.Sample) {
+	for _, rule := range o.apdexRules {
+		if rule.metric != sample.Metric.Name {
+			continue
+		}
+		scenario, _ := sampleTag(sample, scenarioTag)
+		key := apdexKey{metric: rule.metric, scenario: scenario}
+		if o.apdex == nil {
+			o.apdex = make(apdexScores)
+		}
+		score, ok := o.apdex[key]
+		if !ok {
+			score = &apdexScore{}
+			o.apdex[key] = score
+		}
+		score.total++
+		if expected, ok := sampleTag(sample, expectedResponseTag); ok && expected == "false" {
+			continue
+		}
+		switch {
+		case sample.Value <= rule.satisfied:
+			score.satisfied++
+		case sample.Value <= rule.tolerating:
+			score.tolerating++
+		}
+	}
+}
+
+// apdexMetrics returns a k6.apdex gauge per rated metric and scenario seen
+// since the previous flush, (satisfied + tolerating/2) / total, and resets
+// the scores.
+func (o *Output) apdexMetrics(now time.Time) []dynatraceMetric {
+	if len(o.apdex) == 0 {
+		return nil
+	}
+
+	keys := make([]apdexKey, 0, len(o.apdex))
+	for key := range o.apdex {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].metric != keys[j].metric {
+			return keys[i].metric < keys[j].metric
+		}
+		return keys[i].scenario < keys[j].scenario
+	})
+
+	dynMetrics := make([]dynatraceMetric, 0, len(keys))
+	for _, key := range keys {
+		score := o.apdex[key]
+		dims := o.outputDimensions()
+		dims[metricDimension] = key.metric
+		if key.scenario != "" {
+			dims[scenarioTag] = key.scenario
+		}
+		dynMetrics = append(dynMetrics, dynatraceMetric{
+			metricKeyName:    o.metricKey(apdexMetric),
+			description:      "k6 Apdex score over the flush period, from 0 (frustrated) to 1 (satisfied)",
+			metricUnit:       "Ratio",
+			metricDimensions: dims,
+			metricValue:      (float64(score.satisfied) + float64(score.tolerating)/2) / float64(score.total),
+			metricTimeStamp:  o.aggregateTimestamp(now),
+			metricType:       metrics.Gauge,
+		})
+	}
+	o.apdex = nil
+	return dynMetrics
+}
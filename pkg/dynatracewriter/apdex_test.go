@@ -0,0 +1,64 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+)
+
+func TestParseApdexRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := parseApdexRules([]string{"http_req_duration:500", " browser.lcp:2500:4000 "})
+	require.NoError(t, err)
+	assert.Equal(t, []apdexRule{
+		{metric: "http_req_duration", satisfied: 500, tolerating: 2000},
+		{metric: "browser.lcp", satisfied: 2500, tolerating: 4000},
+	}, rules)
+
+	for _, invalid := range []string{"http_req_duration", "http_req_duration:0", "http_req_duration:500:100", "http_req_duration<500"} {
+		_, err := parseApdexRules([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestApdexMetrics(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.Apdex = []string{"http_req_duration:500"}
+	})
+	duration := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	now := time.Now()
+	sample := func(scenario, expected string, value float64) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: duration, Tags: newTags(map[string]string{
+				scenarioTag: scenario, expectedResponseTag: expected,
+			})},
+			Time:  now,
+			Value: value,
+		}
+	}
+	o.convertToTimeDynatraceData([]metrics.SampleContainer{metrics.Samples{
+		sample("browse", "true", 100),   // satisfied
+		sample("browse", "true", 1500),  // tolerating
+		sample("browse", "true", 3000),  // frustrated
+		sample("browse", "false", 100),  // frustrated, the response is an error
+		sample("checkout", "true", 400), // satisfied
+	}})
+
+	lines := o.apdexMetrics(now)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "k6.apdex", lines[0].metricKeyName)
+	assert.Equal(t, "browse", lines[0].metricDimensions[scenarioTag])
+	assert.Equal(t, "http_req_duration", lines[0].metricDimensions[metricDimension])
+	assert.Equal(t, "run", lines[0].metricDimensions[testRunIDDimension])
+	assert.InDelta(t, 0.375, lines[0].metricValue, 1e-9)
+	assert.Equal(t, "checkout", lines[1].metricDimensions[scenarioTag])
+	assert.Equal(t, 1.0, lines[1].metricValue)
+
+	assert.Empty(t, o.apdexMetrics(now), "the scores cover one flush")
+}
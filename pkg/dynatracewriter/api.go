@@ -0,0 +1,89 @@
+package dynatracewriter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// apiUrl returns the url of another Dynatrace API endpoint of the
+// environment the metrics are sent to.
+func (conf Config) apiUrl(endpoint string) string {
+	base := strings.TrimSuffix(conf.Url, defaultDynatraceMetricEndPoint)
+	if conf.IngestMode.String == ingestModeLocal {
+		base = strings.TrimSuffix(conf.Url, defaultDynatraceLocalMetricEndPoint)
+	}
+	return base + endpoint
+}
+
+// apiFeatures returns the configured options that call the Dynatrace API
+// rather than the metrics ingest endpoint, the local ingest mode has no
+// API to call.
+func (conf Config) apiFeatures() []string {
+	var features []string
+	add := func(enabled bool, name string) {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	add(conf.ExportFormat.String == exportFormatOTLP, "exportFormat "+exportFormatOTLP)
+	add(conf.ThresholdEvents.Bool, "thresholdEvents")
+	add(conf.LifecycleEvents.Bool, "lifecycleEvents")
+	add(conf.DeploymentEvent.Bool, "deploymentEvent")
+	add(conf.MaintenanceWindow.Bool, "maintenanceWindow")
+	add(conf.Logs.Bool, "logs")
+	add(conf.FailureLogs.Bool, "failureLogs")
+	add(conf.Traces.Bool, "traces")
+	add(conf.BizEvents.Bool, "bizEvents")
+	add(conf.Slos.Bool, "slos")
+	add(len(conf.MetricEvents) > 0, "metricEvents")
+	add(conf.ThresholdMetricEvents.Bool, "thresholdMetricEvents")
+	add(conf.CreateDashboard.Bool, "createDashboard")
+	return features
+}
+
+// postAPI sends body to a Dynatrace API endpoint with the configured
+// headers and returns an error for any non 2xx answer.
+func (o *Output) postAPI(endpoint, contentType string, body []byte) error {
+	_, err := o.callAPI(http.MethodPost, endpoint, contentType, body)
+	return err
+}
+
+// callAPI calls a Dynatrace API endpoint with the configured headers and
+// returns the response body, or an error for any non 2xx answer.
+func (o *Output) callAPI(method, endpoint, contentType string, body []byte) ([]byte, error) {
+	return o.callAPIContext(context.Background(), method, endpoint, contentType, body)
+}
+
+// callAPIContext is callAPI with the context of the request.
+func (o *Output) callAPIContext(ctx context.Context, method, endpoint, contentType string, body []byte) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, o.config.apiUrl(endpoint), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range o.config.Headers {
+		request.Header.Set(key, value)
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	requestID := newRequestID()
+	if contentType != "application/x-protobuf" {
+		o.dumpPayload(o.logger.WithField("requestId", requestID), string(body))
+	}
+	response, _, err := o.do(request, requestID, 1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("request %s: %w", requestID, err)
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("%s answered %s to request %s: %s", endpoint, response.Status, requestID, string(responseBody))
+	}
+	return responseBody, err
+}
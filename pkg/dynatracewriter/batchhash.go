@@ -0,0 +1,58 @@
+package dynatracewriter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+const (
+	// batchHashHeader carries the hash of the request body, the same for
+	// the retries and the replays of a batch, so proxies and the logs can
+	// tell them apart from new batches.
+	batchHashHeader = "X-Batch-Hash"
+
+	// maxAcceptedBatches bounds the hashes of the replayed batches kept.
+	maxAcceptedBatches = 1024
+)
+
+// batchHash returns the hex sha256 of the body of a batch.
+func batchHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// acceptedBatches remembers the hashes of the last spooled batches the
+// endpoint accepted on replay, so a batch whose file could not be removed
+// is not sent, and its counters counted, twice.
+type acceptedBatches struct {
+	hashes map[string]struct{}
+	order  []string
+}
+
+func (a *acceptedBatches) contains(hash string) bool {
+	_, ok := a.hashes[hash]
+	return ok
+}
+
+func (a *acceptedBatches) add(hash string) {
+	if a.hashes == nil {
+		a.hashes = make(map[string]struct{})
+	}
+	if a.contains(hash) {
+		return
+	}
+	if len(a.order) >= maxAcceptedBatches {
+		delete(a.hashes, a.order[0])
+		a.order = a.order[1:]
+	}
+	a.hashes[hash] = struct{}{}
+	a.order = append(a.order, hash)
+}
+
+// partiallyAccepted reports whether the answer of the endpoint counts some
+// accepted lines, the batch must then not be sent again.
+func partiallyAccepted(answer []byte) bool {
+	var response ingestResponse
+	return json.Unmarshal(answer, &response) == nil && response.LinesOk > 0
+}
@@ -0,0 +1,103 @@
+package dynatracewriter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestBatchHashHeader(t *testing.T) {
+	t.Parallel()
+
+	var (
+		status = http.StatusServiceUnavailable
+		hashes []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, batchHash(body), r.Header.Get(batchHashHeader))
+		hashes = append(hashes, r.Header.Get(batchHashHeader))
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.MaxRetries = null.IntFrom(1)
+		c.RetryExhaustedPolicy = null.StringFrom(retryExhaustedSpool)
+		c.SpoolDir = null.StringFrom(t.TempDir())
+	})
+	lines := []dynatraceMetric{{metricKeyName: "k6.iterations", metricValue: 1, metricType: metrics.Counter, delta: true}}
+	require.Error(t, o.sendMetricsContext(context.Background(), lines))
+
+	status = http.StatusAccepted
+	o.replaySpool(context.Background())
+	require.Len(t, hashes, 3)
+	assert.Equal(t, hashes[0], hashes[1], "the retry keeps the hash")
+	assert.Equal(t, hashes[0], hashes[2], "the replay keeps the hash")
+
+	// the same lines sent again are a new batch
+	require.NoError(t, o.sendMetricsContext(context.Background(), lines))
+	assert.Len(t, hashes, 4)
+}
+
+func TestReplaySkipsAcceptedBatches(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.RetryExhaustedPolicy = null.StringFrom(retryExhaustedSpool)
+		c.SpoolDir = null.StringFrom(t.TempDir())
+	})
+	body := []byte("k6.vus,dt.metrics.source=k6 gauge,1")
+	_, err := o.spoolBatch(body, 1)
+	require.NoError(t, err)
+	o.accepted.add(batchHash(body))
+
+	o.replaySpool(context.Background())
+	assert.Zero(t, requests)
+	spooled, err := o.spooledBatches()
+	require.NoError(t, err)
+	assert.Empty(t, spooled, "the file of the accepted batch is removed")
+}
+
+func TestPartialAcceptanceIsNotRetried(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"linesOk":1,"linesInvalid":1}`))
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.RetryOnStatusCodes = []int{http.StatusBadRequest}
+	})
+	o.sendMetrics([]dynatraceMetric{
+		{metricKeyName: "k6.iterations", metricValue: 1, metricType: metrics.Counter, delta: true},
+		{metricKeyName: "k6.vus", metricValue: 1, metricType: metrics.Gauge},
+	})
+	assert.Equal(t, 1, requests)
+	assert.Zero(t, o.totals.retries)
+	assert.Equal(t, 1, o.totals.linesSent)
+	assert.Equal(t, 1, o.totals.linesInvalid)
+
+	assert.True(t, partiallyAccepted([]byte(`{"linesOk":3}`)))
+	assert.False(t, partiallyAccepted([]byte(`{"linesOk":0,"linesInvalid":2}`)))
+	assert.False(t, partiallyAccepted([]byte("bad gateway")))
+}
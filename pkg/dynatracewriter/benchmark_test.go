@@ -0,0 +1,140 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.k6.io/k6/metrics"
+)
+
+// httpRequestMetrics are the metrics k6 emits for every http request.
+var httpRequestMetrics = []struct {
+	name     string
+	typ      metrics.MetricType
+	contains metrics.ValueType
+}{
+	{"http_reqs", metrics.Counter, metrics.Default},
+	{"http_req_duration", metrics.Trend, metrics.Time},
+	{"http_req_blocked", metrics.Trend, metrics.Time},
+	{"http_req_connecting", metrics.Trend, metrics.Time},
+	{"http_req_tls_handshaking", metrics.Trend, metrics.Time},
+	{"http_req_sending", metrics.Trend, metrics.Time},
+	{"http_req_waiting", metrics.Trend, metrics.Time},
+	{"http_req_receiving", metrics.Trend, metrics.Time},
+	{"http_req_failed", metrics.Rate, metrics.Default},
+}
+
+// benchmarkSamples returns the samples of n http requests spread over 50
+// urls, most of them hitting the first ones, with a few failed requests,
+// as a test of many VUs buffers them between two flushes.
+func benchmarkSamples(n int) []metrics.SampleContainer {
+	registry := metrics.NewRegistry()
+	requestMetrics := make([]*metrics.Metric, len(httpRequestMetrics))
+	for i, m := range httpRequestMetrics {
+		requestMetrics[i] = registry.MustNewMetric(m.name, m.typ, m.contains)
+	}
+
+	now := time.Now()
+	containers := make([]metrics.SampleContainer, n)
+	for i := range containers {
+		status, failed := "200", 0.0
+		if i%50 == 0 {
+			status, failed = "500", 1
+		}
+		tags := registry.RootTagSet().WithTagsFromMap(map[string]string{
+			"url":      fmt.Sprintf("https://test.k6.io/api/%d", (i*i)%50),
+			"method":   "GET",
+			"status":   status,
+			"scenario": "default",
+			"proto":    "HTTP/1.1",
+		})
+		samples := make([]metrics.Sample, len(requestMetrics))
+		for j, m := range requestMetrics {
+			value := float64(i%1000) * 0.75
+			switch m.Name {
+			case "http_reqs":
+				value = 1
+			case "http_req_failed":
+				value = failed
+			}
+			samples[j] = metrics.Sample{
+				TimeSeries: metrics.TimeSeries{Metric: m, Tags: tags},
+				Time:       now,
+				Value:      value,
+			}
+		}
+		containers[i] = metrics.ConnectedSamples{Samples: samples, Tags: tags, Time: now}
+	}
+	return containers
+}
+
+func BenchmarkConvertSamples(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		containers := benchmarkSamples(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			o := newTestOutput(b, "http://localhost", nil)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				o.convertToTimeDynatraceData(containers)
+			}
+		})
+	}
+}
+
+func BenchmarkStreamPayload(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		dynMetrics := benchmarkMetrics(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			o := newTestOutput(b, "http://localhost", nil)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				stream := o.streamPayload(dynMetrics, compressionGzip)
+				_, _ = io.Copy(ioutil.Discard, stream)
+				stream.size()
+			}
+		})
+	}
+}
+
+// TestAllocationBudget guards the hot path against allocating for every
+// sample or line again, the former string concatenation allocated several
+// times per line.
+func TestAllocationBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("allocation budgets are skipped in short mode")
+	}
+
+	t.Run("conversion", func(t *testing.T) {
+		const n = 1000
+		containers := benchmarkSamples(n)
+		samples := n * len(httpRequestMetrics)
+		o := newTestOutput(t, "http://localhost", nil)
+		// the first flush fills the series cache
+		o.convertToTimeDynatraceData(containers)
+
+		allocs := testing.AllocsPerRun(5, func() {
+			o.convertToTimeDynatraceData(containers)
+		})
+		assert.LessOrEqual(t, allocs/float64(samples), 4.0, "allocations per converted sample")
+	})
+
+	t.Run("serialization", func(t *testing.T) {
+		const n = 1000
+		dynMetrics := benchmarkMetrics(n)
+		described := map[string]struct{}{"k6.http_req_duration": {}}
+		// warm up the buffer pool
+		generatePayload(dynMetrics, described)
+
+		allocs := testing.AllocsPerRun(5, func() {
+			buf := getPayloadBuffer(n)
+			writePayload(buf, dynMetrics, described)
+			putPayloadBuffer(buf)
+		})
+		assert.LessOrEqual(t, allocs/n, 0.1, "allocations per serialized line")
+	})
+}
@@ -0,0 +1,113 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	defaultDynatraceBizEventsEndPoint = "/platform/classic/environment-api/v2/bizevents/ingest"
+
+	bizEventType           = "k6.iteration"
+	defaultBizEventsPrefix = "biz."
+
+	// maxBufferedBizEvents bounds the events kept between two flushes.
+	maxBufferedBizEvents = 10000
+
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+)
+
+// bizEventTracker builds a business event per iteration. A failed check or
+// request marks the iteration of its VU as failed, which requires the vu
+// system tag; without it every iteration is reported as a success.
+type bizEventTracker struct {
+	failedVUs map[string]bool
+	events    []map[string]interface{}
+	dropped   int
+}
+
+func (o *Output) observeIteration(sample metrics.Sample) {
+	if !o.config.BizEvents.Bool {
+		return
+	}
+	t := &o.bizEvents
+	if t.failedVUs == nil {
+		t.failedVUs = make(map[string]bool)
+	}
+
+	vu, _ := sampleTag(sample, vuTag)
+	switch sample.Metric.Name {
+	case "checks":
+		if sample.Value == 0 {
+			t.failedVUs[vu] = true
+		}
+		return
+	case "http_req_failed":
+		if sample.Value != 0 {
+			t.failedVUs[vu] = true
+		}
+		return
+	case "iteration_duration":
+	default:
+		return
+	}
+
+	outcome := outcomeSuccess
+	if t.failedVUs[vu] {
+		outcome = outcomeFailure
+	}
+	delete(t.failedVUs, vu)
+
+	if len(t.events) >= maxBufferedBizEvents {
+		t.dropped++
+		return
+	}
+
+	tags := sampleTags(sample)
+
+	event := map[string]interface{}{
+		"event.type":       bizEventType,
+		"event.provider":   "k6",
+		"timestamp":        sample.GetTime().UnixMilli(),
+		"duration":         sample.Value,
+		"outcome":          outcome,
+		testRunIDDimension: o.config.TestRunID.String,
+	}
+	if scenario := tags["scenario"]; scenario != "" {
+		event["scenario"] = scenario
+	}
+	prefix := o.config.BizEventsTagPrefix.String
+	for key, value := range tags {
+		if prefix != "" && strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			event[key[len(prefix):]] = value
+		}
+	}
+	t.events = append(t.events, event)
+}
+
+// sendBizEvents posts the business events of the iterations finished since
+// the last flush.
+func (o *Output) sendBizEvents() {
+	t := &o.bizEvents
+	if t.dropped > 0 {
+		o.logger.WithField("events", t.dropped).Warn("Dynatrace: business event buffer full, dropped events")
+		t.dropped = 0
+	}
+	if len(t.events) == 0 {
+		return
+	}
+	events := t.events
+	t.events = nil
+
+	body, err := json.Marshal(events)
+	if err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to serialize the business events")
+		return
+	}
+	if err := o.postAPI(defaultDynatraceBizEventsEndPoint, "application/json; charset=utf-8", body); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to send the business events")
+	}
+}
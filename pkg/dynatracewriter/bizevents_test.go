@@ -0,0 +1,62 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestBizEvents(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan []map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, defaultDynatraceBizEventsEndPoint, req.URL.Path)
+		body, _ := ioutil.ReadAll(req.Body)
+		var events []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(body, &events))
+		received <- events
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.BizEvents = null.BoolFrom(true)
+	})
+
+	var (
+		now       = time.Now()
+		checks    = newMetric("checks", metrics.Rate)
+		iteration = newMetric("iteration_duration", metrics.Trend, metrics.Time)
+		vu1       = newTags(map[string]string{"vu": "1", "scenario": "checkout", "biz.journey": "buy"})
+		vu2       = newTags(map[string]string{"vu": "2", "scenario": "checkout"})
+	)
+	o.observeIteration(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks, Tags: vu1}, Time: now, Value: 0})
+	o.observeIteration(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks, Tags: vu2}, Time: now, Value: 1})
+	o.observeIteration(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: iteration, Tags: vu1}, Time: now, Value: 1200})
+	o.observeIteration(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: iteration, Tags: vu2}, Time: now, Value: 800})
+	o.observeIteration(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: iteration, Tags: vu1}, Time: now, Value: 900})
+
+	o.sendBizEvents()
+	events := <-received
+	require.Len(t, events, 3)
+
+	assert.Equal(t, bizEventType, events[0]["event.type"])
+	assert.Equal(t, "checkout", events[0]["scenario"])
+	assert.Equal(t, 1200.0, events[0]["duration"])
+	assert.Equal(t, outcomeFailure, events[0]["outcome"])
+	assert.Equal(t, "buy", events[0]["journey"])
+	assert.Equal(t, "run", events[0][testRunIDDimension])
+	assert.NotContains(t, events[0], "biz.journey")
+
+	assert.Equal(t, outcomeSuccess, events[1]["outcome"])
+	assert.NotContains(t, events[1], "journey")
+	assert.Equal(t, outcomeSuccess, events[2]["outcome"])
+}
@@ -0,0 +1,59 @@
+package dynatracewriter
+
+import (
+	"net/url"
+
+	"go.k6.io/k6/metrics"
+)
+
+// webVital describes how a k6 browser web vital metric is exported.
+type webVital struct {
+	key string
+	// duration is false for the unitless vitals, like the layout shift score
+	duration bool
+}
+
+// browserWebVitals maps the web vital metrics of the k6 browser module to
+// their Dynatrace metric keys, before the metric prefix is added.
+var browserWebVitals = map[string]webVital{
+	"browser_web_vital_lcp":  {key: "browser.lcp", duration: true},
+	"browser_web_vital_fcp":  {key: "browser.fcp", duration: true},
+	"browser_web_vital_fid":  {key: "browser.fid", duration: true},
+	"browser_web_vital_inp":  {key: "browser.inp", duration: true},
+	"browser_web_vital_ttfb": {key: "browser.ttfb", duration: true},
+	"browser_web_vital_cls":  {key: "browser.cls"},
+}
+
+// applyWebVital renames a web vital metric and fixes its unit, since the
+// browser module doesn't flag all of them as time metrics. The page url
+// loses its query and fragment before the url groups are applied.
+func (o *Output) applyWebVital(sample metrics.Sample, m *dynatraceMetric) {
+	vital, ok := browserWebVitals[sample.Metric.Name]
+	if !ok || !o.config.BrowserMetrics.Bool {
+		return
+	}
+
+	m.metricKeyName = vital.key
+	switch {
+	case !vital.duration:
+		m.metricUnit = "Unspecified"
+	case sample.Metric.Contains != metrics.Time:
+		m.metricValue *= o.durationUnit.factor
+		m.metricUnit = o.durationUnit.unit
+	}
+	if page, ok := m.metricDimensions[urlTag]; ok {
+		m.metricDimensions[urlTag] = pageUrl(page)
+	}
+}
+
+// pageUrl strips the query and fragment of a page url.
+func pageUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
@@ -0,0 +1,43 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestWebVitals(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.BrowserMetrics = null.BoolFrom(true)
+		c.DurationUnit = null.StringFrom("s")
+	})
+
+	now := time.Now()
+	tags := newTags(map[string]string{"url": "https://shop.example.com/cart?session=42#top"})
+
+	m, ok := o.convertSample(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: newMetric("browser_web_vital_lcp", metrics.Trend), Tags: tags}, Time: now, Value: 1500}, now)
+	require.True(t, ok)
+	assert.Equal(t, "k6.browser.lcp", m.metricKeyName)
+	assert.Equal(t, "Second", m.metricUnit)
+	assert.Equal(t, 1.5, m.metricValue)
+	assert.Equal(t, "https://shop.example.com/cart", m.metricDimensions[urlTag])
+
+	m, ok = o.convertSample(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: newMetric("browser_web_vital_cls", metrics.Trend), Tags: tags}, Time: now, Value: 0.1}, now)
+	require.True(t, ok)
+	assert.Equal(t, "k6.browser.cls", m.metricKeyName)
+	assert.Equal(t, "Unspecified", m.metricUnit)
+	assert.Equal(t, 0.1, m.metricValue)
+}
+
+func TestPageUrl(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "https://example.com/a/b", pageUrl("https://example.com/a/b?x=1#y"))
+	assert.Equal(t, "https://example.com/", pageUrl("https://example.com/"))
+}
@@ -0,0 +1,35 @@
+package dynatracewriter
+
+import (
+	"bytes"
+	"sync"
+)
+
+const (
+	// estimatedLineSize presizes the payload buffers, a k6 line with its
+	// usual dimensions is around 200 bytes
+	estimatedLineSize = 256
+	// maxPooledBufferSize keeps the buffers of exceptionally large flushes
+	// out of the pool
+	maxPooledBufferSize = 8 << 20
+)
+
+var payloadBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getPayloadBuffer returns an empty pooled buffer able to hold the given
+// number of lines without growing.
+func getPayloadBuffer(lines int) *bytes.Buffer {
+	buf := payloadBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	buf.Grow(lines * estimatedLineSize)
+	return buf
+}
+
+func putPayloadBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	payloadBuffers.Put(buf)
+}
@@ -0,0 +1,55 @@
+package dynatracewriter
+
+import (
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	burnRateSourceMetric = "http_req_failed"
+	burnRateMetric       = "error_budget.burn_rate"
+)
+
+// errorBudget counts the requests of a flush for the burn rate, it is only
+// touched by the flushing goroutine.
+type errorBudget struct {
+	failed int
+	total  int
+}
+
+// observeBurnRate counts the http_req_failed samples when burnRateTarget
+// is set, whatever the metric filters.
+func (o *Output) observeBurnRate(sample metrics.Sample) {
+	if o.config.BurnRateTarget.Float64 <= 0 || sample.Metric.Name != burnRateSourceMetric {
+		return
+	}
+	o.budget.total++
+	if sample.Value != 0 {
+		o.budget.failed++
+	}
+}
+
+// burnRateMetrics returns the k6.error_budget.burn_rate gauge of the
+// requests since the previous flush: their error rate divided by the
+// error budget of burnRateTarget, 1 spends the budget exactly over the
+// SLO window, 14.4 is the usual fast-burn alert. It resets the counts.
+func (o *Output) burnRateMetrics(now time.Time) []dynatraceMetric {
+	budget := o.budget
+	o.budget = errorBudget{}
+	if budget.total == 0 {
+		return nil
+	}
+
+	errorRate := float64(budget.failed) / float64(budget.total)
+	allowed := 1 - o.config.BurnRateTarget.Float64/100
+	return []dynatraceMetric{{
+		metricKeyName:    o.metricKey(burnRateMetric),
+		description:      "k6 error budget burn rate over the flush period, the error rate divided by the one the SLO target allows",
+		metricUnit:       "Unspecified",
+		metricDimensions: o.outputDimensions(),
+		metricValue:      errorRate / allowed,
+		metricTimeStamp:  o.aggregateTimestamp(now),
+		metricType:       metrics.Gauge,
+	}}
+}
@@ -0,0 +1,49 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestBurnRateMetrics(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.BurnRateTarget = null.FloatFrom(99.5)
+	})
+	failed := newMetric(burnRateSourceMetric, metrics.Rate)
+	now := time.Now()
+	var samples metrics.Samples
+	for i := 0; i < 200; i++ {
+		value := 0.0
+		if i < 2 {
+			value = 1
+		}
+		samples = append(samples, metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: failed, Tags: newTags(nil)}, Time: now, Value: value})
+	}
+	o.convertToTimeDynatraceData([]metrics.SampleContainer{samples})
+
+	lines := o.burnRateMetrics(now)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "k6.error_budget.burn_rate", lines[0].metricKeyName)
+	assert.Equal(t, "run", lines[0].metricDimensions[testRunIDDimension])
+	// a 1% error rate burns the 0.5% budget twice as fast as allowed
+	assert.InDelta(t, 2, lines[0].metricValue, 1e-9)
+
+	assert.Empty(t, o.burnRateMetrics(now), "the burn rate covers one flush")
+}
+
+func TestValidateBurnRateTarget(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.BurnRateTarget = null.FloatFrom(100)
+	err := c.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "burnRateTarget must be a success percentage below 100")
+}
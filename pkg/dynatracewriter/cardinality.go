@@ -0,0 +1,143 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// cardinalityPolicyOther replaces unseen dimension values with "other"
+	// once the series limit is reached.
+	cardinalityPolicyOther = "other"
+	// cardinalityPolicyDrop drops samples that would create a new series
+	// once the series limit is reached.
+	cardinalityPolicyDrop = "drop"
+
+	otherDimensionValue = "other"
+)
+
+// cardinalityLimiter tracks the distinct metric+dimension series exported
+// during the run and enforces the configured MaxSeries limit.
+type cardinalityLimiter struct {
+	limit  int
+	policy string
+	logger logrus.FieldLogger
+
+	series map[string]struct{}
+	// values holds the known values of each metric dimension, keyed by
+	// "metric|dimension", used to decide what gets folded into "other".
+	values   map[string]map[string]struct{}
+	reported map[string]struct{}
+	// onLimit is called the first time the limit rewrites or drops the
+	// series of a metric dimension.
+	onLimit func()
+}
+
+func newCardinalityLimiter(conf *Config, logger logrus.FieldLogger) (*cardinalityLimiter, error) {
+	policy := conf.CardinalityPolicy.String
+	if policy != cardinalityPolicyOther && policy != cardinalityPolicyDrop {
+		return nil, fmt.Errorf("invalid cardinalityPolicy %q, expected %q or %q",
+			policy, cardinalityPolicyOther, cardinalityPolicyDrop)
+	}
+	if conf.MaxSeries.Int64 < 0 {
+		return nil, fmt.Errorf("maxSeries can not be negative")
+	}
+
+	return &cardinalityLimiter{
+		limit:    int(conf.MaxSeries.Int64),
+		policy:   policy,
+		logger:   logger,
+		series:   make(map[string]struct{}),
+		values:   make(map[string]map[string]struct{}),
+		reported: make(map[string]struct{}),
+	}, nil
+}
+
+// admit reports whether the metric can be exported, possibly after
+// rewriting some of its dimension values to "other".
+func (l *cardinalityLimiter) admit(m *dynatraceMetric) bool {
+	if l.limit == 0 {
+		return true
+	}
+
+	var key string
+	if m.cached != nil {
+		key = m.cached.key
+	} else {
+		key = seriesKey(m.metricKeyName, m.metricDimensions)
+	}
+	if _, ok := l.series[key]; ok {
+		return true
+	}
+
+	if len(l.series) < l.limit {
+		l.remember(key, m)
+		return true
+	}
+
+	if l.policy == cardinalityPolicyDrop {
+		l.report(m.metricKeyName, "", "Dynatrace: series limit of %d reached, dropping new series of metric %q")
+		return false
+	}
+
+	m.ownDimensions()
+	for dim, value := range m.metricDimensions {
+		if _, known := l.values[m.metricKeyName+"|"+dim][value]; !known {
+			m.metricDimensions[dim] = otherDimensionValue
+			l.report(m.metricKeyName, dim,
+				"Dynatrace: series limit of %d reached, replacing new values of metric %q dimension %q with \"other\"")
+		}
+	}
+	l.remember(seriesKey(m.metricKeyName, m.metricDimensions), m)
+	return true
+}
+
+func (l *cardinalityLimiter) remember(key string, m *dynatraceMetric) {
+	l.series[key] = struct{}{}
+	for dim, value := range m.metricDimensions {
+		valuesKey := m.metricKeyName + "|" + dim
+		if l.values[valuesKey] == nil {
+			l.values[valuesKey] = make(map[string]struct{})
+		}
+		l.values[valuesKey][value] = struct{}{}
+	}
+}
+
+// report warns once per metric and dimension about the enforced limit.
+func (l *cardinalityLimiter) report(metric, dim, format string) {
+	key := metric + "|" + dim
+	if _, ok := l.reported[key]; ok {
+		return
+	}
+	l.reported[key] = struct{}{}
+	if l.onLimit != nil {
+		l.onLimit()
+	}
+	if dim == "" {
+		l.logger.Warnf(format, l.limit, metric)
+	} else {
+		l.logger.Warnf(format, l.limit, metric, dim)
+	}
+}
+
+// seriesKey identifies a series independently of the dimension order.
+func seriesKey(name string, dims map[string]string) string {
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(dims[k])
+	}
+	return b.String()
+}
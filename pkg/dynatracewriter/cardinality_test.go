@@ -0,0 +1,57 @@
+package dynatracewriter
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestCardinalityLimiter(t *testing.T) {
+	t.Parallel()
+
+	metric := func(url string) *dynatraceMetric {
+		return &dynatraceMetric{
+			metricKeyName:    "http_reqs",
+			metricDimensions: map[string]string{"url": url, "method": "GET"},
+		}
+	}
+
+	c := NewConfig()
+	c.MaxSeries = null.IntFrom(2)
+	l, err := newCardinalityLimiter(&c, logrus.New())
+	require.NoError(t, err)
+
+	assert.True(t, l.admit(metric("/a")))
+	assert.True(t, l.admit(metric("/b")))
+	assert.True(t, l.admit(metric("/a")))
+
+	m := metric("/c")
+	assert.True(t, l.admit(m))
+	assert.Equal(t, map[string]string{"url": "other", "method": "GET"}, m.metricDimensions)
+
+	c.CardinalityPolicy = null.StringFrom(cardinalityPolicyDrop)
+	l, err = newCardinalityLimiter(&c, logrus.New())
+	require.NoError(t, err)
+	assert.True(t, l.admit(metric("/a")))
+	assert.True(t, l.admit(metric("/b")))
+	assert.False(t, l.admit(metric("/c")))
+	assert.True(t, l.admit(metric("/b")))
+
+	c.CardinalityPolicy = null.StringFrom("unknown")
+	_, err = newCardinalityLimiter(&c, logrus.New())
+	assert.Error(t, err)
+}
+
+func TestSeriesKey(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t,
+		seriesKey("m", map[string]string{"b": "2", "a": "1"}),
+		seriesKey("m", map[string]string{"a": "1", "b": "2"}))
+	assert.NotEqual(t,
+		seriesKey("m", map[string]string{"a": "1"}),
+		seriesKey("n", map[string]string{"a": "1"}))
+}
@@ -0,0 +1,59 @@
+package dynatracewriter
+
+import (
+	"strings"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	checkTag = "check"
+
+	checkPassMetric = "check.pass"
+	checkFailMetric = "check.fail"
+
+	maxCheckNameLength = 250
+)
+
+var (
+	checkPass = newMetric(checkPassMetric, metrics.Counter)
+	checkFail = newMetric(checkFailMetric, metrics.Counter)
+
+	checkNameReplacer = strings.NewReplacer(`"`, "'", `\`, "/", "\n", " ", "\r", " ")
+)
+
+// sanitizeCheckName makes a check name a valid dimension value.
+func sanitizeCheckName(name string) string {
+	name = checkNameReplacer.Replace(strings.TrimSpace(name))
+	if len(name) > maxCheckNameLength {
+		name = name[:maxCheckNameLength]
+	}
+	return name
+}
+
+// checkMetric converts a checks sample into a k6.check.pass or
+// k6.check.fail delta count, with the check name as dimension.
+func (o *Output) checkMetric(sample metrics.Sample, now time.Time) (dynatraceMetric, bool) {
+	if !o.config.CheckMetrics.Bool || sample.Metric.Name != "checks" {
+		return dynatraceMetric{}, false
+	}
+
+	name, _ := sampleTag(sample, checkTag)
+	counter := checkPass
+	if sample.Value == 0 {
+		counter = checkFail
+	}
+	m, ok := o.convertSample(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: counter, Tags: sample.Tags},
+		Time:       sample.Time,
+		Value:      1,
+	}, now)
+	if !ok {
+		return m, false
+	}
+	m.ownDimensions()
+	m.metricDimensions[checkTag] = sanitizeCheckName(name)
+	m.delta = true
+	return m, true
+}
@@ -0,0 +1,52 @@
+package dynatracewriter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestCheckMetrics(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.CheckMetrics = null.BoolFrom(true)
+		c.TagsAsDimensions = []string{"status"}
+	})
+
+	checks := newMetric("checks", metrics.Rate)
+	now := time.Now()
+	tags := newTags(map[string]string{"check": `body has "ok"`, "scenario": "main"})
+
+	m, ok := o.checkMetric(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks, Tags: tags}, Time: now, Value: 1}, now)
+	require.True(t, ok)
+	assert.Equal(t, "k6.check.pass", m.metricKeyName)
+	assert.Equal(t, "body has 'ok'", m.metricDimensions[checkTag])
+	assert.Equal(t, "main", m.metricDimensions[scenarioTag])
+	assert.Equal(t, 1.0, m.metricValue)
+	assert.Equal(t, metrics.Counter, m.metricType)
+	assert.Contains(t, m.toText(), " count,delta=1 ")
+	assert.True(t, strings.HasPrefix(m.metadataText(), "#k6.check.pass count "))
+
+	m, ok = o.checkMetric(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks, Tags: tags}, Time: now, Value: 0}, now)
+	require.True(t, ok)
+	assert.Equal(t, "k6.check.fail", m.metricKeyName)
+	assert.Equal(t, 1.0, m.metricValue)
+
+	reqs := newMetric("http_reqs", metrics.Counter)
+	_, ok = o.checkMetric(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: reqs, Tags: tags}, Time: now, Value: 1}, now)
+	assert.False(t, ok)
+}
+
+func TestSanitizeCheckName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `status is 200`, sanitizeCheckName(" status is 200 "))
+	assert.Equal(t, `a 'b' c/d e`, sanitizeCheckName("a \"b\" c\\d\ne"))
+	assert.Len(t, sanitizeCheckName(strings.Repeat("x", 300)), maxCheckNameLength)
+}
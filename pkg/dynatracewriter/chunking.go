@@ -0,0 +1,83 @@
+package dynatracewriter
+
+import "context"
+
+// defaultMaxLinesPerRequest is the number of metric lines sent at most in
+// a request by default.
+const defaultMaxLinesPerRequest = 1000
+
+// requestChunks splits the lines of a flush into the requests holding at
+// most maxLinesPerRequest lines and maxBytesPerRequest bytes of metric
+// lines, a line bigger than maxBytesPerRequest is sent alone. The OTLP and
+// json bodies are not split, they are not metric lines.
+func (o *Output) requestChunks(dynatraceMetrics []dynatraceMetric) [][]dynatraceMetric {
+	maxLines := int(o.config.MaxLinesPerRequest.Int64)
+	maxBytes := int(o.config.MaxBytesPerRequest.Int64)
+	if o.config.ExportFormat.String != exportFormatMint || (maxLines <= 0 && maxBytes <= 0) {
+		return [][]dynatraceMetric{dynatraceMetrics}
+	}
+	if maxBytes <= 0 {
+		return chunkLines(dynatraceMetrics, maxLines)
+	}
+
+	var (
+		chunks     [][]dynatraceMetric
+		start      int
+		chunkBytes int
+		// described holds the keys of this flush whose metadata line is
+		// counted already, the first request holding the key sends it
+		described = make(map[string]struct{})
+	)
+	buf := getPayloadBuffer(1)
+	defer putPayloadBuffer(buf)
+	for i := range dynatraceMetrics {
+		m := &dynatraceMetrics[i]
+		buf.Reset()
+		m.writeText(buf)
+		size := buf.Len() + 1
+		if _, ok := o.describedMetrics[m.metricKeyName]; !ok {
+			if _, ok := described[m.metricKeyName]; !ok {
+				described[m.metricKeyName] = struct{}{}
+				if metadata := m.metadataText(); metadata != "" {
+					size += len(metadata) + 1
+				}
+			}
+		}
+
+		lines := i - start
+		if lines > 0 && (chunkBytes+size > maxBytes || (maxLines > 0 && lines >= maxLines)) {
+			chunks = append(chunks, dynatraceMetrics[start:i])
+			start, chunkBytes = i, 0
+		}
+		chunkBytes += size
+	}
+	return append(chunks, dynatraceMetrics[start:])
+}
+
+// chunkLines splits the lines by maxLines lines.
+func chunkLines(dynatraceMetrics []dynatraceMetric, maxLines int) [][]dynatraceMetric {
+	chunks := make([][]dynatraceMetric, 0, (len(dynatraceMetrics)+maxLines-1)/maxLines)
+	for start := 0; start < len(dynatraceMetrics); start += maxLines {
+		end := start + maxLines
+		if end > len(dynatraceMetrics) {
+			end = len(dynatraceMetrics)
+		}
+		chunks = append(chunks, dynatraceMetrics[start:end])
+	}
+	return chunks
+}
+
+// sendChunks sends the lines by requestChunks requests, a failed request
+// doesn't stop the next ones. It returns the first error.
+func (o *Output) sendChunks(ctx context.Context, dynatraceMetrics []dynatraceMetric) error {
+	var err error
+	for _, chunk := range o.requestChunks(dynatraceMetrics) {
+		if sendErr := o.sendMetricsContext(ctx, chunk); sendErr != nil && err == nil {
+			err = sendErr
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
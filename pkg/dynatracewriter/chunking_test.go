@@ -0,0 +1,67 @@
+package dynatracewriter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestMaxLinesPerRequest(t *testing.T) {
+	t.Parallel()
+
+	var lines []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lines = append(lines, strings.Count(string(body), "\n"))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.MaxLinesPerRequest = null.IntFrom(2)
+	})
+	gauge := dynatraceMetric{metricKeyName: "k6.vus", metricValue: 1, metricType: metrics.Gauge}
+	o.sendMetrics([]dynatraceMetric{gauge, gauge, gauge, gauge, gauge})
+	assert.Equal(t, []int{2, 2, 1}, lines)
+	assert.Equal(t, 5, o.totals.linesSent)
+}
+
+func TestMaxBytesPerRequest(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.MaxLinesPerRequest = null.IntFrom(3)
+	o := &Output{config: &c, describedMetrics: map[string]struct{}{"k6.vus": {}}}
+
+	gauge := dynatraceMetric{metricKeyName: "k6.vus", metricValue: 1, metricType: metrics.Gauge}
+	lineSize := len(gauge.toText()) + 1
+	dynMetrics := []dynatraceMetric{gauge, gauge, gauge, gauge, gauge}
+
+	// two lines fit in a request
+	c.MaxBytesPerRequest = null.IntFrom(int64(2*lineSize + 1))
+	chunks := o.requestChunks(dynMetrics)
+	require.Len(t, chunks, 3)
+	assert.Len(t, chunks[0], 2)
+	assert.Len(t, chunks[2], 1)
+
+	// a line bigger than the limit is sent alone
+	c.MaxBytesPerRequest = null.IntFrom(1)
+	assert.Len(t, o.requestChunks(dynMetrics), 5)
+
+	// the line limit applies along with the bytes one
+	c.MaxBytesPerRequest = null.IntFrom(1 << 20)
+	chunks = o.requestChunks(dynMetrics)
+	require.Len(t, chunks, 2)
+	assert.Len(t, chunks[0], 3)
+
+	c.MaxLinesPerRequest = null.IntFrom(0)
+	c.MaxBytesPerRequest = null.IntFrom(0)
+	assert.Len(t, o.requestChunks(dynMetrics), 1)
+}
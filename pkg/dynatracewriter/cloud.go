@@ -0,0 +1,162 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+)
+
+const cloudMetadataTimeout = time.Second
+
+// cloudMetadataEndpoints are the base urls of the instance metadata services.
+type cloudMetadataEndpoints struct {
+	aws   string
+	gcp   string
+	azure string
+}
+
+var defaultCloudMetadataEndpoints = cloudMetadataEndpoints{
+	aws:   "http://169.254.169.254",
+	gcp:   "http://metadata.google.internal",
+	azure: "http://169.254.169.254",
+}
+
+// detectCloudMetadata asks the metadata service of each cloud for the
+// instance the load generator runs on, and returns the region, zone,
+// instance type and id as dimensions. It returns nil outside of a cloud.
+func detectCloudMetadata(client *http.Client, endpoints cloudMetadataEndpoints) map[string]string {
+	if dims, err := detectAWS(client, endpoints.aws); err == nil {
+		return dims
+	}
+	if dims, err := detectGCP(client, endpoints.gcp); err == nil {
+		return dims
+	}
+	if dims, err := detectAzure(client, endpoints.azure); err == nil {
+		return dims
+	}
+	return nil
+}
+
+func getMetadata(client *http.Client, method, url string, headers map[string]string) ([]byte, error) {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		request.Header.Set(k, v)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", url, response.Status)
+	}
+	return body, err
+}
+
+// detectAWS uses IMDSv2, which needs a session token.
+func detectAWS(client *http.Client, base string) (map[string]string, error) {
+	token, err := getMetadata(client, http.MethodPut, base+"/latest/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+	if err != nil {
+		return nil, err
+	}
+	body, err := getMetadata(client, http.MethodGet, base+"/latest/dynamic/instance-identity/document",
+		map[string]string{"X-aws-ec2-metadata-token": string(token)})
+	if err != nil {
+		return nil, err
+	}
+	var document struct {
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+		InstanceType     string `json:"instanceType"`
+		InstanceID       string `json:"instanceId"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+	return cloudDimensions("aws", document.Region, document.AvailabilityZone, document.InstanceType, document.InstanceID), nil
+}
+
+func detectGCP(client *http.Client, base string) (map[string]string, error) {
+	body, err := getMetadata(client, http.MethodGet, base+"/computeMetadata/v1/instance/?recursive=true",
+		map[string]string{"Metadata-Flavor": "Google"})
+	if err != nil {
+		return nil, err
+	}
+	var instance struct {
+		Zone        string      `json:"zone"`
+		MachineType string      `json:"machineType"`
+		ID          json.Number `json:"id"`
+	}
+	if err := json.Unmarshal(body, &instance); err != nil {
+		return nil, err
+	}
+	// zone and machineType are resource paths, e.g. projects/1/zones/europe-west1-b
+	zone := path.Base(instance.Zone)
+	region := zone
+	if len(zone) > 2 {
+		region = zone[:len(zone)-2]
+	}
+	return cloudDimensions("gcp", region, zone, path.Base(instance.MachineType), instance.ID.String()), nil
+}
+
+func detectAzure(client *http.Client, base string) (map[string]string, error) {
+	body, err := getMetadata(client, http.MethodGet, base+"/metadata/instance/compute?api-version=2021-02-01",
+		map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil, err
+	}
+	var compute struct {
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+		VMSize   string `json:"vmSize"`
+		VMID     string `json:"vmId"`
+	}
+	if err := json.Unmarshal(body, &compute); err != nil {
+		return nil, err
+	}
+	return cloudDimensions("azure", compute.Location, compute.Zone, compute.VMSize, compute.VMID), nil
+}
+
+func cloudDimensions(provider, region, zone, instanceType, instanceID string) map[string]string {
+	dims := map[string]string{"cloud.provider": provider}
+	for k, v := range map[string]string{
+		"cloud.region":            region,
+		"cloud.availability_zone": zone,
+		"host.type":               instanceType,
+		"host.id":                 instanceID,
+	} {
+		if v != "" {
+			dims[k] = v
+		}
+	}
+	return dims
+}
+
+// addCloudDimensions attaches the cloud instance metadata to the exported
+// metrics, configured dimensions win.
+func (o *Output) addCloudDimensions(endpoints cloudMetadataEndpoints) {
+	if !o.config.CloudMetadata.Bool {
+		return
+	}
+	dims := detectCloudMetadata(&http.Client{Timeout: cloudMetadataTimeout}, endpoints)
+	if dims == nil {
+		o.logger.Debug("Dynatrace: no cloud instance metadata service answered")
+		return
+	}
+	if o.config.Dimensions == nil {
+		o.config.Dimensions = make(map[string]string)
+	}
+	for k, v := range dims {
+		if _, ok := o.config.Dimensions[k]; !ok {
+			o.config.Dimensions[k] = v
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestDetectCloudMetadata(t *testing.T) {
+	t.Parallel()
+
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodPut && req.URL.Path == "/latest/api/token":
+			fmt.Fprint(w, "session")
+		case req.URL.Path == "/latest/dynamic/instance-identity/document" && req.Header.Get("X-aws-ec2-metadata-token") == "session":
+			fmt.Fprint(w, `{"region":"eu-west-1","availabilityZone":"eu-west-1a","instanceType":"c5.xlarge","instanceId":"i-0123"}`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer aws.Close()
+
+	gcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"zone":"projects/42/zones/europe-west1-b","machineType":"projects/42/machineTypes/e2-standard-4","id":1234567890123456789}`)
+	}))
+	defer gcp.Close()
+
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"location":"westeurope","zone":"1","vmSize":"Standard_D4s_v3","vmId":"vm-1"}`)
+	}))
+	defer azure.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	client := &http.Client{Timeout: cloudMetadataTimeout}
+	assert.Equal(t, map[string]string{
+		"cloud.provider":          "aws",
+		"cloud.region":            "eu-west-1",
+		"cloud.availability_zone": "eu-west-1a",
+		"host.type":               "c5.xlarge",
+		"host.id":                 "i-0123",
+	}, detectCloudMetadata(client, cloudMetadataEndpoints{aws: aws.URL, gcp: gcp.URL, azure: azure.URL}))
+
+	assert.Equal(t, map[string]string{
+		"cloud.provider":          "gcp",
+		"cloud.region":            "europe-west1",
+		"cloud.availability_zone": "europe-west1-b",
+		"host.type":               "e2-standard-4",
+		"host.id":                 "1234567890123456789",
+	}, detectCloudMetadata(client, cloudMetadataEndpoints{aws: closed.URL, gcp: gcp.URL, azure: azure.URL}))
+
+	assert.Equal(t, map[string]string{
+		"cloud.provider":          "azure",
+		"cloud.region":            "westeurope",
+		"cloud.availability_zone": "1",
+		"host.type":               "Standard_D4s_v3",
+		"host.id":                 "vm-1",
+	}, detectCloudMetadata(client, cloudMetadataEndpoints{aws: azure.URL, gcp: closed.URL, azure: azure.URL}))
+
+	assert.Nil(t, detectCloudMetadata(client, cloudMetadataEndpoints{aws: closed.URL, gcp: closed.URL, azure: closed.URL}))
+
+	o := newTestOutput(t, aws.URL, func(c *Config) {
+		c.CloudMetadata = null.BoolFrom(true)
+		c.Dimensions = map[string]string{"cloud.region": "explicit"}
+	})
+	o.addCloudDimensions(cloudMetadataEndpoints{aws: aws.URL, gcp: closed.URL, azure: closed.URL})
+	assert.Equal(t, "explicit", o.config.Dimensions["cloud.region"])
+	assert.Equal(t, "i-0123", o.config.Dimensions["host.id"])
+}
@@ -0,0 +1,66 @@
+package dynatracewriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+// newCompressor returns a writer compressing into w with the encoding,
+// the Content-Encoding of the body.
+func newCompressor(w io.Writer, encoding string) (io.WriteCloser, error) {
+	if encoding == compressionZstd {
+		return zstd.NewWriter(w)
+	}
+	return gzip.NewWriter(w), nil
+}
+
+// compressBody returns the body compressed with the encoding, the body
+// itself for compressionNone or no encoding.
+func compressBody(body []byte, encoding string) ([]byte, error) {
+	if encoding == "" || encoding == compressionNone {
+		return body, nil
+	}
+	var buf bytes.Buffer
+	w, err := newCompressor(&buf, encoding)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// streamCompression is the encoding of the streamed bodies, they are
+// always compressed.
+func (o *Output) streamCompression() string {
+	if o.compression == compressionNone {
+		return compressionGzip
+	}
+	return o.compression
+}
+
+// fallbackCompression switches the requests to gzip for the rest of the
+// run when the endpoint doesn't support the zstd body it was sent. It
+// reports whether the request must be sent again.
+func (o *Output) fallbackCompression(response *http.Response, encoding string) bool {
+	if response == nil || response.StatusCode != http.StatusUnsupportedMediaType || encoding != compressionZstd {
+		return false
+	}
+	o.logger.Warn("Dynatrace: the endpoint doesn't accept zstd compressed bodies, compressing them with gzip")
+	o.compression = compressionGzip
+	return true
+}
@@ -0,0 +1,93 @@
+package dynatracewriter
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+// decodeBody returns the uncompressed body of the request.
+func decodeBody(t *testing.T, r *http.Request) string {
+	var reader io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case compressionGzip:
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		reader = gz
+	case compressionZstd:
+		zr, err := zstd.NewReader(r.Body)
+		require.NoError(t, err)
+		defer zr.Close()
+		reader = zr
+	}
+	body, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	for _, compression := range []string{compressionNone, compressionGzip, compressionZstd} {
+		compression := compression
+		t.Run(compression, func(t *testing.T) {
+			t.Parallel()
+
+			var encoding, body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encoding = r.Header.Get("Content-Encoding")
+				body = decodeBody(t, r)
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer server.Close()
+
+			o := newTestOutput(t, server.URL, func(c *Config) {
+				c.Compression = null.StringFrom(compression)
+			})
+			o.sendMetrics([]dynatraceMetric{{metricKeyName: "k6.vus", metricValue: 1, metricType: metrics.Gauge}})
+			assert.Contains(t, body, "k6.vus")
+			if compression == compressionNone {
+				assert.Empty(t, encoding)
+			} else {
+				assert.Equal(t, compression, encoding)
+			}
+			assert.Equal(t, 1, o.totals.linesSent)
+		})
+	}
+}
+
+func TestZstdFallback(t *testing.T) {
+	t.Parallel()
+
+	var encodings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.Header.Get("Content-Encoding")
+		encodings = append(encodings, encoding)
+		if encoding == compressionZstd {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		assert.Contains(t, decodeBody(t, r), "k6.vus")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.Compression = null.StringFrom(compressionZstd)
+	})
+	line := []dynatraceMetric{{metricKeyName: "k6.vus", metricValue: 1, metricType: metrics.Gauge}}
+	o.sendMetrics(line)
+	o.sendMetrics(line)
+	assert.Equal(t, []string{compressionZstd, compressionGzip, compressionGzip}, encodings)
+	assert.Zero(t, o.totals.retries)
+	assert.Equal(t, 2, o.totals.linesSent)
+}
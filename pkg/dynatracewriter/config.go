@@ -1,13 +1,18 @@
 package dynatracewriter
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"net/url"
+	"os"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
     "fmt"
-	"github.com/kubernetes/helm/pkg/strvals"
+	"k8s.io/helm/pkg/strvals"
 	"go.k6.io/k6/lib/types"
     "gopkg.in/guregu/null.v3"
 )
@@ -17,6 +22,20 @@ const (
 	defaultFlushPeriod       = time.Second
 	defaultMetricPrefix      = "k6."
 	defaultDynatraceMetricEndPoint ="/api/v2/metrics/ingest"
+	defaultDynatraceUrl = "https://dynatrace.live.com"
+
+	// the local ingest mode sends the metrics to the listener of the
+	// OneAgent / Extension Execution Controller of the host, which needs
+	// no token
+	ingestModeAPI                       = "api"
+	ingestModeLocal                     = "local"
+	defaultDynatraceLocalUrl            = "http://localhost:14499"
+	defaultDynatraceLocalMetricEndPoint = "/metrics/ingest"
+
+	// a unix:///path/to/proxy.sock url sends the requests over the socket
+	// to a local proxy, with this url
+	unixSocketScheme = "unix://"
+	unixSocketUrl    = "http://localhost"
 )
 
 type Config struct {
@@ -26,22 +45,315 @@ type Config struct {
 	CACert                null.String `json:"caCertFile" envconfig:"K6_CA_CERT_FILE"`
 	ApiToken     null.String `json:"apitoken" envconfig:"K6_DYNATRACE_APITOKEN"`
 	FlushPeriod types.NullDuration `json:"flushPeriod" envconfig:"K6_DYNATRACE_FLUSH_PERIOD"`
+	Timeout     types.NullDuration `json:"timeout" envconfig:"K6_DYNATRACE_TIMEOUT"`
 	KeepTags    null.Bool `json:"keepTags" envconfig:"K6_KEEP_TAGS"`
 	KeepNameTag null.Bool `json:"keepNameTag" envconfig:"K6_KEEP_NAME_TAG"`
 	KeepUrlTag  null.Bool `json:"keepUrlTag" envconfig:"K6_KEEP_URL_TAG"`
+	KeepVuTag   null.Bool `json:"keepVuTag" envconfig:"K6_KEEP_VU_TAG"`
+	KeepIterTag null.Bool `json:"keepIterTag" envconfig:"K6_KEEP_ITER_TAG"`
+	// KeepScenarioTag exports the scenario tag whatever KeepTags and the
+	// tag filters say
+	KeepScenarioTag null.Bool `json:"keepScenarioTag" envconfig:"K6_KEEP_SCENARIO_TAG"`
+
+	TagsAsDimensions []string `json:"tagsAsDimensions" envconfig:"K6_DYNATRACE_TAGS_AS_DIMENSIONS"`
+	ExcludeTags      []string `json:"excludeTags" envconfig:"K6_DYNATRACE_EXCLUDE_TAGS"`
+
+	Dimensions map[string]string `json:"dimensions" envconfig:"K6_DYNATRACE_DIMENSIONS"`
+	TestRunID  null.String       `json:"testRunId" envconfig:"K6_DYNATRACE_TEST_RUN_ID"`
+
+	UrlGroups        []UrlGroup `json:"urlGroups" envconfig:"K6_DYNATRACE_URL_GROUPS"`
+	UseNameTagForUrl null.Bool  `json:"useNameTagForUrl" envconfig:"K6_DYNATRACE_USE_NAME_TAG_FOR_URL"`
+
+	MaxSeries         null.Int    `json:"maxSeries" envconfig:"K6_DYNATRACE_MAX_SERIES"`
+	CardinalityPolicy null.String `json:"cardinalityPolicy" envconfig:"K6_DYNATRACE_CARDINALITY_POLICY"`
+
+	HashDimensions []string `json:"hashDimensions" envconfig:"K6_DYNATRACE_HASH_DIMENSIONS"`
+	HashLength     null.Int `json:"hashLength" envconfig:"K6_DYNATRACE_HASH_LENGTH"`
+
+	RelabelConfigs []RelabelConfig `json:"relabelConfigs" envconfig:"K6_DYNATRACE_RELABEL_CONFIGS"`
+
+	MetricsInclude []string    `json:"metricsInclude" envconfig:"K6_DYNATRACE_METRICS_INCLUDE"`
+	MetricsExclude []string    `json:"metricsExclude" envconfig:"K6_DYNATRACE_METRICS_EXCLUDE"`
+	BuiltinMetrics null.String `json:"builtinMetrics" envconfig:"K6_DYNATRACE_BUILTIN_METRICS"`
+
+	MetricPrefix  null.String       `json:"metricPrefix" envconfig:"K6_DYNATRACE_METRIC_PREFIX"`
+	MetricRenames map[string]string `json:"metricRenames" envconfig:"K6_DYNATRACE_METRIC_RENAMES"`
+	TransformFile null.String       `json:"transformFile" envconfig:"K6_DYNATRACE_TRANSFORM_FILE"`
+	DurationUnit  null.String       `json:"durationUnit" envconfig:"K6_DYNATRACE_DURATION_UNIT"`
+
+	TimestampPolicy null.String `json:"timestampPolicy" envconfig:"K6_DYNATRACE_TIMESTAMP_POLICY"`
+	OmitTimestamps  null.Bool   `json:"omitTimestamps" envconfig:"K6_DYNATRACE_OMIT_TIMESTAMPS"`
+
+	DropZeroValues null.Bool `json:"dropZeroValues" envconfig:"K6_DYNATRACE_DROP_ZERO_VALUES"`
+
+	ExportThresholds   null.Bool   `json:"exportThresholds" envconfig:"K6_DYNATRACE_EXPORT_THRESHOLDS"`
+	ThresholdEvents    null.Bool   `json:"thresholdEvents" envconfig:"K6_DYNATRACE_THRESHOLD_EVENTS"`
+	ThresholdEventType null.String `json:"thresholdEventType" envconfig:"K6_DYNATRACE_THRESHOLD_EVENT_TYPE"`
+
+	LifecycleEvents      null.Bool   `json:"lifecycleEvents" envconfig:"K6_DYNATRACE_LIFECYCLE_EVENTS"`
+	EventsEntitySelector null.String `json:"eventsEntitySelector" envconfig:"K6_DYNATRACE_EVENTS_ENTITY_SELECTOR"`
+
+	DeploymentEvent      null.Bool   `json:"deploymentEvent" envconfig:"K6_DYNATRACE_DEPLOYMENT_EVENT"`
+	DeploymentVersion    null.String `json:"deploymentVersion" envconfig:"K6_DYNATRACE_DEPLOYMENT_VERSION"`
+	DeploymentCiBackLink null.String `json:"deploymentCiBackLink" envconfig:"K6_DYNATRACE_DEPLOYMENT_CI_BACK_LINK"`
+	DeploymentCommit     null.String `json:"deploymentCommit" envconfig:"K6_DYNATRACE_DEPLOYMENT_COMMIT"`
+
+	MaintenanceWindow         null.Bool          `json:"maintenanceWindow" envconfig:"K6_DYNATRACE_MAINTENANCE_WINDOW"`
+	MaintenanceWindowEntities []string           `json:"maintenanceWindowEntities" envconfig:"K6_DYNATRACE_MAINTENANCE_WINDOW_ENTITIES"`
+	MaintenanceWindowTags     []string           `json:"maintenanceWindowTags" envconfig:"K6_DYNATRACE_MAINTENANCE_WINDOW_TAGS"`
+	MaintenanceWindowDuration types.NullDuration `json:"maintenanceWindowDuration" envconfig:"K6_DYNATRACE_MAINTENANCE_WINDOW_DURATION"`
+
+	Summary null.Bool `json:"summary" envconfig:"K6_DYNATRACE_SUMMARY"`
+	Logs    null.Bool `json:"logs" envconfig:"K6_DYNATRACE_LOGS"`
+
+	FailureLogs null.Bool `json:"failureLogs" envconfig:"K6_DYNATRACE_FAILURE_LOGS"`
+
+	Bucket          null.String `json:"bucket" envconfig:"K6_DYNATRACE_BUCKET"`
+	SecurityContext null.String `json:"securityContext" envconfig:"K6_DYNATRACE_SECURITY_CONTEXT"`
+
+	ExportFormat null.String `json:"exportFormat" envconfig:"K6_DYNATRACE_EXPORT_FORMAT"`
+
+	Traces null.Bool `json:"traces" envconfig:"K6_DYNATRACE_TRACES"`
+
+	TraceIDs null.Bool `json:"traceIds" envconfig:"K6_DYNATRACE_TRACE_IDS"`
+
+	BizEvents          null.Bool   `json:"bizEvents" envconfig:"K6_DYNATRACE_BIZEVENTS"`
+	BizEventsTagPrefix null.String `json:"bizEventsTagPrefix" envconfig:"K6_DYNATRACE_BIZEVENTS_TAG_PREFIX"`
+
+	Slos         null.Bool   `json:"slos" envconfig:"K6_DYNATRACE_SLOS"`
+	SloTarget    null.Float  `json:"sloTarget" envconfig:"K6_DYNATRACE_SLO_TARGET"`
+	SloWarning   null.Float  `json:"sloWarning" envconfig:"K6_DYNATRACE_SLO_WARNING"`
+	SloTimeframe null.String `json:"sloTimeframe" envconfig:"K6_DYNATRACE_SLO_TIMEFRAME"`
+
+	MetricEvents          []string  `json:"metricEvents" envconfig:"K6_DYNATRACE_METRIC_EVENTS"`
+	ThresholdMetricEvents null.Bool `json:"thresholdMetricEvents" envconfig:"K6_DYNATRACE_THRESHOLD_METRIC_EVENTS"`
+
+	CreateDashboard null.Bool `json:"createDashboard" envconfig:"K6_DYNATRACE_CREATE_DASHBOARD"`
+
+	IngestMode null.String `json:"ingestMode" envconfig:"K6_DYNATRACE_INGEST_MODE"`
+
+	UseDynatraceEnv null.Bool `json:"useDynatraceEnv" envconfig:"K6_DYNATRACE_USE_DT_ENV"`
+
+	K8sMetadata null.Bool `json:"k8sMetadata" envconfig:"K6_DYNATRACE_K8S_METADATA"`
+
+	CloudMetadata null.Bool `json:"cloudMetadata" envconfig:"K6_DYNATRACE_CLOUD_METADATA"`
+
+	HostMetadata null.Bool `json:"hostMetadata" envconfig:"K6_DYNATRACE_HOST_METADATA"`
+
+	Distributed        null.Bool   `json:"distributed" envconfig:"K6_DYNATRACE_DISTRIBUTED"`
+	InstanceID         null.String `json:"instanceId" envconfig:"K6_DYNATRACE_INSTANCE_ID"`
+	InstanceAggregates null.Bool   `json:"instanceAggregates" envconfig:"K6_DYNATRACE_INSTANCE_AGGREGATES"`
+
+	GroupLevels null.Int `json:"groupLevels" envconfig:"K6_DYNATRACE_GROUP_LEVELS"`
+
+	CheckMetrics null.Bool `json:"checkMetrics" envconfig:"K6_DYNATRACE_CHECK_METRICS"`
+
+	ErrorDimensions null.Bool `json:"errorDimensions" envconfig:"K6_DYNATRACE_ERROR_DIMENSIONS"`
+	StatusClasses   null.Bool `json:"statusClasses" envconfig:"K6_DYNATRACE_STATUS_CLASSES"`
+
+	BrowserMetrics null.Bool `json:"browserMetrics" envconfig:"K6_DYNATRACE_BROWSER_METRICS"`
+
+	ProtocolDimensions null.Bool `json:"protocolDimensions" envconfig:"K6_DYNATRACE_PROTOCOL_DIMENSIONS"`
+
+	ValidateOnly null.Bool `json:"validateOnly" envconfig:"K6_DYNATRACE_VALIDATE_ONLY"`
+
+	ConfigFile null.String `json:"configFile" envconfig:"K6_DYNATRACE_CONFIG"`
+	Profile    null.String `json:"profile" envconfig:"K6_DYNATRACE_PROFILE"`
+
+	TLSMinVersion   null.String `json:"tlsMinVersion" envconfig:"K6_DYNATRACE_TLS_MIN_VERSION"`
+	TLSCipherSuites []string    `json:"tlsCipherSuites" envconfig:"K6_DYNATRACE_TLS_CIPHER_SUITES"`
+
+	ServerName null.String `json:"serverName" envconfig:"K6_DYNATRACE_SERVER_NAME"`
+	ConnectTo  null.String `json:"connectTo" envconfig:"K6_DYNATRACE_CONNECT_TO"`
+
+	HostAliases map[string]string `json:"hostAliases" envconfig:"K6_DYNATRACE_HOST_ALIASES"`
+	DNSServer   null.String       `json:"dnsServer" envconfig:"K6_DYNATRACE_DNS_SERVER"`
+
+	NetworkFamily null.String `json:"networkFamily" envconfig:"K6_DYNATRACE_NETWORK_FAMILY"`
+
+	// socketPath is the unix domain socket of a unix:// url, set by
+	// ConstructConfig
+	socketPath string
+
+	DebugTransport null.Bool `json:"debugTransport" envconfig:"K6_DYNATRACE_DEBUG_TRANSPORT"`
+
+	PayloadDumpBytes null.Int `json:"payloadDumpBytes" envconfig:"K6_DYNATRACE_PAYLOAD_DUMP_BYTES"`
+	PayloadDumpLines null.Int `json:"payloadDumpLines" envconfig:"K6_DYNATRACE_PAYLOAD_DUMP_LINES"`
+
+	SelfMonitoring null.Bool `json:"selfMonitoring" envconfig:"K6_DYNATRACE_SELF_MONITORING"`
+
+	Heartbeat null.Bool `json:"heartbeat" envconfig:"K6_DYNATRACE_HEARTBEAT"`
+
+	LogLevel null.String `json:"logLevel" envconfig:"K6_DYNATRACE_LOG_LEVEL"`
+	Quiet    null.Bool   `json:"quiet" envconfig:"K6_DYNATRACE_QUIET"`
+
+	LogFormat null.String `json:"logFormat" envconfig:"K6_DYNATRACE_LOG_FORMAT"`
+
+	StatsAddress null.String `json:"statsAddress" envconfig:"K6_DYNATRACE_STATS_ADDRESS"`
+
+	FailTestOnExportError       null.Bool  `json:"failTestOnExportError" envconfig:"K6_DYNATRACE_FAIL_TEST_ON_EXPORT_ERROR"`
+	FailTestErrorRate           null.Float `json:"failTestErrorRate" envconfig:"K6_DYNATRACE_FAIL_TEST_ERROR_RATE"`
+	FailTestConsecutiveFailures null.Int   `json:"failTestConsecutiveFailures" envconfig:"K6_DYNATRACE_FAIL_TEST_CONSECUTIVE_FAILURES"`
+
+	StreamPayload null.Bool `json:"streamPayload" envconfig:"K6_DYNATRACE_STREAM_PAYLOAD"`
+
+	MaxMemoryBytes null.Int `json:"maxMemoryBytes" envconfig:"K6_DYNATRACE_MAX_MEMORY_BYTES"`
+
+	ValidateLines null.Bool `json:"validateLines" envconfig:"K6_DYNATRACE_VALIDATE_LINES"`
+
+	MaxRetries         null.Int `json:"maxRetries" envconfig:"K6_DYNATRACE_MAX_RETRIES"`
+	RetryOnStatusCodes []int    `json:"retryOnStatusCodes" envconfig:"K6_DYNATRACE_RETRY_ON_STATUS_CODES"`
+
+	MaxRetryElapsedTime  types.NullDuration `json:"maxRetryElapsedTime" envconfig:"K6_DYNATRACE_MAX_RETRY_ELAPSED_TIME"`
+	RetryExhaustedPolicy null.String        `json:"retryExhaustedPolicy" envconfig:"K6_DYNATRACE_RETRY_EXHAUSTED_POLICY"`
+	SpoolDir             null.String        `json:"spoolDir" envconfig:"K6_DYNATRACE_SPOOL_DIR"`
+
+	MaxLinesPerRequest null.Int `json:"maxLinesPerRequest" envconfig:"K6_DYNATRACE_MAX_LINES_PER_REQUEST"`
+	MaxBytesPerRequest null.Int `json:"maxBytesPerRequest" envconfig:"K6_DYNATRACE_MAX_BYTES_PER_REQUEST"`
+
+	Compression null.String `json:"compression" envconfig:"K6_DYNATRACE_COMPRESSION"`
+
+	ForceHTTP1 null.Bool `json:"forceHTTP1" envconfig:"K6_DYNATRACE_FORCE_HTTP1"`
+
+	MaxSamplesPerFlush null.Int    `json:"maxSamplesPerFlush" envconfig:"K6_DYNATRACE_MAX_SAMPLES_PER_FLUSH"`
+	SampleDropPolicy   null.String `json:"sampleDropPolicy" envconfig:"K6_DYNATRACE_SAMPLE_DROP_POLICY"`
+	MetricPriority     []string    `json:"metricPriority" envconfig:"K6_DYNATRACE_METRIC_PRIORITY"`
+
+	CriticalMetrics   []string `json:"criticalMetrics" envconfig:"K6_DYNATRACE_CRITICAL_METRICS"`
+	BestEffortMetrics []string `json:"bestEffortMetrics" envconfig:"K6_DYNATRACE_BEST_EFFORT_METRICS"`
+
+	OmitAggregateTimestamps null.Bool `json:"omitAggregateTimestamps" envconfig:"K6_DYNATRACE_OMIT_AGGREGATE_TIMESTAMPS"`
+
+	MetricsSource null.String `json:"metricsSource" envconfig:"K6_DYNATRACE_METRICS_SOURCE"`
+
+	Environment null.String `json:"environment" envconfig:"K6_DYNATRACE_ENVIRONMENT"`
+	Stage       null.String `json:"stage" envconfig:"K6_DYNATRACE_STAGE"`
+
+	GroupRollups null.Bool `json:"groupRollups" envconfig:"K6_DYNATRACE_GROUP_ROLLUPS"`
+
+	SubmetricDimensions null.Bool `json:"submetricDimensions" envconfig:"K6_DYNATRACE_SUBMETRIC_DIMENSIONS"`
+	SubmetricNames      null.Bool `json:"submetricNames" envconfig:"K6_DYNATRACE_SUBMETRIC_NAMES"`
+
+	CumulativeCounters null.Bool `json:"cumulativeCounters" envconfig:"K6_DYNATRACE_CUMULATIVE_COUNTERS"`
+
+	Apdex []string `json:"apdex" envconfig:"K6_DYNATRACE_APDEX"`
+
+	BurnRateTarget null.Float `json:"burnRateTarget" envconfig:"K6_DYNATRACE_BURN_RATE_TARGET"`
+
+	RollingPercentiles []string `json:"rollingPercentiles" envconfig:"K6_DYNATRACE_ROLLING_PERCENTILES"`
+}
+
+// UrlGroup rewrites url dimension values matching Pattern into Replacement,
+// e.g. "/users/[0-9]+" into "/users/{id}". Replacement may use regexp
+// submatch references such as ${1}.
+type UrlGroup struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
 }
 
 func NewConfig() Config {
 	return Config{
-		Url:                   "https://dynatrace.live.com",
-		InsecureSkipTLSVerify: null.BoolFrom(true),
+		Url:                   defaultDynatraceUrl,
+		InsecureSkipTLSVerify: null.BoolFrom(false),
 		CACert:                null.NewString("", false),
         ApiToken:              null.NewString("", false),
 		FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
+		Timeout:               types.NullDurationFrom(defaultDynatraceTimeout),
 		KeepTags:              null.BoolFrom(true),
 		KeepNameTag:           null.BoolFrom(false),
 		KeepUrlTag:            null.BoolFrom(true),
+		KeepVuTag:             null.BoolFrom(false),
+		KeepIterTag:           null.BoolFrom(false),
+		KeepScenarioTag:       null.BoolFrom(true),
 		Headers:               make(map[string]string),
+		Dimensions:            make(map[string]string),
+		TestRunID:             null.NewString("", false),
+		UseNameTagForUrl:      null.BoolFrom(true),
+		MaxSeries:             null.NewInt(0, false),
+		CardinalityPolicy:     null.StringFrom(cardinalityPolicyOther),
+		HashLength:            null.IntFrom(defaultHashLength),
+		BuiltinMetrics:        null.StringFrom(builtinMetricsAll),
+		MetricPrefix:          null.StringFrom(defaultMetricPrefix),
+		MetricRenames:         make(map[string]string),
+		HostAliases:           make(map[string]string),
+		TransformFile:         null.NewString("", false),
+		DurationUnit:          null.StringFrom("ms"),
+		TimestampPolicy:       null.StringFrom(timestampPolicyClamp),
+		OmitTimestamps:        null.BoolFrom(false),
+		DropZeroValues:        null.BoolFrom(false),
+		ExportThresholds:      null.BoolFrom(true),
+		ThresholdEvents:       null.BoolFrom(false),
+		ThresholdEventType:    null.StringFrom(eventTypeErrorEvent),
+		LifecycleEvents:       null.BoolFrom(false),
+		EventsEntitySelector:  null.NewString("", false),
+		DeploymentEvent:       null.BoolFrom(false),
+		DeploymentVersion:     null.NewString("", false),
+		DeploymentCiBackLink:  null.NewString("", false),
+		DeploymentCommit:      null.NewString("", false),
+		MaintenanceWindow:     null.BoolFrom(false),
+		Summary:               null.BoolFrom(false),
+		Logs:                  null.BoolFrom(false),
+		FailureLogs:           null.BoolFrom(false),
+		Bucket:                null.NewString("", false),
+		SecurityContext:       null.NewString("", false),
+		ExportFormat:          null.StringFrom(exportFormatMint),
+		Traces:                null.BoolFrom(false),
+		TraceIDs:              null.BoolFrom(false),
+		BizEvents:             null.BoolFrom(false),
+		BizEventsTagPrefix:    null.StringFrom(defaultBizEventsPrefix),
+		Slos:                  null.BoolFrom(false),
+		SloTarget:             null.FloatFrom(defaultSloTarget),
+		SloWarning:            null.FloatFrom(defaultSloWarning),
+		SloTimeframe:          null.StringFrom(defaultSloTimeframe),
+		ThresholdMetricEvents: null.BoolFrom(false),
+		CreateDashboard:       null.BoolFrom(false),
+		IngestMode:            null.NewString("", false),
+		UseDynatraceEnv:       null.BoolFrom(true),
+		K8sMetadata:           null.BoolFrom(true),
+		CloudMetadata:         null.BoolFrom(false),
+		HostMetadata:          null.BoolFrom(true),
+		Distributed:           null.NewBool(false, false),
+		InstanceID:            null.NewString("", false),
+		InstanceAggregates:    null.BoolFrom(false),
+		GroupLevels:           null.IntFrom(0),
+		CheckMetrics:          null.BoolFrom(false),
+		ErrorDimensions:       null.BoolFrom(true),
+		StatusClasses:         null.BoolFrom(false),
+		BrowserMetrics:        null.BoolFrom(true),
+		ProtocolDimensions:    null.BoolFrom(true),
+		NetworkFamily:         null.StringFrom(networkFamilyAuto),
+		DebugTransport:        null.BoolFrom(false),
+		PayloadDumpBytes:      null.IntFrom(defaultPayloadDumpBytes),
+		PayloadDumpLines:      null.IntFrom(0),
+		SelfMonitoring:        null.BoolFrom(false),
+		Heartbeat:             null.BoolFrom(true),
+		Quiet:                 null.BoolFrom(false),
+		FailTestOnExportError: null.BoolFrom(false),
+		FailTestErrorRate:     null.FloatFrom(defaultFailTestErrorRate),
+		StreamPayload:         null.BoolFrom(false),
+		MaxMemoryBytes:        null.IntFrom(0),
+		ValidateLines:         null.BoolFrom(false),
+		MaxRetries:            null.IntFrom(defaultMaxRetries),
+		RetryOnStatusCodes:    append([]int(nil), defaultRetryOnStatusCodes...),
+		MaxRetryElapsedTime:   types.NullDurationFrom(defaultMaxRetryElapsedTime),
+		RetryExhaustedPolicy:  null.StringFrom(retryExhaustedDrop),
+		SpoolDir:              null.StringFrom(defaultSpoolDir()),
+		MaxLinesPerRequest:    null.IntFrom(defaultMaxLinesPerRequest),
+		MaxBytesPerRequest:    null.IntFrom(0),
+		Compression:           null.StringFrom(compressionNone),
+		ForceHTTP1:            null.BoolFrom(false),
+		MaxSamplesPerFlush:    null.IntFrom(defaultMaxSamplesPerFlush),
+		SampleDropPolicy:      null.StringFrom(sampleDropNewest),
+		CriticalMetrics:       append([]string(nil), defaultCriticalMetrics...),
+		MetricsSource:         null.StringFrom(defaultMetricsSource),
+		GroupRollups:          null.BoolFrom(false),
+		SubmetricDimensions:   null.BoolFrom(true),
+		SubmetricNames:        null.BoolFrom(false),
+		CumulativeCounters:    null.BoolFrom(false),
+
+		MaintenanceWindowDuration:   types.NullDurationFrom(defaultMaintenanceWindowDuration),
+		FailTestConsecutiveFailures: null.IntFrom(defaultFailTestConsecutiveFailures),
+		OmitAggregateTimestamps:   null.BoolFrom(false),
 	}
 }
 
@@ -49,19 +361,48 @@ func (conf Config) ConstructConfig() (*Config, error) {
 	// TODO: consider if the auth logic should be enforced here
 	// (e.g. if insecureSkipTLSVerify is switched off, then check for non-empty certificate file and auth, etc.)
 
-	u, err := url.Parse(conf.Url+defaultDynatraceMetricEndPoint)
+	endpoint := defaultDynatraceMetricEndPoint
+	switch conf.IngestMode.String {
+	case ingestModeAPI, "":
+		if len(conf.ApiToken.String) == 0 {
+			return nil, fmt.Errorf("The Dynatrace API token can not been empty or Null")
+		}
+	case ingestModeLocal:
+		if conf.Url == defaultDynatraceUrl {
+			conf.Url = defaultDynatraceLocalUrl
+		}
+		endpoint = defaultDynatraceLocalMetricEndPoint
+	default:
+		return nil, fmt.Errorf("invalid ingestMode %q, expected %s or %s", conf.IngestMode.String, ingestModeAPI, ingestModeLocal)
+	}
+
+	if strings.HasPrefix(conf.Url, unixSocketScheme) {
+		conf.socketPath = strings.TrimPrefix(conf.Url, unixSocketScheme)
+		conf.Url = unixSocketUrl
+	}
+
+	u, err := url.Parse(conf.Url+endpoint)
 	if err != nil {
 		return nil, err
 	}
-    if len(conf.ApiToken.String) == 0 {
-       return nil, fmt.Errorf("The Dynatrace API token can not been empty or Null")
-    } else {
-        conf.Headers["Content-Type"] = "text/plain; charset=utf-8"
+    conf.Headers["Content-Type"] = "text/plain; charset=utf-8"
+    if len(conf.ApiToken.String) > 0 {
         conf.Headers["Authorization"] ="Api-Token " + conf.ApiToken.String
-        conf.Headers["accept"] = "*/*"
+    }
+    conf.Headers["accept"] = "*/*"
+    if !hasHeader(conf.Headers, "User-Agent") {
+        conf.Headers["User-Agent"] = userAgent()
     }
      conf.Url= u.String()
 
+	if len(conf.TestRunID.String) == 0 {
+		id, err := newTestRunID()
+		if err != nil {
+			return nil, err
+		}
+		conf.TestRunID = null.StringFrom(id)
+	}
+
 	return &conf, nil
 }
 
@@ -92,6 +433,10 @@ func (base Config) Apply(applied Config) Config {
 		base.FlushPeriod = applied.FlushPeriod
 	}
 
+	if applied.Timeout.Valid {
+		base.Timeout = applied.Timeout
+	}
+
 	if applied.KeepTags.Valid {
 		base.KeepTags = applied.KeepTags
 	}
@@ -104,171 +449,2082 @@ func (base Config) Apply(applied Config) Config {
 		base.KeepUrlTag = applied.KeepUrlTag
 	}
 
+	if applied.KeepVuTag.Valid {
+		base.KeepVuTag = applied.KeepVuTag
+	}
+
+	if applied.KeepIterTag.Valid {
+		base.KeepIterTag = applied.KeepIterTag
+	}
+
+	if applied.KeepScenarioTag.Valid {
+		base.KeepScenarioTag = applied.KeepScenarioTag
+	}
+
 	if len(applied.Headers) > 0 {
 		for k, v := range applied.Headers {
 			base.Headers[k] = v
 		}
 	}
 
-	return base
-}
+	if len(applied.TagsAsDimensions) > 0 {
+		base.TagsAsDimensions = applied.TagsAsDimensions
+	}
 
-// ParseArg takes an arg string and converts it to a config
-func ParseArg(arg string) (Config, error) {
-	var c Config
-	params, err := strvals.Parse(arg)
-	if err != nil {
-		return c, err
+	if len(applied.ExcludeTags) > 0 {
+		base.ExcludeTags = applied.ExcludeTags
 	}
 
-	if v, ok := params["url"].(string); ok {
-		c.Url = v
+	if applied.TestRunID.Valid {
+		base.TestRunID = applied.TestRunID
 	}
 
-	if v, ok := params["insecureSkipTLSVerify"].(bool); ok {
-		c.InsecureSkipTLSVerify = null.BoolFrom(v)
+	if len(applied.UrlGroups) > 0 {
+		base.UrlGroups = applied.UrlGroups
 	}
 
-	if v, ok := params["caCertFile"].(string); ok {
-		c.CACert = null.StringFrom(v)
+	if applied.UseNameTagForUrl.Valid {
+		base.UseNameTagForUrl = applied.UseNameTagForUrl
 	}
 
-	if v, ok := params["apitoken"].(string); ok {
-		c.ApiToken = null.StringFrom(v)
+	if applied.MaxSeries.Valid {
+		base.MaxSeries = applied.MaxSeries
 	}
 
+	if applied.CardinalityPolicy.Valid {
+		base.CardinalityPolicy = applied.CardinalityPolicy
+	}
 
-	if v, ok := params["flushPeriod"].(string); ok {
-		if err := c.FlushPeriod.UnmarshalText([]byte(v)); err != nil {
-			return c, err
-		}
+	if len(applied.HashDimensions) > 0 {
+		base.HashDimensions = applied.HashDimensions
 	}
 
-	if v, ok := params["keepTags"].(bool); ok {
-		c.KeepTags = null.BoolFrom(v)
+	if applied.HashLength.Valid {
+		base.HashLength = applied.HashLength
 	}
 
-	if v, ok := params["keepNameTag"].(bool); ok {
-		c.KeepNameTag = null.BoolFrom(v)
+	if len(applied.MetricsInclude) > 0 {
+		base.MetricsInclude = applied.MetricsInclude
 	}
 
-	if v, ok := params["keepUrlTag"].(bool); ok {
-		c.KeepUrlTag = null.BoolFrom(v)
+	if len(applied.MetricsExclude) > 0 {
+		base.MetricsExclude = applied.MetricsExclude
 	}
 
-	c.Headers = make(map[string]string)
-	if v, ok := params["headers"].(map[string]interface{}); ok {
-		for k, v := range v {
-			if v, ok := v.(string); ok {
-				c.Headers[k] = v
-			}
-		}
+	if applied.BuiltinMetrics.Valid {
+		base.BuiltinMetrics = applied.BuiltinMetrics
 	}
 
-	return c, nil
-}
+	if applied.MetricPrefix.Valid {
+		base.MetricPrefix = applied.MetricPrefix
+	}
 
-// GetConsolidatedConfig combines {default config values + JSON config +
-// environment vars + arg config values}, and returns the final result.
-func GetConsolidatedConfig(jsonRawConf json.RawMessage, env map[string]string, arg string) (Config, error) {
-	result := NewConfig()
-	if jsonRawConf != nil {
-		jsonConf := Config{}
-		if err := json.Unmarshal(jsonRawConf, &jsonConf); err != nil {
-			return result, err
+	if len(applied.MetricRenames) > 0 {
+		if base.MetricRenames == nil {
+			base.MetricRenames = make(map[string]string)
+		}
+		for k, v := range applied.MetricRenames {
+			base.MetricRenames[k] = v
 		}
-		result = result.Apply(jsonConf)
 	}
 
-	getEnvBool := func(env map[string]string, name string) (null.Bool, error) {
-		if v, vDefined := env[name]; vDefined {
-			if b, err := strconv.ParseBool(v); err != nil {
-				return null.NewBool(false, false), err
-			} else {
-				return null.BoolFrom(b), nil
-			}
-		}
-		return null.NewBool(false, false), nil
+	if applied.TransformFile.Valid {
+		base.TransformFile = applied.TransformFile
 	}
 
-	getEnvMap := func(env map[string]string, prefix string) map[string]string {
-		result := make(map[string]string)
-		for ek, ev := range env {
-			if strings.HasPrefix(ek, prefix) {
-				k := strings.TrimPrefix(ek, prefix)
-				result[k] = ev
-			}
-		}
-		return result
+	if applied.DurationUnit.Valid {
+		base.DurationUnit = applied.DurationUnit
 	}
 
-	// envconfig is not processing some undefined vars (at least duration) so apply them manually
-	if flushPeriod, flushPeriodDefined := env["K6_DYNATRACE_FLUSH_PERIOD"]; flushPeriodDefined {
-		if err := result.FlushPeriod.UnmarshalText([]byte(flushPeriod)); err != nil {
-			return result, err
-		}
+	if applied.TimestampPolicy.Valid {
+		base.TimestampPolicy = applied.TimestampPolicy
 	}
 
+	if applied.OmitTimestamps.Valid {
+		base.OmitTimestamps = applied.OmitTimestamps
+	}
 
+	if applied.DropZeroValues.Valid {
+		base.DropZeroValues = applied.DropZeroValues
+	}
 
-	if url, urlDefined := env["K6_DYNATRACE_URL"]; urlDefined {
-		result.Url =url
+	if applied.ExportThresholds.Valid {
+		base.ExportThresholds = applied.ExportThresholds
 	}
 
-	if b, err := getEnvBool(env, "K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY"); err != nil {
-		return result, err
-	} else {
-		if b.Valid {
-			// apply only if valid, to keep default option otherwise
-			result.InsecureSkipTLSVerify = b
-		}
+	if applied.ThresholdEvents.Valid {
+		base.ThresholdEvents = applied.ThresholdEvents
 	}
 
-	if ca, caDefined := env["K6_CA_CERT_FILE"]; caDefined {
-		result.CACert = null.StringFrom(ca)
+	if applied.ThresholdEventType.Valid {
+		base.ThresholdEventType = applied.ThresholdEventType
 	}
 
-	if apitoken, userDefined := env["K6_DYNATRACE_APITOKEN"]; userDefined {
-		result.ApiToken = null.StringFrom(apitoken)
+	if applied.LifecycleEvents.Valid {
+		base.LifecycleEvents = applied.LifecycleEvents
 	}
 
+	if applied.EventsEntitySelector.Valid {
+		base.EventsEntitySelector = applied.EventsEntitySelector
+	}
 
-	if b, err := getEnvBool(env, "K6_KEEP_TAGS"); err != nil {
-		return result, err
-	} else {
-		if b.Valid {
-			result.KeepTags = b
-		}
+	if applied.DeploymentEvent.Valid {
+		base.DeploymentEvent = applied.DeploymentEvent
 	}
 
-	if b, err := getEnvBool(env, "K6_KEEP_NAME_TAG"); err != nil {
-		return result, err
-	} else {
-		if b.Valid {
-			result.KeepNameTag = b
-		}
+	if applied.DeploymentVersion.Valid {
+		base.DeploymentVersion = applied.DeploymentVersion
 	}
 
-	if b, err := getEnvBool(env, "K6_KEEP_URL_TAG"); err != nil {
-		return result, err
-	} else {
-		if b.Valid {
-			result.KeepUrlTag = b
-		}
+	if applied.DeploymentCiBackLink.Valid {
+		base.DeploymentCiBackLink = applied.DeploymentCiBackLink
 	}
 
-	envHeaders := getEnvMap(env, "K6_DYNATRACE_HEADER")
-	for k, v := range envHeaders {
-		result.Headers[k] = v
+	if applied.DeploymentCommit.Valid {
+		base.DeploymentCommit = applied.DeploymentCommit
 	}
 
-	if arg != "" {
-		argConf, err := ParseArg(arg)
-		if err != nil {
-			return result, err
-		}
+	if applied.MaintenanceWindow.Valid {
+		base.MaintenanceWindow = applied.MaintenanceWindow
+	}
 
-		result = result.Apply(argConf)
+	if len(applied.MaintenanceWindowEntities) > 0 {
+		base.MaintenanceWindowEntities = applied.MaintenanceWindowEntities
+	}
+
+	if len(applied.MaintenanceWindowTags) > 0 {
+		base.MaintenanceWindowTags = applied.MaintenanceWindowTags
+	}
+
+	if applied.MaintenanceWindowDuration.Valid {
+		base.MaintenanceWindowDuration = applied.MaintenanceWindowDuration
+	}
+
+	if applied.Summary.Valid {
+		base.Summary = applied.Summary
+	}
+
+	if applied.Logs.Valid {
+		base.Logs = applied.Logs
+	}
+
+	if applied.FailureLogs.Valid {
+		base.FailureLogs = applied.FailureLogs
+	}
+
+	if applied.Bucket.Valid {
+		base.Bucket = applied.Bucket
+	}
+
+	if applied.SecurityContext.Valid {
+		base.SecurityContext = applied.SecurityContext
+	}
+
+	if applied.ExportFormat.Valid {
+		base.ExportFormat = applied.ExportFormat
+	}
+
+	if applied.Traces.Valid {
+		base.Traces = applied.Traces
+	}
+
+	if applied.TraceIDs.Valid {
+		base.TraceIDs = applied.TraceIDs
+	}
+
+	if applied.BizEvents.Valid {
+		base.BizEvents = applied.BizEvents
+	}
+
+	if applied.BizEventsTagPrefix.Valid {
+		base.BizEventsTagPrefix = applied.BizEventsTagPrefix
+	}
+
+	if applied.Slos.Valid {
+		base.Slos = applied.Slos
+	}
+
+	if applied.SloTarget.Valid {
+		base.SloTarget = applied.SloTarget
+	}
+
+	if applied.SloWarning.Valid {
+		base.SloWarning = applied.SloWarning
+	}
+
+	if applied.SloTimeframe.Valid {
+		base.SloTimeframe = applied.SloTimeframe
+	}
+
+	if len(applied.MetricEvents) > 0 {
+		base.MetricEvents = applied.MetricEvents
+	}
+
+	if applied.ThresholdMetricEvents.Valid {
+		base.ThresholdMetricEvents = applied.ThresholdMetricEvents
+	}
+
+	if applied.CreateDashboard.Valid {
+		base.CreateDashboard = applied.CreateDashboard
+	}
+
+	if applied.IngestMode.Valid {
+		base.IngestMode = applied.IngestMode
+	}
+
+	if applied.UseDynatraceEnv.Valid {
+		base.UseDynatraceEnv = applied.UseDynatraceEnv
+	}
+
+	if applied.K8sMetadata.Valid {
+		base.K8sMetadata = applied.K8sMetadata
+	}
+
+	if applied.CloudMetadata.Valid {
+		base.CloudMetadata = applied.CloudMetadata
+	}
+
+	if applied.HostMetadata.Valid {
+		base.HostMetadata = applied.HostMetadata
+	}
+
+	if applied.Distributed.Valid {
+		base.Distributed = applied.Distributed
+	}
+
+	if applied.InstanceID.Valid {
+		base.InstanceID = applied.InstanceID
+	}
+
+	if applied.InstanceAggregates.Valid {
+		base.InstanceAggregates = applied.InstanceAggregates
+	}
+
+	if applied.GroupLevels.Valid {
+		base.GroupLevels = applied.GroupLevels
+	}
+
+	if applied.CheckMetrics.Valid {
+		base.CheckMetrics = applied.CheckMetrics
+	}
+
+	if applied.ErrorDimensions.Valid {
+		base.ErrorDimensions = applied.ErrorDimensions
+	}
+
+	if applied.StatusClasses.Valid {
+		base.StatusClasses = applied.StatusClasses
+	}
+
+	if applied.BrowserMetrics.Valid {
+		base.BrowserMetrics = applied.BrowserMetrics
+	}
+
+	if applied.ProtocolDimensions.Valid {
+		base.ProtocolDimensions = applied.ProtocolDimensions
+	}
+
+	if applied.ValidateOnly.Valid {
+		base.ValidateOnly = applied.ValidateOnly
+	}
+
+	if applied.ConfigFile.Valid {
+		base.ConfigFile = applied.ConfigFile
+	}
+
+	if applied.Profile.Valid {
+		base.Profile = applied.Profile
+	}
+
+	if applied.TLSMinVersion.Valid {
+		base.TLSMinVersion = applied.TLSMinVersion
+	}
+
+	if len(applied.TLSCipherSuites) > 0 {
+		base.TLSCipherSuites = applied.TLSCipherSuites
+	}
+
+	if applied.ServerName.Valid {
+		base.ServerName = applied.ServerName
+	}
+
+	if applied.ConnectTo.Valid {
+		base.ConnectTo = applied.ConnectTo
+	}
+
+	if len(applied.HostAliases) > 0 {
+		if base.HostAliases == nil {
+			base.HostAliases = make(map[string]string)
+		}
+		for k, v := range applied.HostAliases {
+			base.HostAliases[k] = v
+		}
+	}
+
+	if applied.DNSServer.Valid {
+		base.DNSServer = applied.DNSServer
+	}
+
+	if applied.NetworkFamily.Valid {
+		base.NetworkFamily = applied.NetworkFamily
+	}
+
+	if applied.DebugTransport.Valid {
+		base.DebugTransport = applied.DebugTransport
+	}
+
+	if applied.PayloadDumpBytes.Valid {
+		base.PayloadDumpBytes = applied.PayloadDumpBytes
+	}
+
+	if applied.PayloadDumpLines.Valid {
+		base.PayloadDumpLines = applied.PayloadDumpLines
+	}
+
+	if applied.SelfMonitoring.Valid {
+		base.SelfMonitoring = applied.SelfMonitoring
+	}
+
+	if applied.Heartbeat.Valid {
+		base.Heartbeat = applied.Heartbeat
+	}
+
+	if applied.LogLevel.Valid {
+		base.LogLevel = applied.LogLevel
+	}
+
+	if applied.Quiet.Valid {
+		base.Quiet = applied.Quiet
+	}
+
+	if applied.LogFormat.Valid {
+		base.LogFormat = applied.LogFormat
+	}
+
+	if applied.StatsAddress.Valid {
+		base.StatsAddress = applied.StatsAddress
+	}
+
+	if applied.FailTestOnExportError.Valid {
+		base.FailTestOnExportError = applied.FailTestOnExportError
+	}
+
+	if applied.FailTestErrorRate.Valid {
+		base.FailTestErrorRate = applied.FailTestErrorRate
+	}
+
+	if applied.FailTestConsecutiveFailures.Valid {
+		base.FailTestConsecutiveFailures = applied.FailTestConsecutiveFailures
+	}
+
+	if applied.StreamPayload.Valid {
+		base.StreamPayload = applied.StreamPayload
+	}
+
+	if applied.MaxMemoryBytes.Valid {
+		base.MaxMemoryBytes = applied.MaxMemoryBytes
+	}
+
+	if applied.ValidateLines.Valid {
+		base.ValidateLines = applied.ValidateLines
+	}
+
+	if applied.MaxRetries.Valid {
+		base.MaxRetries = applied.MaxRetries
+	}
+
+	if len(applied.RetryOnStatusCodes) > 0 {
+		base.RetryOnStatusCodes = applied.RetryOnStatusCodes
+	}
+
+	if applied.MaxRetryElapsedTime.Valid {
+		base.MaxRetryElapsedTime = applied.MaxRetryElapsedTime
+	}
+
+	if applied.RetryExhaustedPolicy.Valid {
+		base.RetryExhaustedPolicy = applied.RetryExhaustedPolicy
+	}
+
+	if applied.SpoolDir.Valid {
+		base.SpoolDir = applied.SpoolDir
+	}
+
+	if applied.MaxLinesPerRequest.Valid {
+		base.MaxLinesPerRequest = applied.MaxLinesPerRequest
+	}
+
+	if applied.MaxBytesPerRequest.Valid {
+		base.MaxBytesPerRequest = applied.MaxBytesPerRequest
+	}
+
+	if applied.Compression.Valid {
+		base.Compression = applied.Compression
+	}
+
+	if applied.ForceHTTP1.Valid {
+		base.ForceHTTP1 = applied.ForceHTTP1
+	}
+
+	if applied.MaxSamplesPerFlush.Valid {
+		base.MaxSamplesPerFlush = applied.MaxSamplesPerFlush
+	}
+
+	if applied.SampleDropPolicy.Valid {
+		base.SampleDropPolicy = applied.SampleDropPolicy
+	}
+
+	if len(applied.MetricPriority) > 0 {
+		base.MetricPriority = applied.MetricPriority
+	}
+
+	if len(applied.CriticalMetrics) > 0 {
+		base.CriticalMetrics = applied.CriticalMetrics
+	}
+
+	if len(applied.BestEffortMetrics) > 0 {
+		base.BestEffortMetrics = applied.BestEffortMetrics
+	}
+
+	if applied.OmitAggregateTimestamps.Valid {
+		base.OmitAggregateTimestamps = applied.OmitAggregateTimestamps
+	}
+
+	if applied.MetricsSource.Valid {
+		base.MetricsSource = applied.MetricsSource
+	}
+
+	if applied.Environment.Valid {
+		base.Environment = applied.Environment
+	}
+
+	if applied.Stage.Valid {
+		base.Stage = applied.Stage
+	}
+
+	if applied.GroupRollups.Valid {
+		base.GroupRollups = applied.GroupRollups
+	}
+
+	if applied.SubmetricDimensions.Valid {
+		base.SubmetricDimensions = applied.SubmetricDimensions
+	}
+
+	if applied.SubmetricNames.Valid {
+		base.SubmetricNames = applied.SubmetricNames
+	}
+
+	if applied.CumulativeCounters.Valid {
+		base.CumulativeCounters = applied.CumulativeCounters
+	}
+
+	if len(applied.Apdex) > 0 {
+		base.Apdex = applied.Apdex
+	}
+
+	if applied.BurnRateTarget.Valid {
+		base.BurnRateTarget = applied.BurnRateTarget
+	}
+
+	if len(applied.RollingPercentiles) > 0 {
+		base.RollingPercentiles = applied.RollingPercentiles
+	}
+
+	if len(applied.RelabelConfigs) > 0 {
+		base.RelabelConfigs = applied.RelabelConfigs
+	}
+
+	if len(applied.Dimensions) > 0 {
+		if base.Dimensions == nil {
+			base.Dimensions = make(map[string]string)
+		}
+		for k, v := range applied.Dimensions {
+			base.Dimensions[k] = v
+		}
+	}
+
+	return base
+}
+
+// ParseArg takes an arg string and converts it to a config
+func ParseArg(arg string) (Config, error) {
+	var c Config
+	params, err := strvals.Parse(arg)
+	if err != nil {
+		return c, err
+	}
+	if err := checkArgs(params); err != nil {
+		return c, err
+	}
+
+	if v, ok := params["url"].(string); ok {
+		c.Url = v
+	}
+
+	if v, ok := params["insecureSkipTLSVerify"].(bool); ok {
+		c.InsecureSkipTLSVerify = null.BoolFrom(v)
+	}
+
+	if v, ok := params["caCertFile"].(string); ok {
+		c.CACert = null.StringFrom(v)
+	}
+
+	if v, ok := params["apitoken"].(string); ok {
+		c.ApiToken = null.StringFrom(v)
+	}
+
+
+	if v, ok := params["flushPeriod"].(string); ok {
+		if err := c.FlushPeriod.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["timeout"].(string); ok {
+		if err := c.Timeout.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["keepTags"].(bool); ok {
+		c.KeepTags = null.BoolFrom(v)
+	}
+
+	if v, ok := params["keepNameTag"].(bool); ok {
+		c.KeepNameTag = null.BoolFrom(v)
+	}
+
+	if v, ok := params["keepUrlTag"].(bool); ok {
+		c.KeepUrlTag = null.BoolFrom(v)
+	}
+
+	if v, ok := params["keepVuTag"].(bool); ok {
+		c.KeepVuTag = null.BoolFrom(v)
+	}
+
+	if v, ok := params["keepIterTag"].(bool); ok {
+		c.KeepIterTag = null.BoolFrom(v)
+	}
+
+	if v, ok := params["keepScenarioTag"].(bool); ok {
+		c.KeepScenarioTag = null.BoolFrom(v)
+	}
+
+	c.Headers = make(map[string]string)
+	if v, ok := params["headers"].(map[string]interface{}); ok {
+		for k, v := range v {
+			if v, ok := v.(string); ok {
+				c.Headers[k] = v
+			}
+		}
+	}
+
+	if v, ok := toStringSlice(params["tagsAsDimensions"]); ok {
+		c.TagsAsDimensions = v
+	}
+
+	if v, ok := toStringSlice(params["excludeTags"]); ok {
+		c.ExcludeTags = v
+	}
+
+	if v, ok := params["testRunId"]; ok {
+		c.TestRunID = null.StringFrom(fmt.Sprint(v))
+	}
+
+	if v, ok := params["urlGroups"].(string); ok {
+		groups, err := parseUrlGroups(v)
+		if err != nil {
+			return c, err
+		}
+		c.UrlGroups = groups
+	}
+
+	if v, ok := params["useNameTagForUrl"].(bool); ok {
+		c.UseNameTagForUrl = null.BoolFrom(v)
+	}
+
+	if v, ok := params["maxSeries"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("maxSeries: %w", err)
+		}
+		c.MaxSeries = null.IntFrom(i)
+	}
+
+	if v, ok := params["cardinalityPolicy"].(string); ok {
+		c.CardinalityPolicy = null.StringFrom(v)
+	}
+
+	if v, ok := toStringSlice(params["hashDimensions"]); ok {
+		c.HashDimensions = v
+	}
+
+	if v, ok := params["hashLength"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("hashLength: %w", err)
+		}
+		c.HashLength = null.IntFrom(i)
+	}
+
+	if v, ok := toStringSlice(params["metricsInclude"]); ok {
+		c.MetricsInclude = v
+	}
+
+	if v, ok := toStringSlice(params["metricsExclude"]); ok {
+		c.MetricsExclude = v
+	}
+
+	if v, ok := params["builtinMetrics"].(string); ok {
+		c.BuiltinMetrics = null.StringFrom(v)
+	}
+
+	if v, ok := params["metricPrefix"].(string); ok {
+		c.MetricPrefix = null.StringFrom(v)
+	}
+
+	c.MetricRenames = make(map[string]string)
+	if v, ok := params["metricRenames"].(map[string]interface{}); ok {
+		for k, v := range v {
+			c.MetricRenames[k] = fmt.Sprint(v)
+		}
+	}
+
+	if v, ok := params["transformFile"].(string); ok {
+		c.TransformFile = null.StringFrom(v)
+	}
+
+	if v, ok := params["durationUnit"].(string); ok {
+		c.DurationUnit = null.StringFrom(v)
+	}
+
+	if v, ok := params["timestampPolicy"].(string); ok {
+		c.TimestampPolicy = null.StringFrom(v)
+	}
+
+	if v, ok := params["omitTimestamps"].(bool); ok {
+		c.OmitTimestamps = null.BoolFrom(v)
+	}
+
+	if v, ok := params["dropZeroValues"].(bool); ok {
+		c.DropZeroValues = null.BoolFrom(v)
+	}
+
+	if v, ok := params["exportThresholds"].(bool); ok {
+		c.ExportThresholds = null.BoolFrom(v)
+	}
+
+	if v, ok := params["thresholdEvents"].(bool); ok {
+		c.ThresholdEvents = null.BoolFrom(v)
+	}
+
+	if v, ok := params["thresholdEventType"].(string); ok {
+		c.ThresholdEventType = null.StringFrom(v)
+	}
+
+	if v, ok := params["lifecycleEvents"].(bool); ok {
+		c.LifecycleEvents = null.BoolFrom(v)
+	}
+
+	if v, ok := params["eventsEntitySelector"].(string); ok {
+		c.EventsEntitySelector = null.StringFrom(v)
+	}
+
+	if v, ok := params["deploymentEvent"].(bool); ok {
+		c.DeploymentEvent = null.BoolFrom(v)
+	}
+
+	if v, ok := params["deploymentVersion"]; ok {
+		c.DeploymentVersion = null.StringFrom(fmt.Sprint(v))
+	}
+
+	if v, ok := params["deploymentCiBackLink"].(string); ok {
+		c.DeploymentCiBackLink = null.StringFrom(v)
+	}
+
+	if v, ok := params["deploymentCommit"]; ok {
+		c.DeploymentCommit = null.StringFrom(fmt.Sprint(v))
+	}
+
+	if v, ok := params["maintenanceWindow"].(bool); ok {
+		c.MaintenanceWindow = null.BoolFrom(v)
+	}
+
+	if v, ok := toStringSlice(params["maintenanceWindowEntities"]); ok {
+		c.MaintenanceWindowEntities = v
+	}
+
+	if v, ok := toStringSlice(params["maintenanceWindowTags"]); ok {
+		c.MaintenanceWindowTags = v
+	}
+
+	if v, ok := params["maintenanceWindowDuration"].(string); ok {
+		if err := c.MaintenanceWindowDuration.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["summary"].(bool); ok {
+		c.Summary = null.BoolFrom(v)
+	}
+
+	if v, ok := params["logs"].(bool); ok {
+		c.Logs = null.BoolFrom(v)
+	}
+
+	if v, ok := params["failureLogs"].(bool); ok {
+		c.FailureLogs = null.BoolFrom(v)
+	}
+
+	if v, ok := params["bucket"].(string); ok {
+		c.Bucket = null.StringFrom(v)
+	}
+
+	if v, ok := params["securityContext"].(string); ok {
+		c.SecurityContext = null.StringFrom(v)
+	}
+
+	if v, ok := params["exportFormat"].(string); ok {
+		c.ExportFormat = null.StringFrom(v)
+	}
+
+	if v, ok := params["traces"].(bool); ok {
+		c.Traces = null.BoolFrom(v)
+	}
+
+	if v, ok := params["traceIds"].(bool); ok {
+		c.TraceIDs = null.BoolFrom(v)
+	}
+
+	if v, ok := params["bizEvents"].(bool); ok {
+		c.BizEvents = null.BoolFrom(v)
+	}
+
+	if v, ok := params["bizEventsTagPrefix"].(string); ok {
+		c.BizEventsTagPrefix = null.StringFrom(v)
+	}
+
+	if v, ok := params["slos"].(bool); ok {
+		c.Slos = null.BoolFrom(v)
+	}
+
+	if v, ok := params["sloTarget"]; ok {
+		f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		if err != nil {
+			return c, fmt.Errorf("sloTarget: %w", err)
+		}
+		c.SloTarget = null.FloatFrom(f)
+	}
+
+	if v, ok := params["sloWarning"]; ok {
+		f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		if err != nil {
+			return c, fmt.Errorf("sloWarning: %w", err)
+		}
+		c.SloWarning = null.FloatFrom(f)
+	}
+
+	if v, ok := params["sloTimeframe"].(string); ok {
+		c.SloTimeframe = null.StringFrom(v)
+	}
+
+	if v, ok := toStringSlice(params["metricEvents"]); ok {
+		c.MetricEvents = v
+	}
+
+	if v, ok := params["thresholdMetricEvents"].(bool); ok {
+		c.ThresholdMetricEvents = null.BoolFrom(v)
+	}
+
+	if v, ok := params["createDashboard"].(bool); ok {
+		c.CreateDashboard = null.BoolFrom(v)
+	}
+
+	if v, ok := params["ingestMode"].(string); ok {
+		c.IngestMode = null.StringFrom(v)
+	}
+
+	if v, ok := params["useDynatraceEnv"].(bool); ok {
+		c.UseDynatraceEnv = null.BoolFrom(v)
+	}
+
+	if v, ok := params["k8sMetadata"].(bool); ok {
+		c.K8sMetadata = null.BoolFrom(v)
+	}
+
+	if v, ok := params["cloudMetadata"].(bool); ok {
+		c.CloudMetadata = null.BoolFrom(v)
+	}
+
+	if v, ok := params["hostMetadata"].(bool); ok {
+		c.HostMetadata = null.BoolFrom(v)
+	}
+
+	if v, ok := params["distributed"].(bool); ok {
+		c.Distributed = null.BoolFrom(v)
+	}
+
+	if v, ok := params["instanceId"].(string); ok {
+		c.InstanceID = null.StringFrom(v)
+	}
+
+	if v, ok := params["instanceAggregates"].(bool); ok {
+		c.InstanceAggregates = null.BoolFrom(v)
+	}
+
+	if v, ok := params["groupLevels"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("groupLevels: %w", err)
+		}
+		c.GroupLevels = null.IntFrom(i)
+	}
+
+	if v, ok := params["checkMetrics"].(bool); ok {
+		c.CheckMetrics = null.BoolFrom(v)
+	}
+
+	if v, ok := params["errorDimensions"].(bool); ok {
+		c.ErrorDimensions = null.BoolFrom(v)
+	}
+
+	if v, ok := params["statusClasses"].(bool); ok {
+		c.StatusClasses = null.BoolFrom(v)
+	}
+
+	if v, ok := params["browserMetrics"].(bool); ok {
+		c.BrowserMetrics = null.BoolFrom(v)
+	}
+
+	if v, ok := params["protocolDimensions"].(bool); ok {
+		c.ProtocolDimensions = null.BoolFrom(v)
+	}
+
+	if v, ok := params["validateOnly"].(bool); ok {
+		c.ValidateOnly = null.BoolFrom(v)
+	}
+
+	if v, ok := params["configFile"].(string); ok {
+		c.ConfigFile = null.StringFrom(v)
+	}
+
+	if v, ok := params["profile"].(string); ok {
+		c.Profile = null.StringFrom(v)
+	}
+
+	if v, ok := params["tlsMinVersion"].(string); ok {
+		c.TLSMinVersion = null.StringFrom(v)
+	}
+
+	if v, ok := toStringSlice(params["tlsCipherSuites"]); ok {
+		c.TLSCipherSuites = v
+	}
+
+	if v, ok := params["serverName"].(string); ok {
+		c.ServerName = null.StringFrom(v)
+	}
+
+	if v, ok := params["connectTo"].(string); ok {
+		c.ConnectTo = null.StringFrom(v)
+	}
+
+	c.HostAliases = make(map[string]string)
+	if v, ok := params["hostAliases"].(map[string]interface{}); ok {
+		for k, v := range v {
+			c.HostAliases[k] = fmt.Sprint(v)
+		}
+	}
+
+	if v, ok := params["dnsServer"].(string); ok {
+		c.DNSServer = null.StringFrom(v)
+	}
+
+	if v, ok := params["networkFamily"].(string); ok {
+		c.NetworkFamily = null.StringFrom(v)
+	}
+
+	if v, ok := params["debugTransport"].(bool); ok {
+		c.DebugTransport = null.BoolFrom(v)
+	}
+
+	if v, ok := params["payloadDumpBytes"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("payloadDumpBytes: %w", err)
+		}
+		c.PayloadDumpBytes = null.IntFrom(i)
+	}
+
+	if v, ok := params["payloadDumpLines"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("payloadDumpLines: %w", err)
+		}
+		c.PayloadDumpLines = null.IntFrom(i)
+	}
+
+	if v, ok := params["selfMonitoring"].(bool); ok {
+		c.SelfMonitoring = null.BoolFrom(v)
+	}
+
+	if v, ok := params["heartbeat"].(bool); ok {
+		c.Heartbeat = null.BoolFrom(v)
+	}
+
+	if v, ok := params["logLevel"].(string); ok {
+		c.LogLevel = null.StringFrom(v)
+	}
+
+	if v, ok := params["quiet"].(bool); ok {
+		c.Quiet = null.BoolFrom(v)
+	}
+
+	if v, ok := params["logFormat"].(string); ok {
+		c.LogFormat = null.StringFrom(v)
+	}
+
+	if v, ok := params["statsAddress"].(string); ok {
+		c.StatsAddress = null.StringFrom(v)
+	}
+
+	if v, ok := params["failTestOnExportError"].(bool); ok {
+		c.FailTestOnExportError = null.BoolFrom(v)
+	}
+
+	if v, ok := params["failTestErrorRate"]; ok {
+		f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		if err != nil {
+			return c, fmt.Errorf("failTestErrorRate: %w", err)
+		}
+		c.FailTestErrorRate = null.FloatFrom(f)
+	}
+
+	if v, ok := params["failTestConsecutiveFailures"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("failTestConsecutiveFailures: %w", err)
+		}
+		c.FailTestConsecutiveFailures = null.IntFrom(i)
+	}
+
+	if v, ok := params["streamPayload"].(bool); ok {
+		c.StreamPayload = null.BoolFrom(v)
+	}
+
+	if v, ok := params["maxMemoryBytes"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("maxMemoryBytes: %w", err)
+		}
+		c.MaxMemoryBytes = null.IntFrom(i)
+	}
+
+	if v, ok := params["validateLines"].(bool); ok {
+		c.ValidateLines = null.BoolFrom(v)
+	}
+
+	if v, ok := params["maxRetries"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("maxRetries: %w", err)
+		}
+		c.MaxRetries = null.IntFrom(i)
+	}
+
+	if v, ok := toStringSlice(params["retryOnStatusCodes"]); ok {
+		codes, err := parseStatusCodes(v)
+		if err != nil {
+			return c, fmt.Errorf("retryOnStatusCodes: %w", err)
+		}
+		c.RetryOnStatusCodes = codes
+	}
+
+	if v, ok := params["maxRetryElapsedTime"].(string); ok {
+		if err := c.MaxRetryElapsedTime.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+
+	if v, ok := params["retryExhaustedPolicy"].(string); ok {
+		c.RetryExhaustedPolicy = null.StringFrom(v)
+	}
+
+	if v, ok := params["spoolDir"].(string); ok {
+		c.SpoolDir = null.StringFrom(v)
+	}
+
+	if v, ok := params["maxLinesPerRequest"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("maxLinesPerRequest: %w", err)
+		}
+		c.MaxLinesPerRequest = null.IntFrom(i)
+	}
+
+	if v, ok := params["maxBytesPerRequest"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("maxBytesPerRequest: %w", err)
+		}
+		c.MaxBytesPerRequest = null.IntFrom(i)
+	}
+
+	if v, ok := params["compression"].(string); ok {
+		c.Compression = null.StringFrom(v)
+	}
+
+	if v, ok := params["forceHTTP1"].(bool); ok {
+		c.ForceHTTP1 = null.BoolFrom(v)
+	}
+
+	if v, ok := params["maxSamplesPerFlush"]; ok {
+		i, err := toInt64(v)
+		if err != nil {
+			return c, fmt.Errorf("maxSamplesPerFlush: %w", err)
+		}
+		c.MaxSamplesPerFlush = null.IntFrom(i)
+	}
+
+	if v, ok := params["sampleDropPolicy"].(string); ok {
+		c.SampleDropPolicy = null.StringFrom(v)
+	}
+
+	if v, ok := toStringSlice(params["metricPriority"]); ok {
+		c.MetricPriority = v
+	}
+
+	if v, ok := toStringSlice(params["criticalMetrics"]); ok {
+		c.CriticalMetrics = v
+	}
+
+	if v, ok := toStringSlice(params["bestEffortMetrics"]); ok {
+		c.BestEffortMetrics = v
+	}
+
+	if v, ok := params["omitAggregateTimestamps"].(bool); ok {
+		c.OmitAggregateTimestamps = null.BoolFrom(v)
+	}
+
+	if v, ok := params["metricsSource"].(string); ok {
+		c.MetricsSource = null.StringFrom(v)
+	}
+
+	if v, ok := params["environment"].(string); ok {
+		c.Environment = null.StringFrom(v)
+	}
+
+	if v, ok := params["stage"].(string); ok {
+		c.Stage = null.StringFrom(v)
+	}
+
+	if v, ok := params["groupRollups"].(bool); ok {
+		c.GroupRollups = null.BoolFrom(v)
+	}
+
+	if v, ok := params["submetricDimensions"].(bool); ok {
+		c.SubmetricDimensions = null.BoolFrom(v)
+	}
+
+	if v, ok := params["submetricNames"].(bool); ok {
+		c.SubmetricNames = null.BoolFrom(v)
+	}
+
+	if v, ok := params["cumulativeCounters"].(bool); ok {
+		c.CumulativeCounters = null.BoolFrom(v)
+	}
+
+	if v, ok := toStringSlice(params["apdex"]); ok {
+		c.Apdex = v
+	}
+
+	if v, ok := params["burnRateTarget"]; ok {
+		f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		if err != nil {
+			return c, fmt.Errorf("burnRateTarget: %w", err)
+		}
+		c.BurnRateTarget = null.FloatFrom(f)
+	}
+
+	if v, ok := toStringSlice(params["rollingPercentiles"]); ok {
+		c.RollingPercentiles = v
+	}
+
+	c.Dimensions = make(map[string]string)
+	if v, ok := params["dimensions"].(map[string]interface{}); ok {
+		for k, v := range v {
+			c.Dimensions[k] = fmt.Sprint(v)
+		}
+	}
+
+	return c, nil
+}
+
+var (
+	nullBoolType   = reflect.TypeOf(null.Bool{})
+	stringMapType  = reflect.TypeOf(map[string]string{})
+	relabelsType   = reflect.TypeOf([]RelabelConfig{})
+	configArgTypes = configFieldTypes()
+)
+
+// configFieldTypes returns the type of every Config field by its JSON key,
+// which is also its key in the --out argument.
+func configFieldTypes() map[string]reflect.Type {
+	t := reflect.TypeOf(Config{})
+	types := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; key != "" && key != "-" {
+			types[key] = t.Field(i).Type
+		}
+	}
+	return types
+}
+
+// checkArgs reports the unknown keys and the values of the wrong type of a
+// parsed --out argument, all at once, instead of silently ignoring them.
+// The values strvals typed as numbers or booleans are turned back into
+// strings for the string options, e.g. apitoken or testRunId.
+func checkArgs(params map[string]interface{}) error {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		value := params[key]
+		typ, ok := configArgTypes[key]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("unknown option %q", key))
+		case typ == relabelsType:
+			problems = append(problems, fmt.Sprintf("%s can only be set in the JSON config or with K6_DYNATRACE_RELABEL_CONFIGS", key))
+		case typ == nullBoolType:
+			if _, ok := value.(bool); !ok {
+				problems = append(problems, fmt.Sprintf("%s: expected true or false, got %v", key, value))
+			}
+		case typ == stringMapType:
+			if _, ok := value.(map[string]interface{}); !ok {
+				problems = append(problems, fmt.Sprintf("%s: expected %s.<key>=<value>", key, key))
+			}
+		default:
+			if _, ok := value.(map[string]interface{}); ok {
+				problems = append(problems, fmt.Sprintf("%s: unexpected %s.<key>=<value>", key, key))
+			} else if _, isList := value.([]interface{}); !isList {
+				params[key] = fmt.Sprint(value)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid output-dynatrace argument: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// toInt64 accepts the int64 produced by strvals as well as numeric strings.
+func toInt64(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("unexpected value %v", v)
+}
+
+// toStringSlice accepts either a single value or a strvals list ({a,b}).
+func toStringSlice(v interface{}) ([]string, bool) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			result = append(result, fmt.Sprint(item))
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// parseUrlGroups parses "pattern => replacement" rules separated by ";".
+func parseUrlGroups(v string) ([]UrlGroup, error) {
+	var result []UrlGroup
+	for _, rule := range strings.Split(v, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, "=>", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid url group %q, expected \"pattern => replacement\"", rule)
+		}
+		result = append(result, UrlGroup{
+			Pattern:     strings.TrimSpace(parts[0]),
+			Replacement: strings.TrimSpace(parts[1]),
+		})
+	}
+	return result, nil
+}
+
+// newTestRunID returns a random identifier for the current test execution.
+func newTestRunID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate the test run id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hasHeader reports whether the headers set the given one, in any case.
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitKeyValues parses a "k1=v1,k2=v2" env value.
+func splitKeyValues(v string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range splitList(v) {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			return nil, fmt.Errorf("invalid key=value pair %q", item)
+		}
+		result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return result, nil
+}
+
+// splitList splits a comma separated env value, dropping empty items.
+func splitList(v string) []string {
+	var result []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// scriptConfigKey is the key of the output configuration in the options.ext
+// block of the script.
+const scriptConfigKey = "dynatrace"
+
+// GetConsolidatedConfig combines {default config values + JSON config +
+// config file + script options.ext.dynatrace config + environment vars +
+// arg config values}, and returns the final result.
+func GetConsolidatedConfig(jsonRawConf, scriptRawConf json.RawMessage, env map[string]string, arg string) (Config, error) {
+	result := NewConfig()
+	if jsonRawConf != nil {
+		jsonConf := Config{}
+		if err := json.Unmarshal(jsonRawConf, &jsonConf); err != nil {
+			return result, err
+		}
+		result = result.Apply(jsonConf)
+	}
+
+	// the arg is applied last, but it can name the config file
+	var argConf Config
+	if arg != "" {
+		var err error
+		if argConf, err = ParseArg(arg); err != nil {
+			return result, err
+		}
+	}
+	if v, vDefined := env["K6_DYNATRACE_CONFIG"]; vDefined {
+		result.ConfigFile = null.StringFrom(v)
+	}
+	if argConf.ConfigFile.Valid {
+		result.ConfigFile = argConf.ConfigFile
+	}
+	if v, vDefined := env["K6_DYNATRACE_PROFILE"]; vDefined {
+		result.Profile = null.StringFrom(v)
+	}
+	if argConf.Profile.Valid {
+		result.Profile = argConf.Profile
+	}
+	if result.ConfigFile.String != "" {
+		file, err := loadConfigFile(result.ConfigFile.String)
+		if err != nil {
+			return result, err
+		}
+		// the profile selected outside of the file wins over its default one
+		if result.Profile.Valid {
+			file.Profile = result.Profile
+		}
+		profile, err := file.profile(file.Profile.String)
+		if err != nil {
+			return result, err
+		}
+		result = result.Apply(file.Config).Apply(profile)
+	} else if result.Profile.String != "" {
+		return result, fmt.Errorf("profile %q is selected but no config file is set", result.Profile.String)
+	}
+
+	if scriptRawConf != nil {
+		scriptConf := Config{}
+		if err := json.Unmarshal(scriptRawConf, &scriptConf); err != nil {
+			return result, fmt.Errorf("invalid options.ext.%s: %w", scriptConfigKey, err)
+		}
+		result = result.Apply(scriptConf)
+	}
+
+	getEnvBool := func(env map[string]string, name string) (null.Bool, error) {
+		if v, vDefined := env[name]; vDefined {
+			if b, err := strconv.ParseBool(v); err != nil {
+				return null.NewBool(false, false), err
+			} else {
+				return null.BoolFrom(b), nil
+			}
+		}
+		return null.NewBool(false, false), nil
+	}
+
+	getEnvInt := func(env map[string]string, name string) (null.Int, error) {
+		if v, vDefined := env[name]; vDefined {
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return null.NewInt(0, false), err
+			}
+			return null.IntFrom(i), nil
+		}
+		return null.NewInt(0, false), nil
+	}
+
+	getEnvMap := func(env map[string]string, prefix string) map[string]string {
+		result := make(map[string]string)
+		for ek, ev := range env {
+			if strings.HasPrefix(ek, prefix) {
+				k := strings.TrimPrefix(ek, prefix)
+				result[k] = ev
+			}
+		}
+		return result
+	}
+
+	// envconfig is not processing some undefined vars (at least duration) so apply them manually
+	if flushPeriod, flushPeriodDefined := env["K6_DYNATRACE_FLUSH_PERIOD"]; flushPeriodDefined {
+		if err := result.FlushPeriod.UnmarshalText([]byte(flushPeriod)); err != nil {
+			return result, err
+		}
+	}
+
+	if timeout, timeoutDefined := env["K6_DYNATRACE_TIMEOUT"]; timeoutDefined {
+		if err := result.Timeout.UnmarshalText([]byte(timeout)); err != nil {
+			return result, err
+		}
+	}
+
+
+
+	if url, urlDefined := env["K6_DYNATRACE_URL"]; urlDefined {
+		result.Url =url
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			// apply only if valid, to keep default option otherwise
+			result.InsecureSkipTLSVerify = b
+		}
+	}
+
+	if ca, caDefined := env["K6_CA_CERT_FILE"]; caDefined {
+		result.CACert = null.StringFrom(ca)
+	}
+
+	if apitoken, userDefined := env["K6_DYNATRACE_APITOKEN"]; userDefined {
+		result.ApiToken = null.StringFrom(apitoken)
+	}
+
+
+	if b, err := getEnvBool(env, "K6_KEEP_TAGS"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KeepTags = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_KEEP_NAME_TAG"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KeepNameTag = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_KEEP_URL_TAG"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KeepUrlTag = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_KEEP_VU_TAG"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KeepVuTag = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_KEEP_ITER_TAG"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KeepIterTag = b
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_KEEP_SCENARIO_TAG"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.KeepScenarioTag = b
+		}
+	}
+
+	envHeaders := getEnvMap(env, "K6_DYNATRACE_HEADER")
+	for k, v := range envHeaders {
+		result.Headers[k] = v
+	}
+
+	if tags, tagsDefined := env["K6_DYNATRACE_TAGS_AS_DIMENSIONS"]; tagsDefined {
+		result.TagsAsDimensions = splitList(tags)
+	}
+
+	if tags, tagsDefined := env["K6_DYNATRACE_EXCLUDE_TAGS"]; tagsDefined {
+		result.ExcludeTags = splitList(tags)
+	}
+
+	if id, idDefined := env["K6_DYNATRACE_TEST_RUN_ID"]; idDefined {
+		result.TestRunID = null.StringFrom(id)
+	}
+
+	if groups, groupsDefined := env["K6_DYNATRACE_URL_GROUPS"]; groupsDefined {
+		urlGroups, err := parseUrlGroups(groups)
+		if err != nil {
+			return result, err
+		}
+		result.UrlGroups = urlGroups
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_USE_NAME_TAG_FOR_URL"); err != nil {
+		return result, err
+	} else {
+		if b.Valid {
+			result.UseNameTagForUrl = b
+		}
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_MAX_SERIES"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.MaxSeries = i
+	}
+
+	if policy, policyDefined := env["K6_DYNATRACE_CARDINALITY_POLICY"]; policyDefined {
+		result.CardinalityPolicy = null.StringFrom(policy)
+	}
+
+	if tags, tagsDefined := env["K6_DYNATRACE_HASH_DIMENSIONS"]; tagsDefined {
+		result.HashDimensions = splitList(tags)
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_HASH_LENGTH"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.HashLength = i
+	}
+
+	if metrics, metricsDefined := env["K6_DYNATRACE_METRICS_INCLUDE"]; metricsDefined {
+		result.MetricsInclude = splitList(metrics)
+	}
+
+	if metrics, metricsDefined := env["K6_DYNATRACE_METRICS_EXCLUDE"]; metricsDefined {
+		result.MetricsExclude = splitList(metrics)
+	}
+
+	if builtin, builtinDefined := env["K6_DYNATRACE_BUILTIN_METRICS"]; builtinDefined {
+		result.BuiltinMetrics = null.StringFrom(builtin)
+	}
+
+	if prefix, prefixDefined := env["K6_DYNATRACE_METRIC_PREFIX"]; prefixDefined {
+		result.MetricPrefix = null.StringFrom(prefix)
+	}
+
+	if renames, renamesDefined := env["K6_DYNATRACE_METRIC_RENAMES"]; renamesDefined {
+		envRenames, err := splitKeyValues(renames)
+		if err != nil {
+			return result, fmt.Errorf("K6_DYNATRACE_METRIC_RENAMES: %w", err)
+		}
+		for k, v := range envRenames {
+			result.MetricRenames[k] = v
+		}
+	}
+
+	if file, fileDefined := env["K6_DYNATRACE_TRANSFORM_FILE"]; fileDefined {
+		result.TransformFile = null.StringFrom(file)
+	}
+
+	if unit, unitDefined := env["K6_DYNATRACE_DURATION_UNIT"]; unitDefined {
+		result.DurationUnit = null.StringFrom(unit)
+	}
+
+	if policy, policyDefined := env["K6_DYNATRACE_TIMESTAMP_POLICY"]; policyDefined {
+		result.TimestampPolicy = null.StringFrom(policy)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_OMIT_TIMESTAMPS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.OmitTimestamps = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_DROP_ZERO_VALUES"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.DropZeroValues = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_EXPORT_THRESHOLDS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.ExportThresholds = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_THRESHOLD_EVENTS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.ThresholdEvents = b
+	}
+
+	if eventType, eventTypeDefined := env["K6_DYNATRACE_THRESHOLD_EVENT_TYPE"]; eventTypeDefined {
+		result.ThresholdEventType = null.StringFrom(eventType)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_LIFECYCLE_EVENTS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.LifecycleEvents = b
+	}
+
+	if selector, selectorDefined := env["K6_DYNATRACE_EVENTS_ENTITY_SELECTOR"]; selectorDefined {
+		result.EventsEntitySelector = null.StringFrom(selector)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_DEPLOYMENT_EVENT"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.DeploymentEvent = b
+	}
+
+	if version, versionDefined := env["K6_DYNATRACE_DEPLOYMENT_VERSION"]; versionDefined {
+		result.DeploymentVersion = null.StringFrom(version)
+	}
+
+	if link, linkDefined := env["K6_DYNATRACE_DEPLOYMENT_CI_BACK_LINK"]; linkDefined {
+		result.DeploymentCiBackLink = null.StringFrom(link)
+	}
+
+	if commit, commitDefined := env["K6_DYNATRACE_DEPLOYMENT_COMMIT"]; commitDefined {
+		result.DeploymentCommit = null.StringFrom(commit)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_MAINTENANCE_WINDOW"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.MaintenanceWindow = b
+	}
+
+	if entities, entitiesDefined := env["K6_DYNATRACE_MAINTENANCE_WINDOW_ENTITIES"]; entitiesDefined {
+		result.MaintenanceWindowEntities = splitList(entities)
+	}
+
+	if tags, tagsDefined := env["K6_DYNATRACE_MAINTENANCE_WINDOW_TAGS"]; tagsDefined {
+		result.MaintenanceWindowTags = splitList(tags)
+	}
+
+	if duration, durationDefined := env["K6_DYNATRACE_MAINTENANCE_WINDOW_DURATION"]; durationDefined {
+		if err := result.MaintenanceWindowDuration.UnmarshalText([]byte(duration)); err != nil {
+			return result, err
+		}
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_SUMMARY"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.Summary = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_LOGS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.Logs = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_FAILURE_LOGS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.FailureLogs = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_BUCKET"]; vDefined {
+		result.Bucket = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_SECURITY_CONTEXT"]; vDefined {
+		result.SecurityContext = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_EXPORT_FORMAT"]; vDefined {
+		result.ExportFormat = null.StringFrom(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_TRACES"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.Traces = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_TRACE_IDS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.TraceIDs = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_BIZEVENTS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.BizEvents = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_BIZEVENTS_TAG_PREFIX"]; vDefined {
+		result.BizEventsTagPrefix = null.StringFrom(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_SLOS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.Slos = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_SLO_TARGET"]; vDefined {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return result, fmt.Errorf("K6_DYNATRACE_SLO_TARGET: %w", err)
+		}
+		result.SloTarget = null.FloatFrom(f)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_SLO_WARNING"]; vDefined {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return result, fmt.Errorf("K6_DYNATRACE_SLO_WARNING: %w", err)
+		}
+		result.SloWarning = null.FloatFrom(f)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_SLO_TIMEFRAME"]; vDefined {
+		result.SloTimeframe = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_METRIC_EVENTS"]; vDefined {
+		result.MetricEvents = splitList(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_THRESHOLD_METRIC_EVENTS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.ThresholdMetricEvents = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_CREATE_DASHBOARD"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.CreateDashboard = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_INGEST_MODE"]; vDefined {
+		result.IngestMode = null.StringFrom(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_USE_DT_ENV"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.UseDynatraceEnv = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_K8S_METADATA"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.K8sMetadata = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_CLOUD_METADATA"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.CloudMetadata = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_HOST_METADATA"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.HostMetadata = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_DISTRIBUTED"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.Distributed = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_INSTANCE_ID"]; vDefined {
+		result.InstanceID = null.StringFrom(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_INSTANCE_AGGREGATES"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.InstanceAggregates = b
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_GROUP_LEVELS"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.GroupLevels = i
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_CHECK_METRICS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.CheckMetrics = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_ERROR_DIMENSIONS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.ErrorDimensions = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_STATUS_CLASSES"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.StatusClasses = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_BROWSER_METRICS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.BrowserMetrics = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_PROTOCOL_DIMENSIONS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.ProtocolDimensions = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_VALIDATE_ONLY"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.ValidateOnly = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_TLS_MIN_VERSION"]; vDefined {
+		result.TLSMinVersion = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_TLS_CIPHER_SUITES"]; vDefined {
+		result.TLSCipherSuites = splitList(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_SERVER_NAME"]; vDefined {
+		result.ServerName = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_CONNECT_TO"]; vDefined {
+		result.ConnectTo = null.StringFrom(v)
+	}
+
+	if aliases, aliasesDefined := env["K6_DYNATRACE_HOST_ALIASES"]; aliasesDefined {
+		envAliases, err := splitKeyValues(aliases)
+		if err != nil {
+			return result, fmt.Errorf("K6_DYNATRACE_HOST_ALIASES: %w", err)
+		}
+		if result.HostAliases == nil {
+			result.HostAliases = make(map[string]string)
+		}
+		for k, v := range envAliases {
+			result.HostAliases[k] = v
+		}
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_DNS_SERVER"]; vDefined {
+		result.DNSServer = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_NETWORK_FAMILY"]; vDefined {
+		result.NetworkFamily = null.StringFrom(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_DEBUG_TRANSPORT"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.DebugTransport = b
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_PAYLOAD_DUMP_BYTES"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.PayloadDumpBytes = i
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_PAYLOAD_DUMP_LINES"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.PayloadDumpLines = i
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_SELF_MONITORING"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.SelfMonitoring = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_HEARTBEAT"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.Heartbeat = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_LOG_LEVEL"]; vDefined {
+		result.LogLevel = null.StringFrom(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_QUIET"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.Quiet = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_LOG_FORMAT"]; vDefined {
+		result.LogFormat = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_STATS_ADDRESS"]; vDefined {
+		result.StatsAddress = null.StringFrom(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_FAIL_TEST_ON_EXPORT_ERROR"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.FailTestOnExportError = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_FAIL_TEST_ERROR_RATE"]; vDefined {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return result, fmt.Errorf("K6_DYNATRACE_FAIL_TEST_ERROR_RATE: %w", err)
+		}
+		result.FailTestErrorRate = null.FloatFrom(f)
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_FAIL_TEST_CONSECUTIVE_FAILURES"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.FailTestConsecutiveFailures = i
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_STREAM_PAYLOAD"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.StreamPayload = b
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_MAX_MEMORY_BYTES"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.MaxMemoryBytes = i
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_VALIDATE_LINES"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.ValidateLines = b
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_MAX_RETRIES"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.MaxRetries = i
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_RETRY_ON_STATUS_CODES"]; vDefined {
+		codes, err := parseStatusCodes(splitList(v))
+		if err != nil {
+			return result, fmt.Errorf("K6_DYNATRACE_RETRY_ON_STATUS_CODES: %w", err)
+		}
+		result.RetryOnStatusCodes = codes
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_MAX_RETRY_ELAPSED_TIME"]; vDefined {
+		if err := result.MaxRetryElapsedTime.UnmarshalText([]byte(v)); err != nil {
+			return result, err
+		}
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_RETRY_EXHAUSTED_POLICY"]; vDefined {
+		result.RetryExhaustedPolicy = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_SPOOL_DIR"]; vDefined {
+		result.SpoolDir = null.StringFrom(v)
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_MAX_LINES_PER_REQUEST"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.MaxLinesPerRequest = i
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_MAX_BYTES_PER_REQUEST"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.MaxBytesPerRequest = i
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_COMPRESSION"]; vDefined {
+		result.Compression = null.StringFrom(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_FORCE_HTTP1"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.ForceHTTP1 = b
+	}
+
+	if i, err := getEnvInt(env, "K6_DYNATRACE_MAX_SAMPLES_PER_FLUSH"); err != nil {
+		return result, err
+	} else if i.Valid {
+		result.MaxSamplesPerFlush = i
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_SAMPLE_DROP_POLICY"]; vDefined {
+		result.SampleDropPolicy = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_METRIC_PRIORITY"]; vDefined {
+		result.MetricPriority = splitList(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_CRITICAL_METRICS"]; vDefined {
+		result.CriticalMetrics = splitList(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_BEST_EFFORT_METRICS"]; vDefined {
+		result.BestEffortMetrics = splitList(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_OMIT_AGGREGATE_TIMESTAMPS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.OmitAggregateTimestamps = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_METRICS_SOURCE"]; vDefined {
+		result.MetricsSource = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_ENVIRONMENT"]; vDefined {
+		result.Environment = null.StringFrom(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_STAGE"]; vDefined {
+		result.Stage = null.StringFrom(v)
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_GROUP_ROLLUPS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.GroupRollups = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_SUBMETRIC_DIMENSIONS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.SubmetricDimensions = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_SUBMETRIC_NAMES"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.SubmetricNames = b
+	}
+
+	if b, err := getEnvBool(env, "K6_DYNATRACE_CUMULATIVE_COUNTERS"); err != nil {
+		return result, err
+	} else if b.Valid {
+		result.CumulativeCounters = b
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_APDEX"]; vDefined {
+		result.Apdex = splitList(v)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_BURN_RATE_TARGET"]; vDefined {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return result, fmt.Errorf("K6_DYNATRACE_BURN_RATE_TARGET: %w", err)
+		}
+		result.BurnRateTarget = null.FloatFrom(f)
+	}
+
+	if v, vDefined := env["K6_DYNATRACE_ROLLING_PERCENTILES"]; vDefined {
+		result.RollingPercentiles = splitList(v)
+	}
+
+	// relabel rules are too structured for key=value pairs, the env var holds the JSON array
+	if relabel, relabelDefined := env["K6_DYNATRACE_RELABEL_CONFIGS"]; relabelDefined {
+		var relabelConfigs []RelabelConfig
+		if err := json.Unmarshal([]byte(relabel), &relabelConfigs); err != nil {
+			return result, fmt.Errorf("K6_DYNATRACE_RELABEL_CONFIGS: %w", err)
+		}
+		result.RelabelConfigs = relabelConfigs
+	}
+
+	if dims, dimsDefined := env["K6_DYNATRACE_DIMENSIONS"]; dimsDefined {
+		envDims, err := splitKeyValues(dims)
+		if err != nil {
+			return result, fmt.Errorf("K6_DYNATRACE_DIMENSIONS: %w", err)
+		}
+		for k, v := range envDims {
+			result.Dimensions[k] = v
+		}
+	}
+
+	if arg != "" {
+		result = result.Apply(argConf)
+	}
+
+	detectCIDeployment(&result, env)
+	if result.UseDynatraceEnv.Bool {
+		applyDynatraceEnv(&result, env)
+	}
+	if result.K8sMetadata.Bool {
+		addK8sDimensions(&result, env)
+	}
+
+	// static dimension values may reference the environment, e.g. build=${BUILD_ID}
+	for k, v := range result.Dimensions {
+		result.Dimensions[k] = os.Expand(v, func(name string) string {
+			return env[name]
+		})
 	}
 
 	return result, nil
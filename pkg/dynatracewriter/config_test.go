@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.k6.io/k6/lib/types"
 	"gopkg.in/guregu/null.v3"
 )
@@ -16,10 +17,10 @@ func TestApply(t *testing.T) {
 	t.Parallel()
 
 	fullConfig := Config{
-		Url:                   null.StringFrom("some-url"),
+		Url:                   "some-url",
 		InsecureSkipTLSVerify: null.BoolFrom(false),
 		CACert:                null.StringFrom("some-file"),
-		ApiToken:                  null.StringFrom("user"),
+		ApiToken:              null.StringFrom("user"),
 		FlushPeriod:           types.NullDurationFrom(10 * time.Second),
 		Headers: map[string]string{
 			"X-Header": "value",
@@ -39,7 +40,7 @@ func TestApply(t *testing.T) {
 	// Defaults shouldn't be impacted by invalid values
 	c = NewConfig()
 	c = c.Apply(Config{
-		ApiToken:                  null.NewString("user", false),
+		ApiToken:              null.NewString("user", false),
 		InsecureSkipTLSVerify: null.NewBool(false, false),
 	})
 	assert.Equal(t, false, c.ApiToken.Valid)
@@ -51,58 +52,98 @@ func TestConfigParseArg(t *testing.T) {
 
 	c, err := ParseArg("url=https://bix24852.dev.dynatracelabs.com")
 	assert.Nil(t, err)
-	assert.Equal(t, null.StringFrom("https://bix24852.dev.dynatracelabs.com/"), c.Url)
+	assert.Equal(t, "https://bix24852.dev.dynatracelabs.com", c.Url)
 
 	c, err = ParseArg("url=https://bix24852.dev.dynatracelabs.com,insecureSkipTLSVerify=false")
 	assert.Nil(t, err)
-	assert.Equal(t, null.StringFrom("https://bix24852.dev.dynatracelabs.com"), c.Url)
+	assert.Equal(t, "https://bix24852.dev.dynatracelabs.com", c.Url)
 	assert.Equal(t, null.BoolFrom(false), c.InsecureSkipTLSVerify)
 
 	c, err = ParseArg("url=https://bix24852.dev.dynatracelabs.com,caCertFile=f.crt")
 	assert.Nil(t, err)
-	assert.Equal(t, null.StringFrom("https://bix24852.dev.dynatracelabs.com"), c.Url)
+	assert.Equal(t, "https://bix24852.dev.dynatracelabs.com", c.Url)
 	assert.Equal(t, null.StringFrom("f.crt"), c.CACert)
 
 	c, err = ParseArg("url=https://bix24852.dev.dynatracelabs.com,insecureSkipTLSVerify=false,caCertFile=f.crt,apitoken=dede")
 	assert.Nil(t, err)
-	assert.Equal(t, null.StringFrom("https://bix24852.dev.dynatracelabs.com"), c.Url)
+	assert.Equal(t, "https://bix24852.dev.dynatracelabs.com", c.Url)
 	assert.Equal(t, null.BoolFrom(false), c.InsecureSkipTLSVerify)
 	assert.Equal(t, null.StringFrom("f.crt"), c.CACert)
-	assert.Equal(t, null.StringFrom("apitoken"), c.ApiToken)
-
+	assert.Equal(t, null.StringFrom("dede"), c.ApiToken)
 
 	c, err = ParseArg("url=https://bix24852.dev.dynatracelabs.com,flushPeriod=2s")
 	assert.Nil(t, err)
-	assert.Equal(t, null.StringFrom("https://bix24852.dev.dynatracelabs.com"), c.Url)
+	assert.Equal(t, "https://bix24852.dev.dynatracelabs.com", c.Url)
 	assert.Equal(t, types.NullDurationFrom(time.Second*2), c.FlushPeriod)
 
 	c, err = ParseArg("url=https://bix24852.dev.dynatracelabs.com,headers.X-Header=value")
 	assert.Nil(t, err)
-	assert.Equal(t, null.StringFrom("http://prometheus.remote:3412/write"), c.Url)
+	assert.Equal(t, "https://bix24852.dev.dynatracelabs.com", c.Url)
 	assert.Equal(t, map[string]string{"X-Header": "value"}, c.Headers)
+
+	c, err = ParseArg("tagsAsDimensions={scenario,status},excludeTags=vu")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"scenario", "status"}, c.TagsAsDimensions)
+	assert.Equal(t, []string{"vu"}, c.ExcludeTags)
+
+	c, err = ParseArg("urlGroups=/users/[0-9]+ => /users/{id}; /orders/[0-9]+ => /orders/{id},useNameTagForUrl=false")
+	assert.Nil(t, err)
+	assert.Equal(t, []UrlGroup{
+		{Pattern: "/users/[0-9]+", Replacement: "/users/{id}"},
+		{Pattern: "/orders/[0-9]+", Replacement: "/orders/{id}"},
+	}, c.UrlGroups)
+	assert.Equal(t, null.BoolFrom(false), c.UseNameTagForUrl)
+
+	_, err = ParseArg("urlGroups=/users/[0-9]+")
+	assert.Error(t, err)
+
+	c, err = ParseArg("maxSeries=5000,cardinalityPolicy=drop")
+	assert.Nil(t, err)
+	assert.Equal(t, null.IntFrom(5000), c.MaxSeries)
+	assert.Equal(t, null.StringFrom("drop"), c.CardinalityPolicy)
+}
+
+func TestParseArgTypes(t *testing.T) {
+	t.Parallel()
+
+	c, err := ParseArg("timeout=10s,apitoken=12345,testRunId=42,sloTarget=99,dimensions.build=7,metricsInclude={http_req_.*,checks}")
+	require.NoError(t, err)
+	assert.Equal(t, types.NullDurationFrom(10*time.Second), c.Timeout)
+	assert.Equal(t, null.StringFrom("12345"), c.ApiToken)
+	assert.Equal(t, null.StringFrom("42"), c.TestRunID)
+	assert.Equal(t, null.FloatFrom(99), c.SloTarget)
+	assert.Equal(t, map[string]string{"build": "7"}, c.Dimensions)
+	assert.Equal(t, []string{"http_req_.*", "checks"}, c.MetricsInclude)
+
+	_, err = ParseArg("url=http://localhost,flushPeriods=2s,keepTags=yes,headers=x")
+	require.Error(t, err)
+	assert.Equal(t, `invalid output-dynatrace argument: unknown option "flushPeriods"; `+
+		`headers: expected headers.<key>=<value>; keepTags: expected true or false, got yes`, err.Error())
+
+	_, err = ParseArg("relabelConfigs=x")
+	assert.Error(t, err)
 }
 
-// testing both GetConsolidatedConfig and ConstructRemoteConfig here until it's future config refactor takes shape (k6 #883)
-func TestConstructRemoteConfig(t *testing.T) {
+// testing GetConsolidatedConfig here until it's future config refactor takes shape (k6 #883)
+func TestGetConsolidatedConfig(t *testing.T) {
 	u, _ := url.Parse("https://bix24852.dev.dynatracelabs.com")
 
 	t.Parallel()
 
 	testCases := map[string]struct {
-		jsonRaw      json.RawMessage
-		env          map[string]string
-		arg          string
-		config       Config
-		errString    string
-		remoteConfig *remote.ClientConfig
+		jsonRaw   json.RawMessage
+		env       map[string]string
+		arg       string
+		config    Config
+		errString string
 	}{
 		"json_success": {
 			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
 			env:     nil,
 			arg:     "",
 			config: Config{
-				Url:                   null.StringFrom(u.String()),
-				InsecureSkipTLSVerify: null.BoolFrom(true),
+				Url:                   u.String(),
+				InsecureSkipTLSVerify: null.BoolFrom(false),
 				CACert:                null.NewString("", false),
 				ApiToken:              null.NewString("", false),
 				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
@@ -112,17 +153,33 @@ func TestConstructRemoteConfig(t *testing.T) {
 				Headers:               make(map[string]string),
 			},
 			errString: "",
-
 		},
 		"mixed_success": {
 			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
 			env:     map[string]string{"K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY": "false", "K6_DYNATRACE_APITOKEN": "u"},
 			arg:     "apitoken=user",
 			config: Config{
-				Url:                   null.StringFrom(u.String()),
+				Url:                   u.String(),
 				InsecureSkipTLSVerify: null.BoolFrom(false),
 				CACert:                null.NewString("", false),
-                ApiToken:              null.NewString("apitoken", true),
+				ApiToken:              null.StringFrom("user"),
+				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
+				KeepTags:              null.BoolFrom(true),
+				KeepNameTag:           null.BoolFrom(false),
+				KeepUrlTag:            null.BoolFrom(true),
+				Headers:               make(map[string]string),
+			},
+			errString: "",
+		},
+		"insecure_opt_in": {
+			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
+			env:     map[string]string{"K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY": "true"},
+			arg:     "",
+			config: Config{
+				Url:                   u.String(),
+				InsecureSkipTLSVerify: null.BoolFrom(true),
+				CACert:                null.NewString("", false),
+				ApiToken:              null.NewString("", false),
 				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
 				KeepTags:              null.BoolFrom(true),
 				KeepNameTag:           null.BoolFrom(false),
@@ -130,33 +187,52 @@ func TestConstructRemoteConfig(t *testing.T) {
 				Headers:               make(map[string]string),
 			},
 			errString: "",
-
 		},
 		"invalid_duration": {
-			jsonRaw:      json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
-			env:          map[string]string{"K6_DYNATRACE_FLUSH_PERIOD": "d"},
-			arg:          "",
-			config:       Config{},
-			errString:    "strconv.ParseInt",
-			remoteConfig: nil,
+			jsonRaw:   json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
+			env:       map[string]string{"K6_DYNATRACE_FLUSH_PERIOD": "d"},
+			arg:       "",
+			config:    Config{},
+			errString: "strconv.ParseInt",
 		},
 		"invalid_insecureSkipTLSVerify": {
-			jsonRaw:      json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
-			env:          map[string]string{"K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY": "d"},
-			arg:          "",
-			config:       Config{},
-			errString:    "strconv.ParseBool",
-			remoteConfig: nil,
+			jsonRaw:   json.RawMessage(fmt.Sprintf(`{"url":"%s"}`, u.String())),
+			env:       map[string]string{"K6_DYNATRACE_INSECURE_SKIP_TLS_VERIFY": "d"},
+			arg:       "",
+			config:    Config{},
+			errString: "strconv.ParseBool",
+		},
+		"tag_lists_env": {
+			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s", "excludeTags":["iter"]}`, u.String())),
+			env: map[string]string{
+				"K6_DYNATRACE_TAGS_AS_DIMENSIONS": "scenario, status",
+				"K6_DYNATRACE_EXCLUDE_TAGS":       "vu,^x_.*",
+			},
+			arg: "",
+			config: Config{
+				Url:                   u.String(),
+				InsecureSkipTLSVerify: null.BoolFrom(false),
+				CACert:                null.NewString("", false),
+				ApiToken:              null.NewString("", false),
+				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
+				KeepTags:              null.BoolFrom(true),
+				KeepNameTag:           null.BoolFrom(false),
+				KeepUrlTag:            null.BoolFrom(true),
+				Headers:               make(map[string]string),
+				TagsAsDimensions:      []string{"scenario", "status"},
+				ExcludeTags:           []string{"vu", "^x_.*"},
+			},
+			errString: "",
 		},
 		"remote_write_with_headers_json": {
 			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s", "headers":{"X-Header":"value"}}`, u.String())),
 			env:     nil,
 			arg:     "",
 			config: Config{
-				Url:                   null.StringFrom(u.String()),
-				InsecureSkipTLSVerify: null.BoolFrom(true),
+				Url:                   u.String(),
+				InsecureSkipTLSVerify: null.BoolFrom(false),
 				CACert:                null.NewString("", false),
-				ApiToken:                  null.NewString("", false),
+				ApiToken:              null.NewString("", false),
 				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
 				KeepTags:              null.BoolFrom(true),
 				KeepNameTag:           null.BoolFrom(false),
@@ -166,19 +242,18 @@ func TestConstructRemoteConfig(t *testing.T) {
 				},
 			},
 			errString: "",
-
 		},
 		"remote_write_with_headers_env": {
 			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s", "headers":{"X-Header":"value"}}`, u.String())),
 			env: map[string]string{
-				"K6_DYNATRACE_HEADER": "value_from_env",
+				"K6_DYNATRACE_HEADERX-Header": "value_from_env",
 			},
 			arg: "",
 			config: Config{
-				Url:                   null.StringFrom(u.String()),
-				InsecureSkipTLSVerify: null.BoolFrom(true),
+				Url:                   u.String(),
+				InsecureSkipTLSVerify: null.BoolFrom(false),
 				CACert:                null.NewString("", false),
-				ApiToken:                  null.NewString("", false),
+				ApiToken:              null.NewString("", false),
 				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
 				KeepTags:              null.BoolFrom(true),
 				KeepNameTag:           null.BoolFrom(false),
@@ -188,19 +263,18 @@ func TestConstructRemoteConfig(t *testing.T) {
 				},
 			},
 			errString: "",
-
 		},
 		"remote_write_with_headers_arg": {
 			jsonRaw: json.RawMessage(fmt.Sprintf(`{"url":"%s", "headers":{"X-Header":"value"}}`, u.String())),
 			env: map[string]string{
-				"K6_DYNATRACE_HEADER": "value_from_env",
+				"K6_DYNATRACE_HEADERX-Header": "value_from_env",
 			},
 			arg: "headers.X-Header=value_from_arg",
 			config: Config{
-				Url:                   null.StringFrom(u.String()),
-				InsecureSkipTLSVerify: null.BoolFrom(true),
+				Url:                   u.String(),
+				InsecureSkipTLSVerify: null.BoolFrom(false),
 				CACert:                null.NewString("", false),
-				ApiToken:                  null.NewString("", false),
+				ApiToken:              null.NewString("", false),
 				FlushPeriod:           types.NullDurationFrom(defaultFlushPeriod),
 				KeepTags:              null.BoolFrom(true),
 				KeepNameTag:           null.BoolFrom(false),
@@ -210,38 +284,184 @@ func TestConstructRemoteConfig(t *testing.T) {
 				},
 			},
 			errString: "",
-
-			},
 		},
 	}
 
 	for name, testCase := range testCases {
 		testCase := testCase
 		t.Run(name, func(t *testing.T) {
-			c, err := GetConsolidatedConfig(testCase.jsonRaw, testCase.env, testCase.arg)
+			c, err := GetConsolidatedConfig(testCase.jsonRaw, nil, testCase.env, testCase.arg)
 			if len(testCase.errString) > 0 {
 				assert.Contains(t, err.Error(), testCase.errString)
 				return
 			}
 			assertConfig(t, c, testCase.config)
-
-			// there can be error only on url.Parse at the moment so skipping that
-			remoteConfig, _ := c.ConstructRemoteConfig()
-			assertRemoteConfig(t, remoteConfig, testCase.remoteConfig)
 		})
 	}
 }
 
 func assertConfig(t *testing.T, actual, expected Config) {
-	assert.Equal(t, expected.Mapping, actual.Mapping)
 	assert.Equal(t, expected.Url, actual.Url)
 	assert.Equal(t, expected.InsecureSkipTLSVerify, actual.InsecureSkipTLSVerify)
 	assert.Equal(t, expected.CACert, actual.CACert)
 	assert.Equal(t, expected.ApiToken, actual.ApiToken)
 	assert.Equal(t, expected.FlushPeriod, actual.FlushPeriod)
 	assert.Equal(t, expected.KeepTags, actual.KeepTags)
-	assert.Equal(t, expected.KeepNameTag, expected.KeepNameTag)
-	assert.Equal(t, expected.KeepUrlTag, expected.KeepUrlTag)
+	assert.Equal(t, expected.KeepNameTag, actual.KeepNameTag)
+	assert.Equal(t, expected.KeepUrlTag, actual.KeepUrlTag)
 	assert.Equal(t, expected.Headers, actual.Headers)
+	assert.Equal(t, expected.TagsAsDimensions, actual.TagsAsDimensions)
+	assert.Equal(t, expected.ExcludeTags, actual.ExcludeTags)
 }
 
+func TestScriptConfig(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(
+		json.RawMessage(`{"metricPrefix":"json.","dimensions":{"team":"payments"}}`),
+		json.RawMessage(`{
+			"metricPrefix": "script.",
+			"headers": {"X-Test": "checkout"},
+			"dimensions": {"env": "staging"},
+			"metricsInclude": ["http_req_.*"]
+		}`),
+		map[string]string{"K6_DYNATRACE_DIMENSIONS": "env=prod"},
+		"",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom("script."), c.MetricPrefix)
+	assert.Equal(t, "checkout", c.Headers["X-Test"])
+	assert.Equal(t, map[string]string{"team": "payments", "env": "prod"}, c.Dimensions)
+	assert.Equal(t, []string{"http_req_.*"}, c.MetricsInclude)
+
+	_, err = GetConsolidatedConfig(nil, json.RawMessage(`{"keepTags":"yes"}`), nil, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid options.ext.dynatrace")
+}
+
+func TestConsolidatedDimensions(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(
+		json.RawMessage(`{"dimensions":{"team":"payments","region":"${REGION}"}}`),
+		nil,
+		map[string]string{
+			"K6_DYNATRACE_DIMENSIONS": "env=prod, build=${BUILD_ID}",
+			"BUILD_ID":                "42",
+			"REGION":                  "eu-west-1",
+		},
+		"dimensions.team=checkout",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"env":    "prod",
+		"build":  "42",
+		"team":   "checkout",
+		"region": "eu-west-1",
+	}, c.Dimensions)
+
+	_, err = GetConsolidatedConfig(nil, nil, map[string]string{"K6_DYNATRACE_DIMENSIONS": "env"}, "")
+	assert.Error(t, err)
+}
+
+func TestConstructConfigTestRunID(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.ApiToken = null.StringFrom("token")
+	constructed, err := c.ConstructConfig()
+	require.NoError(t, err)
+	assert.True(t, constructed.TestRunID.Valid)
+	assert.Len(t, constructed.TestRunID.String, 16)
+
+	c = NewConfig()
+	c.ApiToken = null.StringFrom("token")
+	c.TestRunID = null.StringFrom("run-42")
+	constructed, err = c.ConstructConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "run-42", constructed.TestRunID.String)
+}
+
+func TestConstructConfigIngestMode(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	_, err := c.ConstructConfig()
+	assert.Error(t, err, "the api mode needs a token")
+
+	c = NewConfig()
+	c.IngestMode = null.StringFrom(ingestModeLocal)
+	constructed, err := c.ConstructConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:14499/metrics/ingest", constructed.Url)
+	assert.Equal(t, "http://localhost:14499"+defaultDynatraceEventsEndPoint, constructed.apiUrl(defaultDynatraceEventsEndPoint))
+	assert.NotContains(t, constructed.Headers, "Authorization")
+
+	c = NewConfig()
+	c.IngestMode = null.StringFrom(ingestModeLocal)
+	c.Url = "http://127.0.0.1:9999"
+	constructed, err = c.ConstructConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:9999/metrics/ingest", constructed.Url)
+	assert.Equal(t, "http://127.0.0.1:9999"+defaultDynatraceEventsEndPoint, constructed.apiUrl(defaultDynatraceEventsEndPoint))
+
+	c = NewConfig()
+	c.IngestMode = null.StringFrom("remote")
+	_, err = c.ConstructConfig()
+	assert.Error(t, err)
+}
+
+func TestConsolidatedRelabelConfigs(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, nil, map[string]string{
+		"K6_DYNATRACE_RELABEL_CONFIGS": `[{"sourceDimensions":["status"],"regex":"5..","action":"drop"}]`,
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []RelabelConfig{{SourceDimensions: []string{"status"}, Regex: "5..", Action: "drop"}}, c.RelabelConfigs)
+
+	_, err = GetConsolidatedConfig(nil, nil, map[string]string{"K6_DYNATRACE_RELABEL_CONFIGS": "status=drop"}, "")
+	assert.Error(t, err)
+}
+
+func TestConsolidatedMetricNaming(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, nil, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom("k6."), c.MetricPrefix)
+
+	c, err = GetConsolidatedConfig(
+		json.RawMessage(`{"metricRenames":{"vus":"loadtest.users"}}`),
+		nil,
+		map[string]string{
+			"K6_DYNATRACE_METRIC_PREFIX":  "perf.",
+			"K6_DYNATRACE_METRIC_RENAMES": "http_req_duration=loadtest.request.latency",
+		},
+		"metricRenames.iterations=loadtest.iterations",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom("perf."), c.MetricPrefix)
+	assert.Equal(t, map[string]string{
+		"vus":               "loadtest.users",
+		"http_req_duration": "loadtest.request.latency",
+		"iterations":        "loadtest.iterations",
+	}, c.MetricRenames)
+}
+
+func TestUserAgentHeader(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.ApiToken = null.StringFrom("token")
+	constructed, err := c.ConstructConfig()
+	require.NoError(t, err)
+	assert.Regexp(t, `^xk6-output-dynatrace/\S+ k6/v\d+\.\d+\.\d+`, constructed.Headers["User-Agent"])
+
+	c = NewConfig()
+	c.ApiToken = null.StringFrom("token")
+	c.Headers = map[string]string{"user-agent": "custom"}
+	constructed, err = c.ConstructConfig()
+	require.NoError(t, err)
+	assert.NotContains(t, constructed.Headers, "User-Agent")
+}
@@ -0,0 +1,67 @@
+package dynatracewriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the content of the config file: the settings shared by
+// all the profiles, and the named profiles overriding them, e.g. one per
+// Dynatrace environment.
+type configFile struct {
+	Config
+	Profiles map[string]Config `json:"profiles"`
+}
+
+// loadConfigFile reads the output configuration from a YAML or JSON file,
+// using the JSON config keys.
+func loadConfigFile(path string) (*configFile, error) {
+	file := &configFile{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the config file: %w", err)
+	}
+
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		// the Config only has JSON tags, so the YAML goes through JSON
+		var doc map[string]interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(file); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// profile returns the settings of the named profile, none when name is
+// empty.
+func (f *configFile) profile(name string) (Config, error) {
+	if name == "" {
+		return Config{}, nil
+	}
+	profile, ok := f.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(f.Profiles))
+		for name := range f.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Config{}, fmt.Errorf("unknown profile %q, the config file defines %s", name, strings.Join(names, ", "))
+	}
+	return profile, nil
+}
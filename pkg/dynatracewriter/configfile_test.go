@@ -0,0 +1,104 @@
+package dynatracewriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestConfigFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "dynatrace.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+url: https://abc12345.live.dynatrace.com
+flushPeriod: 5s
+keepTags: false
+headers:
+  X-Team: checkout
+dimensions:
+  env: staging
+metricsInclude:
+  - http_req_.*
+relabelConfigs:
+  - sourceDimensions: [status]
+    regex: "5.."
+    action: drop
+`), 0o600))
+
+	c, err := GetConsolidatedConfig(nil, nil, map[string]string{
+		"K6_DYNATRACE_CONFIG":     path,
+		"K6_DYNATRACE_DIMENSIONS": "env=prod",
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://abc12345.live.dynatrace.com", c.Url)
+	assert.Equal(t, "5s", c.FlushPeriod.String())
+	assert.Equal(t, null.BoolFrom(false), c.KeepTags)
+	assert.Equal(t, "checkout", c.Headers["X-Team"])
+	assert.Equal(t, "prod", c.Dimensions["env"])
+	assert.Equal(t, []string{"http_req_.*"}, c.MetricsInclude)
+	assert.Len(t, c.RelabelConfigs, 1)
+
+	c, err = GetConsolidatedConfig(nil, nil, nil, "configFile="+path+",url=http://localhost")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost", c.Url)
+	assert.Equal(t, "5s", c.FlushPeriod.String())
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	_, err := loadConfigFile(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+
+	path := filepath.Join(dir, "dynatrace.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"flushPeriods":"5s"}`), 0o600))
+	_, err = loadConfigFile(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "flushPeriods")
+}
+
+func TestConfigFileProfiles(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "dynatrace.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+profile: staging
+flushPeriod: 5s
+dimensions:
+  team: checkout
+profiles:
+  staging:
+    url: https://staging.live.dynatrace.com
+    dimensions:
+      stage: staging
+  prod:
+    url: https://prod.live.dynatrace.com
+    flushPeriod: 10s
+`), 0o600))
+
+	c, err := GetConsolidatedConfig(nil, nil, map[string]string{"K6_DYNATRACE_CONFIG": path}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://staging.live.dynatrace.com", c.Url)
+	assert.Equal(t, map[string]string{"team": "checkout", "stage": "staging"}, c.Dimensions)
+
+	c, err = GetConsolidatedConfig(nil, nil, map[string]string{
+		"K6_DYNATRACE_CONFIG":  path,
+		"K6_DYNATRACE_PROFILE": "prod",
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://prod.live.dynatrace.com", c.Url)
+	assert.Equal(t, "10s", c.FlushPeriod.String())
+
+	_, err = GetConsolidatedConfig(nil, nil, map[string]string{"K6_DYNATRACE_CONFIG": path}, "profile=dev")
+	require.Error(t, err)
+	assert.Equal(t, `unknown profile "dev", the config file defines prod, staging`, err.Error())
+
+	_, err = GetConsolidatedConfig(nil, nil, map[string]string{"K6_DYNATRACE_PROFILE": "prod"}, "")
+	assert.Error(t, err)
+}
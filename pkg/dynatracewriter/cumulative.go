@@ -0,0 +1,74 @@
+package dynatracewriter
+
+import (
+	"sort"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// cumulativeSuffix is appended to the key of a counter for its running
+// total, a Dynatrace metric key can't be both a counter and a gauge.
+const cumulativeSuffix = ".total"
+
+// counterTotal is the running total of a counter series since the test
+// started.
+type counterTotal struct {
+	line  dynatraceMetric
+	total float64
+}
+
+// counterTotals holds the counter totals by series key, it is only touched
+// by the flushing goroutine and starts empty with every test run.
+type counterTotals map[string]*counterTotal
+
+// accumulateCounter adds the value of a counter line to the total of its
+// series when cumulativeCounters is set.
+func (o *Output) accumulateCounter(m dynatraceMetric) {
+	if !o.config.CumulativeCounters.Bool || m.metricType != metrics.Counter || m.delta {
+		return
+	}
+	key := seriesKey(m.metricKeyName, m.metricDimensions)
+	if m.cached != nil {
+		key = m.cached.key
+	}
+	if o.counters == nil {
+		o.counters = make(counterTotals)
+	}
+	total, ok := o.counters[key]
+	if !ok {
+		line := m
+		// the dimensions of the cached series are never modified
+		line.cached = nil
+		line.metricKeyName += cumulativeSuffix
+		line.description = m.description + ", total since the test started"
+		line.metricType = metrics.Gauge
+		total = &counterTotal{line: line}
+		o.counters[key] = total
+	}
+	total.total += m.metricValue
+}
+
+// cumulativeMetrics returns the running total of every counter series
+// seen since the test started as a {metric}.total gauge.
+func (o *Output) cumulativeMetrics(now time.Time) []dynatraceMetric {
+	if len(o.counters) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(o.counters))
+	for key := range o.counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dynMetrics := make([]dynatraceMetric, 0, len(keys))
+	for _, key := range keys {
+		total := o.counters[key]
+		line := total.line
+		line.metricValue = total.total
+		line.metricTimeStamp = o.aggregateTimestamp(now)
+		dynMetrics = append(dynMetrics, line)
+	}
+	return dynMetrics
+}
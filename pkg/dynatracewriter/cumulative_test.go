@@ -0,0 +1,50 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestCumulativeCounters(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.CumulativeCounters = null.BoolFrom(true)
+		c.TagsAsDimensions = []string{"status"}
+	})
+	now := time.Now()
+	reqs := newMetric("http_reqs", metrics.Counter)
+	vus := newMetric("vus", metrics.Gauge)
+	sample := func(metric *metrics.Metric, status string) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: newTags(map[string]string{"status": status})},
+			Time:       now,
+			Value:      1,
+		}
+	}
+
+	o.convertToTimeDynatraceData([]metrics.SampleContainer{metrics.Samples{
+		sample(reqs, "200"), sample(reqs, "200"), sample(reqs, "500"), sample(vus, "200"),
+	}})
+	lines := o.cumulativeMetrics(now)
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"k6.http_reqs.total{200}", "k6.http_reqs.total{500}"}, metricKeys(lines))
+	assert.Equal(t, []float64{2, 1}, []float64{lines[0].metricValue, lines[1].metricValue})
+	assert.Equal(t, metrics.Gauge, lines[0].metricType)
+	assert.Contains(t, lines[0].toText(), " 2 ")
+
+	o.convertToTimeDynatraceData([]metrics.SampleContainer{metrics.Samples{sample(reqs, "200")}})
+	lines = o.cumulativeMetrics(now)
+	require.Len(t, lines, 2, "the totals are sent every flush")
+	assert.Equal(t, []float64{3, 1}, []float64{lines[0].metricValue, lines[1].metricValue})
+
+	o.config.CumulativeCounters = null.BoolFrom(false)
+	o.counters = nil
+	o.convertToTimeDynatraceData([]metrics.SampleContainer{metrics.Samples{sample(reqs, "200")}})
+	assert.Empty(t, o.cumulativeMetrics(now))
+}
@@ -0,0 +1,170 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultDynatraceDashboardsEndPoint = "/api/config/v1/dashboards"
+
+	dashboardTileWidth  = 608
+	dashboardTileHeight = 304
+)
+
+type dashboard struct {
+	Metadata dashboardMetadata `json:"dashboardMetadata"`
+	Tiles    []dashboardTile   `json:"tiles"`
+}
+
+type dashboardMetadata struct {
+	Name   string `json:"name"`
+	Shared bool   `json:"shared"`
+}
+
+type dashboardTile struct {
+	Name              string           `json:"name"`
+	TileType          string           `json:"tileType"`
+	Configured        bool             `json:"configured"`
+	Bounds            dashboardBounds  `json:"bounds"`
+	CustomName        string           `json:"customName"`
+	Queries           []dashboardQuery `json:"queries"`
+	MetricExpressions []string         `json:"metricExpressions"`
+}
+
+type dashboardBounds struct {
+	Top    int `json:"top"`
+	Left   int `json:"left"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type dashboardQuery struct {
+	ID               string          `json:"id"`
+	Metric           string          `json:"metric"`
+	SpaceAggregation string          `json:"spaceAggregation"`
+	TimeAggregation  string          `json:"timeAggregation"`
+	SplitBy          []string        `json:"splitBy"`
+	FilterBy         dashboardFilter `json:"filterBy"`
+	Enabled          bool            `json:"enabled"`
+}
+
+type dashboardFilter struct {
+	Filter         string              `json:"filter,omitempty"`
+	FilterType     string              `json:"filterType,omitempty"`
+	FilterOperator string              `json:"filterOperator"`
+	NestedFilters  []dashboardFilter   `json:"nestedFilters"`
+	Criteria       []dashboardCriteria `json:"criteria"`
+}
+
+type dashboardCriteria struct {
+	Value     string `json:"value"`
+	Evaluator string `json:"evaluator"`
+}
+
+type dashboardCreated struct {
+	ID string `json:"id"`
+}
+
+// dashboardTileQuery is a metric and aggregation shown by a tile.
+type dashboardTileQuery struct {
+	metric      string
+	aggregation string
+}
+
+// newDashboard returns the dashboard of the current test run, every tile
+// is filtered on its test_run_id.
+func (o *Output) newDashboard() dashboard {
+	runID := o.config.TestRunID.String
+	tiles := []struct {
+		name    string
+		queries []dashboardTileQuery
+	}{
+		{"Request rate", []dashboardTileQuery{{"http_reqs", "SUM"}}},
+		{"Request duration percentiles", []dashboardTileQuery{
+			{"http_req_duration", "PERCENTILE_50"},
+			{"http_req_duration", "PERCENTILE_90"},
+			{"http_req_duration", "PERCENTILE_95"},
+		}},
+		{"Error rate", []dashboardTileQuery{{"http_req_failed", "AVG"}}},
+		{"Virtual users", []dashboardTileQuery{{"vus", "MAX"}}},
+	}
+
+	result := dashboard{Metadata: dashboardMetadata{Name: "k6 load test " + runID, Shared: true}}
+	for i, tile := range tiles {
+		t := dashboardTile{
+			Name:       "Data explorer results",
+			TileType:   "DATA_EXPLORER",
+			Configured: true,
+			Bounds: dashboardBounds{
+				Top:    (i / 2) * dashboardTileHeight,
+				Left:   (i % 2) * dashboardTileWidth,
+				Width:  dashboardTileWidth,
+				Height: dashboardTileHeight,
+			},
+			CustomName: tile.name,
+		}
+		for j, q := range tile.queries {
+			key := o.metricKey(q.metric)
+			t.Queries = append(t.Queries, dashboardQuery{
+				ID:               string(rune('A' + j)),
+				Metric:           key,
+				SpaceAggregation: q.aggregation,
+				TimeAggregation:  "DEFAULT",
+				SplitBy:          []string{},
+				FilterBy: dashboardFilter{
+					FilterOperator: "AND",
+					NestedFilters: []dashboardFilter{{
+						Filter:         testRunIDDimension,
+						FilterType:     "DIMENSION",
+						FilterOperator: "OR",
+						NestedFilters:  []dashboardFilter{},
+						Criteria:       []dashboardCriteria{{Value: runID, Evaluator: "EQ"}},
+					}},
+					Criteria: []dashboardCriteria{},
+				},
+				Enabled: true,
+			})
+			t.MetricExpressions = append(t.MetricExpressions, fmt.Sprintf(
+				`resolution=null&(%s:filter(eq(%s,"%s")):splitBy():%s):names`,
+				key, testRunIDDimension, escapeSelector(runID), dashboardAggregation(q.aggregation)))
+		}
+		result.Tiles = append(result.Tiles, t)
+	}
+	return result
+}
+
+// dashboardAggregation converts a space aggregation into its metric
+// selector form, e.g. PERCENTILE_95 into percentile(95).
+func dashboardAggregation(aggregation string) string {
+	if p := strings.TrimPrefix(aggregation, "PERCENTILE_"); p != aggregation {
+		return "percentile(" + p + ")"
+	}
+	return strings.ToLower(aggregation)
+}
+
+// createDashboard creates the dashboard of the test run and logs its url.
+func (o *Output) createDashboard() {
+	if !o.config.CreateDashboard.Bool {
+		return
+	}
+
+	body, err := json.Marshal(o.newDashboard())
+	if err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to create the dashboard")
+		return
+	}
+	response, err := o.callAPI(http.MethodPost, defaultDynatraceDashboardsEndPoint, "application/json; charset=utf-8", body)
+	if err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to create the dashboard")
+		return
+	}
+	var created dashboardCreated
+	if err := json.Unmarshal(response, &created); err != nil || created.ID == "" {
+		o.logger.Warnf("Dynatrace: unexpected dashboard creation response: %s", string(response))
+		return
+	}
+	o.logger.WithField("url", o.config.apiUrl("/#dashboard;id="+created.ID)).Info("Dynatrace: created the test run dashboard")
+}
@@ -0,0 +1,58 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestCreateDashboard(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan dashboard, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, defaultDynatraceDashboardsEndPoint, req.URL.Path)
+		body, _ := ioutil.ReadAll(req.Body)
+		var d dashboard
+		assert.NoError(t, json.Unmarshal(body, &d))
+		received <- d
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":"dash-1","name":"k6 load test run"}`)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.CreateDashboard = null.BoolFrom(true)
+	})
+	logger, hook := test.NewNullLogger()
+	o.logger = logger
+	o.createDashboard()
+
+	d := <-received
+	assert.Equal(t, "k6 load test run", d.Metadata.Name)
+	require.Len(t, d.Tiles, 4)
+	assert.Equal(t, "Request duration percentiles", d.Tiles[1].CustomName)
+	require.Len(t, d.Tiles[1].Queries, 3)
+	assert.Equal(t, "k6.http_req_duration", d.Tiles[1].Queries[2].Metric)
+	assert.Equal(t, "PERCENTILE_95", d.Tiles[1].Queries[2].SpaceAggregation)
+	assert.Equal(t, "run", d.Tiles[1].Queries[2].FilterBy.NestedFilters[0].Criteria[0].Value)
+	assert.Equal(t, `resolution=null&(k6.http_req_duration:filter(eq(test_run_id,"run")):splitBy():percentile(95)):names`,
+		d.Tiles[1].MetricExpressions[2])
+	assert.Equal(t, dashboardTileWidth, d.Tiles[3].Bounds.Left)
+	assert.Equal(t, dashboardTileHeight, d.Tiles[3].Bounds.Top)
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, logrus.InfoLevel, entry.Level)
+	assert.Equal(t, server.URL+"/#dashboard;id=dash-1", entry.Data["url"])
+}
@@ -0,0 +1,61 @@
+package dynatracewriter
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+const eventTypeCustomDeployment = "CUSTOM_DEPLOYMENT"
+
+// detectCIDeployment fills the deployment details that were not configured
+// from the variables set by common CI systems.
+func detectCIDeployment(conf *Config, env map[string]string) {
+	var ciBackLink, commit string
+	switch {
+	case env["GITHUB_RUN_ID"] != "":
+		ciBackLink = env["GITHUB_SERVER_URL"] + "/" + env["GITHUB_REPOSITORY"] + "/actions/runs/" + env["GITHUB_RUN_ID"]
+		commit = env["GITHUB_SHA"]
+	case env["CI_JOB_URL"] != "":
+		ciBackLink = env["CI_JOB_URL"]
+		commit = env["CI_COMMIT_SHA"]
+	case env["BUILD_URL"] != "":
+		ciBackLink = env["BUILD_URL"]
+		commit = env["GIT_COMMIT"]
+	}
+
+	if !conf.DeploymentCiBackLink.Valid && ciBackLink != "" {
+		conf.DeploymentCiBackLink = null.StringFrom(ciBackLink)
+	}
+	if !conf.DeploymentCommit.Valid && commit != "" {
+		conf.DeploymentCommit = null.StringFrom(commit)
+	}
+}
+
+// sendDeploymentEvent lets Davis correlate the behavior of the services
+// under test with the load test execution.
+func (o *Output) sendDeploymentEvent(start time.Time) {
+	if !o.config.DeploymentEvent.Bool {
+		return
+	}
+
+	properties := o.testInfo.properties()
+	properties["dt.event.deployment.name"] = "k6 load test " + o.config.TestRunID.String
+	properties["dt.event.deployment.version"] = o.config.DeploymentVersion.String
+	if o.config.DeploymentCiBackLink.String != "" {
+		properties["dt.event.deployment.ci_back_link"] = o.config.DeploymentCiBackLink.String
+	}
+	if o.config.DeploymentCommit.String != "" {
+		properties["commit"] = o.config.DeploymentCommit.String
+	}
+
+	event := dynatraceEvent{
+		EventType:  eventTypeCustomDeployment,
+		Title:      "k6 load test deployment " + o.config.DeploymentVersion.String,
+		StartTime:  start.UnixMilli(),
+		Properties: properties,
+	}
+	if err := o.sendEvent(event); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to send the deployment event")
+	}
+}
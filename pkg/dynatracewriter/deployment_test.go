@@ -0,0 +1,57 @@
+package dynatracewriter
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestDetectCIDeployment(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	detectCIDeployment(&c, map[string]string{
+		"GITHUB_SERVER_URL": "https://github.com",
+		"GITHUB_REPOSITORY": "acme/shop",
+		"GITHUB_RUN_ID":     "42",
+		"GITHUB_SHA":        "abc123",
+	})
+	assert.Equal(t, null.StringFrom("https://github.com/acme/shop/actions/runs/42"), c.DeploymentCiBackLink)
+	assert.Equal(t, null.StringFrom("abc123"), c.DeploymentCommit)
+
+	c = NewConfig()
+	c.DeploymentCommit = null.StringFrom("configured")
+	detectCIDeployment(&c, map[string]string{"CI_JOB_URL": "https://gitlab/job/1", "CI_COMMIT_SHA": "def"})
+	assert.Equal(t, null.StringFrom("https://gitlab/job/1"), c.DeploymentCiBackLink)
+	assert.Equal(t, null.StringFrom("configured"), c.DeploymentCommit)
+
+	c = NewConfig()
+	detectCIDeployment(&c, map[string]string{})
+	assert.False(t, c.DeploymentCiBackLink.Valid)
+}
+
+func TestDeploymentEvent(t *testing.T) {
+	t.Parallel()
+
+	recorder := &eventRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.DeploymentEvent = null.BoolFrom(true)
+		c.DeploymentVersion = null.StringFrom("1.2.3")
+		c.DeploymentCommit = null.StringFrom("abc123")
+	})
+	o.sendDeploymentEvent(time.Now())
+
+	require.Len(t, recorder.events, 1)
+	event := recorder.events[0]
+	assert.Equal(t, eventTypeCustomDeployment, event.EventType)
+	assert.Equal(t, "1.2.3", event.Properties["dt.event.deployment.version"])
+	assert.Equal(t, "abc123", event.Properties["commit"])
+	assert.Equal(t, "run", event.Properties["test_run_id"])
+}
@@ -0,0 +1,357 @@
+package dynatracewriter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	nameTag     = "name"
+	urlTag      = "url"
+	scenarioTag = "scenario"
+	groupTag    = "group"
+	statusTag   = "status"
+	vuTag       = "vu"
+	iterTag     = "iter"
+	errorTag    = "error_code"
+
+	// expectedResponseTag tells apart the responses the script expects,
+	// e.g. the 4xx of negative tests, from the failures
+	expectedResponseTag = "expected_response"
+
+	// groupSeparator separates the nested group names in the group tag,
+	// which starts with it, e.g. "::checkout::payment"
+	groupSeparator = "::"
+
+	testRunIDDimension = "test_run_id"
+
+	// metricsSourceDimension attributes the lines to their source, e.g. in
+	// the ingest volume or the management zones of the tenant
+	metricsSourceDimension = "dt.metrics.source"
+	defaultMetricsSource   = "k6"
+
+	environmentDimension = "environment"
+	stageDimension       = "stage"
+
+	defaultHashLength = 8
+)
+
+// addSourceDimension attaches the dt.metrics.source dimension to every
+// line, unless it is disabled with an empty metricsSource. A configured
+// dimension wins.
+func (o *Output) addSourceDimension() {
+	source := o.config.MetricsSource.String
+	if source == "" {
+		return
+	}
+	if o.config.Dimensions == nil {
+		o.config.Dimensions = make(map[string]string)
+	}
+	if _, ok := o.config.Dimensions[metricsSourceDimension]; !ok {
+		o.config.Dimensions[metricsSourceDimension] = source
+	}
+}
+
+// stageDimensions returns the environment and stage dimensions of the
+// configuration, e.g. environment=staging and stage=smoke.
+func (conf *Config) stageDimensions() map[string]string {
+	dims := make(map[string]string, 2)
+	if conf.Environment.String != "" {
+		dims[environmentDimension] = conf.Environment.String
+	}
+	if conf.Stage.String != "" {
+		dims[stageDimension] = conf.Stage.String
+	}
+	return dims
+}
+
+// addStageDimensions attaches the environment and stage dimensions to
+// every line, they win over the configured dimensions of the same name.
+func (o *Output) addStageDimensions() {
+	dims := o.config.stageDimensions()
+	if len(dims) == 0 {
+		return
+	}
+	o.config.Dimensions = addDimensions(o.config.Dimensions, dims)
+}
+
+// tagFilter decides which k6 sample tags are exported as Dynatrace dimensions.
+type tagFilter struct {
+	keepTags        bool
+	keepNameTag     bool
+	keepUrlTag      bool
+	keepVuTag       bool
+	keepIterTag     bool
+	keepScenarioTag bool
+	allow           map[string]struct{}
+	deny            []*regexp.Regexp
+}
+
+func newTagFilter(conf *Config) (*tagFilter, error) {
+	f := &tagFilter{
+		keepTags:        conf.KeepTags.Bool,
+		keepNameTag:     conf.KeepNameTag.Bool,
+		keepUrlTag:      conf.KeepUrlTag.Bool,
+		keepVuTag:       conf.KeepVuTag.Bool,
+		keepIterTag:     conf.KeepIterTag.Bool,
+		keepScenarioTag: conf.KeepScenarioTag.Bool,
+	}
+
+	if len(conf.TagsAsDimensions) > 0 {
+		f.allow = make(map[string]struct{}, len(conf.TagsAsDimensions))
+		for _, tag := range conf.TagsAsDimensions {
+			f.allow[tag] = struct{}{}
+		}
+	}
+
+	// anchor the expressions so that "vu" does not also exclude "vus_tag"
+	deny, err := compileAnchored("excludeTags", conf.ExcludeTags)
+	if err != nil {
+		return nil, err
+	}
+	f.deny = deny
+
+	return f, nil
+}
+
+// keep reports whether the tag with the given key should become a dimension.
+// A tag listed explicitly in the allowlist is kept even if KeepNameTag,
+// KeepUrlTag, KeepVuTag or KeepIterTag would drop it, but the denylist
+// always wins. The scenario tag only depends on KeepScenarioTag, so that
+// scenarios can always be compared.
+func (f *tagFilter) keep(key string) bool {
+	if key == scenarioTag {
+		return f.keepScenarioTag
+	}
+
+	if !f.keepTags {
+		return false
+	}
+
+	for _, re := range f.deny {
+		if re.MatchString(key) {
+			return false
+		}
+	}
+
+	if f.allow != nil {
+		_, ok := f.allow[key]
+		return ok
+	}
+
+	switch key {
+	case nameTag:
+		return f.keepNameTag
+	case urlTag:
+		return f.keepUrlTag
+	case vuTag:
+		return f.keepVuTag
+	case iterTag:
+		return f.keepIterTag
+	}
+
+	return true
+}
+
+// apply removes, in place, every tag that should not be exported.
+func (f *tagFilter) apply(tags map[string]string) map[string]string {
+	return f.applyPolicy(tags, nil)
+}
+
+// applyPolicy removes, in place, every tag that should not be exported
+// for a metric with the given tag policy, which overrides the filter.
+func (f *tagFilter) applyPolicy(tags map[string]string, policy *tagPolicy) map[string]string {
+	for key := range tags {
+		if !f.keepFor(key, policy) {
+			delete(tags, key)
+		}
+	}
+	return tags
+}
+
+func (f *tagFilter) keepFor(key string, policy *tagPolicy) bool {
+	if policy == nil {
+		return f.keep(key)
+	}
+	if containsString(policy.Drop, key) {
+		return false
+	}
+	if policy.Only != nil {
+		return containsString(policy.Only, key)
+	}
+	return containsString(policy.Keep, key) || f.keep(key)
+}
+
+// metadataTags are the tags k6 keeps in the sample metadata, exported
+// only when the filter keeps them.
+var metadataTags = []string{vuTag, iterTag}
+
+// metadataDimensions returns the metadata tags of the sample the filter
+// keeps for a metric with the given tag policy.
+func (f *tagFilter) metadataDimensions(sample metrics.Sample, policy *tagPolicy) map[string]string {
+	var dims map[string]string
+	for _, key := range metadataTags {
+		value, ok := sample.Metadata[key]
+		if !ok || !f.keepFor(key, policy) {
+			continue
+		}
+		if dims == nil {
+			dims = make(map[string]string, len(metadataTags))
+		}
+		dims[key] = value
+	}
+	return dims
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type urlGroupRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// urlGrouper rewrites url dimension values into templated forms so that
+// URLs carrying ids don't create an unbounded number of dimension values.
+type urlGrouper struct {
+	useNameTag bool
+	rules      []urlGroupRule
+}
+
+func newUrlGrouper(conf *Config) (*urlGrouper, error) {
+	g := &urlGrouper{useNameTag: conf.UseNameTagForUrl.Bool}
+	for _, group := range conf.UrlGroups {
+		re, err := regexp.Compile(group.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid urlGroups pattern %q: %w", group.Pattern, err)
+		}
+		g.rules = append(g.rules, urlGroupRule{re: re, replacement: group.Replacement})
+	}
+	return g, nil
+}
+
+// group returns the grouped form of rawUrl. When the script named the
+// request (the name tag differs from the url) that name is used as is,
+// otherwise the first matching rule is applied.
+func (g *urlGrouper) group(rawUrl, name string) string {
+	if g.useNameTag && name != "" && name != rawUrl {
+		return name
+	}
+	for _, rule := range g.rules {
+		if rule.re.MatchString(rawUrl) {
+			return rule.re.ReplaceAllString(rawUrl, rule.replacement)
+		}
+	}
+	return rawUrl
+}
+
+// apply must run before the tag filter since it needs the name tag.
+func (g *urlGrouper) apply(tags map[string]string) map[string]string {
+	rawUrl, ok := tags[urlTag]
+	if !ok {
+		return tags
+	}
+	grouped := g.group(rawUrl, tags[nameTag])
+	tags[urlTag] = grouped
+	if tags[nameTag] == rawUrl {
+		tags[nameTag] = grouped
+	}
+	return tags
+}
+
+// dimensionHasher replaces the values of selected dimensions with a short,
+// stable hash: the same value always maps to the same hash, so exported
+// data can still be joined with logs carrying the original value.
+type dimensionHasher struct {
+	keys   map[string]struct{}
+	length int
+}
+
+func newDimensionHasher(conf *Config) (*dimensionHasher, error) {
+	length := int(conf.HashLength.Int64)
+	if length < 1 || length > sha256.Size*2 {
+		return nil, fmt.Errorf("hashLength must be between 1 and %d, got %d", sha256.Size*2, length)
+	}
+
+	h := &dimensionHasher{keys: make(map[string]struct{}), length: length}
+	for _, key := range conf.HashDimensions {
+		h.keys[key] = struct{}{}
+	}
+	return h, nil
+}
+
+func (h *dimensionHasher) hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:h.length]
+}
+
+func (h *dimensionHasher) apply(tags map[string]string) map[string]string {
+	if len(h.keys) == 0 {
+		return tags
+	}
+	for key, value := range tags {
+		if _, ok := h.keys[key]; ok {
+			tags[key] = h.hash(value)
+		}
+	}
+	return tags
+}
+
+// errorDimensionMetrics are the metrics whose errorDimensionTags are
+// exported whatever the tag filters say, to tell failure modes apart.
+var errorDimensionMetrics = map[string]bool{
+	"http_req_failed":   true,
+	"http_req_duration": true,
+}
+
+var errorDimensionTags = []string{statusTag, errorTag, expectedResponseTag}
+
+// statusClass groups an http status into its class, e.g. 404 into 4xx.
+// Status 0, a request without response, is kept as is.
+func statusClass(status string) string {
+	if len(status) != 3 || status[0] < '1' || status[0] > '5' {
+		return status
+	}
+	return status[:1] + "xx"
+}
+
+// groupLevels returns a group.level{N} dimension per group() nesting level
+// of the group path, up to depth levels, so that latency can be split by
+// user journey step.
+func groupLevels(group string, depth int) map[string]string {
+	group = strings.TrimPrefix(group, groupSeparator)
+	if group == "" || depth <= 0 {
+		return nil
+	}
+	levels := make(map[string]string)
+	for i, name := range strings.SplitN(group, groupSeparator, depth+1) {
+		if i == depth {
+			break
+		}
+		levels[fmt.Sprintf("group.level%d", i+1)] = name
+	}
+	return levels
+}
+
+// addDimensions copies the static dimensions onto the sample dimensions,
+// overriding sample tags with the same key.
+func addDimensions(dst, static map[string]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string, len(static))
+	}
+	for k, v := range static {
+		dst[k] = v
+	}
+	return dst
+}
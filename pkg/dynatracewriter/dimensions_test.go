@@ -0,0 +1,284 @@
+package dynatracewriter
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestTagFilter(t *testing.T) {
+	t.Parallel()
+
+	tags := func() map[string]string {
+		return map[string]string{
+			"name":     "http://example.com/1",
+			"url":      "http://example.com/1",
+			"scenario": "default",
+			"status":   "200",
+			"vu":       "1",
+			"x_debug":  "on",
+		}
+	}
+
+	testCases := map[string]struct {
+		config   Config
+		expected map[string]string
+	}{
+		"defaults": {
+			config: NewConfig(),
+			expected: map[string]string{
+				"url": "http://example.com/1", "scenario": "default", "status": "200", "x_debug": "on",
+			},
+		},
+		"keep_tags_off": {
+			config: func() Config {
+				c := NewConfig()
+				c.KeepTags = null.BoolFrom(false)
+				return c
+			}(),
+			expected: map[string]string{"scenario": "default"},
+		},
+		"keep_scenario_tag_off": {
+			config: func() Config {
+				c := NewConfig()
+				c.KeepScenarioTag = null.BoolFrom(false)
+				return c
+			}(),
+			expected: map[string]string{
+				"url": "http://example.com/1", "status": "200", "x_debug": "on",
+			},
+		},
+		"allowlist": {
+			config: func() Config {
+				c := NewConfig()
+				c.TagsAsDimensions = []string{"name", "status"}
+				return c
+			}(),
+			expected: map[string]string{"name": "http://example.com/1", "status": "200", "scenario": "default"},
+		},
+		"denylist": {
+			config: func() Config {
+				c := NewConfig()
+				c.ExcludeTags = []string{"vu", "x_.*", "url"}
+				return c
+			}(),
+			expected: map[string]string{"scenario": "default", "status": "200"},
+		},
+		"denylist_wins_over_allowlist": {
+			config: func() Config {
+				c := NewConfig()
+				c.TagsAsDimensions = []string{"status", "vu"}
+				c.ExcludeTags = []string{"vu"}
+				return c
+			}(),
+			expected: map[string]string{"status": "200", "scenario": "default"},
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			f, err := newTagFilter(&testCase.config)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, f.apply(tags()))
+		})
+	}
+
+	c := NewConfig()
+	c.ExcludeTags = []string{"("}
+	_, err := newTagFilter(&c)
+	assert.Error(t, err)
+}
+
+func TestKeepVuIterTags(t *testing.T) {
+	t.Parallel()
+
+	duration := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	tags := newTags(map[string]string{"scenario": "default"})
+	samples := func() []metrics.SampleContainer {
+		now := time.Now()
+		return []metrics.SampleContainer{metrics.Samples{
+			metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: tags}, Time: now, Value: 1,
+				Metadata: map[string]string{"vu": "3", "iter": "5"}},
+			metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: tags}, Time: now, Value: 2,
+				Metadata: map[string]string{"vu": "4", "iter": "6"}},
+		}}
+	}
+
+	o := newTestOutput(t, "http://localhost", nil)
+	lines := o.convertToTimeDynatraceData(samples())
+	require.Len(t, lines, 2)
+	assert.NotContains(t, lines[0].metricDimensions, "vu", "the vu and iter metadata are dropped by default")
+	assert.NotContains(t, lines[0].metricDimensions, "iter")
+
+	o = newTestOutput(t, "http://localhost", func(c *Config) {
+		c.KeepVuTag = null.BoolFrom(true)
+		c.KeepIterTag = null.BoolFrom(true)
+	})
+	for i := 0; i < 2; i++ {
+		lines = o.convertToTimeDynatraceData(samples())
+		require.Len(t, lines, 2)
+		assert.Equal(t, "3", lines[0].metricDimensions["vu"])
+		assert.Equal(t, "5", lines[0].metricDimensions["iter"])
+		assert.Equal(t, "default", lines[0].metricDimensions["scenario"])
+		assert.Equal(t, "4", lines[1].metricDimensions["vu"], "the series carrying metadata are not cached")
+		assert.Equal(t, "6", lines[1].metricDimensions["iter"])
+	}
+
+	o = newTestOutput(t, "http://localhost", func(c *Config) {
+		c.KeepVuTag = null.BoolFrom(true)
+	})
+	lines = o.convertToTimeDynatraceData(samples())
+	assert.Equal(t, "3", lines[0].metricDimensions["vu"])
+	assert.NotContains(t, lines[0].metricDimensions, "iter")
+}
+
+func TestUrlGrouper(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.UrlGroups = []UrlGroup{
+		{Pattern: `/users/[0-9]+`, Replacement: "/users/{id}"},
+		{Pattern: `/orders/([a-z]+)/[0-9]+`, Replacement: "/orders/${1}/{id}"},
+	}
+	g, err := newUrlGrouper(&c)
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://a/users/{id}/cart", g.group("http://a/users/12345/cart", "http://a/users/12345/cart"))
+	assert.Equal(t, "http://a/orders/eu/{id}", g.group("http://a/orders/eu/7", ""))
+	assert.Equal(t, "http://a/static", g.group("http://a/static", ""))
+	assert.Equal(t, "user page", g.group("http://a/users/1", "user page"))
+
+	tags := g.apply(map[string]string{"url": "http://a/users/1", "name": "http://a/users/1"})
+	assert.Equal(t, map[string]string{"url": "http://a/users/{id}", "name": "http://a/users/{id}"}, tags)
+
+	c.UseNameTagForUrl = null.BoolFrom(false)
+	g, err = newUrlGrouper(&c)
+	require.NoError(t, err)
+	assert.Equal(t, "http://a/users/{id}", g.group("http://a/users/1", "user page"))
+
+	c.UrlGroups = []UrlGroup{{Pattern: "(", Replacement: ""}}
+	_, err = newUrlGrouper(&c)
+	assert.Error(t, err)
+}
+
+func TestDimensionHasher(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.HashDimensions = []string{"vu", "request_id"}
+	h, err := newDimensionHasher(&c)
+	require.NoError(t, err)
+
+	tags := h.apply(map[string]string{"vu": "12", "request_id": "abc", "status": "200"})
+	assert.Len(t, tags["vu"], defaultHashLength)
+	assert.Equal(t, h.hash("12"), tags["vu"])
+	assert.NotEqual(t, tags["vu"], tags["request_id"])
+	assert.Equal(t, "200", tags["status"])
+
+	c.HashLength = null.IntFrom(0)
+	_, err = newDimensionHasher(&c)
+	assert.Error(t, err)
+}
+
+func TestGroupLevels(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, map[string]string{
+		"group.level1": "checkout",
+		"group.level2": "payment",
+	}, groupLevels("::checkout::payment::card", 2))
+	assert.Equal(t, map[string]string{
+		"group.level1": "checkout",
+		"group.level2": "payment",
+		"group.level3": "card",
+	}, groupLevels("::checkout::payment::card", 5))
+	assert.Nil(t, groupLevels("", 3))
+	assert.Nil(t, groupLevels("::checkout", 0))
+}
+
+func TestErrorDimensions(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.TagsAsDimensions = []string{"method"}
+		c.StatusClasses = null.BoolFrom(true)
+	})
+
+	now := time.Now()
+	tags := newTags(map[string]string{"method": "GET", "status": "503", "error_code": "1503", "expected_response": "false"})
+
+	m, ok := o.convertSample(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: newMetric("http_req_duration", metrics.Trend, metrics.Time), Tags: tags}, Time: now, Value: 1}, now)
+	require.True(t, ok)
+	assert.Equal(t, "5xx", m.metricDimensions[statusTag])
+	assert.Equal(t, "1503", m.metricDimensions[errorTag])
+	assert.Equal(t, "false", m.metricDimensions[expectedResponseTag])
+
+	m, ok = o.convertSample(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: newMetric("http_reqs", metrics.Counter), Tags: tags}, Time: now, Value: 1}, now)
+	require.True(t, ok)
+	assert.NotContains(t, m.metricDimensions, statusTag)
+	assert.NotContains(t, m.metricDimensions, errorTag)
+	assert.NotContains(t, m.metricDimensions, expectedResponseTag)
+}
+
+func TestStatusClass(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "2xx", statusClass("200"))
+	assert.Equal(t, "4xx", statusClass("404"))
+	assert.Equal(t, "5xx", statusClass("503"))
+	assert.Equal(t, "0", statusClass("0"))
+	assert.Equal(t, "", statusClass(""))
+}
+
+func TestAddSourceDimension(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", nil)
+	o.addSourceDimension()
+	assert.Equal(t, defaultMetricsSource, o.config.Dimensions[metricsSourceDimension])
+
+	o = newTestOutput(t, "http://localhost", func(c *Config) {
+		c.MetricsSource = null.StringFrom("k6-nightly")
+		c.Dimensions = map[string]string{metricsSourceDimension: "configured"}
+	})
+	o.addSourceDimension()
+	assert.Equal(t, "configured", o.config.Dimensions[metricsSourceDimension], "a configured dimension wins")
+
+	o = newTestOutput(t, "http://localhost", func(c *Config) {
+		c.MetricsSource = null.StringFrom("")
+	})
+	o.addSourceDimension()
+	assert.NotContains(t, o.config.Dimensions, metricsSourceDimension)
+}
+
+func TestStageDimensions(t *testing.T) {
+	t.Parallel()
+
+	recorder := &eventRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.Environment = null.StringFrom("staging")
+		c.Stage = null.StringFrom("smoke")
+		c.Dimensions = map[string]string{"team": "checkout", stageDimension: "configured"}
+	})
+	assert.Equal(t, map[string]string{"team": "checkout", environmentDimension: "staging", stageDimension: "smoke"},
+		o.config.Dimensions)
+
+	require.NoError(t, o.sendEvent(dynatraceEvent{EventType: eventTypeCustomInfo, Title: "k6 test started"}))
+	require.Len(t, recorder.events, 1)
+	assert.Equal(t, "staging", recorder.events[0].Properties[environmentDimension])
+	assert.Equal(t, "smoke", recorder.events[0].Properties[stageDimension])
+
+	o = newTestOutput(t, server.URL, nil)
+	assert.NotContains(t, o.config.Dimensions, environmentDimension)
+	assert.NotContains(t, o.config.Dimensions, stageDimension)
+}
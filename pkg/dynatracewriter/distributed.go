@@ -0,0 +1,60 @@
+package dynatracewriter
+
+import (
+	"time"
+)
+
+const (
+	instanceIDDimension = "instance_id"
+	// instanceAggregateSuffix is appended to the key of the instance-less
+	// copies so they are not counted twice with the per instance series
+	instanceAggregateSuffix = ".all"
+)
+
+// resolveInstanceID returns the instance_id of the k6 instance when the test
+// is distributed, e.g. fanned out by the k6-operator, which is detected from
+// the execution segment unless configured: the configured id, the pod name
+// or a random one. It returns "" for a single instance test.
+func resolveInstanceID(conf *Config, env map[string]string, segmented bool) (string, error) {
+	if !conf.Distributed.Bool && (conf.Distributed.Valid || !segmented) {
+		return "", nil
+	}
+	if conf.InstanceID.String != "" {
+		return conf.InstanceID.String, nil
+	}
+	for _, name := range []string{"K8S_POD_NAME", "POD_NAME", "HOSTNAME"} {
+		if id := env[name]; id != "" {
+			return id, nil
+		}
+	}
+	return newTestRunID()
+}
+
+// untilNextWindow returns the time until the next multiple of the flush
+// period, so that the instances of a distributed test flush, and aggregate,
+// over the same windows.
+func untilNextWindow(now time.Time, period time.Duration) time.Duration {
+	if period <= 0 {
+		return 0
+	}
+	return now.Truncate(period).Add(period).Sub(now)
+}
+
+// instanceAggregate returns the instance-less copy of a metric line, which
+// Dynatrace merges with the copies of the other instances into the whole
+// test view.
+func (o *Output) instanceAggregate(m dynatraceMetric) (dynatraceMetric, bool) {
+	dims := make(map[string]string, len(m.metricDimensions))
+	for k, v := range m.metricDimensions {
+		if k != instanceIDDimension {
+			dims[k] = v
+		}
+	}
+	m.metricDimensions = dims
+	m.cached = nil
+	m.metricKeyName += instanceAggregateSuffix
+	if o.config.OmitAggregateTimestamps.Bool {
+		m.metricTimeStamp = 0
+	}
+	return m, o.limiter.admit(&m)
+}
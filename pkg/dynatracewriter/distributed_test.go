@@ -0,0 +1,69 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestResolveInstanceID(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	id, err := resolveInstanceID(&c, map[string]string{"POD_NAME": "runner-1"}, false)
+	require.NoError(t, err)
+	assert.Empty(t, id, "single instance")
+
+	id, err = resolveInstanceID(&c, map[string]string{"POD_NAME": "runner-1", "HOSTNAME": "host"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, "runner-1", id)
+
+	id, err = resolveInstanceID(&c, nil, true)
+	require.NoError(t, err)
+	assert.Len(t, id, 16)
+
+	c.Distributed = null.BoolFrom(false)
+	id, err = resolveInstanceID(&c, map[string]string{"POD_NAME": "runner-1"}, true)
+	require.NoError(t, err)
+	assert.Empty(t, id)
+
+	c.Distributed = null.BoolFrom(true)
+	c.InstanceID = null.StringFrom("generator-eu")
+	id, err = resolveInstanceID(&c, map[string]string{"POD_NAME": "runner-1"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, "generator-eu", id)
+}
+
+func TestUntilNextWindow(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 1, 10, 0, 7, int(300*time.Millisecond), time.UTC)
+	assert.Equal(t, 700*time.Millisecond, untilNextWindow(now, time.Second))
+	assert.Equal(t, 2700*time.Millisecond, untilNextWindow(now, 5*time.Second))
+	assert.Equal(t, time.Duration(0), untilNextWindow(now, 0))
+}
+
+func TestInstanceAggregates(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.InstanceAggregates = null.BoolFrom(true)
+	})
+	o.instanceID = "runner-1"
+
+	reqs := newMetric("http_reqs", metrics.Counter)
+	dynMetrics := o.convertToTimeDynatraceData([]metrics.SampleContainer{metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: reqs, Tags: newTags(map[string]string{"status": "200"})}, Time: time.Now(), Value: 1,
+	}})
+	require.Len(t, dynMetrics, 2)
+
+	assert.Equal(t, "k6.http_reqs", dynMetrics[0].metricKeyName)
+	assert.Equal(t, "runner-1", dynMetrics[0].metricDimensions[instanceIDDimension])
+	assert.Equal(t, "k6.http_reqs"+instanceAggregateSuffix, dynMetrics[1].metricKeyName)
+	assert.NotContains(t, dynMetrics[1].metricDimensions, instanceIDDimension)
+	assert.Equal(t, "200", dynMetrics[1].metricDimensions["status"])
+}
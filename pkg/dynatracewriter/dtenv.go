@@ -0,0 +1,33 @@
+package dynatracewriter
+
+import (
+	"strings"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+// applyDynatraceEnv fills the connection settings that were not configured
+// from the variables the Dynatrace Operator and OneAgent inject into the
+// pods: the environment from DT_TENANT and the token from DT_API_TOKEN.
+// DT_TENANTTOKEN is an agent token the API does not accept, but it tells
+// a OneAgent runs next to k6, so without an API token the metrics are
+// sent to its local ingest listener.
+func applyDynatraceEnv(conf *Config, env map[string]string) {
+	if token := env["DT_API_TOKEN"]; token != "" && !conf.ApiToken.Valid {
+		conf.ApiToken = null.StringFrom(token)
+	}
+
+	if env["DT_TENANTTOKEN"] != "" && !conf.ApiToken.Valid && !conf.IngestMode.Valid {
+		// the local listener url is the default of the local mode
+		conf.IngestMode = null.StringFrom(ingestModeLocal)
+		return
+	}
+
+	if tenant := env["DT_TENANT"]; tenant != "" && conf.Url == defaultDynatraceUrl {
+		if strings.Contains(tenant, "://") {
+			conf.Url = strings.TrimSuffix(tenant, "/")
+		} else {
+			conf.Url = "https://" + tenant + ".live.dynatrace.com"
+		}
+	}
+}
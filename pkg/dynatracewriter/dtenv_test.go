@@ -0,0 +1,52 @@
+package dynatracewriter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestDynatraceEnv(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, nil, map[string]string{
+		"DT_TENANT":    "abc12345",
+		"DT_API_TOKEN": "dt0c01.token",
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://abc12345.live.dynatrace.com", c.Url)
+	assert.Equal(t, null.StringFrom("dt0c01.token"), c.ApiToken)
+	assert.False(t, c.IngestMode.Valid)
+
+	c, err = GetConsolidatedConfig(nil, nil, map[string]string{
+		"DT_TENANT":             "https://abc.apps.example.com/",
+		"DT_API_TOKEN":          "dt0c01.token",
+		"K6_DYNATRACE_URL":      "https://explicit.live.dynatrace.com",
+		"K6_DYNATRACE_APITOKEN": "explicit",
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://explicit.live.dynatrace.com", c.Url)
+	assert.Equal(t, null.StringFrom("explicit"), c.ApiToken)
+
+	c, err = GetConsolidatedConfig(nil, nil, map[string]string{"DT_TENANT": "https://abc.apps.example.com/"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://abc.apps.example.com", c.Url)
+
+	c, err = GetConsolidatedConfig(nil, nil, map[string]string{"DT_TENANT": "abc12345", "DT_TENANTTOKEN": "agent"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, null.StringFrom(ingestModeLocal), c.IngestMode)
+	assert.Equal(t, defaultDynatraceUrl, c.Url)
+
+	c, err = GetConsolidatedConfig(nil, nil, map[string]string{"DT_TENANTTOKEN": "agent", "DT_API_TOKEN": "dt0c01.token"}, "")
+	require.NoError(t, err)
+	assert.False(t, c.IngestMode.Valid)
+
+	c, err = GetConsolidatedConfig(nil, nil, map[string]string{
+		"DT_API_TOKEN":            "dt0c01.token",
+		"K6_DYNATRACE_USE_DT_ENV": "false",
+	}, "")
+	require.NoError(t, err)
+	assert.False(t, c.ApiToken.Valid)
+}
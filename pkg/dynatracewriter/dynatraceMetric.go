@@ -1,17 +1,17 @@
 package dynatracewriter
 
 import (
-   "time"
+   "bytes"
    "fmt"
    "strconv"
-    "go.k6.io/k6/stats"
+   "strings"
+    "go.k6.io/k6/metrics"
 )
 
 const (
     metricDisplayNameProperty="dt.meta.displayName"
     metricDescriptionProperty="dt.meta.description"
     metricUnitProperty="dt.meta.unit"
-    metricKeyPrefix="k6"
 )
 type dynatraceMetric struct{
     metricDisplayName string
@@ -21,56 +21,183 @@ type dynatraceMetric struct{
     metricDimensions map[string]string
     metricValue float64
     metricTimeStamp int64
+    metricType metrics.MetricType
+    // delta marks counter lines, sent as count,delta=value
+    delta bool
+    // cached is the series the metric was made from, its dimensions are
+    // shared with the series and already serialized
+    cached *cachedSeries
 }
 
 
-func samleToDynametric(sample stats.Sample ) dynatraceMetric {
+func samleToDynametric(sample metrics.Sample ) dynatraceMetric {
      return dynatraceMetric{
         metricKeyName : sample.Metric.Name,
-        metricDimensions : sample.GetTags().CloneTags(),
+        metricUnit : metricUnit(sample.Metric),
+        description : metricDescription(sample.Metric),
+        metricDimensions : sampleTags(sample),
         metricValue : sample.Value,
         metricTimeStamp : sample.GetTime().UnixMilli(),
+        metricType : sample.Metric.Type,
      }
 }
 
+// sampleTags returns a copy of the tags of the sample.
+func sampleTags(sample metrics.Sample) map[string]string {
+	if sample.Tags == nil {
+		return make(map[string]string)
+	}
+	return sample.Tags.Map()
+}
 
-func (e *dynatraceMetric) toText() string {
+// sampleTag returns the value of a tag of the sample, falling back to its
+// metadata, where k6 keeps the high cardinality values like vu, iter or
+// trace_id.
+func sampleTag(sample metrics.Sample, key string) (string, bool) {
+	if sample.Tags != nil {
+		if value, ok := sample.Tags.Get(key); ok {
+			return value, true
+		}
+	}
+	value, ok := sample.Metadata[key]
+	return value, ok
+}
+
+// newMetric creates a metric outside of the k6 registry, for the metrics
+// the output synthesizes itself.
+func newMetric(name string, typ metrics.MetricType, contains ...metrics.ValueType) *metrics.Metric {
+	m := &metrics.Metric{Name: name, Type: typ, Sink: metrics.NewSink(typ)}
+	if len(contains) > 0 {
+		m.Contains = contains[0]
+	}
+	return m
+}
 
-   var result=""
+// metricUnit maps the k6 metric type to a Dynatrace unit.
+func metricUnit(m *metrics.Metric) string {
+	switch {
+	case m.Contains == metrics.Time:
+		return "MilliSecond"
+	case m.Contains == metrics.Data:
+		return "Byte"
+	case m.Type == metrics.Rate:
+		return "Ratio"
+	default:
+		return "Count"
+	}
+}
 
-   result=metricKeyPrefix+"."+e.metricKeyName
+type durationUnit struct {
+	unit string
+	// factor converts the k6 milliseconds into the unit
+	factor float64
+}
 
-   if(len(e.metricDimensions)!=0) {
-        for key, value := range e.metricDimensions {
-                if len(key)>0 && len(value)>0 {
-                     result+=","+key+ "="+ "\""+value+"\""
-                }
-        }
-   }
+var durationUnits = map[string]durationUnit{
+	"ms": {unit: "MilliSecond", factor: 1},
+	"s":  {unit: "Second", factor: 0.001},
+	"us": {unit: "MicroSecond", factor: 1000},
+}
 
-    result+=" "
-   if(len(e.metricUnit)>0){
-        result+=metricUnitProperty+"="+e.metricUnit
-    }
+func lookupDurationUnit(name string) (durationUnit, error) {
+	u, ok := durationUnits[name]
+	if !ok {
+		return u, fmt.Errorf("invalid durationUnit %q, expected ms, s or us", name)
+	}
+	return u, nil
+}
 
-    if(len(e.description)>0){
-        result+=","+metricDescriptionProperty+"="+e.description
+func metricDescription(m *metrics.Metric) string {
+	return fmt.Sprintf("k6 %s metric %s", m.Type, m.Name)
+}
 
-    }
 
-    if(len(e.metricDisplayName)>0){
-            result+=","+metricDisplayNameProperty+"="+e.metricDisplayName
-    }
+func (e *dynatraceMetric) toText() string {
+	var buf bytes.Buffer
+	e.writeText(&buf)
+	return buf.String()
+}
 
-    result+=" "+ fmt.Sprint(e.metricValue)
+// writeText writes the metric line, without the trailing newline, e.g.
+// k6.vus,test_run_id="abc" 10 1700000000000
+func (e *dynatraceMetric) writeText(buf *bytes.Buffer) {
+	buf.WriteString(e.metricKeyName)
+	if e.cached != nil {
+		buf.WriteString(e.cached.rendered)
+	} else {
+		writeDimensions(buf, e.metricDimensions)
+	}
+
+	var scratch [32]byte
+	if e.delta {
+		buf.WriteString(" count,delta=")
+	} else {
+		buf.WriteByte(' ')
+	}
+	// same format as fmt.Sprint
+	buf.Write(strconv.AppendFloat(scratch[:0], e.metricValue, 'g', -1, 64))
+
+	// without timestamp Dynatrace uses the time the line was received
+	if e.metricTimeStamp > 0 {
+		buf.WriteByte(' ')
+		buf.Write(strconv.AppendInt(scratch[:0], e.metricTimeStamp, 10))
+	}
+}
 
-    if e.metricTimeStamp<= 0 {
-        t := time.Now() //It will return time.Time object with current timestamp
-        tUnixMilli := int64(time.Nanosecond) * t.UnixNano() / int64(time.Millisecond)
-        e.metricTimeStamp=tUnixMilli
+// writeDimensions writes the dimensions of a metric line in key order, so
+// a series always gives the same bytes, e.g.
+// ,scenario="default",test_run_id="abc"
+func writeDimensions(buf *bytes.Buffer, dims map[string]string) {
+	// sorted by insertion on the stack, the lines have a few dimensions
+	// and sort.Strings would allocate for every line
+	var scratch [32]string
+	keys := scratch[:0]
+	for key := range dims {
+		keys = append(keys, key)
+	}
+	for i := 1; i < len(keys); i++ {
+		for j := i; j > 0 && keys[j] < keys[j-1]; j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+		}
+	}
+
+	for _, key := range keys {
+		if value := dims[key]; len(key) > 0 && len(value) > 0 {
+			buf.WriteByte(',')
+			buf.WriteString(key)
+			buf.WriteString("=\"")
+			buf.WriteString(value)
+			buf.WriteByte('"')
+		}
+	}
+}
 
-    }
-    result+=" "+strconv.FormatInt(e.metricTimeStamp,10)
+// metadataText returns the metadata line describing the metric, e.g.
+// #k6.http_req_duration gauge dt.meta.unit=MilliSecond,dt.meta.description="..."
+// It returns an empty string when there is nothing to describe.
+func (e *dynatraceMetric) metadataText() string {
+	var properties []string
+	if len(e.metricUnit) > 0 {
+		properties = append(properties, metricUnitProperty+"="+e.metricUnit)
+	}
+	if len(e.description) > 0 {
+		properties = append(properties, metricDescriptionProperty+"="+quoteMetadata(e.description))
+	}
+	if len(e.metricDisplayName) > 0 {
+		properties = append(properties, metricDisplayNameProperty+"="+quoteMetadata(e.metricDisplayName))
+	}
+	if len(properties) == 0 {
+		return ""
+	}
+	payload := "gauge"
+	if e.delta {
+		payload = "count"
+	}
+	return "#" + e.metricKeyName + " " + payload + " " + strings.Join(properties, ",")
+}
 
-    return result
-}
\ No newline at end of file
+func quoteMetadata(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "\"", "\\\"")
+	return "\"" + value + "\""
+}
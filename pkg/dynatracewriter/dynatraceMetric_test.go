@@ -0,0 +1,156 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.k6.io/k6/metrics"
+)
+
+func TestMetricMetadata(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "MilliSecond", metricUnit(newMetric("http_req_duration", metrics.Trend, metrics.Time)))
+	assert.Equal(t, "Byte", metricUnit(newMetric("data_sent", metrics.Counter, metrics.Data)))
+	assert.Equal(t, "Count", metricUnit(newMetric("iterations", metrics.Counter)))
+	assert.Equal(t, "Ratio", metricUnit(newMetric("checks", metrics.Rate)))
+
+	m := dynatraceMetric{
+		metricKeyName: "k6.http_req_duration",
+		metricUnit:    "MilliSecond",
+		description:   `k6 "trend" metric`,
+	}
+	assert.Equal(t, `#k6.http_req_duration gauge dt.meta.unit=MilliSecond,dt.meta.description="k6 \"trend\" metric"`,
+		m.metadataText())
+	assert.Equal(t, "", (&dynatraceMetric{metricKeyName: "k6.vus"}).metadataText())
+}
+
+func TestGeneratePayloadDescribesOnce(t *testing.T) {
+	t.Parallel()
+
+	dynMetrics := []dynatraceMetric{
+		{metricKeyName: "k6.vus", metricUnit: "Count", metricValue: 1, metricTimeStamp: 1000},
+		{metricKeyName: "k6.vus", metricUnit: "Count", metricValue: 2, metricTimeStamp: 2000},
+	}
+	described := make(map[string]struct{})
+	assert.Equal(t, "#k6.vus gauge dt.meta.unit=Count\nk6.vus 1 1000\nk6.vus 2 2000\n", generatePayload(dynMetrics, described))
+	assert.Equal(t, "k6.vus 1 1000\nk6.vus 2 2000\n", generatePayload(dynMetrics, described))
+}
+
+func TestLookupDurationUnit(t *testing.T) {
+	t.Parallel()
+
+	u, err := lookupDurationUnit("s")
+	assert.NoError(t, err)
+	assert.Equal(t, "Second", u.unit)
+	assert.Equal(t, 1.5, 1500*u.factor)
+
+	u, err = lookupDurationUnit("us")
+	assert.NoError(t, err)
+	assert.Equal(t, "MicroSecond", u.unit)
+
+	_, err = lookupDurationUnit("minutes")
+	assert.Error(t, err)
+}
+
+func TestSampleTag(t *testing.T) {
+	t.Parallel()
+
+	sample := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: newMetric("http_req_duration", metrics.Trend, metrics.Time), Tags: newTags(map[string]string{"status": "200"})},
+		Metadata:   map[string]string{"trace_id": "abc", "status": "500"},
+	}
+
+	value, ok := sampleTag(sample, "status")
+	assert.True(t, ok)
+	assert.Equal(t, "200", value)
+	value, ok = sampleTag(sample, "trace_id")
+	assert.True(t, ok)
+	assert.Equal(t, "abc", value)
+	_, ok = sampleTag(sample, "vu")
+	assert.False(t, ok)
+
+	assert.Equal(t, map[string]string{"status": "200"}, sampleTags(sample))
+	assert.Empty(t, sampleTags(metrics.Sample{}))
+}
+
+func TestMetricLineValues(t *testing.T) {
+	t.Parallel()
+
+	for _, value := range []float64{0, 1, -2.5, 0.1, 1e21, 1.5e-7, 123456789, math.MaxFloat64} {
+		m := dynatraceMetric{metricKeyName: "k6.vus", metricValue: value, metricTimeStamp: 1000}
+		assert.Equal(t, "k6.vus "+fmt.Sprint(value)+" 1000", m.toText())
+	}
+	m := dynatraceMetric{
+		metricKeyName:    "k6.http_reqs",
+		metricDimensions: map[string]string{"status": "200", "empty": ""},
+		metricValue:      3,
+		delta:            true,
+	}
+	assert.Equal(t, `k6.http_reqs,status="200" count,delta=3`, m.toText())
+
+	m.metricDimensions = map[string]string{"test_run_id": "run", "status": "200", "method": "GET", "scenario": "default"}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, `k6.http_reqs,method="GET",scenario="default",status="200",test_run_id="run" count,delta=3`, m.toText(),
+			"the dimensions come in key order")
+	}
+}
+
+// benchmarkMetrics returns n lines looking like the k6 http ones.
+func benchmarkMetrics(n int) []dynatraceMetric {
+	dynMetrics := make([]dynatraceMetric, n)
+	for i := range dynMetrics {
+		dynMetrics[i] = dynatraceMetric{
+			metricKeyName: "k6.http_req_duration",
+			metricDimensions: map[string]string{
+				"method": "GET", "status": "200", "url": "https://test.k6.io/contacts.php",
+				"scenario": "default", "test_run_id": "0123456789abcdef",
+			},
+			metricValue:     float64(i) * 1.25,
+			metricTimeStamp: 1700000000000 + int64(i),
+		}
+	}
+	return dynMetrics
+}
+
+// concatPayload is the former string concatenation of generatePayload,
+// kept as the baseline of the benchmarks.
+func concatPayload(dynMetrics []dynatraceMetric) string {
+	result := ""
+	for i := range dynMetrics {
+		line := dynMetrics[i].metricKeyName
+		for key, value := range dynMetrics[i].metricDimensions {
+			line += "," + key + "=" + "\"" + value + "\""
+		}
+		line += " " + fmt.Sprint(dynMetrics[i].metricValue) + " " + strconv.FormatInt(dynMetrics[i].metricTimeStamp, 10)
+		result += line + "\n"
+	}
+	return result
+}
+
+func BenchmarkGeneratePayload(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		dynMetrics := benchmarkMetrics(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				generatePayload(dynMetrics, map[string]struct{}{"k6.http_req_duration": {}})
+			}
+		})
+	}
+}
+
+func BenchmarkConcatPayload(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		dynMetrics := benchmarkMetrics(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				concatPayload(dynMetrics)
+			}
+		})
+	}
+}
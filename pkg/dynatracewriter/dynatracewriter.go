@@ -1,7 +1,9 @@
 package dynatracewriter
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"time"
     "net/http"
     "io/ioutil"
@@ -9,7 +11,9 @@ import (
     "bytes"
 	"github.com/sirupsen/logrus"
 	"go.k6.io/k6/output"
-	"go.k6.io/k6/stats"
+	"go.k6.io/k6/metrics"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"gopkg.in/guregu/null.v3"
 )
 
 type Output struct {
@@ -18,72 +22,366 @@ type Output struct {
 	output.SampleBuffer
     params  output.Params
 	logger logrus.FieldLogger
+	// summaryLogger reports the outcome of the export, even in quiet mode
+	summaryLogger logrus.FieldLogger
+
+	metricFilter *metricFilter
+	transform    *transformSpec
+	tagFilter    *tagFilter
+	urlGrouper   *urlGrouper
+	hasher       *dimensionHasher
+	relabeler    *relabeler
+	limiter      *cardinalityLimiter
+	series       *seriesCache
+	durationUnit durationUnit
+	timestamps   *timestampValidator
+
+	client     Doer
+	serializer serializer
+	accepted   acceptedBatches
+	priority   []metricSelector
+	critical   []metricSelector
+	bestEffort []metricSelector
+	// overloaded is set when the previous flush took longer than the flush
+	// period, the next one keeps at most maxSamplesPerFlush lines
+	overloaded bool
+	// compression is the Content-Encoding of the bodies, it falls back to
+	// gzip when the endpoint doesn't accept zstd
+	compression string
+	retry      *retryPolicy
+	hooks      []PreSendHook
+	thresholds thresholdState
+	summary    testSummary
+	logs       logShipper
+	testInfo   testInfo
+	started    time.Time
+	lastExport time.Time
+
+	// spans and business events are only touched by the flushing goroutine
+	spans        []*tracepb.Span
+	droppedSpans int
+	bizEvents    bizEventTracker
+	groups       groupRollups
+	counters     counterTotals
+	apdex        apdexScores
+	budget       errorBudget
+	rolling      rollingTrends
+	stats        exportStats
+	totals       exportStats
+
+	live        liveStats
+	memory      memoryCap
+	statsServer *http.Server
+
+	exportGuard exportGuard
+	testRunStop func(error)
+
+	maintenanceWindowID string
+	instanceID          string
+	metricEventRules    []metricEventRule
+	apdexRules          []apdexRule
+
+	// describedMetrics holds the metric keys whose metadata line was sent
+	describedMetrics map[string]struct{}
 }
 
 var _ output.Output = new(Output)
-
-// toggle to indicate whether we should stop dropping samples
-var flushTooLong bool
+var _ output.WithStopWithTestError = new(Output)
 
 func New(params output.Params) (*Output, error) {
-	config, err := GetConsolidatedConfig(params.JSONConfig, params.Environment, params.ConfigArgument)
+	config, err := GetConsolidatedConfig(params.JSONConfig, params.ScriptOptions.External[scriptConfigKey],
+		params.Environment, params.ConfigArgument)
 	if err != nil {
 		return nil, err
 	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	newconfig, err := config.ConstructConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Output{
-		config:  newconfig,
-		logger:  params.Logger,
-	}, nil
+	o, err := newOutput(newconfig, params.Logger)
+	if err != nil {
+		return nil, err
+	}
+	o.testInfo = newTestInfo(params)
+	o.instanceID, err = resolveInstanceID(o.config, params.Environment, params.ScriptOptions.ExecutionSegment != nil)
+	if err != nil {
+		return nil, err
+	}
+	o.addCloudDimensions(defaultCloudMetadataEndpoints)
+	o.addHostDimensions(oneAgentMetadataFiles)
+	o.addSourceDimension()
+	if o.config.ValidateOnly.Bool {
+		// k6 stops on the error, letting the other outputs close
+		if err := o.validateOnly(); err != nil {
+			return nil, err
+		}
+		return nil, ErrValidateOnly
+	}
+	o.registerLogHook(params.Logger)
+	return o, nil
+}
+
+// newOutput builds the output and its conversion pipeline from the
+// constructed config.
+func newOutput(newconfig *Config, k6Logger logrus.FieldLogger) (*Output, error) {
+	logger, err := newOutputLogger(k6Logger, newconfig)
+	if err != nil {
+		return nil, err
+	}
+	// the quiet mode still reports the outcome of the export
+	summaryLogger := logger
+	if newconfig.Quiet.Bool {
+		summaryConfig := *newconfig
+		summaryConfig.Quiet = null.BoolFrom(false)
+		summaryConfig.LogLevel = null.NewString("", false)
+		if summaryLogger, err = newOutputLogger(k6Logger, &summaryConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	metricFilter, err := newMetricFilter(newconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	transform, err := loadTransformFile(newconfig.TransformFile.String)
+	if err != nil {
+		return nil, err
+	}
+
+	tagFilter, err := newTagFilter(newconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	urlGrouper, err := newUrlGrouper(newconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher, err := newDimensionHasher(newconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	relabeler, err := newRelabeler(newconfig.RelabelConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter, err := newCardinalityLimiter(newconfig, logger)
+	if err != nil {
+		return nil, err
+	}
+	// the limiter rewrites or drops the new series from then on, the cached
+	// series are built again
+	series := newSeriesCache(defaultSeriesCacheSize)
+	limiter.onLimit = series.reset
+
+	retry, err := newRetryPolicy(newconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	priority, err := parseMetricSelectors(newconfig.MetricPriority)
+	if err != nil {
+		return nil, err
+	}
+	critical, err := parseMetricSelectors(newconfig.CriticalMetrics)
+	if err != nil {
+		return nil, err
+	}
+	bestEffort, err := parseMetricSelectors(newconfig.BestEffortMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	durationUnit, err := lookupDurationUnit(newconfig.DurationUnit.String)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamps, err := newTimestampValidator(newconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateExportFormat(newconfig.ExportFormat.String); err != nil {
+		return nil, err
+	}
+
+	metricEventRules, err := parseMetricEventRules(newconfig.MetricEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	apdexRules, err := parseApdexRules(newconfig.Apdex)
+	if err != nil {
+		return nil, err
+	}
+
+	switch newconfig.ThresholdEventType.String {
+	case eventTypeErrorEvent, eventTypeCustomAlert:
+	default:
+		return nil, fmt.Errorf("invalid thresholdEventType %q, expected %s or %s",
+			newconfig.ThresholdEventType.String, eventTypeErrorEvent, eventTypeCustomAlert)
+	}
+
+	client, err := newHTTPClient(newconfig)
+	if err != nil {
+		return nil, err
+	}
+	if newconfig.InsecureSkipTLSVerify.Bool {
+		logger.Warn("Dynatrace: TLS certificate verification is DISABLED (insecureSkipTLSVerify=true), " +
+			"the API token and the metrics can be intercepted. Use caCertFile to trust a private CA instead.")
+	}
+
+	o := &Output{
+		config:        newconfig,
+		logger:        logger,
+		summaryLogger: summaryLogger,
+		metricFilter:  metricFilter,
+		transform:     transform,
+		tagFilter:     tagFilter,
+		urlGrouper:    urlGrouper,
+		hasher:        hasher,
+		relabeler:     relabeler,
+		limiter:       limiter,
+		series:        series,
+		durationUnit:  durationUnit,
+		timestamps:    timestamps,
+
+		metricEventRules: metricEventRules,
+		apdexRules:       apdexRules,
+
+		client:           client,
+		retry:            retry,
+		priority:         priority,
+		critical:         critical,
+		bestEffort:       bestEffort,
+		compression:      newconfig.Compression.String,
+		memory:           memoryCap{limit: newconfig.MaxMemoryBytes.Int64},
+		describedMetrics: make(map[string]struct{}),
+	}
+	o.addStageDimensions()
+	o.hooks = registeredPreSendHooks()
+	if o.serializer, err = newSerializer(o, newconfig.ExportFormat.String); err != nil {
+		return nil, err
+	}
+	return o, nil
 }
 
 func (*Output) Description() string {
-	return "Output k6 metrics to Dynatrace metrics ingest api"
+	return "Output k6 metrics to Dynatrace metrics ingest api (xk6-output-dynatrace " + extensionVersion() + ")"
 }
 
 func (o *Output) Start() error {
+	if o.instanceID != "" {
+		time.Sleep(untilNextWindow(time.Now(), time.Duration(o.config.FlushPeriod.Duration)))
+	}
 	if periodicFlusher, err := output.NewPeriodicFlusher(time.Duration(o.config.FlushPeriod.Duration), o.flush); err != nil {
 		return err
 	} else {
 		o.periodicFlusher = periodicFlusher
 	}
+	if err := o.startStatsListener(); err != nil {
+		return err
+	}
 	o.logger.Debug("Dynatrace: starting dynatrace-write")
+	o.logger.WithField(testRunIDDimension, o.config.TestRunID.String).Info("Dynatrace: exporting metrics")
+
+	o.started = time.Now()
+	o.counters = nil
+	o.sendLifecycleEvent("k6 load test started", o.started, time.Time{}, nil)
+	o.sendDeploymentEvent(o.started)
+	o.openMaintenanceWindow(o.started)
+	o.syncSlos()
+	o.provisionMetricEvents()
+	o.createDashboard()
 
 	return nil
 }
 
 func (o *Output) Stop() error {
+	return o.StopWithTestError(nil)
+}
+
+// StopWithTestError flushes the remaining samples and reports the outcome
+// of the test, failed when testRunErr is set or a threshold failed.
+func (o *Output) StopWithTestError(testRunErr error) error {
 	o.logger.Debug("Dynatrace: stopping dynatrace-write")
 	o.periodicFlusher.Stop()
+	now := time.Now()
+	o.sendSummary(now)
+	result, reason := o.testResult(testRunErr)
+	o.sendTestResult(result, now)
+	o.flushLogs()
+
+	properties := map[string]string{"result": result}
+	if reason != "" {
+		properties["reason"] = reason
+	}
+	o.sendLifecycleEvent("k6 load test "+result, o.started, now, properties)
+	o.closeMaintenanceWindow()
+	o.summaryLogger.WithFields(logrus.Fields{
+		"lines":        o.totals.linesSent,
+		"linesInvalid": o.totals.linesInvalid,
+		"linesDropped": o.totals.linesDropped,
+		"bytes":        o.totals.payloadBytes,
+		"result":       result,
+	}).Info("Dynatrace: export finished")
+	o.stopStatsListener()
 	return nil
 }
 
 func (o *Output) flush() {
+	// the failures are logged and counted by the export guard
+	_ = o.flushContext(context.Background())
+}
+
+// flushContext converts and sends the buffered samples, returning the
+// error of sending the metric lines.
+func (o *Output) flushContext(ctx context.Context) (err error) {
 	var (
 		start = time.Now()
 		nts   int
 	)
 
+	before := o.totals
 	defer func() {
 		d := time.Since(start)
+		o.stats.flushDuration = d
+		o.live.store(o.totals)
+		logger := o.logger.WithFields(o.totals.since(before, d))
 		if d > time.Duration(o.config.FlushPeriod.Duration) {
 			// There is no intermediary storage so warn if writing to remote write endpoint becomes too slow
-			o.logger.WithField("nts", nts).
+			logger.WithField("nts", nts).
 				Warn(fmt.Sprintf("Remote write took %s while flush period is %s. Some samples may be dropped.",
 					d.String(), o.config.FlushPeriod.String()))
-			flushTooLong = true
+			o.overloaded = true
 		} else {
-			o.logger.WithField("nts", nts).Debug(fmt.Sprintf("Remote write took %s.", d.String()))
-			flushTooLong = false
+			if o.config.LogFormat.String == logFormatJSON {
+				// the flush records are meant to be scraped
+				logger.WithField("nts", nts).Info("Dynatrace: flush")
+			} else {
+				logger.WithField("nts", nts).Debug(fmt.Sprintf("Remote write took %s.", d.String()))
+			}
+			o.overloaded = false
 		}
 	}()
 
 	samplesContainers := o.GetBufferedSamples()
+	queueDepth := 0
+	for _, samplesContainer := range samplesContainers {
+		queueDepth += len(samplesContainer.GetSamples())
+	}
+	o.live.queueDepth.Store(int64(queueDepth))
+	o.releaseMemory(samplesContainers)
 
 	// Remote write endpoint accepts TimeSeries structure defined in gRPC. It must:
 	// a) contain Labels array
@@ -92,80 +390,380 @@ func (o *Output) flush() {
 	// c) not have duplicate timestamps within 1 timeseries, see https://github.com/prometheus/prometheus/issues/9210
 	// Prometheus write handler processes only some fields as of now, so here we'll add only them.
 	dynatraceMetric := o.convertToTimeDynatraceData(samplesContainers)
+	dynatraceMetric = append(dynatraceMetric, o.thresholdMetrics(start)...)
+	dynatraceMetric = append(dynatraceMetric, o.groupRollupMetrics(start)...)
+	dynatraceMetric = append(dynatraceMetric, o.cumulativeMetrics(start)...)
+	dynatraceMetric = append(dynatraceMetric, o.apdexMetrics(start)...)
+	dynatraceMetric = append(dynatraceMetric, o.burnRateMetrics(start)...)
+	dynatraceMetric = append(dynatraceMetric, o.rollingMetrics(start)...)
+	dynatraceMetric = append(dynatraceMetric, o.selfMonitoringMetrics(start, queueDepth)...)
+	dynatraceMetric = append(dynatraceMetric, o.heartbeatMetric(start)...)
+	o.reportThresholdFailures(start)
+	o.flushLogs()
+	o.sendSpans()
+	o.sendBizEvents()
+	dynatraceMetric = o.applyPreSendHooks(dynatraceMetric)
+	dynatraceMetric = o.dropInvalidLines(dynatraceMetric)
+	o.replaySpool(ctx)
 	nts = len(dynatraceMetric)
     if nts > 0 {
              o.logger.WithField("nts", nts).Debug("Converted samples to time series in preparation for sending.")
+             err = o.sendChunks(ctx, dynatraceMetric)
+    } else {
+         o.logger.Debug("no data to send")
+    }
+    return err
 
-            var payload=generatePayload(dynatraceMetric)
+}
 
-        	request, error := http.NewRequest( "POST", o.config.Url, bytes.NewBuffer([]byte(payload)))
+// sendMetrics posts the metric lines to the metrics ingest endpoint, or
+// the OTLP metrics to the OTLP endpoint.
+func (o *Output) sendMetrics(dynatraceMetric []dynatraceMetric) {
+	// the failures are logged and counted by the export guard
+	_ = o.sendChunks(context.Background(), dynatraceMetric)
+}
 
-        	for key,value := range o.config.Headers {
-        	    request.Header.Set(key, value)
-        	}
-            o.logger.Debug("Payload to send " + payload)
-            client := &http.Client{}
-            response, error := client.Do(request)
-            if error != nil {
-                o.logger.WithError(error).Fatal("Failed to send timeseries.")
+// sendMetricsContext sends the lines in a single request, returning its
+// error.
+func (o *Output) sendMetricsContext(ctx context.Context, dynatraceMetric []dynatraceMetric) error {
+            requestID := newRequestID()
+            streamed := o.config.StreamPayload.Bool && o.config.ExportFormat.String == exportFormatMint
+            var body []byte
+            if !streamed {
+                var err error
+                if body, err = o.serializer.serialize(dynatraceMetric); err != nil {
+                    o.logger.WithError(err).Error("Dynatrace: failed to serialize the metrics")
+                    return err
+                }
+                if o.config.ExportFormat.String != exportFormatOTLP {
+                    o.dumpPayload(o.logger.WithField("requestId", requestID), string(body))
+                }
+            }
+            // the retries and the replays of the batch carry the same hash
+            var hash string
+            if !streamed {
+                hash = batchHash(body)
             }
-            o.logger.Debug("response Status:" + response.Status)
-            defer response.Body.Close()
 
+            start := time.Now()
+            for attempt := 1; ; attempt++ {
+                var (
+                    payload io.Reader
+                    // payloadSize returns the size of the payload once sent
+                    payloadSize func() int
+                    encoding    string
+                )
+                if streamed {
+                    // the streamed body can't be read again, every attempt serializes it
+                    encoding = o.streamCompression()
+                    stream := o.streamPayload(dynatraceMetric, encoding)
+                    payload, payloadSize = stream, stream.size
+                } else {
+                    encoding = o.compression
+                    compressed, err := compressBody(body, encoding)
+                    if err != nil {
+                        return err
+                    }
+                    payload, payloadSize = bytes.NewReader(compressed), func() int { return len(body) }
+                }
+
+                request, error := o.newIngestRequest(ctx, payload, encoding)
+                if error != nil {
+                    payloadSize() // stops the streamed serialization
+                    return error
+                }
+                if hash != "" {
+                    request.Header.Set(batchHashHeader, hash)
+                }
+                response, logger, error := o.do(request, requestID, attempt, len(dynatraceMetric))
+                var responseBody []byte
+                if error == nil {
+                    responseBody, _ = ioutil.ReadAll(response.Body)
+                    response.Body.Close()
+                }
+                // the attempt is over, this stops and releases the streamed
+                // serialization
+                payloadSize()
+                if error == nil && o.fallbackCompression(response, encoding) {
+                    // sent again with gzip, it is not a retry
+                    attempt--
+                    continue
+                }
 
-            var b=""
-            for key, value := range  response.Header {
-                 for _, singlevalue := range value {
-                    b+=key+"="+singlevalue+"\n"
-                 }
+                // sending a partially accepted batch again would count its
+                // accepted counters twice
+                retryable := o.retry.retryable(response, error) && !partiallyAccepted(responseBody)
+                wait := o.retry.backoff(attempt, response)
+                if retryable && o.retry.allowed(attempt, time.Since(start), wait) {
+                    entry := logger.WithField("retryIn", wait.String())
+                    if error != nil {
+                        entry = entry.WithError(error)
+                    }
+                    entry.Warn("Dynatrace: the request failed, retrying")
+                    o.stats.retries++
+                    o.totals.retries++
+                    if err := sleepContext(ctx, wait); err == nil {
+                        continue
+                    }
+                    // the context ended, the last failure is reported
+                } else if retryable && o.config.RetryExhaustedPolicy.String == retryExhaustedSpool {
+                    return o.spoolLines(logger, dynatraceMetric, body, attempt)
+                }
+
+                if error != nil {
+                    logger.WithError(error).Error("Failed to send timeseries.")
+                    o.stats.payloadBytes += payloadSize()
+                    o.totals.payloadBytes += payloadSize()
+                    o.stats.linesDropped += len(dynatraceMetric)
+                    o.totals.linesDropped += len(dynatraceMetric)
+                    o.recordExport(false)
+                    return fmt.Errorf("request %s: %w", requestID, error)
+                }
+                var b=""
+                for key, value := range  response.Header {
+                     for _, singlevalue := range value {
+                        b+=key+"="+singlevalue+"\n"
+                     }
+                }
+                logger.Debug("response Headers:" + b)
+                o.stats.recordIngest(payloadSize(), len(dynatraceMetric), response.StatusCode, responseBody)
+                o.totals.recordIngest(payloadSize(), len(dynatraceMetric), response.StatusCode, responseBody)
+                if response.StatusCode < 200 || response.StatusCode > 299 {
+                    logger.Warn("Dynatrace: the metrics ingest rejected the lines: " + string(responseBody))
+                    o.recordExport(false)
+                    return fmt.Errorf("the metrics ingest answered %s to request %s: %s", response.Status, requestID, string(responseBody))
+                }
+                o.recordExport(true)
+                if o.config.ExportFormat.String == exportFormatMint {
+                    o.markDescribed(dynatraceMetric)
+                }
+                logger.Debug("response Body:"+ string(responseBody))
+                return nil
             }
-            o.logger.Debug("response Headers:" + b)
-            body, _ := ioutil.ReadAll(response.Body)
-            o.logger.Debug("response Body:"+ string(body))
-    } else {
-         o.logger.Debug("no data to send")
-    }
+}
 
+// generatePayload serializes the metrics, preceded by a metadata line for
+// every metric key not described yet.
+func generatePayload(dynatraceMetrics []dynatraceMetric, described map[string]struct{}) string {
+	buf := getPayloadBuffer(len(dynatraceMetrics))
+	defer putPayloadBuffer(buf)
+	writePayload(buf, dynatraceMetrics, described)
+	return buf.String()
 }
 
-func generatePayload(dynatraceMetrics []dynatraceMetric) string {
+// writePayload writes the lines of generatePayload into buf.
+func writePayload(buf *bytes.Buffer, dynatraceMetrics []dynatraceMetric, described map[string]struct{}) {
+	for i := range dynatraceMetrics {
+		m := &dynatraceMetrics[i]
+		if _, ok := described[m.metricKeyName]; !ok {
+			described[m.metricKeyName] = struct{}{}
+			if metadata := m.metadataText(); metadata != "" {
+				buf.WriteString(metadata)
+				buf.WriteByte('\n')
+			}
+		}
+		m.writeText(buf)
+		buf.WriteByte('\n')
+	}
+}
 
-    var result=""
-    for i:= 0; i < len(dynatraceMetrics); i++ {
-        result+=dynatraceMetrics[i].toText()+"\n"
-    }
+// convertSample turns a k6 sample into a Dynatrace metric line, applying
+// the configured dimension rules. It returns false if the sample must not
+// be exported.
+func (o *Output) convertSample(sample metrics.Sample, now time.Time) (dynatraceMetric, bool) {
+	return o.convertSeriesSample(sample, o.lookupSeries(sample), now)
+}
 
-    return result
+// lookupSeries returns the series of the sample, from the cache or built
+// from its tags, or nil if the sample is filtered out. It only reads the
+// output and may run on several goroutines.
+func (o *Output) lookupSeries(sample metrics.Sample) *cachedSeries {
+	if !o.metricFilter.keep(sample.Metric.Name) || o.transform.dropMetric(sample.Metric.Name) {
+		return nil
+	}
+
+	if o.config.DropZeroValues.Bool && isZeroCountOrRate(sample) {
+		return nil
+	}
+
+	if series := o.series.get(sample); series != nil {
+		return series
+	}
+	return o.buildSeries(sample)
 }
 
-func (o *Output) convertToTimeDynatraceData(samplesContainers []stats.SampleContainer) []dynatraceMetric {
-	var dynTimeSeries []dynatraceMetric
+// convertSeriesSample completes the line of the sample from its series,
+// applying the steps depending on the sample itself or on the previous
+// samples.
+func (o *Output) convertSeriesSample(sample metrics.Sample, series *cachedSeries, now time.Time) (dynatraceMetric, bool) {
+	if series == nil {
+		return dynatraceMetric{}, false
+	}
+	o.series.put(sample, series)
+	if !series.keep {
+		return dynatraceMetric{}, false
+	}
+
+	dynametric := series.template
+	dynametric.cached = series
+	// the value transforms of the series are a factor, the one of 1
+	dynametric.metricValue = sample.Value * series.template.metricValue
+	dynametric.metricTimeStamp = sample.GetTime().UnixMilli()
+	o.applyTraceID(sample, &dynametric)
 
+	if !o.timestamps.apply(&dynametric, now) {
+		return dynametric, false
+	}
+
+	if !o.limiter.admit(&dynametric) {
+		return dynametric, false
+	}
+
+	return dynametric, true
+}
+
+// buildSeries runs the conversion steps depending only on the metric and
+// the tags of the sample, cached for the following samples of the series.
+func (o *Output) buildSeries(sample metrics.Sample) *cachedSeries {
+	dynametric := samleToDynametric(sample)
+	dynametric.metricValue = 1
+	if sample.Metric.Contains == metrics.Time {
+		dynametric.metricValue *= o.durationUnit.factor
+		dynametric.metricUnit = o.durationUnit.unit
+	}
+	o.applyWebVital(sample, &dynametric)
+	if unit := o.transform.metricUnit(sample.Metric.Name); unit != "" {
+		dynametric.metricUnit = unit
+	}
+	dynametric.metricDimensions = o.urlGrouper.apply(dynametric.metricDimensions)
+	policy := o.transform.tagPolicy(sample.Metric.Name)
+	dynametric.metricDimensions = o.tagFilter.applyPolicy(dynametric.metricDimensions, policy)
+	// k6 keeps vu and iter in the metadata, not in the tags
+	metadata := o.tagFilter.metadataDimensions(sample, policy)
+	dynametric.metricDimensions = addDimensions(dynametric.metricDimensions, metadata)
+	dynametric.metricDimensions = addDimensions(dynametric.metricDimensions, o.submetricDimensions(sample))
+	if o.config.ErrorDimensions.Bool && errorDimensionMetrics[sample.Metric.Name] {
+		for _, key := range errorDimensionTags {
+			if value, ok := sampleTag(sample, key); ok {
+				dynametric.metricDimensions[key] = value
+			}
+		}
+	}
+	if o.config.ProtocolDimensions.Bool {
+		dynametric.metricDimensions = addDimensions(dynametric.metricDimensions, protocolDimensions(sample))
+	}
+	if status, ok := dynametric.metricDimensions[statusTag]; ok && o.config.StatusClasses.Bool {
+		dynametric.metricDimensions[statusTag] = statusClass(status)
+	}
+	if group, ok := sampleTag(sample, groupTag); ok {
+		dynametric.metricDimensions = addDimensions(dynametric.metricDimensions,
+			groupLevels(group, int(o.config.GroupLevels.Int64)))
+	}
+	dynametric.metricDimensions = o.transform.applyDimensions(dynametric.metricDimensions)
+	dynametric.metricDimensions = o.hasher.apply(dynametric.metricDimensions)
+	dynametric.metricDimensions = addDimensions(dynametric.metricDimensions, o.transform.Dimensions.Static)
+	dynametric.metricDimensions = addDimensions(dynametric.metricDimensions, o.config.Dimensions)
+	dynametric.metricDimensions[testRunIDDimension] = o.config.TestRunID.String
+	if o.instanceID != "" {
+		dynametric.metricDimensions[instanceIDDimension] = o.instanceID
+	}
+
+	if !o.relabeler.apply(&dynametric) {
+		return &cachedSeries{perSample: len(metadata) > 0}
+	}
+
+	dynametric.metricKeyName = o.metricKey(dynametric.metricKeyName)
+	series := newCachedSeries(dynametric)
+	series.perSample = len(metadata) > 0
+	return series
+}
+
+// metricKey returns the Dynatrace metric key for a k6 metric: renamed
+// metrics are used as is, the others get the configured prefix.
+func (o *Output) metricKey(name string) string {
+	if renamed, ok := o.config.MetricRenames[name]; ok {
+		return renamed
+	}
+	if renamed, ok := o.transform.metricName(name); ok {
+		return renamed
+	}
+	return o.config.MetricPrefix.String + name
+}
+
+func (o *Output) convertToTimeDynatraceData(samplesContainers []metrics.SampleContainer) []dynatraceMetric {
+	var (
+		dynTimeSeries []dynatraceMetric
+		// ranks holds the sampleRank of every line when it may be dropped
+		ranks    []lineRank
+		shedding = o.shedding()
+	)
+	now := time.Now()
+	defer o.timestamps.report(o.logger)
+
+	series := o.resolveSeries(samplesContainers)
+	next := 0
 	for _, samplesContainer := range samplesContainers {
 		samples := samplesContainer.GetSamples()
 
 		for _, sample := range samples {
+			sampleSeries := series[next]
+			next++
+
+			o.thresholds.observe(sample)
+			if o.config.Summary.Bool {
+				o.summary.observe(sample)
+			}
+			o.observeCheck(sample)
+			o.observeFailure(sample)
+			o.observeSpan(sample)
+			o.observeIteration(sample)
+			o.observeGroup(sample)
+			o.observeApdex(sample)
+			o.observeBurnRate(sample)
+			o.observeRolling(sample)
+			if check, ok := o.checkMetric(sample, now); ok {
+				dynTimeSeries = append(dynTimeSeries, check)
+				if shedding {
+					ranks = append(ranks, o.sampleRank(sample, true))
+				}
+			}
 			// Prometheus remote write treats each label array in TimeSeries as the same
 			// for all Samples in those TimeSeries (https://github.com/prometheus/prometheus/blob/03d084f8629477907cab39fc3d314b375eeac010/storage/remote/write_handler.go#L75).
 			// But K6 metrics can have different tags per each Sample so in order not to
 			// lose info in tags or assign tags wrongly, let's store each Sample in a different TimeSeries, for now.
 			// This approach also allows to avoid hard to replicate issues with duplicate timestamps.
 
-            dynametric := samleToDynametric( sample)
+            dynametric, ok := o.convertSeriesSample(sample, sampleSeries, now)
+            if !ok {
+                continue
+            }
             if &dynametric.metricValue != nil {
                 o.logger.Debug("metric name : " + dynametric.metricKeyName)
                 dynTimeSeries = append  (dynTimeSeries, dynametric)
+                o.accumulateCounter(dynametric)
+                if shedding {
+                    ranks = append(ranks, o.sampleRank(sample, false))
+                }
+                for _, line := range o.submetricLines(sample, dynametric) {
+                    dynTimeSeries = append(dynTimeSeries, line)
+                    if shedding {
+                        ranks = append(ranks, o.sampleRank(sample, false))
+                    }
+                }
+                if o.instanceID != "" && o.config.InstanceAggregates.Bool {
+                    if aggregate, ok := o.instanceAggregate(dynametric); ok {
+                        dynTimeSeries = append(dynTimeSeries, aggregate)
+                        if shedding {
+                            ranks = append(ranks, o.sampleRank(sample, true))
+                        }
+                    }
+                }
             } else {
                 o.logger.Debug("The value is missing")
             }
 		}
-
-		// Do not blow up if remote endpoint is overloaded and responds too slowly.
-		// TODO: consider other approaches
-		if flushTooLong && len(dynTimeSeries) > 150000 {
-			break
-		}
 	}
 
-	return dynTimeSeries
+	// Do not blow up if remote endpoint is overloaded and responds too slowly.
+	return o.shedSamples(dynTimeSeries, ranks)
 }
\ No newline at end of file
@@ -0,0 +1,43 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+)
+
+const (
+	defaultDynatraceEventsEndPoint = "/api/v2/events/ingest"
+
+	eventTypeErrorEvent  = "ERROR_EVENT"
+	eventTypeCustomAlert = "CUSTOM_ALERT"
+	eventTypeCustomInfo  = "CUSTOM_INFO"
+)
+
+// dynatraceEvent is the payload of the Events API v2.
+type dynatraceEvent struct {
+	EventType      string            `json:"eventType"`
+	Title          string            `json:"title"`
+	EntitySelector string            `json:"entitySelector,omitempty"`
+	StartTime      int64             `json:"startTime,omitempty"`
+	EndTime        int64             `json:"endTime,omitempty"`
+	Properties     map[string]string `json:"properties,omitempty"`
+}
+
+func (o *Output) sendEvent(event dynatraceEvent) error {
+	if event.Properties == nil {
+		event.Properties = make(map[string]string)
+	}
+	event.Properties[testRunIDDimension] = o.config.TestRunID.String
+	for key, value := range o.config.stageDimensions() {
+		event.Properties[key] = value
+	}
+	o.addGrailAttributes(event.Properties)
+	if event.EntitySelector == "" {
+		event.EntitySelector = o.config.EventsEntitySelector.String
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return o.postAPI(defaultDynatraceEventsEndPoint, "application/json; charset=utf-8", body)
+}
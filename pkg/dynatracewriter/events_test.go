@@ -0,0 +1,104 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+// eventRecorder is a fake Events API recording the received events.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []dynatraceEvent
+}
+
+func (r *eventRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != defaultDynatraceEventsEndPoint {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	var event dynatraceEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+}
+
+// newTags builds the tag set of a test sample.
+func newTags(tags map[string]string) *metrics.TagSet {
+	return metrics.NewRegistry().RootTagSet().WithTagsFromMap(tags)
+}
+
+func newTestOutput(t testing.TB, serverUrl string, configure func(*Config)) *Output {
+	t.Helper()
+
+	c := NewConfig()
+	c.Url = serverUrl
+	c.ApiToken = null.StringFrom("token")
+	c.TestRunID = null.StringFrom("run")
+	if configure != nil {
+		configure(&c)
+	}
+	constructed, err := c.ConstructConfig()
+	require.NoError(t, err)
+	o, err := newOutput(constructed, logrus.New())
+	require.NoError(t, err)
+	return o
+}
+
+func TestThresholdFailureEvent(t *testing.T) {
+	t.Parallel()
+
+	recorder := &eventRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.ThresholdEvents = null.BoolFrom(true)
+	})
+
+	threshold := &metrics.Threshold{Source: "p(99) < 200"}
+	o.SetThresholds(map[string]metrics.Thresholds{
+		"http_req_duration": {Thresholds: []*metrics.Threshold{threshold}},
+	})
+
+	metric := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	now := time.Now()
+	observe := func(values ...float64) {
+		for _, v := range values {
+			o.thresholds.observe(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric}, Time: now, Value: v})
+		}
+	}
+
+	observe(100, 150)
+	o.reportThresholdFailures(now)
+	assert.Empty(t, recorder.events)
+
+	observe(300)
+	o.reportThresholdFailures(now)
+	o.reportThresholdFailures(now)
+
+	require.Len(t, recorder.events, 1)
+	event := recorder.events[0]
+	assert.Equal(t, eventTypeErrorEvent, event.EventType)
+	assert.Equal(t, "k6 threshold crossed: http_req_duration p(99) < 200", event.Title)
+	assert.Equal(t, "p(99) < 200", event.Properties["threshold"])
+	assert.Equal(t, "run", event.Properties["test_run_id"])
+	assert.NotEmpty(t, event.Properties["value"])
+	assert.False(t, threshold.LastFailed, "the engine's thresholds are left alone")
+}
@@ -0,0 +1,63 @@
+package dynatracewriter
+
+import (
+	"fmt"
+
+	"go.k6.io/k6/output"
+)
+
+const (
+	defaultFailTestErrorRate           = 0.5
+	defaultFailTestConsecutiveFailures = 5
+)
+
+var _ output.WithTestRunStop = new(Output)
+
+// exportGuard follows the outcome of the metrics ingest requests for the
+// failTestOnExportError option. Like the stats, it is only touched by the
+// flushing goroutine.
+type exportGuard struct {
+	requests    int
+	failures    int
+	consecutive int
+	stopped     bool
+}
+
+// SetTestRunStopCallback receives the function aborting the test run,
+// called when failTestOnExportError is set and the export keeps failing.
+func (o *Output) SetTestRunStopCallback(stop func(error)) {
+	o.testRunStop = stop
+}
+
+// recordExport counts the outcome of a metrics ingest request and aborts
+// the test when the consecutive failures or, past as many requests, the
+// error rate exceed their limits.
+func (o *Output) recordExport(ok bool) {
+	g := &o.exportGuard
+	g.requests++
+	if ok {
+		g.consecutive = 0
+		return
+	}
+	g.failures++
+	g.consecutive++
+
+	if !o.config.FailTestOnExportError.Bool || g.stopped || o.testRunStop == nil {
+		return
+	}
+	maxConsecutive := int(o.config.FailTestConsecutiveFailures.Int64)
+	errorRate := float64(g.failures) / float64(g.requests)
+	var err error
+	switch {
+	case maxConsecutive > 0 && g.consecutive >= maxConsecutive:
+		err = fmt.Errorf("Dynatrace: the last %d metrics exports failed, aborting the test (failTestOnExportError)", g.consecutive)
+	case g.requests >= maxConsecutive && errorRate > o.config.FailTestErrorRate.Float64:
+		err = fmt.Errorf("Dynatrace: %d of the %d metrics exports failed, over the %g error rate, aborting the test (failTestOnExportError)",
+			g.failures, g.requests, o.config.FailTestErrorRate.Float64)
+	default:
+		return
+	}
+	g.stopped = true
+	o.logger.Error(err.Error())
+	o.testRunStop(err)
+}
@@ -0,0 +1,93 @@
+package dynatracewriter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestFailTestOnExportError(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		configure func(*Config)
+		outcomes  []bool
+		stopped   bool
+	}{
+		"disabled": {
+			outcomes: []bool{false, false, false, false, false, false},
+		},
+		"consecutive": {
+			configure: func(c *Config) { c.FailTestConsecutiveFailures = null.IntFrom(3) },
+			outcomes:  []bool{true, false, false, false},
+			stopped:   true,
+		},
+		"reset_by_success": {
+			configure: func(c *Config) {
+				c.FailTestConsecutiveFailures = null.IntFrom(3)
+				c.FailTestErrorRate = null.FloatFrom(1)
+			},
+			outcomes:  []bool{false, false, true, false, true},
+		},
+		"error_rate": {
+			configure: func(c *Config) {
+				c.FailTestConsecutiveFailures = null.IntFrom(4)
+				c.FailTestErrorRate = null.FloatFrom(0.4)
+			},
+			outcomes: []bool{false, true, false, true, false},
+			stopped:  true,
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			o := newTestOutput(t, "http://localhost", func(c *Config) {
+				if tc.configure != nil {
+					c.FailTestOnExportError = null.BoolFrom(true)
+					tc.configure(c)
+				}
+			})
+			var stops []error
+			o.SetTestRunStopCallback(func(err error) { stops = append(stops, err) })
+			for _, ok := range tc.outcomes {
+				o.recordExport(ok)
+			}
+			if tc.stopped {
+				require.Len(t, stops, 1)
+				assert.Contains(t, stops[0].Error(), "failTestOnExportError")
+			} else {
+				assert.Empty(t, stops)
+			}
+		})
+	}
+}
+
+func TestSendMetricsRecordsFailures(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.FailTestOnExportError = null.BoolFrom(true)
+		c.FailTestConsecutiveFailures = null.IntFrom(2)
+		c.MaxRetries = null.IntFrom(0)
+	})
+	var stopped error
+	o.SetTestRunStopCallback(func(err error) { stopped = err })
+	line := []dynatraceMetric{{metricKeyName: "k6.vus", metricValue: 1, metricType: metrics.Gauge}}
+
+	o.sendMetrics(line)
+	assert.NoError(t, stopped)
+	server.Close()
+	// the connection errors count too, instead of exiting k6
+	o.sendMetrics(line)
+	assert.Error(t, stopped)
+	assert.Equal(t, 2, o.totals.linesDropped)
+}
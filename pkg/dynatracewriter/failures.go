@@ -0,0 +1,148 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+)
+
+// failureAttributes are the sample tags copied onto failure log records,
+// trace_id and span_id link the record to the distributed trace.
+var failureAttributes = []string{
+	"check", "url", "name", "method", "status", "error_code", "scenario", "group", "trace_id", "span_id",
+}
+
+// thresholdBound is the numeric bound of a trend threshold such as
+// "p(95)<500", a single request beyond it is reported as a failure.
+type thresholdBound struct {
+	source   string
+	metric   string
+	selector map[string]string
+	operator string
+	limit    float64
+}
+
+var thresholdBoundRe = regexp.MustCompile(
+	`^\s*(?:avg|min|max|med|p\(\s*[0-9.]+\s*\))\s*(<=|<|>=|>|===|==|!=)\s*([0-9.]+)\s*$`)
+
+// newThresholdBounds extracts the bounds of the trend thresholds, the
+// other expressions can't be judged on a single sample.
+func newThresholdBounds(thresholds map[string]metrics.Thresholds) map[string][]thresholdBound {
+	bounds := make(map[string][]thresholdBound)
+	for name, ts := range thresholds {
+		parent := parentMetricName(name)
+		selector := submetricSelector(name)
+		for _, threshold := range ts.Thresholds {
+			match := thresholdBoundRe.FindStringSubmatch(threshold.Source)
+			if match == nil {
+				continue
+			}
+			limit, err := strconv.ParseFloat(match[2], 64)
+			if err != nil {
+				continue
+			}
+			bounds[parent] = append(bounds[parent], thresholdBound{
+				source:   threshold.Source,
+				metric:   name,
+				selector: selector,
+				operator: match[1],
+				limit:    limit,
+			})
+		}
+	}
+	return bounds
+}
+
+// submetricSelector parses the tag selector of a submetric name,
+// e.g. http_req_duration{status:200,method:GET}.
+func submetricSelector(name string) map[string]string {
+	start := strings.IndexByte(name, '{')
+	if start < 0 || !strings.HasSuffix(name, "}") {
+		return nil
+	}
+	selector := make(map[string]string)
+	for _, pair := range strings.Split(name[start+1:len(name)-1], ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		selector[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+	}
+	return selector
+}
+
+// violatedBy reports whether the sample alone breaks the bound.
+func (b thresholdBound) violatedBy(value float64, tags map[string]string) bool {
+	for k, v := range b.selector {
+		if tags[k] != v {
+			return false
+		}
+	}
+	switch b.operator {
+	case "<":
+		return !(value < b.limit)
+	case "<=":
+		return !(value <= b.limit)
+	case ">":
+		return !(value > b.limit)
+	case ">=":
+		return !(value >= b.limit)
+	case "==", "===":
+		return value != b.limit
+	case "!=":
+		return value == b.limit
+	}
+	return false
+}
+
+// observeFailure records an ERROR log record when a check fails or when a
+// request breaks a threshold bound.
+func (o *Output) observeFailure(sample metrics.Sample) {
+	if !o.config.FailureLogs.Bool {
+		return
+	}
+
+	var tags map[string]string
+	if sample.Metric.Name == "checks" {
+		if sample.Value != 0 {
+			return
+		}
+		tags = sampleTags(sample)
+		o.logs.add(o.failureRecord(sample, "check failed: "+tags["check"], tags))
+		return
+	}
+
+	o.thresholds.mu.Lock()
+	bounds := o.thresholds.bounds[sample.Metric.Name]
+	o.thresholds.mu.Unlock()
+	for _, bound := range bounds {
+		if tags == nil {
+			tags = sampleTags(sample)
+		}
+		if !bound.violatedBy(sample.Value, tags) {
+			continue
+		}
+		content := fmt.Sprintf("request exceeded threshold %s %s: %s", bound.metric, bound.source,
+			strconv.FormatFloat(sample.Value, 'f', -1, 64))
+		record := o.failureRecord(sample, content, tags)
+		record[thresholdDimension] = bound.source
+		record[metricDimension] = bound.metric
+		record["value"] = strconv.FormatFloat(sample.Value, 'f', -1, 64)
+		o.logs.add(record)
+	}
+}
+
+func (o *Output) failureRecord(sample metrics.Sample, content string, tags map[string]string) logRecord {
+	record := o.newLogRecord(sample.Time, "error", content)
+	for _, key := range failureAttributes {
+		if value := tags[key]; value != "" {
+			record[key] = value
+		} else if value, _ := sampleTag(sample, key); value != "" {
+			record[key] = value
+		}
+	}
+	return record
+}
@@ -0,0 +1,88 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestThresholdBounds(t *testing.T) {
+	t.Parallel()
+
+	thresholds := map[string]metrics.Thresholds{
+		"http_req_duration": {Thresholds: []*metrics.Threshold{
+			{Source: "p(95)<500"}, {Source: "avg <= 200"},
+		}},
+		"http_req_duration{status:200}": {Thresholds: []*metrics.Threshold{{Source: "max<1000"}}},
+		"http_req_failed":               {Thresholds: []*metrics.Threshold{{Source: "rate<0.01"}}},
+	}
+	bounds := newThresholdBounds(thresholds)
+	require.Len(t, bounds["http_req_duration"], 3)
+	assert.NotContains(t, bounds, "http_req_failed")
+
+	for _, bound := range bounds["http_req_duration"] {
+		switch bound.source {
+		case "p(95)<500":
+			assert.False(t, bound.violatedBy(499, nil))
+			assert.True(t, bound.violatedBy(500, nil))
+		case "avg <= 200":
+			assert.False(t, bound.violatedBy(200, nil))
+			assert.True(t, bound.violatedBy(201, nil))
+		case "max<1000":
+			assert.Equal(t, map[string]string{"status": "200"}, bound.selector)
+			assert.True(t, bound.violatedBy(2000, map[string]string{"status": "200"}))
+			assert.False(t, bound.violatedBy(2000, map[string]string{"status": "500"}))
+		default:
+			t.Fatalf("unexpected bound %q", bound.source)
+		}
+	}
+}
+
+func TestObserveFailure(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.FailureLogs = null.BoolFrom(true)
+	c.Logs = null.BoolFrom(true)
+	c.TestRunID = null.StringFrom("run")
+	o, err := newOutput(&c, logrus.New())
+	require.NoError(t, err)
+	o.SetThresholds(map[string]metrics.Thresholds{
+		"http_req_duration": {Thresholds: []*metrics.Threshold{{Source: "p(95)<500"}}},
+	})
+
+	now := time.Now()
+	duration := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	requestTags := newTags(map[string]string{
+		"url": "http://a/", "status": "503", "error_code": "1503", "trace_id": "abc", "vu": "1",
+	})
+	o.observeFailure(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: requestTags}, Time: now, Value: 120})
+	o.observeFailure(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: requestTags}, Time: now, Value: 750})
+
+	checks := newMetric("checks", metrics.Rate)
+	checkTags := newTags(map[string]string{"check": "is ok", "scenario": "main"})
+	o.observeCheck(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks, Tags: checkTags}, Time: now, Value: 0})
+	o.observeFailure(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks, Tags: checkTags}, Time: now, Value: 1})
+	o.observeFailure(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks, Tags: checkTags}, Time: now, Value: 0})
+
+	records, _ := o.logs.take()
+	require.Len(t, records, 2)
+
+	assert.Equal(t, "error", records[0]["severity"])
+	assert.Equal(t, "request exceeded threshold http_req_duration p(95)<500: 750", records[0]["content"])
+	assert.Equal(t, "http://a/", records[0]["url"])
+	assert.Equal(t, "503", records[0]["status"])
+	assert.Equal(t, "1503", records[0]["error_code"])
+	assert.Equal(t, "abc", records[0]["trace_id"])
+	assert.Equal(t, "run", records[0][testRunIDDimension])
+	assert.NotContains(t, records[0], "vu")
+
+	assert.Equal(t, "error", records[1]["severity"])
+	assert.Equal(t, "check failed: is ok", records[1]["content"])
+	assert.Equal(t, "main", records[1]["scenario"])
+}
@@ -0,0 +1,89 @@
+package dynatracewriter
+
+import (
+	"sort"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+const groupDurationMetric = "group_duration"
+
+// groupRollup aggregates the group_duration samples of a group over a
+// flush.
+type groupRollup struct {
+	count int
+	sum   float64
+	sink  *metrics.TrendSink
+}
+
+// groupRollups aggregates the group durations by group path, it is only
+// touched by the flushing goroutine.
+type groupRollups map[string]*groupRollup
+
+// observeGroup aggregates the group_duration samples when groupRollups is
+// set, whatever the metric filters.
+func (o *Output) observeGroup(sample metrics.Sample) {
+	if !o.config.GroupRollups.Bool || sample.Metric.Name != groupDurationMetric {
+		return
+	}
+	group, ok := sampleTag(sample, groupTag)
+	if !ok || group == "" {
+		return
+	}
+	if o.groups == nil {
+		o.groups = make(groupRollups)
+	}
+	rollup, ok := o.groups[group]
+	if !ok {
+		rollup = &groupRollup{sink: metrics.NewSink(metrics.Trend).(*metrics.TrendSink)}
+		o.groups[group] = rollup
+	}
+	rollup.count++
+	rollup.sum += sample.Value
+	rollup.sink.Add(sample)
+}
+
+// groupRollupMetrics returns the k6.group_duration.avg, .p95 and .count
+// lines of every group seen since the previous flush, and resets them.
+func (o *Output) groupRollupMetrics(now time.Time) []dynatraceMetric {
+	if len(o.groups) == 0 {
+		return nil
+	}
+
+	groups := make([]string, 0, len(o.groups))
+	for group := range o.groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	dynMetrics := make([]dynatraceMetric, 0, 3*len(groups))
+	for _, group := range groups {
+		rollup := o.groups[group]
+		line := func(suffix, unit string, value float64, delta bool) dynatraceMetric {
+			dims := o.outputDimensions()
+			dims[groupTag] = group
+			m := dynatraceMetric{
+				metricKeyName:    o.metricKey(groupDurationMetric + "." + suffix),
+				description:      "k6 group duration " + suffix + " by group over the flush period",
+				metricUnit:       unit,
+				metricDimensions: dims,
+				metricValue:      value,
+				metricTimeStamp:  o.aggregateTimestamp(now),
+				metricType:       metrics.Gauge,
+				delta:            delta,
+			}
+			if delta {
+				m.metricType = metrics.Counter
+			}
+			return m
+		}
+		dynMetrics = append(dynMetrics,
+			line("avg", o.durationUnit.unit, rollup.sum/float64(rollup.count)*o.durationUnit.factor, false),
+			line("p95", o.durationUnit.unit, rollup.sink.P(0.95)*o.durationUnit.factor, false),
+			line("count", "Count", float64(rollup.count), true),
+		)
+	}
+	o.groups = nil
+	return dynMetrics
+}
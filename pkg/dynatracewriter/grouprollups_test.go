@@ -0,0 +1,54 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestGroupRollups(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.GroupRollups = null.BoolFrom(true)
+		c.DurationUnit = null.StringFrom("s")
+		// the raw group durations are not exported
+		c.MetricsExclude = []string{groupDurationMetric}
+	})
+	metric := newMetric(groupDurationMetric, metrics.Trend, metrics.Time)
+	now := time.Now()
+	var samples metrics.Samples
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: newTags(map[string]string{groupTag: "::checkout"})},
+			Time:       now,
+			Value:      float64(i * 100),
+		})
+	}
+	samples = append(samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: metric, Tags: newTags(map[string]string{groupTag: "::checkout::payment"})},
+		Time:       now,
+		Value:      500,
+	})
+
+	assert.Empty(t, o.convertToTimeDynatraceData([]metrics.SampleContainer{samples}))
+	lines := o.groupRollupMetrics(now)
+	require.Len(t, lines, 6)
+
+	assert.Equal(t, "k6.group_duration.avg", lines[0].metricKeyName)
+	assert.Equal(t, "::checkout", lines[0].metricDimensions[groupTag])
+	assert.Equal(t, "run", lines[0].metricDimensions[testRunIDDimension])
+	assert.Equal(t, "Second", lines[0].metricUnit)
+	assert.InDelta(t, 1.05, lines[0].metricValue, 1e-9)
+	assert.Equal(t, "k6.group_duration.p95", lines[1].metricKeyName)
+	assert.InDelta(t, 1.905, lines[1].metricValue, 1e-9)
+	assert.Equal(t, "k6.group_duration.count", lines[2].metricKeyName)
+	assert.Contains(t, lines[2].toText(), " count,delta=20")
+	assert.Equal(t, "::checkout::payment", lines[3].metricDimensions[groupTag])
+
+	assert.Empty(t, o.groupRollupMetrics(now), "the rollups cover one flush")
+}
@@ -0,0 +1,100 @@
+package dynatracewriter
+
+import (
+	"sync"
+
+	"go.k6.io/k6/metrics"
+)
+
+// MetricLine is a converted metric line, as the pre-send hooks see it.
+type MetricLine struct {
+	Key        string
+	Dimensions map[string]string
+	Value      float64
+	// Delta sends the value as a counter increment
+	Delta bool
+	Unit  string
+	// Timestamp is in unix milliseconds, Dynatrace uses the time the line
+	// was received when it is 0
+	Timestamp int64
+
+	// source is the index + 1 of the converted metric the line comes
+	// from, 0 for the lines added by a hook
+	source int
+}
+
+// PreSendHook receives the lines of a flush before they are serialized and
+// returns the lines to send. It may modify, filter or add lines, e.g. to
+// apply site-specific naming or dimension conventions.
+type PreSendHook func(lines []MetricLine) []MetricLine
+
+var (
+	preSendHooksMu sync.Mutex
+	preSendHooks   []PreSendHook
+)
+
+// RegisterPreSendHook adds a hook to every output created afterwards,
+// usually from the init function of an extension built along with this
+// one.
+func RegisterPreSendHook(hook PreSendHook) {
+	preSendHooksMu.Lock()
+	defer preSendHooksMu.Unlock()
+	preSendHooks = append(preSendHooks, hook)
+}
+
+func registeredPreSendHooks() []PreSendHook {
+	preSendHooksMu.Lock()
+	defer preSendHooksMu.Unlock()
+	return append([]PreSendHook(nil), preSendHooks...)
+}
+
+// AddPreSendHook adds a hook to the output, it must be called before the
+// output starts.
+func (o *Output) AddPreSendHook(hook PreSendHook) {
+	o.hooks = append(o.hooks, hook)
+}
+
+// applyPreSendHooks runs the hooks over the lines of the flush, in the
+// order they were added.
+func (o *Output) applyPreSendHooks(dynMetrics []dynatraceMetric) []dynatraceMetric {
+	if len(o.hooks) == 0 {
+		return dynMetrics
+	}
+
+	lines := make([]MetricLine, len(dynMetrics))
+	for i, m := range dynMetrics {
+		lines[i] = MetricLine{
+			Key: m.metricKeyName,
+			// the dimensions of the cached series are shared
+			Dimensions: addDimensions(make(map[string]string, len(m.metricDimensions)), m.metricDimensions),
+			Value:      m.metricValue,
+			Delta:      m.delta,
+			Unit:       m.metricUnit,
+			Timestamp:  m.metricTimeStamp,
+			source:     i + 1,
+		}
+	}
+	for _, hook := range o.hooks {
+		lines = hook(lines)
+	}
+
+	result := make([]dynatraceMetric, 0, len(lines))
+	for _, line := range lines {
+		m := dynatraceMetric{metricType: metrics.Gauge}
+		if line.source > 0 && line.source <= len(dynMetrics) {
+			m = dynMetrics[line.source-1]
+			m.cached = nil
+		}
+		if line.Delta {
+			m.metricType = metrics.Counter
+		}
+		m.metricKeyName = line.Key
+		m.metricDimensions = line.Dimensions
+		m.metricValue = line.Value
+		m.delta = line.Delta
+		m.metricUnit = line.Unit
+		m.metricTimeStamp = line.Timestamp
+		result = append(result, m)
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package dynatracewriter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+)
+
+func TestPreSendHooks(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", nil)
+	series := newCachedSeries(dynatraceMetric{
+		metricKeyName:    "k6.http_reqs",
+		metricDimensions: map[string]string{"url": "/a"},
+		metricType:       metrics.Counter,
+		delta:            true,
+	})
+	counter := series.template
+	counter.cached = series
+	counter.metricValue = 1
+	vus := dynatraceMetric{metricKeyName: "k6.vus", metricValue: 10, metricType: metrics.Gauge, description: "k6 gauge metric vus"}
+
+	o.AddPreSendHook(func(lines []MetricLine) []MetricLine {
+		var kept []MetricLine
+		for _, line := range lines {
+			if line.Key == "k6.vus" {
+				continue
+			}
+			line.Key = strings.Replace(line.Key, "k6.", "acme.loadtest.", 1)
+			line.Dimensions["team"] = "checkout"
+			kept = append(kept, line)
+		}
+		return append(kept, MetricLine{Key: "acme.loadtest.marker", Value: 1})
+	})
+	o.AddPreSendHook(func(lines []MetricLine) []MetricLine {
+		for i := range lines {
+			lines[i].Dimensions = addDimensions(lines[i].Dimensions, map[string]string{"site": "eu"})
+		}
+		return lines
+	})
+
+	result := o.applyPreSendHooks([]dynatraceMetric{counter, vus})
+	require.Len(t, result, 2)
+	assert.True(t, strings.HasPrefix(result[0].toText(), "acme.loadtest.http_reqs,"))
+	assert.True(t, strings.HasSuffix(result[0].toText(), " count,delta=1"))
+	assert.Equal(t, map[string]string{"url": "/a", "team": "checkout", "site": "eu"}, result[0].metricDimensions)
+	assert.True(t, result[0].delta)
+	assert.Nil(t, result[0].cached)
+	assert.Equal(t, "acme.loadtest.marker", result[1].metricKeyName)
+	assert.Equal(t, metrics.Gauge, result[1].metricType)
+	assert.Empty(t, result[1].description)
+
+	// the hooks don't modify the cached series
+	assert.Equal(t, map[string]string{"url": "/a"}, series.template.metricDimensions)
+}
+
+func TestRegisterPreSendHook(t *testing.T) {
+	// not parallel, the hooks are global
+	preSendHooksMu.Lock()
+	registered := preSendHooks
+	preSendHooksMu.Unlock()
+	defer func() {
+		preSendHooksMu.Lock()
+		preSendHooks = registered
+		preSendHooksMu.Unlock()
+	}()
+
+	RegisterPreSendHook(func(lines []MetricLine) []MetricLine { return nil })
+	o := newTestOutput(t, "http://localhost", nil)
+	assert.Len(t, o.hooks, len(registered)+1)
+	assert.Empty(t, o.applyPreSendHooks([]dynatraceMetric{{metricKeyName: "k6.vus"}}))
+}
@@ -0,0 +1,69 @@
+package dynatracewriter
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const hostEntityDimension = "dt.entity.host"
+
+// oneAgentMetadataFiles are the enrichment files of a local OneAgent. The
+// first one is virtual: the OneAgent answers its read with the path of the
+// actual properties file.
+var oneAgentMetadataFiles = []string{
+	"dt_metadata_e617c525669e072eebe3d0f08212e8f2.properties",
+	"/var/lib/dynatrace/enrichment/dt_host_metadata.properties",
+}
+
+// readOneAgentMetadata returns the properties written by a local OneAgent,
+// or nil if there is none.
+func readOneAgentMetadata(files []string) map[string]string {
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if target := strings.TrimSpace(string(content)); !strings.Contains(target, "=") {
+			if content, err = ioutil.ReadFile(target); err != nil {
+				continue
+			}
+		}
+
+		properties := make(map[string]string)
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			kv := strings.SplitN(scanner.Text(), "=", 2)
+			if len(kv) == 2 {
+				properties[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+		return properties
+	}
+	return nil
+}
+
+// addHostDimensions attaches the name of the load generator and, if a
+// OneAgent monitors it, its host entity, so the saturation of the
+// generator can be correlated with the test metrics.
+func (o *Output) addHostDimensions(files []string) {
+	if !o.config.HostMetadata.Bool {
+		return
+	}
+	if o.config.Dimensions == nil {
+		o.config.Dimensions = make(map[string]string)
+	}
+
+	if _, ok := o.config.Dimensions["host.name"]; !ok {
+		if hostname, err := os.Hostname(); err == nil {
+			o.config.Dimensions["host.name"] = hostname
+		}
+	}
+	if _, ok := o.config.Dimensions[hostEntityDimension]; !ok {
+		if entity := readOneAgentMetadata(files)[hostEntityDimension]; entity != "" {
+			o.config.Dimensions[hostEntityDimension] = entity
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package dynatracewriter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestAddHostDimensions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	properties := filepath.Join(dir, "dt_host_metadata.properties")
+	require.NoError(t, ioutil.WriteFile(properties, []byte("dt.entity.host=HOST-0123456789ABCDEF\nhost.name=generator\n"), 0o600))
+	magic := filepath.Join(dir, "magic.properties")
+	require.NoError(t, ioutil.WriteFile(magic, []byte(properties), 0o600))
+
+	assert.Equal(t, "HOST-0123456789ABCDEF", readOneAgentMetadata([]string{filepath.Join(dir, "missing"), magic})[hostEntityDimension])
+	assert.Equal(t, "generator", readOneAgentMetadata([]string{properties})["host.name"])
+	assert.Nil(t, readOneAgentMetadata([]string{filepath.Join(dir, "missing")}))
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	o := newTestOutput(t, "http://localhost", nil)
+	o.addHostDimensions([]string{magic})
+	assert.Equal(t, hostname, o.config.Dimensions["host.name"])
+	assert.Equal(t, "HOST-0123456789ABCDEF", o.config.Dimensions[hostEntityDimension])
+
+	o = newTestOutput(t, "http://localhost", func(c *Config) {
+		c.HostMetadata = null.BoolFrom(false)
+	})
+	o.addHostDimensions([]string{magic})
+	assert.NotContains(t, o.config.Dimensions, "host.name")
+}
@@ -0,0 +1,77 @@
+package dynatracewriter
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// requestTimings records the phases of a request to Dynatrace for the
+// debugTransport mode, telling a slow endpoint from a slow network.
+type requestTimings struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dns          time.Duration
+	connectStart time.Time
+	connect      time.Duration
+	tlsStart     time.Time
+	tls          time.Duration
+	ttfb         time.Duration
+	reused       bool
+}
+
+// traceRequest returns the request instrumented to record its timings.
+func traceRequest(request *http.Request) (*http.Request, *requestTimings) {
+	t := &requestTimings{start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.record(func() { t.reused = info.Reused })
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.record(func() { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.record(func() { t.dns = time.Since(t.dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			t.record(func() { t.connectStart = time.Now() })
+		},
+		ConnectDone: func(string, string, error) {
+			t.record(func() { t.connect = time.Since(t.connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			t.record(func() { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.record(func() { t.tls = time.Since(t.tlsStart) })
+		},
+		GotFirstResponseByte: func() {
+			t.record(func() { t.ttfb = time.Since(t.start) })
+		},
+	}
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), trace)), t
+}
+
+// record runs update under the lock, the dial hooks may run concurrently.
+func (t *requestTimings) record(update func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	update()
+}
+
+func (t *requestTimings) fields() logrus.Fields {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return logrus.Fields{
+		"dns":          t.dns.String(),
+		"connect":      t.connect.String(),
+		"tlsHandshake": t.tls.String(),
+		"ttfb":         t.ttfb.String(),
+		"connReused":   t.reused,
+	}
+}
@@ -0,0 +1,52 @@
+package dynatracewriter
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// serviceAccountNamespaceFile holds the namespace of the pod, mounted with
+// the service account token.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// k8sDimensions maps the Kubernetes dimensions to the variables they are
+// read from, usually set with the Downward API, in order of preference.
+var k8sDimensions = []struct {
+	dimension string
+	env       []string
+}{
+	{"k8s.namespace.name", []string{"K8S_NAMESPACE_NAME", "POD_NAMESPACE"}},
+	{"k8s.pod.name", []string{"K8S_POD_NAME", "POD_NAME", "HOSTNAME"}},
+	{"k8s.node.name", []string{"K8S_NODE_NAME", "NODE_NAME"}},
+	{"k8s.job.name", []string{"K8S_JOB_NAME", "JOB_NAME"}},
+}
+
+// addK8sDimensions attaches the Kubernetes metadata of the pod k6 runs in,
+// e.g. a k6-operator runner, as dimensions, so that the data of a
+// distributed test can be split per pod. Configured dimensions win.
+func addK8sDimensions(conf *Config, env map[string]string) {
+	if env["KUBERNETES_SERVICE_HOST"] == "" {
+		return
+	}
+	if conf.Dimensions == nil {
+		conf.Dimensions = make(map[string]string)
+	}
+
+	for _, d := range k8sDimensions {
+		if _, ok := conf.Dimensions[d.dimension]; ok {
+			continue
+		}
+		for _, name := range d.env {
+			if value := env[name]; value != "" {
+				conf.Dimensions[d.dimension] = value
+				break
+			}
+		}
+	}
+
+	if _, ok := conf.Dimensions["k8s.namespace.name"]; !ok {
+		if namespace, err := ioutil.ReadFile(serviceAccountNamespaceFile); err == nil {
+			conf.Dimensions["k8s.namespace.name"] = strings.TrimSpace(string(namespace))
+		}
+	}
+}
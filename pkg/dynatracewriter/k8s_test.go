@@ -0,0 +1,39 @@
+package dynatracewriter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestK8sDimensions(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+		"POD_NAMESPACE":           "load",
+		"POD_NAME":                "k6-test-1-abcde",
+		"HOSTNAME":                "ignored",
+		"NODE_NAME":               "node-7",
+		"K6_DYNATRACE_DIMENSIONS": "k8s.job.name=explicit",
+		"JOB_NAME":                "k6-test-1",
+	}
+	c, err := GetConsolidatedConfig(nil, nil, env, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"k8s.namespace.name": "load",
+		"k8s.pod.name":       "k6-test-1-abcde",
+		"k8s.node.name":      "node-7",
+		"k8s.job.name":       "explicit",
+	}, c.Dimensions)
+
+	c, err = GetConsolidatedConfig(nil, nil, map[string]string{"POD_NAME": "k6"}, "")
+	require.NoError(t, err)
+	assert.Empty(t, c.Dimensions, "only inside Kubernetes")
+
+	env["K6_DYNATRACE_K8S_METADATA"] = "false"
+	c, err = GetConsolidatedConfig(nil, nil, env, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"k8s.job.name": "explicit"}, c.Dimensions)
+}
@@ -0,0 +1,145 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.k6.io/k6/lib/consts"
+	"go.k6.io/k6/metrics"
+	"go.k6.io/k6/output"
+)
+
+const (
+	testResultMetric = "test.result"
+
+	testResultPassed = "passed"
+	testResultFailed = "failed"
+)
+
+// testInfo describes the test script and its execution options, attached
+// to the lifecycle events and as dimensions to the k6.test.* metrics.
+type testInfo struct {
+	script    string
+	k6Version string
+	vus       string
+	duration  string
+	stages    string
+	scenarios string
+}
+
+func newTestInfo(params output.Params) testInfo {
+	info := testInfo{k6Version: consts.Version}
+	if params.ScriptPath != nil {
+		info.script = path.Base(params.ScriptPath.Path)
+	}
+
+	options := params.ScriptOptions
+	if options.VUs.Valid {
+		info.vus = fmt.Sprint(options.VUs.Int64)
+	}
+	if options.Duration.Valid {
+		info.duration = options.Duration.String()
+	}
+
+	stages := make([]string, 0, len(options.Stages))
+	for _, stage := range options.Stages {
+		stages = append(stages, fmt.Sprintf("%s:%d", stage.Duration.String(), stage.Target.Int64))
+	}
+	info.stages = strings.Join(stages, ",")
+
+	scenarios := make([]string, 0, len(options.Scenarios))
+	for name := range options.Scenarios {
+		scenarios = append(scenarios, name)
+	}
+	sort.Strings(scenarios)
+	info.scenarios = strings.Join(scenarios, ",")
+
+	return info
+}
+
+func (i testInfo) properties() map[string]string {
+	properties := make(map[string]string)
+	for key, value := range map[string]string{
+		"script":     i.script,
+		"k6_version": i.k6Version,
+		"vus":        i.vus,
+		"duration":   i.duration,
+		"stages":     i.stages,
+		"scenarios":  i.scenarios,
+	} {
+		if value != "" {
+			properties[key] = value
+		}
+	}
+	return properties
+}
+
+// sendLifecycleEvent annotates the start or the end of the test in
+// Dynatrace, with the extra properties next to the test description.
+func (o *Output) sendLifecycleEvent(title string, start, end time.Time, extra map[string]string) {
+	if !o.config.LifecycleEvents.Bool {
+		return
+	}
+
+	event := dynatraceEvent{
+		EventType:  eventTypeCustomInfo,
+		Title:      title,
+		StartTime:  start.UnixMilli(),
+		Properties: addDimensions(o.testInfo.properties(), extra),
+	}
+	if !end.IsZero() {
+		event.EndTime = end.UnixMilli()
+	}
+	if err := o.sendEvent(event); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to send the lifecycle event")
+	}
+}
+
+// testResult returns the outcome of the test: failed when the run ended
+// with an error, like an abort or a script exception, or when one of the
+// thresholds failed, with the reason.
+func (o *Output) testResult(testRunErr error) (string, string) {
+	if testRunErr != nil {
+		return testResultFailed, testRunErr.Error()
+	}
+
+	o.thresholds.mu.Lock()
+	defer o.thresholds.mu.Unlock()
+	o.thresholds.evaluate(time.Now())
+	var crossed []string
+	for name, thresholds := range o.thresholds.evaluated {
+		for _, threshold := range thresholds.Thresholds {
+			if threshold.LastFailed {
+				crossed = append(crossed, name+" "+threshold.Source)
+			}
+		}
+	}
+	if len(crossed) == 0 {
+		return testResultPassed, ""
+	}
+	sort.Strings(crossed)
+	return testResultFailed, "thresholds crossed: " + strings.Join(crossed, ", ")
+}
+
+// sendTestResult pushes a k6.test.result gauge, 1 when the test passed and
+// 0 when it failed, so test outcomes can be charted and alerted on.
+func (o *Output) sendTestResult(result string, now time.Time) {
+	value := 1.0
+	if result == testResultFailed {
+		value = 0
+	}
+	dims := addDimensions(o.testInfo.properties(), o.config.Dimensions)
+	dims[testRunIDDimension] = o.config.TestRunID.String
+	o.sendMetrics([]dynatraceMetric{{
+		metricKeyName:    o.metricKey(testResultMetric),
+		description:      "k6 test result, 1 when passed and 0 when failed",
+		metricUnit:       "Unspecified",
+		metricDimensions: dims,
+		metricValue:      value,
+		metricTimeStamp:  o.aggregateTimestamp(now),
+		metricType:       metrics.Gauge,
+	}})
+}
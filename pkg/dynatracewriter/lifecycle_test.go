@@ -0,0 +1,117 @@
+package dynatracewriter
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/consts"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/metrics"
+	"go.k6.io/k6/output"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestNewTestInfo(t *testing.T) {
+	t.Parallel()
+
+	info := newTestInfo(output.Params{
+		ScriptPath: &url.URL{Scheme: "file", Path: "/scripts/checkout.js"},
+		ScriptOptions: lib.Options{
+			VUs: null.IntFrom(10),
+			Stages: []lib.Stage{
+				{Duration: types.NullDurationFrom(30 * time.Second), Target: null.IntFrom(10)},
+				{Duration: types.NullDurationFrom(time.Minute), Target: null.IntFrom(0)},
+			},
+		},
+	})
+	assert.Equal(t, map[string]string{
+		"script":     "checkout.js",
+		"k6_version": consts.Version,
+		"vus":        "10",
+		"stages":     "30s:10,1m0s:0",
+	}, info.properties())
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	t.Parallel()
+
+	recorder := &eventRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.LifecycleEvents = null.BoolFrom(true)
+		c.EventsEntitySelector = null.StringFrom(`type(SERVICE),tag("checkout")`)
+	})
+	o.testInfo = testInfo{script: "checkout.js"}
+
+	start := time.Now()
+	o.sendLifecycleEvent("k6 load test started", start, time.Time{}, nil)
+	o.sendLifecycleEvent("k6 load test failed", start, start.Add(time.Minute), map[string]string{"result": "failed"})
+
+	require.Len(t, recorder.events, 2)
+	assert.Equal(t, eventTypeCustomInfo, recorder.events[0].EventType)
+	assert.Equal(t, "k6 load test started", recorder.events[0].Title)
+	assert.Equal(t, `type(SERVICE),tag("checkout")`, recorder.events[0].EntitySelector)
+	assert.Equal(t, int64(0), recorder.events[0].EndTime)
+	assert.Equal(t, "checkout.js", recorder.events[1].Properties["script"])
+	assert.Equal(t, "run", recorder.events[1].Properties["test_run_id"])
+	assert.Equal(t, "failed", recorder.events[1].Properties["result"])
+	assert.Equal(t, start.Add(time.Minute).UnixMilli(), recorder.events[1].EndTime)
+}
+
+func TestTestResult(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", nil)
+
+	result, reason := o.testResult(nil)
+	assert.Equal(t, testResultPassed, result)
+	assert.Empty(t, reason)
+
+	result, reason = o.testResult(errors.New("test aborted"))
+	assert.Equal(t, testResultFailed, result)
+	assert.Equal(t, "test aborted", reason)
+
+	o.SetThresholds(map[string]metrics.Thresholds{
+		"http_req_duration": {Thresholds: []*metrics.Threshold{{Source: "p(95)<500"}}},
+	})
+	metric := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	o.thresholds.observe(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric}, Time: time.Now(), Value: 100})
+	result, _ = o.testResult(nil)
+	assert.Equal(t, testResultPassed, result)
+
+	o.thresholds.observe(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric}, Time: time.Now(), Value: 900})
+	result, reason = o.testResult(nil)
+	assert.Equal(t, testResultFailed, result)
+	assert.Equal(t, "thresholds crossed: http_req_duration p(95)<500", reason)
+}
+
+func TestTestResultDimensions(t *testing.T) {
+	t.Parallel()
+
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, nil)
+	o.testInfo = testInfo{script: "checkout.js", k6Version: "0.45.0", vus: "10"}
+	o.sendTestResult(testResultPassed, time.Now())
+	line := findLine(t, strings.Split(body, "\n"), "k6.test.result,")
+	assert.Contains(t, line, `script="checkout.js"`)
+	assert.Contains(t, line, `k6_version="0.45.0"`)
+	assert.Contains(t, line, `vus="10"`)
+}
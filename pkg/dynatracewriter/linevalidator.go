@@ -0,0 +1,304 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxLineMetricKeyLength    = 250
+	maxLineDimensionKeyLength = 100
+	maxLineDimensionValueSize = 255
+	maxLineDimensions         = 50
+)
+
+// lineError locates the first rule of the line protocol a metric line
+// breaks.
+type lineError struct {
+	// column is the position of the faulty character, from 1
+	column int
+	rule   string
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.column, e.rule)
+}
+
+// lineValidator checks metric lines against the line protocol of the
+// metrics ingest API, e.g. k6.http_reqs,url="/a" count,delta=1 1700000000000
+type lineValidator struct {
+	line string
+	pos  int
+}
+
+// validateLine returns the first problem of the metric line, nil when the
+// ingest API accepts it. Metadata lines, starting with #, are not checked.
+func validateLine(line string) error {
+	if strings.HasPrefix(line, "#") {
+		return nil
+	}
+	v := &lineValidator{line: line}
+	if err := v.metricKey(); err != nil {
+		return err
+	}
+	if err := v.dimensions(); err != nil {
+		return err
+	}
+	if err := v.expect(' ', "expected a space before the payload"); err != nil {
+		return err
+	}
+	if err := v.payload(); err != nil {
+		return err
+	}
+	return v.timestamp()
+}
+
+func (v *lineValidator) fail(pos int, format string, args ...interface{}) error {
+	return &lineError{column: pos + 1, rule: fmt.Sprintf(format, args...)}
+}
+
+func (v *lineValidator) peek() byte {
+	if v.pos < len(v.line) {
+		return v.line[v.pos]
+	}
+	return 0
+}
+
+func (v *lineValidator) expect(c byte, rule string) error {
+	if v.peek() != c {
+		return v.fail(v.pos, rule)
+	}
+	v.pos++
+	return nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// metricKey checks the key is made of sections separated by dots, the
+// first one starting with a letter.
+func (v *lineValidator) metricKey() error {
+	start := v.pos
+	sectionStart := true
+	for ; v.pos < len(v.line); v.pos++ {
+		c := v.line[v.pos]
+		switch {
+		case c == ' ' || c == ',':
+			if sectionStart {
+				return v.fail(v.pos, "metric key can't be empty or end with a dot")
+			}
+			if v.pos-start > maxLineMetricKeyLength {
+				return v.fail(start+maxLineMetricKeyLength, "metric key longer than %d characters", maxLineMetricKeyLength)
+			}
+			return nil
+		case c == '.':
+			if sectionStart {
+				return v.fail(v.pos, "metric key sections can't be empty")
+			}
+			sectionStart = true
+		case v.pos == start && !isLetter(c):
+			return v.fail(v.pos, "metric key must start with a letter")
+		case sectionStart && !isLetter(c) && c != '_':
+			return v.fail(v.pos, "metric key sections must start with a letter or _")
+		case !isLetter(c) && !isDigit(c) && c != '_' && c != '-':
+			return v.fail(v.pos, "invalid character %q in metric key, expected letters, digits, _ or -", c)
+		default:
+			sectionStart = false
+		}
+	}
+	return v.fail(v.pos, "missing payload after the metric key")
+}
+
+// dimensions checks the comma separated key=value dimensions.
+func (v *lineValidator) dimensions() error {
+	count := 0
+	for v.peek() == ',' {
+		v.pos++
+		count++
+		if count > maxLineDimensions {
+			return v.fail(v.pos, "more than %d dimensions", maxLineDimensions)
+		}
+		if err := v.dimensionKey(); err != nil {
+			return err
+		}
+		if err := v.expect('=', "expected = after the dimension key"); err != nil {
+			return err
+		}
+		if err := v.dimensionValue(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *lineValidator) dimensionKey() error {
+	start := v.pos
+	for ; v.pos < len(v.line) && v.line[v.pos] != '='; v.pos++ {
+		c := v.line[v.pos]
+		switch {
+		case v.pos == start && !isLetter(c):
+			return v.fail(v.pos, "dimension key must start with a letter")
+		case !isLetter(c) && !isDigit(c) && !strings.ContainsRune("_.:-", rune(c)):
+			return v.fail(v.pos, "invalid character %q in dimension key, expected letters, digits or _.:-", c)
+		}
+	}
+	if v.pos == start {
+		return v.fail(v.pos, "dimension key can't be empty")
+	}
+	if v.pos-start > maxLineDimensionKeyLength {
+		return v.fail(start+maxLineDimensionKeyLength, "dimension key longer than %d characters", maxLineDimensionKeyLength)
+	}
+	return nil
+}
+
+// dimensionValue checks a quoted value, where " and \ are escaped, or an
+// unquoted one without spaces, commas or quotes.
+func (v *lineValidator) dimensionValue() error {
+	start := v.pos
+	if v.peek() != '"' {
+		for ; v.pos < len(v.line); v.pos++ {
+			c := v.line[v.pos]
+			if c == ' ' || c == ',' {
+				break
+			}
+			if c == '"' || c == '=' {
+				return v.fail(v.pos, "invalid character %q in unquoted dimension value, quote the value", c)
+			}
+		}
+		if v.pos == start {
+			return v.fail(v.pos, "dimension value can't be empty")
+		}
+		return v.valueLength(start, v.pos-start)
+	}
+
+	v.pos++
+	for ; v.pos < len(v.line); v.pos++ {
+		switch v.line[v.pos] {
+		case '\\':
+			v.pos++
+		case '"':
+			v.pos++
+			return v.valueLength(start, v.pos-start-2)
+		}
+	}
+	return v.fail(start, "unterminated quoted dimension value")
+}
+
+func (v *lineValidator) valueLength(start, length int) error {
+	if length > maxLineDimensionValueSize {
+		return v.fail(start, "dimension value longer than %d characters", maxLineDimensionValueSize)
+	}
+	return nil
+}
+
+// payload checks a gauge, a gauge summary or a counter payload:
+// 10, gauge,10, gauge,min=1,max=3,sum=4,count=2 or count,delta=1
+func (v *lineValidator) payload() error {
+	rest := v.line[v.pos:]
+	switch {
+	case strings.HasPrefix(rest, "count,delta="):
+		v.pos += len("count,delta=")
+		return v.number("counter delta")
+	case strings.HasPrefix(rest, "count,"):
+		v.pos += len("count,")
+		return v.fail(v.pos, "counters must be sent as count,delta=")
+	case strings.HasPrefix(rest, "gauge,min="):
+		v.pos += len("gauge,")
+		for i, field := range []string{"min", "max", "sum", "count"} {
+			if i > 0 {
+				if err := v.expect(',', "expected ,"+field+"= in the gauge summary"); err != nil {
+					return err
+				}
+			}
+			if !strings.HasPrefix(v.line[v.pos:], field+"=") {
+				return v.fail(v.pos, "expected %s= in the gauge summary", field)
+			}
+			v.pos += len(field) + 1
+			if err := v.number("gauge " + field); err != nil {
+				return err
+			}
+		}
+		return nil
+	case strings.HasPrefix(rest, "gauge,"):
+		v.pos += len("gauge,")
+	}
+	return v.number("value")
+}
+
+func (v *lineValidator) number(what string) error {
+	start := v.pos
+	for v.pos < len(v.line) && v.line[v.pos] != ' ' && v.line[v.pos] != ',' {
+		v.pos++
+	}
+	value, err := strconv.ParseFloat(v.line[start:v.pos], 64)
+	if err != nil || start == v.pos {
+		return v.fail(start, "invalid %s %q, expected a number", what, v.line[start:v.pos])
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return v.fail(start, "invalid %s %q, NaN and infinite values are rejected", what, v.line[start:v.pos])
+	}
+	return nil
+}
+
+// timestamp checks the optional unix milliseconds timestamp ending the
+// line.
+func (v *lineValidator) timestamp() error {
+	if v.pos == len(v.line) {
+		return nil
+	}
+	if err := v.expect(' ', "expected a space before the timestamp"); err != nil {
+		return err
+	}
+	start := v.pos
+	for ; v.pos < len(v.line); v.pos++ {
+		if !isDigit(v.line[v.pos]) {
+			return v.fail(v.pos, "timestamp must be unix milliseconds")
+		}
+	}
+	if v.pos == start {
+		return v.fail(start, "timestamp can't be empty")
+	}
+	return nil
+}
+
+// dropInvalidLines removes the lines the ingest API would reject, when
+// validateLines is set, and reports the first one with the position of its
+// problem.
+func (o *Output) dropInvalidLines(dynMetrics []dynatraceMetric) []dynatraceMetric {
+	if !o.config.ValidateLines.Bool || o.config.ExportFormat.String != exportFormatMint {
+		return dynMetrics
+	}
+
+	var (
+		valid     = dynMetrics[:0]
+		invalid   int
+		firstLine string
+		firstErr  *lineError
+	)
+	for _, m := range dynMetrics {
+		line := m.toText()
+		if err := validateLine(line); err != nil {
+			if invalid == 0 {
+				firstLine, firstErr = line, err.(*lineError)
+			}
+			invalid++
+			continue
+		}
+		valid = append(valid, m)
+	}
+	if invalid > 0 {
+		o.stats.linesInvalid += invalid
+		o.totals.linesInvalid += invalid
+		o.logger.WithField("invalidLines", invalid).
+			Warnf("Dynatrace: dropping the invalid metric lines, the first one at %v\n%s\n%s^",
+				firstErr, firstLine, strings.Repeat(" ", firstErr.column-1))
+	}
+	return valid
+}
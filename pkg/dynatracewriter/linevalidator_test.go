@@ -0,0 +1,69 @@
+package dynatracewriter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestValidateLine(t *testing.T) {
+	t.Parallel()
+
+	for _, line := range []string{
+		"k6.vus 10",
+		`k6.vus,scenario="default",test_run_id=abc 10 1700000000000`,
+		`k6.http_reqs,url="/a \"b\"" count,delta=1`,
+		"k6.http_req_duration gauge,min=1,max=3,sum=4,count=2 1700000000000",
+		"k6.vus gauge,1.5e+06",
+		"#k6.vus gauge dt.meta.unit=Count",
+	} {
+		assert.NoError(t, validateLine(line), line)
+	}
+
+	for _, tc := range []struct {
+		line   string
+		column int
+		rule   string
+	}{
+		{"6k.vus 10", 1, "metric key must start with a letter"},
+		{"k6..vus 10", 4, "metric key sections can't be empty"},
+		{"k6.v$us 10", 5, `invalid character '$' in metric key`},
+		{"k6.vus", 7, "missing payload after the metric key"},
+		{`k6.vus,1scenario="a" 10`, 8, "dimension key must start with a letter"},
+		{`k6.vus,scenario 10`, 16, "invalid character ' ' in dimension key"},
+		{`k6.vus,scenario="a 10`, 17, "unterminated quoted dimension value"},
+		{`k6.vus,scenario=a"b 10`, 18, "invalid character '\"' in unquoted dimension value"},
+		{"k6.vus ten", 8, `invalid value "ten", expected a number`},
+		{"k6.vus NaN", 8, "NaN and infinite values are rejected"},
+		{"k6.http_reqs count,1", 20, "counters must be sent as count,delta="},
+		{"k6.vus gauge,min=1,max=3,count=2", 26, "expected sum= in the gauge summary"},
+		{"k6.vus 10 17000s", 16, "timestamp must be unix milliseconds"},
+		{"k6." + strings.Repeat("a", 250) + " 1", 251, "metric key longer than 250 characters"},
+	} {
+		err := validateLine(tc.line)
+		require.Error(t, err, tc.line)
+		lineErr, ok := err.(*lineError)
+		require.True(t, ok)
+		assert.Equal(t, tc.column, lineErr.column, tc.line)
+		assert.Contains(t, lineErr.rule, tc.rule, tc.line)
+	}
+}
+
+func TestDropInvalidLines(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.ValidateLines = null.BoolFrom(true)
+	})
+	lines := o.dropInvalidLines([]dynatraceMetric{
+		{metricKeyName: "k6.vus", metricValue: 1},
+		{metricKeyName: "k6.bad key", metricValue: 1},
+		{metricKeyName: "k6.iterations", metricValue: 2, delta: true},
+	})
+	require.Len(t, lines, 2)
+	assert.Equal(t, "k6.iterations", lines[1].metricKeyName)
+	assert.Equal(t, 1, o.totals.linesInvalid)
+}
@@ -0,0 +1,65 @@
+package dynatracewriter
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// newOutputLogger returns the logger of the output: the k6 one, or a copy
+// of it with its own level or format when logLevel, quiet or logFormat are
+// set. The quiet mode only logs the warnings and errors.
+func newOutputLogger(base logrus.FieldLogger, conf *Config) (logrus.FieldLogger, error) {
+	switch conf.LogFormat.String {
+	case "", logFormatText, logFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid logFormat %q, expected %s or %s", conf.LogFormat.String, logFormatText, logFormatJSON)
+	}
+	if !conf.Quiet.Bool && conf.LogLevel.String == "" && conf.LogFormat.String == "" {
+		return base, nil
+	}
+
+	var entry *logrus.Entry
+	switch l := base.(type) {
+	case *logrus.Logger:
+		entry = logrus.NewEntry(l)
+	case *logrus.Entry:
+		entry = l
+	default:
+		base.Warn("Dynatrace: the k6 logger can't be copied, logLevel, quiet and logFormat are ignored")
+		return base, nil
+	}
+
+	level := entry.Logger.GetLevel()
+	switch {
+	case conf.Quiet.Bool:
+		level = logrus.WarnLevel
+	case conf.LogLevel.String != "":
+		var err error
+		level, err = logrus.ParseLevel(conf.LogLevel.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid logLevel %q, expected trace, debug, info, warn or error", conf.LogLevel.String)
+		}
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(entry.Logger.Out)
+	switch conf.LogFormat.String {
+	case logFormatJSON:
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	case logFormatText:
+		logger.SetFormatter(&logrus.TextFormatter{})
+	default:
+		logger.SetFormatter(entry.Logger.Formatter)
+	}
+	logger.SetReportCaller(entry.Logger.ReportCaller)
+	// sharing the hooks keeps the lines shipped by the logs option
+	logger.ReplaceHooks(entry.Logger.Hooks)
+	logger.SetLevel(level)
+	return logger.WithFields(entry.Data), nil
+}
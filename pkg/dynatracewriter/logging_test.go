@@ -0,0 +1,81 @@
+package dynatracewriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestOutputLogger(t *testing.T) {
+	t.Parallel()
+
+	base, hook := test.NewNullLogger()
+	base.SetLevel(logrus.InfoLevel)
+	entry := base.WithField("output", "dynatrace")
+
+	c := NewConfig()
+	logger, err := newOutputLogger(entry, &c)
+	require.NoError(t, err)
+	assert.Same(t, entry, logger, "the k6 logger is used as is by default")
+
+	c.LogLevel = null.StringFrom("debug")
+	logger, err = newOutputLogger(entry, &c)
+	require.NoError(t, err)
+	logger.Debug("debug line")
+	require.NotNil(t, hook.LastEntry(), "the hooks of the k6 logger are kept")
+	assert.Equal(t, "debug line", hook.LastEntry().Message)
+	assert.Equal(t, "dynatrace", hook.LastEntry().Data["output"])
+	assert.Equal(t, logrus.InfoLevel, base.GetLevel(), "the k6 level is untouched")
+
+	hook.Reset()
+	c.Quiet = null.BoolFrom(true)
+	logger, err = newOutputLogger(entry, &c)
+	require.NoError(t, err)
+	logger.Info("info line")
+	assert.Nil(t, hook.LastEntry())
+	logger.Warn("warn line")
+	require.NotNil(t, hook.LastEntry())
+
+	c.Quiet = null.BoolFrom(false)
+	c.LogLevel = null.StringFrom("loud")
+	_, err = newOutputLogger(entry, &c)
+	assert.Error(t, err)
+}
+
+func TestJSONFlushRecords(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&out)
+	c := NewConfig()
+	c.Url = server.URL
+	c.ApiToken = null.StringFrom("token")
+	c.LogFormat = null.StringFrom(logFormatJSON)
+	constructed, err := c.ConstructConfig()
+	require.NoError(t, err)
+	o, err := newOutput(constructed, base)
+	require.NoError(t, err)
+	o.flush()
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &record), out.String())
+	assert.Equal(t, "Dynatrace: flush", record["msg"])
+	assert.EqualValues(t, 1, record["lines"], "the heartbeat")
+	assert.EqualValues(t, http.StatusAccepted, record["status"])
+	assert.NotZero(t, record["bytes"])
+	assert.Contains(t, record, "duration")
+}
@@ -0,0 +1,153 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	defaultDynatraceLogsEndPoint = "/api/v2/logs/ingest"
+
+	// maxBufferedLogRecords bounds the memory used when the endpoint is
+	// slower than the script is logging, newer records are dropped.
+	maxBufferedLogRecords = 10000
+
+	logSource = "k6"
+
+	bucketAttribute          = "dt.system.bucket"
+	securityContextAttribute = "dt.security_context"
+)
+
+// logRecord is a Log Ingest API v2 record: content, timestamp, severity
+// and free form attributes.
+type logRecord map[string]string
+
+// logShipper buffers log records until the next flush.
+type logShipper struct {
+	mu      sync.Mutex
+	records []logRecord
+	dropped int
+}
+
+func (s *logShipper) add(record logRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.records) >= maxBufferedLogRecords {
+		s.dropped++
+		return
+	}
+	s.records = append(s.records, record)
+}
+
+func (s *logShipper) take() ([]logRecord, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, dropped := s.records, s.dropped
+	s.records, s.dropped = nil, 0
+	return records, dropped
+}
+
+// logHook forwards the script console output and exceptions, which k6 logs
+// with the "console" and "stacktrace" sources, to the log shipper.
+type logHook struct {
+	output *Output
+}
+
+func (h *logHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *logHook) Fire(entry *logrus.Entry) error {
+	source, _ := entry.Data["source"].(string)
+	if source != "console" && source != "stacktrace" {
+		return nil
+	}
+
+	record := h.output.newLogRecord(entry.Time, entry.Level.String(), entry.Message)
+	record["k6.source"] = source
+	if scenario, ok := entry.Data["scenario"]; ok {
+		record["scenario"] = fmt.Sprint(scenario)
+	}
+	h.output.logs.add(record)
+	return nil
+}
+
+// registerLogHook attaches the hook to the k6 logger, which is either a
+// logger or an entry derived from one.
+func (o *Output) registerLogHook(logger logrus.FieldLogger) {
+	if !o.config.Logs.Bool {
+		return
+	}
+	switch l := logger.(type) {
+	case *logrus.Logger:
+		l.AddHook(&logHook{output: o})
+	case *logrus.Entry:
+		l.Logger.AddHook(&logHook{output: o})
+	default:
+		o.logger.Warn("Dynatrace: the k6 logger does not support hooks, console output won't be shipped")
+	}
+}
+
+func (o *Output) newLogRecord(t time.Time, severity, content string) logRecord {
+	record := logRecord{
+		"content":          content,
+		"timestamp":        t.UTC().Format(time.RFC3339Nano),
+		"severity":         severity,
+		"log.source":       logSource,
+		testRunIDDimension: o.config.TestRunID.String,
+	}
+	o.addGrailAttributes(record)
+	return record
+}
+
+// addGrailAttributes sets the Grail bucket and the security context of the
+// log records and events, if configured.
+func (o *Output) addGrailAttributes(attributes map[string]string) {
+	if o.config.Bucket.String != "" {
+		attributes[bucketAttribute] = o.config.Bucket.String
+	}
+	if o.config.SecurityContext.String != "" {
+		attributes[securityContextAttribute] = o.config.SecurityContext.String
+	}
+}
+
+// observeCheck records a log line for every failed check, unless the
+// failure logs already report them.
+func (o *Output) observeCheck(sample metrics.Sample) {
+	if !o.config.Logs.Bool || o.config.FailureLogs.Bool || sample.Metric.Name != "checks" || sample.Value != 0 {
+		return
+	}
+	tags := sampleTags(sample)
+	record := o.newLogRecord(sample.Time, "warning", "check failed: "+tags["check"])
+	for _, key := range []string{"check", "scenario", "group"} {
+		if value := tags[key]; value != "" {
+			record[key] = value
+		}
+	}
+	o.logs.add(record)
+}
+
+// flushLogs sends the buffered log records.
+func (o *Output) flushLogs() {
+	records, dropped := o.logs.take()
+	if dropped > 0 {
+		o.logger.WithField("records", dropped).Warn("Dynatrace: log buffer full, dropped log records")
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(records)
+	if err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to serialize the log records")
+		return
+	}
+	if err := o.postAPI(defaultDynatraceLogsEndPoint, "application/json; charset=utf-8", body); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to send the log records")
+	}
+}
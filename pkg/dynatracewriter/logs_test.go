@@ -0,0 +1,110 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestLogShipping(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		records []logRecord
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != defaultDynatraceLogsEndPoint {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		var batch []logRecord
+		if !assert.NoError(t, json.Unmarshal(body, &batch)) {
+			return
+		}
+		mu.Lock()
+		records = append(records, batch...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.Logs = null.BoolFrom(true)
+	})
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	o.registerLogHook(logger.WithField("test", true))
+
+	logger.WithField("source", "console").Info("hello")
+	logger.WithFields(logrus.Fields{"source": "stacktrace", "scenario": "main"}).Error("ReferenceError: x is not defined")
+	logger.Warn("not from the script")
+
+	checks := newMetric("checks", metrics.Rate)
+	tags := newTags(map[string]string{"check": "status is 200", "scenario": "main"})
+	o.observeCheck(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks, Tags: tags}, Time: time.Now(), Value: 1})
+	o.observeCheck(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks, Tags: tags}, Time: time.Now(), Value: 0})
+
+	o.flushLogs()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, records, 3)
+	assert.Equal(t, "hello", records[0]["content"])
+	assert.Equal(t, "info", records[0]["severity"])
+	assert.Equal(t, "console", records[0]["k6.source"])
+	assert.Equal(t, "run", records[0][testRunIDDimension])
+	assert.Equal(t, "error", records[1]["severity"])
+	assert.Equal(t, "main", records[1]["scenario"])
+	assert.Equal(t, "check failed: status is 200", records[2]["content"])
+	assert.Equal(t, "status is 200", records[2]["check"])
+	assert.Equal(t, "main", records[2]["scenario"])
+}
+
+func TestLogShipperBound(t *testing.T) {
+	t.Parallel()
+
+	var s logShipper
+	for i := 0; i < maxBufferedLogRecords+5; i++ {
+		s.add(logRecord{"content": "x"})
+	}
+	records, dropped := s.take()
+	assert.Len(t, records, maxBufferedLogRecords)
+	assert.Equal(t, 5, dropped)
+
+	records, dropped = s.take()
+	assert.Empty(t, records)
+	assert.Zero(t, dropped)
+}
+
+func TestGrailAttributes(t *testing.T) {
+	t.Parallel()
+
+	c, err := GetConsolidatedConfig(nil, nil, map[string]string{
+		"K6_DYNATRACE_BUCKET":           "perf_tests",
+		"K6_DYNATRACE_SECURITY_CONTEXT": "team-checkout",
+	}, "")
+	require.NoError(t, err)
+	o, err := newOutput(&c, logrus.New())
+	require.NoError(t, err)
+
+	record := o.newLogRecord(time.Now(), "info", "hello")
+	assert.Equal(t, "perf_tests", record[bucketAttribute])
+	assert.Equal(t, "team-checkout", record[securityContextAttribute])
+
+	properties := map[string]string{}
+	o.config.Bucket = null.StringFrom("")
+	o.addGrailAttributes(properties)
+	assert.Equal(t, map[string]string{securityContextAttribute: "team-checkout"}, properties)
+}
@@ -0,0 +1,137 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultDynatraceSettingsEndPoint = "/api/v2/settings/objects"
+
+	maintenanceWindowSchema = "builtin:alerting.maintenance-window"
+	// the end time is only a safety net in case Stop is never called, the
+	// window is deleted when the test finishes
+	defaultMaintenanceWindowDuration = 2 * time.Hour
+)
+
+type settingsObject struct {
+	SchemaID string      `json:"schemaId"`
+	Scope    string      `json:"scope"`
+	Value    interface{} `json:"value"`
+}
+
+type settingsObjectResponse struct {
+	Code     int    `json:"code"`
+	ObjectID string `json:"objectId"`
+}
+
+type maintenanceWindow struct {
+	Enabled           bool                      `json:"enabled"`
+	GeneralProperties maintenanceWindowGeneral  `json:"generalProperties"`
+	Schedule          maintenanceWindowSchedule `json:"schedule"`
+	Filters           []maintenanceWindowFilter `json:"filters"`
+}
+
+type maintenanceWindowGeneral struct {
+	Name                             string `json:"name"`
+	Description                      string `json:"description"`
+	MaintenanceType                  string `json:"maintenanceType"`
+	Suppression                      string `json:"suppression"`
+	DisableSyntheticMonitorExecution bool   `json:"disableSyntheticMonitorExecution"`
+}
+
+type maintenanceWindowSchedule struct {
+	ScheduleType   string                  `json:"scheduleType"`
+	OnceRecurrence maintenanceWindowWindow `json:"onceRecurrence"`
+}
+
+type maintenanceWindowWindow struct {
+	StartTime string `json:"startTime"`
+	EndTime   string `json:"endTime"`
+	TimeZone  string `json:"timeZone"`
+}
+
+type maintenanceWindowFilter struct {
+	EntityID        string   `json:"entityId,omitempty"`
+	EntityTags      []string `json:"entityTags"`
+	ManagementZones []string `json:"managementZones"`
+}
+
+func (o *Output) newMaintenanceWindow(start time.Time) maintenanceWindow {
+	const layout = "2006-01-02T15:04:05"
+
+	var filters []maintenanceWindowFilter
+	for _, entity := range o.config.MaintenanceWindowEntities {
+		filters = append(filters, maintenanceWindowFilter{EntityID: entity, EntityTags: []string{}, ManagementZones: []string{}})
+	}
+	if len(o.config.MaintenanceWindowTags) > 0 {
+		filters = append(filters, maintenanceWindowFilter{EntityTags: o.config.MaintenanceWindowTags, ManagementZones: []string{}})
+	}
+
+	return maintenanceWindow{
+		Enabled: true,
+		GeneralProperties: maintenanceWindowGeneral{
+			Name:            "k6 load test " + o.config.TestRunID.String,
+			Description:     "Opened by xk6-output-dynatrace for the duration of the load test",
+			MaintenanceType: "PLANNED",
+			Suppression:     "DETECT_PROBLEMS_DONT_ALERT",
+		},
+		Schedule: maintenanceWindowSchedule{
+			ScheduleType: "ONCE",
+			OnceRecurrence: maintenanceWindowWindow{
+				StartTime: start.UTC().Format(layout),
+				EndTime:   start.Add(time.Duration(o.config.MaintenanceWindowDuration.Duration)).UTC().Format(layout),
+				TimeZone:  "UTC",
+			},
+		},
+		Filters: filters,
+	}
+}
+
+// openMaintenanceWindow suppresses the alerts on the selected entities while
+// the test intentionally loads them.
+func (o *Output) openMaintenanceWindow(start time.Time) {
+	if !o.config.MaintenanceWindow.Bool {
+		return
+	}
+
+	body, err := json.Marshal([]settingsObject{{
+		SchemaID: maintenanceWindowSchema,
+		Scope:    "environment",
+		Value:    o.newMaintenanceWindow(start),
+	}})
+	if err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to create the maintenance window")
+		return
+	}
+
+	response, err := o.callAPI(http.MethodPost, defaultDynatraceSettingsEndPoint, "application/json; charset=utf-8", body)
+	if err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to create the maintenance window")
+		return
+	}
+
+	var created []settingsObjectResponse
+	if err := json.Unmarshal(response, &created); err != nil || len(created) == 0 {
+		o.logger.Warnf("Dynatrace: unexpected maintenance window creation response: %s", string(response))
+		return
+	}
+	o.maintenanceWindowID = created[0].ObjectID
+	o.logger.WithField("objectId", o.maintenanceWindowID).Info("Dynatrace: opened the maintenance window")
+}
+
+// closeMaintenanceWindow deletes the maintenance window opened at Start.
+func (o *Output) closeMaintenanceWindow() {
+	if o.maintenanceWindowID == "" {
+		return
+	}
+
+	endpoint := fmt.Sprintf("%s/%s", defaultDynatraceSettingsEndPoint, o.maintenanceWindowID)
+	if _, err := o.callAPI(http.MethodDelete, endpoint, "", nil); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to close the maintenance window")
+		return
+	}
+	o.maintenanceWindowID = ""
+}
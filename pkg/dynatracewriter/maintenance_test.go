@@ -0,0 +1,56 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	t.Parallel()
+
+	var (
+		created []settingsObject
+		deleted []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodPost && req.URL.Path == defaultDynatraceSettingsEndPoint:
+			body, _ := ioutil.ReadAll(req.Body)
+			assert.NoError(t, json.Unmarshal(body, &created))
+			_, _ = w.Write([]byte(`[{"code":200,"objectId":"mw-1"}]`))
+		case req.Method == http.MethodDelete:
+			deleted = append(deleted, req.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.MaintenanceWindow = null.BoolFrom(true)
+		c.MaintenanceWindowTags = []string{"checkout"}
+	})
+
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	o.openMaintenanceWindow(start)
+	require.Len(t, created, 1)
+	assert.Equal(t, maintenanceWindowSchema, created[0].SchemaID)
+	value := created[0].Value.(map[string]interface{})
+	schedule := value["schedule"].(map[string]interface{})["onceRecurrence"].(map[string]interface{})
+	assert.Equal(t, "2022-03-01T10:00:00", schedule["startTime"])
+	assert.Equal(t, "2022-03-01T12:00:00", schedule["endTime"])
+	assert.Equal(t, "mw-1", o.maintenanceWindowID)
+
+	o.closeMaintenanceWindow()
+	o.closeMaintenanceWindow()
+	assert.Equal(t, []string{defaultDynatraceSettingsEndPoint + "/mw-1"}, deleted)
+}
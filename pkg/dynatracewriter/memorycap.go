@@ -0,0 +1,107 @@
+package dynatracewriter
+
+import (
+	"sync/atomic"
+
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	// sampleOverhead approximates the memory of a buffered sample, its
+	// metric and tag set are shared with the other samples
+	sampleOverhead = 64
+	// metadataEntryOverhead approximates the memory of a metadata entry
+	// besides its key and value
+	metadataEntryOverhead = 48
+)
+
+// memoryCap accounts for the approximate memory of the buffered samples,
+// added by the k6 goroutines and taken by the flushing goroutine.
+type memoryCap struct {
+	limit    int64
+	buffered atomic.Int64
+	// dropped counts the samples dropped since the last flush
+	dropped atomic.Int64
+}
+
+// sampleSize approximates the memory of a buffered sample.
+func sampleSize(sample metrics.Sample) int64 {
+	size := int64(sampleOverhead)
+	for key, value := range sample.Metadata {
+		size += int64(len(key) + len(value) + metadataEntryOverhead)
+	}
+	return size
+}
+
+// containersSize approximates the memory of the sample containers and
+// counts their samples.
+func containersSize(containers []metrics.SampleContainer) (size int64, samples int) {
+	for _, container := range containers {
+		for _, sample := range container.GetSamples() {
+			size += sampleSize(sample)
+			samples++
+		}
+	}
+	return size, samples
+}
+
+// AddMetricSamples buffers the samples until the next flush. Once the
+// buffered samples take more than maxMemoryBytes, for instance because the
+// endpoint slowed down, the new samples are dropped until the next flush
+// frees the buffer, except the ones of the critical metrics.
+func (o *Output) AddMetricSamples(containers []metrics.SampleContainer) {
+	if o.memory.limit == 0 {
+		o.SampleBuffer.AddMetricSamples(containers)
+		return
+	}
+
+	kept := make([]metrics.SampleContainer, 0, len(containers))
+	for _, container := range containers {
+		size, samples := containersSize([]metrics.SampleContainer{container})
+		if o.memory.buffered.Load()+size > o.memory.limit {
+			critical := o.criticalSamples(container)
+			o.memory.dropped.Add(int64(samples - len(critical)))
+			if len(critical) == 0 {
+				continue
+			}
+			container = critical
+			size, _ = containersSize([]metrics.SampleContainer{container})
+		}
+		o.memory.buffered.Add(size)
+		kept = append(kept, container)
+	}
+	if len(kept) > 0 {
+		o.SampleBuffer.AddMetricSamples(kept)
+	}
+}
+
+// criticalSamples returns the samples of the container whose metric is
+// critical.
+func (o *Output) criticalSamples(container metrics.SampleContainer) metrics.Samples {
+	var critical metrics.Samples
+	for _, sample := range container.GetSamples() {
+		if o.metricClass(sample) == classCritical {
+			critical = append(critical, sample)
+		}
+	}
+	return critical
+}
+
+// releaseMemory accounts for the samples taken by the flush and reports
+// the samples dropped since the previous one.
+func (o *Output) releaseMemory(containers []metrics.SampleContainer) {
+	if o.memory.limit == 0 {
+		return
+	}
+	size, _ := containersSize(containers)
+	o.memory.buffered.Add(-size)
+
+	dropped := int(o.memory.dropped.Swap(0))
+	if dropped == 0 {
+		return
+	}
+	o.stats.linesDropped += dropped
+	o.totals.linesDropped += dropped
+	o.logger.WithField("samplesDropped", dropped).
+		Warnf("Dynatrace: the buffered samples reached maxMemoryBytes %d, dropping the new samples", o.memory.limit)
+}
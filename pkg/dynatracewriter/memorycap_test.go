@@ -0,0 +1,76 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestMaxMemoryBytes(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.MaxMemoryBytes = null.IntFrom(3 * sampleOverhead)
+	})
+	metric := newMetric("vus", metrics.Gauge)
+	tags := newTags(map[string]string{"scenario": "default"})
+	samples := func(n int) metrics.Samples {
+		s := make(metrics.Samples, n)
+		for i := range s {
+			s[i] = metrics.Sample{
+				TimeSeries: metrics.TimeSeries{Metric: metric, Tags: tags},
+				Time:       time.Now(),
+				Value:      1,
+			}
+		}
+		return s
+	}
+
+	o.AddMetricSamples([]metrics.SampleContainer{samples(2), samples(2), samples(1)})
+	assert.Equal(t, int64(3*sampleOverhead), o.memory.buffered.Load())
+	assert.Equal(t, int64(2), o.memory.dropped.Load())
+
+	buffered := o.GetBufferedSamples()
+	assert.Len(t, buffered, 2)
+	o.releaseMemory(buffered)
+	assert.Zero(t, o.memory.buffered.Load())
+	assert.Zero(t, o.memory.dropped.Load())
+	assert.Equal(t, 2, o.totals.linesDropped)
+
+	// the flush freed the buffer
+	o.AddMetricSamples([]metrics.SampleContainer{samples(2)})
+	assert.Len(t, o.GetBufferedSamples(), 1)
+}
+
+func TestMaxMemoryBytesKeepsCriticalSamples(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.MaxMemoryBytes = null.IntFrom(sampleOverhead)
+	})
+	sample := func(metric *metrics.Metric) metrics.Sample {
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric, Tags: newTags(nil)}, Time: time.Now(), Value: 1}
+	}
+	vus := newMetric("vus", metrics.Gauge)
+	failed := newMetric("http_req_failed", metrics.Rate)
+
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{sample(vus)}})
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Samples{sample(vus), sample(failed)}})
+	assert.Equal(t, int64(1), o.memory.dropped.Load())
+	buffered := o.GetBufferedSamples()
+	require.Len(t, buffered, 2)
+	assert.Equal(t, "http_req_failed", buffered[1].GetSamples()[0].Metric.Name)
+	assert.Equal(t, int64(2*sampleOverhead), o.memory.buffered.Load())
+}
+
+func TestSampleSize(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, int64(sampleOverhead), sampleSize(metrics.Sample{}))
+	assert.Equal(t, int64(sampleOverhead+len("vu")+len("12")+metadataEntryOverhead),
+		sampleSize(metrics.Sample{Metadata: map[string]string{"vu": "12"}}))
+}
@@ -0,0 +1,241 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const metricEventSchema = "builtin:anomaly-detection.metric-events"
+
+// metricEventRule alerts when the aggregation of a k6 metric crosses a
+// static threshold, e.g. "http_req_duration:avg>500".
+type metricEventRule struct {
+	metric      string
+	aggregation string
+	condition   string
+	threshold   float64
+	// filter restricts the rule to the series with these dimensions
+	filter map[string]string
+}
+
+var metricEventRuleRe = regexp.MustCompile(`^\s*([A-Za-z0-9_.]+):(avg|min|max|sum|count|median|percentile90)\s*(<|>)\s*([0-9.]+)\s*$`)
+
+func parseMetricEventRules(exprs []string) ([]metricEventRule, error) {
+	rules := make([]metricEventRule, 0, len(exprs))
+	for _, expr := range exprs {
+		match := metricEventRuleRe.FindStringSubmatch(expr)
+		if match == nil {
+			return nil, fmt.Errorf("invalid metricEvents rule %q, expected metric:aggregation>value", expr)
+		}
+		threshold, err := strconv.ParseFloat(match[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metricEvents rule %q: %w", expr, err)
+		}
+		condition := "ABOVE"
+		if match[3] == "<" {
+			condition = "BELOW"
+		}
+		rules = append(rules, metricEventRule{
+			metric:      match[1],
+			aggregation: strings.ToUpper(match[2]),
+			condition:   condition,
+			threshold:   threshold,
+		})
+	}
+	return rules, nil
+}
+
+type metricEvent struct {
+	Enabled         bool                `json:"enabled"`
+	Summary         string              `json:"summary"`
+	QueryDefinition metricEventQuery    `json:"queryDefinition"`
+	ModelProperties metricEventModel    `json:"modelProperties"`
+	EventTemplate   metricEventTemplate `json:"eventTemplate"`
+	EntityDimension string              `json:"eventEntityDimensionKey"`
+}
+
+type metricEventQuery struct {
+	Type            string                  `json:"type"`
+	MetricKey       string                  `json:"metricKey"`
+	Aggregation     string                  `json:"aggregation"`
+	DimensionFilter []metricEventDimFilter  `json:"dimensionFilter"`
+	EntityFilter    metricEventEntityFilter `json:"entityFilter"`
+}
+
+type metricEventDimFilter struct {
+	DimensionKey   string `json:"dimensionKey"`
+	DimensionValue string `json:"dimensionValue"`
+}
+
+type metricEventEntityFilter struct {
+	DimensionKey string        `json:"dimensionKey"`
+	Conditions   []interface{} `json:"conditions"`
+}
+
+type metricEventModel struct {
+	Type              string  `json:"type"`
+	Threshold         float64 `json:"threshold"`
+	AlertOnNoData     bool    `json:"alertOnNoData"`
+	AlertCondition    string  `json:"alertCondition"`
+	ViolatingSamples  int     `json:"violatingSamples"`
+	Samples           int     `json:"samples"`
+	DealertingSamples int     `json:"dealertingSamples"`
+}
+
+type metricEventTemplate struct {
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	EventType   string        `json:"eventType"`
+	DavisMerge  bool          `json:"davisMerge"`
+	Metadata    []interface{} `json:"metadata"`
+}
+
+type settingsObjectList struct {
+	Items []struct {
+		ObjectID string `json:"objectId"`
+		Value    struct {
+			Summary string `json:"summary"`
+		} `json:"value"`
+	} `json:"items"`
+}
+
+func (o *Output) newMetricEvent(summary string, rule metricEventRule) metricEvent {
+	filters := []metricEventDimFilter{}
+	keys := make([]string, 0, len(rule.filter))
+	for k := range rule.filter {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		filters = append(filters, metricEventDimFilter{DimensionKey: k, DimensionValue: rule.filter[k]})
+	}
+
+	return metricEvent{
+		Enabled: true,
+		Summary: summary,
+		QueryDefinition: metricEventQuery{
+			Type:            "METRIC_KEY",
+			MetricKey:       o.metricKey(rule.metric),
+			Aggregation:     rule.aggregation,
+			DimensionFilter: filters,
+			EntityFilter:    metricEventEntityFilter{Conditions: []interface{}{}},
+		},
+		ModelProperties: metricEventModel{
+			Type:              "STATIC_THRESHOLD",
+			Threshold:         rule.threshold,
+			AlertCondition:    rule.condition,
+			ViolatingSamples:  3,
+			Samples:           5,
+			DealertingSamples: 5,
+		},
+		EventTemplate: metricEventTemplate{
+			Title:       summary,
+			Description: "Raised by the metric event provisioned by xk6-output-dynatrace, {metricname} is {severity}",
+			EventType:   eventTypeCustomAlert,
+			DavisMerge:  true,
+			Metadata:    []interface{}{},
+		},
+	}
+}
+
+// metricEvents returns the metric events to provision: one per configured
+// rule and, if enabled, one per threshold alerting once the
+// k6.threshold.{metric} gauge drops to 0.
+func (o *Output) metricEvents() []metricEvent {
+	var result []metricEvent
+	for _, rule := range o.metricEventRules {
+		direction := ">"
+		if rule.condition == "BELOW" {
+			direction = "<"
+		}
+		summary := fmt.Sprintf("k6 %s %s %s %s", rule.metric, strings.ToLower(rule.aggregation), direction,
+			strconv.FormatFloat(rule.threshold, 'f', -1, 64))
+		result = append(result, o.newMetricEvent(summary, rule))
+	}
+
+	if !o.config.ThresholdMetricEvents.Bool {
+		return result
+	}
+
+	o.thresholds.mu.Lock()
+	defer o.thresholds.mu.Unlock()
+	names := make([]string, 0, len(o.thresholds.thresholds))
+	for name := range o.thresholds.thresholds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, threshold := range o.thresholds.thresholds[name].Thresholds {
+			result = append(result, o.newMetricEvent(
+				fmt.Sprintf("k6 threshold crossed: %s %s", name, threshold.Source),
+				metricEventRule{
+					// metricKey adds the prefix
+					metric:      thresholdMetricPrefix + parentMetricName(name),
+					aggregation: "MIN",
+					condition:   "BELOW",
+					threshold:   1,
+					filter:      map[string]string{thresholdDimension: threshold.Source, metricDimension: name},
+				}))
+		}
+	}
+	return result
+}
+
+// provisionMetricEvents creates the metric events, or updates those with
+// the same summary, so that provisioning on every test run is idempotent.
+func (o *Output) provisionMetricEvents() {
+	events := o.metricEvents()
+	if len(events) == 0 {
+		return
+	}
+
+	existing := make(map[string]string)
+	query := url.Values{
+		"schemaIds": {metricEventSchema},
+		"fields":    {"objectId,value"},
+		"pageSize":  {"500"},
+	}
+	response, err := o.callAPI(http.MethodGet, defaultDynatraceSettingsEndPoint+"?"+query.Encode(), "", nil)
+	if err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to list the metric events")
+		return
+	}
+	var list settingsObjectList
+	if err := json.Unmarshal(response, &list); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to list the metric events")
+		return
+	}
+	for _, item := range list.Items {
+		existing[item.Value.Summary] = item.ObjectID
+	}
+
+	for _, event := range events {
+		if err := o.upsertMetricEvent(event, existing[event.Summary]); err != nil {
+			o.logger.WithError(err).WithField("summary", event.Summary).Warn("Dynatrace: failed to provision the metric event")
+		}
+	}
+}
+
+func (o *Output) upsertMetricEvent(event metricEvent, objectID string) error {
+	if objectID != "" {
+		body, err := json.Marshal(map[string]interface{}{"value": event})
+		if err != nil {
+			return err
+		}
+		_, err = o.callAPI(http.MethodPut, defaultDynatraceSettingsEndPoint+"/"+url.PathEscape(objectID),
+			"application/json; charset=utf-8", body)
+		return err
+	}
+
+	body, err := json.Marshal([]settingsObject{{SchemaID: metricEventSchema, Scope: "environment", Value: event}})
+	if err != nil {
+		return err
+	}
+	return o.postAPI(defaultDynatraceSettingsEndPoint, "application/json; charset=utf-8", body)
+}
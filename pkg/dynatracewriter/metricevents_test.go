@@ -0,0 +1,93 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestParseMetricEventRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := parseMetricEventRules([]string{"http_req_duration:avg>500", "checks:min < 0.95"})
+	require.NoError(t, err)
+	assert.Equal(t, []metricEventRule{
+		{metric: "http_req_duration", aggregation: "AVG", condition: "ABOVE", threshold: 500},
+		{metric: "checks", aggregation: "MIN", condition: "BELOW", threshold: 0.95},
+	}, rules)
+
+	_, err = parseMetricEventRules([]string{"http_req_duration:p95>500"})
+	assert.Error(t, err)
+}
+
+func TestProvisionMetricEvents(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		created []metricEvent
+		updated = make(map[string]metricEvent)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := ioutil.ReadAll(req.Body)
+		switch req.Method {
+		case http.MethodGet:
+			assert.Equal(t, metricEventSchema, req.URL.Query().Get("schemaIds"))
+			fmt.Fprint(w, `{"items":[{"objectId":"obj-1","value":{"summary":"k6 http_req_duration avg > 500"}}]}`)
+		case http.MethodPut:
+			var object struct {
+				Value metricEvent `json:"value"`
+			}
+			assert.NoError(t, json.Unmarshal(body, &object))
+			updated[req.URL.Path] = object.Value
+		case http.MethodPost:
+			var objects []struct {
+				SchemaID string      `json:"schemaId"`
+				Value    metricEvent `json:"value"`
+			}
+			assert.NoError(t, json.Unmarshal(body, &objects))
+			for _, object := range objects {
+				assert.Equal(t, metricEventSchema, object.SchemaID)
+				created = append(created, object.Value)
+			}
+		}
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.MetricEvents = []string{"http_req_duration:avg>500"}
+		c.ThresholdMetricEvents = null.BoolFrom(true)
+	})
+	o.SetThresholds(map[string]metrics.Thresholds{
+		"http_req_failed": {Thresholds: []*metrics.Threshold{{Source: "rate<0.01"}}},
+	})
+	o.provisionMetricEvents()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Contains(t, updated, defaultDynatraceSettingsEndPoint+"/obj-1")
+	rule := updated[defaultDynatraceSettingsEndPoint+"/obj-1"]
+	assert.Equal(t, "k6.http_req_duration", rule.QueryDefinition.MetricKey)
+	assert.Equal(t, "ABOVE", rule.ModelProperties.AlertCondition)
+	assert.Equal(t, 500.0, rule.ModelProperties.Threshold)
+
+	require.Len(t, created, 1)
+	assert.Equal(t, "k6 threshold crossed: http_req_failed rate<0.01", created[0].Summary)
+	assert.Equal(t, "k6.threshold.http_req_failed", created[0].QueryDefinition.MetricKey)
+	assert.Equal(t, []metricEventDimFilter{
+		{DimensionKey: metricDimension, DimensionValue: "http_req_failed"},
+		{DimensionKey: thresholdDimension, DimensionValue: "rate<0.01"},
+	}, created[0].QueryDefinition.DimensionFilter)
+	assert.Equal(t, "BELOW", created[0].ModelProperties.AlertCondition)
+}
@@ -0,0 +1,121 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"regexp"
+
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	builtinMetricsAll     = "all"
+	builtinMetricsMinimal = "minimal"
+	builtinMetricsNone    = "none"
+)
+
+// builtinMetrics lists the metrics emitted by k6 itself, the ones not in
+// the minimal set are internal timings few dashboards look at.
+var builtinMetrics = map[string]bool{
+	"vus":                      true,
+	"vus_max":                  false,
+	"iterations":               true,
+	"iteration_duration":       false,
+	"dropped_iterations":       true,
+	"data_received":            true,
+	"data_sent":                true,
+	"checks":                   true,
+	"group_duration":           false,
+	"http_reqs":                true,
+	"http_req_duration":        true,
+	"http_req_failed":          true,
+	"http_req_blocked":         false,
+	"http_req_connecting":      false,
+	"http_req_tls_handshaking": false,
+	"http_req_sending":         false,
+	"http_req_waiting":         false,
+	"http_req_receiving":       false,
+	"ws_connecting":            false,
+	"ws_ping":                  false,
+	"ws_sessions":              true,
+	"ws_session_duration":      true,
+	"ws_msgs_sent":             true,
+	"ws_msgs_received":         true,
+	"grpc_req_duration":        true,
+}
+
+// metricFilter decides which k6 metrics are exported at all, based on the
+// builtinMetrics preset and the metricsInclude and metricsExclude
+// expressions matched against the whole k6 metric name.
+type metricFilter struct {
+	builtin string
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newMetricFilter(conf *Config) (*metricFilter, error) {
+	builtin := conf.BuiltinMetrics.String
+	switch builtin {
+	case builtinMetricsAll, builtinMetricsMinimal, builtinMetricsNone:
+	default:
+		return nil, fmt.Errorf("invalid builtinMetrics %q, expected %q, %q or %q",
+			builtin, builtinMetricsAll, builtinMetricsMinimal, builtinMetricsNone)
+	}
+
+	include, err := compileAnchored("metricsInclude", conf.MetricsInclude)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileAnchored("metricsExclude", conf.MetricsExclude)
+	if err != nil {
+		return nil, err
+	}
+	return &metricFilter{builtin: builtin, include: include, exclude: exclude}, nil
+}
+
+// keep reports whether the metric should be exported. An empty include list
+// means every metric not excluded is exported.
+func (f *metricFilter) keep(name string) bool {
+	if minimal, isBuiltin := builtinMetrics[name]; isBuiltin {
+		switch {
+		case f.builtin == builtinMetricsNone:
+			return false
+		case f.builtin == builtinMetricsMinimal && !minimal:
+			return false
+		}
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isZeroCountOrRate reports whether the sample is a zero valued counter or
+// rate sample, which dropZeroValues skips.
+func isZeroCountOrRate(sample metrics.Sample) bool {
+	if sample.Value != 0 {
+		return false
+	}
+	return sample.Metric.Type == metrics.Counter || sample.Metric.Type == metrics.Rate
+}
+
+func compileAnchored(option string, exprs []string) ([]*regexp.Regexp, error) {
+	result := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s expression %q: %w", option, expr, err)
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
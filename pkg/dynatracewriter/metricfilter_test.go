@@ -0,0 +1,75 @@
+package dynatracewriter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestMetricFilter(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.MetricsExclude = []string{"data_.*", "vus_max"}
+	f, err := newMetricFilter(&c)
+	require.NoError(t, err)
+	assert.False(t, f.keep("data_sent"))
+	assert.False(t, f.keep("vus_max"))
+	assert.True(t, f.keep("vus"))
+	assert.True(t, f.keep("http_req_duration"))
+
+	c = NewConfig()
+	c.MetricsInclude = []string{"http_req_duration", "custom_.*"}
+	c.MetricsExclude = []string{"custom_debug"}
+	f, err = newMetricFilter(&c)
+	require.NoError(t, err)
+	assert.True(t, f.keep("http_req_duration"))
+	assert.True(t, f.keep("custom_orders"))
+	assert.False(t, f.keep("custom_debug"))
+	assert.False(t, f.keep("http_req_duration_extra"))
+	assert.False(t, f.keep("iterations"))
+
+	c.MetricsInclude = []string{"["}
+	_, err = newMetricFilter(&c)
+	assert.Error(t, err)
+}
+
+func TestMetricFilterBuiltinMetrics(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.BuiltinMetrics = null.StringFrom(builtinMetricsMinimal)
+	f, err := newMetricFilter(&c)
+	require.NoError(t, err)
+	assert.True(t, f.keep("http_req_duration"))
+	assert.False(t, f.keep("iteration_duration"))
+	assert.False(t, f.keep("http_req_tls_handshaking"))
+	assert.True(t, f.keep("custom_orders"))
+
+	c.BuiltinMetrics = null.StringFrom(builtinMetricsNone)
+	f, err = newMetricFilter(&c)
+	require.NoError(t, err)
+	assert.False(t, f.keep("http_req_duration"))
+	assert.True(t, f.keep("custom_orders"))
+
+	c.BuiltinMetrics = null.StringFrom("some")
+	_, err = newMetricFilter(&c)
+	assert.Error(t, err)
+}
+
+func TestIsZeroCountOrRate(t *testing.T) {
+	t.Parallel()
+
+	sample := func(m *metrics.Metric, v float64) metrics.Sample {
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: m}, Value: v}
+	}
+
+	assert.True(t, isZeroCountOrRate(sample(newMetric("data_sent", metrics.Counter, metrics.Data), 0)))
+	assert.True(t, isZeroCountOrRate(sample(newMetric("http_req_failed", metrics.Rate), 0)))
+	assert.False(t, isZeroCountOrRate(sample(newMetric("data_sent", metrics.Counter, metrics.Data), 12)))
+	assert.False(t, isZeroCountOrRate(sample(newMetric("vus", metrics.Gauge), 0)))
+	assert.False(t, isZeroCountOrRate(sample(newMetric("http_req_duration", metrics.Trend, metrics.Time), 0)))
+}
@@ -0,0 +1,216 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.k6.io/k6/metrics"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	defaultDynatraceOTLPEndPoint = "/api/v2/otlp/v1/metrics"
+
+	exportFormatMint = "mint"
+	exportFormatOTLP = "otlp"
+
+	otlpScopeName = "xk6-output-dynatrace"
+)
+
+// otlpHistogramBounds are the explicit bucket bounds, in milliseconds, of
+// the trend histograms; they are scaled to the configured duration unit.
+var otlpHistogramBounds = []float64{5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+// otlpUnits maps the Dynatrace units to their UCUM form.
+var otlpUnits = map[string]string{
+	"MilliSecond": "ms",
+	"Second":      "s",
+	"MicroSecond": "us",
+	"Byte":        "By",
+	"Ratio":       "1",
+	"Count":       "1",
+}
+
+func validateExportFormat(format string) error {
+	switch format {
+	case exportFormatMint, exportFormatOTLP, exportFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid exportFormat %q, expected %s, %s or %s", format, exportFormatMint, exportFormatOTLP, exportFormatJSON)
+}
+
+type otlpSeries struct {
+	attributes []*commonpb.KeyValue
+	values     []float64
+	// last holds the timestamp of the newest sample, in milliseconds
+	last int64
+}
+
+type otlpMetric struct {
+	metric dynatraceMetric
+	series map[string]*otlpSeries
+	keys   []string
+}
+
+// toOTLP aggregates the metrics of a flush into an OTLP export request:
+// counters become delta sums, trends delta histograms and the other
+// metrics gauges holding the last (or, for rates, the mean) value.
+func (o *Output) toOTLP(dynMetrics []dynatraceMetric, start, now time.Time) *colmetricspb.ExportMetricsServiceRequest {
+	byKey := make(map[string]*otlpMetric)
+	var keys []string
+	for _, m := range dynMetrics {
+		om, ok := byKey[m.metricKeyName]
+		if !ok {
+			om = &otlpMetric{metric: m, series: make(map[string]*otlpSeries)}
+			byKey[m.metricKeyName] = om
+			keys = append(keys, m.metricKeyName)
+		}
+		id := seriesKey("", m.metricDimensions)
+		series, ok := om.series[id]
+		if !ok {
+			series = &otlpSeries{attributes: otlpAttributes(m.metricDimensions)}
+			om.series[id] = series
+			om.keys = append(om.keys, id)
+		}
+		series.values = append(series.values, m.metricValue)
+		if m.metricTimeStamp > series.last {
+			series.last = m.metricTimeStamp
+		}
+	}
+
+	startNano, nowNano := uint64(start.UnixNano()), uint64(now.UnixNano())
+	bounds := make([]float64, len(otlpHistogramBounds))
+	for i, b := range otlpHistogramBounds {
+		bounds[i] = b * o.durationUnit.factor
+	}
+
+	result := make([]*metricspb.Metric, 0, len(keys))
+	for _, key := range keys {
+		om := byKey[key]
+		pb := &metricspb.Metric{
+			Name:        key,
+			Description: om.metric.description,
+			Unit:        otlpUnits[om.metric.metricUnit],
+		}
+
+		switch om.metric.metricType {
+		case metrics.Counter:
+			sum := &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				IsMonotonic:            true,
+			}
+			for _, id := range om.keys {
+				series := om.series[id]
+				sum.DataPoints = append(sum.DataPoints, numberDataPoint(series, total(series.values), startNano, nowNano))
+			}
+			pb.Data = &metricspb.Metric_Sum{Sum: sum}
+		case metrics.Trend:
+			histogram := &metricspb.Histogram{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			}
+			for _, id := range om.keys {
+				histogram.DataPoints = append(histogram.DataPoints,
+					histogramDataPoint(om.series[id], bounds, startNano, nowNano))
+			}
+			pb.Data = &metricspb.Metric_Histogram{Histogram: histogram}
+		default:
+			gauge := &metricspb.Gauge{}
+			for _, id := range om.keys {
+				series := om.series[id]
+				value := series.values[len(series.values)-1]
+				if om.metric.metricType == metrics.Rate {
+					value = total(series.values) / float64(len(series.values))
+				}
+				timestamp := uint64(time.UnixMilli(series.last).UnixNano())
+				gauge.DataPoints = append(gauge.DataPoints, numberDataPoint(series, value, 0, timestamp))
+			}
+			pb.Data = &metricspb.Metric_Gauge{Gauge: gauge}
+		}
+		result = append(result, pb)
+	}
+
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: otlpResource(),
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: otlpScopeName},
+				Metrics: result,
+			}},
+		}},
+	}
+}
+
+func numberDataPoint(series *otlpSeries, value float64, start, now uint64) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        series.attributes,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      now,
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+func histogramDataPoint(series *otlpSeries, bounds []float64, start, now uint64) *metricspb.HistogramDataPoint {
+	counts := make([]uint64, len(bounds)+1)
+	sum, min, max := 0.0, series.values[0], series.values[0]
+	for _, v := range series.values {
+		counts[sort.SearchFloat64s(bounds, v)]++
+		sum += v
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return &metricspb.HistogramDataPoint{
+		Attributes:        series.attributes,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      now,
+		Count:             uint64(len(series.values)),
+		Sum:               &sum,
+		Min:               &min,
+		Max:               &max,
+		BucketCounts:      counts,
+		ExplicitBounds:    bounds,
+	}
+}
+
+func total(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+// otlpResource describes k6 as the producer of the OTLP data.
+func otlpResource() *resourcepb.Resource {
+	return &resourcepb.Resource{Attributes: otlpAttributes(map[string]string{
+		"service.name":           "k6",
+		"telemetry.sdk.name":     otlpScopeName,
+		"telemetry.sdk.language": "go",
+	})}
+}
+
+// otlpAttributes converts the dimensions into attributes sorted by key.
+func otlpAttributes(dims map[string]string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attributes := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attributes = append(attributes, &commonpb.KeyValue{
+			Key:   k,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: dims[k]}},
+		})
+	}
+	return attributes
+}
+
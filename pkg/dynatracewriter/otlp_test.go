@@ -0,0 +1,104 @@
+package dynatracewriter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestToOTLP(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	o, err := newOutput(&c, logrus.New())
+	require.NoError(t, err)
+
+	now := time.Now()
+	start := now.Add(-time.Second)
+	ms := now.UnixMilli()
+	dims := map[string]string{"status": "200"}
+	dynMetrics := []dynatraceMetric{
+		{metricKeyName: "k6.http_reqs", metricUnit: "Count", metricType: metrics.Counter, metricDimensions: dims, metricValue: 1, metricTimeStamp: ms},
+		{metricKeyName: "k6.http_reqs", metricUnit: "Count", metricType: metrics.Counter, metricDimensions: dims, metricValue: 1, metricTimeStamp: ms},
+		{metricKeyName: "k6.http_req_duration", metricUnit: "MilliSecond", metricType: metrics.Trend, metricDimensions: dims, metricValue: 20, metricTimeStamp: ms},
+		{metricKeyName: "k6.http_req_duration", metricUnit: "MilliSecond", metricType: metrics.Trend, metricDimensions: dims, metricValue: 600, metricTimeStamp: ms},
+		{metricKeyName: "k6.checks", metricUnit: "Ratio", metricType: metrics.Rate, metricDimensions: dims, metricValue: 1, metricTimeStamp: ms},
+		{metricKeyName: "k6.checks", metricUnit: "Ratio", metricType: metrics.Rate, metricDimensions: dims, metricValue: 0, metricTimeStamp: ms},
+		{metricKeyName: "k6.vus", metricUnit: "Count", metricType: metrics.Gauge, metricValue: 3, metricTimeStamp: ms},
+		{metricKeyName: "k6.vus", metricUnit: "Count", metricType: metrics.Gauge, metricValue: 5, metricTimeStamp: ms},
+	}
+
+	request := o.toOTLP(dynMetrics, start, now)
+	require.Len(t, request.ResourceMetrics, 1)
+	require.Len(t, request.ResourceMetrics[0].ScopeMetrics, 1)
+	result := request.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, result, 4)
+
+	sum := result[0].GetSum()
+	require.NotNil(t, sum)
+	assert.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, sum.AggregationTemporality)
+	require.Len(t, sum.DataPoints, 1)
+	assert.Equal(t, 2.0, sum.DataPoints[0].GetAsDouble())
+	assert.Equal(t, uint64(start.UnixNano()), sum.DataPoints[0].StartTimeUnixNano)
+	assert.Equal(t, "status", sum.DataPoints[0].Attributes[0].Key)
+
+	histogram := result[1].GetHistogram()
+	require.NotNil(t, histogram)
+	assert.Equal(t, "ms", result[1].Unit)
+	point := histogram.DataPoints[0]
+	assert.Equal(t, uint64(2), point.Count)
+	assert.Equal(t, 620.0, point.GetSum())
+	assert.Equal(t, 20.0, point.GetMin())
+	assert.Equal(t, 600.0, point.GetMax())
+	assert.Len(t, point.BucketCounts, len(otlpHistogramBounds)+1)
+	assert.Equal(t, uint64(1), point.BucketCounts[2])
+	assert.Equal(t, uint64(1), point.BucketCounts[8])
+
+	assert.Equal(t, 0.5, result[2].GetGauge().DataPoints[0].GetAsDouble())
+	assert.Equal(t, 5.0, result[3].GetGauge().DataPoints[0].GetAsDouble())
+}
+
+func TestSendOTLP(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan *colmetricspb.ExportMetricsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, defaultDynatraceOTLPEndPoint, req.URL.Path)
+		assert.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(req.Body)
+		request := &colmetricspb.ExportMetricsServiceRequest{}
+		assert.NoError(t, proto.Unmarshal(body, request))
+		received <- request
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.ExportFormat = null.StringFrom(exportFormatOTLP)
+	})
+	o.sendMetrics([]dynatraceMetric{
+		{metricKeyName: "k6.vus", metricUnit: "Count", metricType: metrics.Gauge, metricValue: 1, metricTimeStamp: time.Now().UnixMilli()},
+	})
+
+	request := <-received
+	assert.Equal(t, "k6.vus", request.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Name)
+}
+
+func TestValidateExportFormat(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, validateExportFormat(exportFormatMint))
+	assert.NoError(t, validateExportFormat(exportFormatOTLP))
+	assert.NoError(t, validateExportFormat(exportFormatJSON))
+	assert.Error(t, validateExportFormat("prometheus"))
+}
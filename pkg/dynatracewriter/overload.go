@@ -0,0 +1,187 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	// defaultMaxSamplesPerFlush is the number of metric lines kept by
+	// default in a flush following one that took longer than the flush
+	// period.
+	defaultMaxSamplesPerFlush = 150000
+
+	// sampleDropNewest drops the lines converted last.
+	sampleDropNewest = "newest"
+	// sampleDropRaw drops the raw samples first, keeping the check lines
+	// and the instance aggregates.
+	sampleDropRaw = "raw"
+	// sampleDropPriority drops the samples of the metrics missing from
+	// metricPriority first, then the ones listed last.
+	sampleDropPriority = "priority"
+)
+
+// metricSelector selects the samples of a k6 metric, optionally having
+// the given tags, written like a k6 threshold: http_req_duration{status:200}.
+type metricSelector struct {
+	metric string
+	tags   map[string]string
+}
+
+func parseMetricSelector(s string) (metricSelector, error) {
+	s = strings.TrimSpace(s)
+	name, tags, hasTags := strings.Cut(s, "{")
+	selector := metricSelector{metric: strings.TrimSpace(name)}
+	if selector.metric == "" {
+		return selector, fmt.Errorf("invalid metric selector %q, the metric name is missing", s)
+	}
+	if !hasTags {
+		return selector, nil
+	}
+	if !strings.HasSuffix(tags, "}") {
+		return selector, fmt.Errorf("invalid metric selector %q, expected metric{tag:value}", s)
+	}
+	selector.tags = make(map[string]string)
+	for _, tag := range strings.Split(strings.TrimSuffix(tags, "}"), ",") {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return selector, fmt.Errorf("invalid metric selector %q, expected metric{tag:value}", s)
+		}
+		selector.tags[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return selector, nil
+}
+
+func parseMetricSelectors(list []string) ([]metricSelector, error) {
+	selectors := make([]metricSelector, 0, len(list))
+	for _, s := range list {
+		selector, err := parseMetricSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+func (s metricSelector) matches(sample metrics.Sample) bool {
+	if sample.Metric.Name != s.metric {
+		return false
+	}
+	for key, value := range s.tags {
+		if tag, ok := sampleTag(sample, key); !ok || tag != value {
+			return false
+		}
+	}
+	return true
+}
+
+// metricClass is the priority class of a sample under backpressure.
+type metricClass int
+
+const (
+	// classCritical samples are never dropped.
+	classCritical metricClass = iota
+	classNormal
+	// classBestEffort samples are dropped first.
+	classBestEffort
+)
+
+// defaultCriticalMetrics are the key performance indicators kept under
+// backpressure by default.
+var defaultCriticalMetrics = []string{"http_req_failed", "checks"}
+
+// metricClass returns the priority class of the sample, critical wins over
+// best-effort when both select it.
+func (o *Output) metricClass(sample metrics.Sample) metricClass {
+	for _, selector := range o.critical {
+		if selector.matches(sample) {
+			return classCritical
+		}
+	}
+	for _, selector := range o.bestEffort {
+		if selector.matches(sample) {
+			return classBestEffort
+		}
+	}
+	return classNormal
+}
+
+// lineRank orders the lines of a flush, the lines of the highest class,
+// then of the highest rank, are dropped first.
+type lineRank struct {
+	class metricClass
+	rank  int
+}
+
+// shedding reports whether the lines of this flush may be cut, after a
+// flush that took longer than the flush period.
+func (o *Output) shedding() bool {
+	return o.overloaded && o.config.MaxSamplesPerFlush.Int64 > 0
+}
+
+// sampleRank returns the rank of a line made from the sample, from its
+// class and the sampleDropPolicy.
+func (o *Output) sampleRank(sample metrics.Sample, aggregate bool) lineRank {
+	r := lineRank{class: o.metricClass(sample)}
+	switch o.config.SampleDropPolicy.String {
+	case sampleDropRaw:
+		if !aggregate {
+			r.rank = 1
+		}
+	case sampleDropPriority:
+		r.rank = len(o.priority)
+		for i, selector := range o.priority {
+			if selector.matches(sample) {
+				r.rank = i
+				break
+			}
+		}
+	}
+	return r
+}
+
+// shedSamples keeps the maxSamplesPerFlush lines of the lowest ranks, and
+// the critical ones beyond it, in their order, and counts the other ones
+// as dropped.
+func (o *Output) shedSamples(lines []dynatraceMetric, ranks []lineRank) []dynatraceMetric {
+	limit := int(o.config.MaxSamplesPerFlush.Int64)
+	if !o.shedding() || len(lines) <= limit {
+		return lines
+	}
+
+	order := make([]int, len(lines))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := ranks[order[i]], ranks[order[j]]
+		if a.class != b.class {
+			return a.class < b.class
+		}
+		return a.rank < b.rank
+	})
+	for limit < len(order) && ranks[order[limit]].class == classCritical {
+		limit++
+	}
+	if limit == len(lines) {
+		return lines
+	}
+	kept := order[:limit]
+	sort.Ints(kept)
+
+	shed := make([]dynatraceMetric, len(kept))
+	for i, index := range kept {
+		shed[i] = lines[index]
+	}
+	dropped := len(lines) - limit
+	o.stats.linesDropped += dropped
+	o.totals.linesDropped += dropped
+	o.logger.WithField("dropped", dropped).
+		Warnf("Dynatrace: the previous flush took too long, keeping %d of the %d lines of this flush (sampleDropPolicy %s)",
+			limit, len(lines), o.config.SampleDropPolicy.String)
+	return shed
+}
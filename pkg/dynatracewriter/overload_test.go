@@ -0,0 +1,111 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+// overloadSamples returns a vus sample, two http_req_duration samples and
+// a passing check.
+func overloadSamples() []metrics.SampleContainer {
+	now := time.Now()
+	sample := func(metric *metrics.Metric, tags map[string]string) metrics.Sample {
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: metric, Tags: newTags(tags)}, Time: now, Value: 1}
+	}
+	duration := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	return []metrics.SampleContainer{metrics.Samples{
+		sample(newMetric("vus", metrics.Gauge), nil),
+		sample(duration, map[string]string{"status": "200"}),
+		sample(duration, map[string]string{"status": "500"}),
+		sample(newMetric("checks", metrics.Rate), map[string]string{"check": "ok"}),
+	}}
+}
+
+func metricKeys(lines []dynatraceMetric) []string {
+	keys := make([]string, len(lines))
+	for i, m := range lines {
+		keys[i] = m.metricKeyName
+		if status, ok := m.metricDimensions["status"]; ok {
+			keys[i] += "{" + status + "}"
+		}
+	}
+	return keys
+}
+
+func TestSampleDropPolicies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		policy   string
+		priority []string
+		expected []string
+	}{
+		{sampleDropNewest, nil, []string{"k6.vus", "k6.http_req_duration{200}"}},
+		{sampleDropRaw, nil, []string{"k6.vus", "k6.check.pass"}},
+		{sampleDropPriority, []string{"http_req_duration{status:500}", "vus"}, []string{"k6.vus", "k6.http_req_duration{500}"}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.policy, func(t *testing.T) {
+			t.Parallel()
+
+			o := newTestOutput(t, "http://localhost", func(c *Config) {
+				c.CheckMetrics = null.BoolFrom(true)
+				c.TagsAsDimensions = []string{"status"}
+				c.MaxSamplesPerFlush = null.IntFrom(2)
+				c.SampleDropPolicy = null.StringFrom(tc.policy)
+				c.MetricPriority = tc.priority
+				c.CriticalMetrics = nil
+			})
+			assert.Len(t, o.convertToTimeDynatraceData(overloadSamples()), 5, "only the flushes after an overrun are cut")
+
+			o.overloaded = true
+			lines := o.convertToTimeDynatraceData(overloadSamples())
+			assert.Equal(t, tc.expected, metricKeys(lines))
+			assert.Equal(t, 3, o.totals.linesDropped)
+		})
+	}
+}
+
+func TestParseMetricSelector(t *testing.T) {
+	t.Parallel()
+
+	s, err := parseMetricSelector(" http_req_duration{status:200, method:GET} ")
+	require.NoError(t, err)
+	assert.Equal(t, "http_req_duration", s.metric)
+	assert.Equal(t, map[string]string{"status": "200", "method": "GET"}, s.tags)
+
+	s, err = parseMetricSelector("vus")
+	require.NoError(t, err)
+	assert.Nil(t, s.tags)
+
+	for _, invalid := range []string{"", "{status:200}", "http_reqs{status}", "http_reqs{status:200"} {
+		_, err := parseMetricSelector(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestMetricClasses(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.CheckMetrics = null.BoolFrom(true)
+		c.TagsAsDimensions = []string{"status"}
+		c.MaxSamplesPerFlush = null.IntFrom(1)
+		c.BestEffortMetrics = []string{"vus", "checks"}
+	})
+	o.overloaded = true
+	// the checks are critical by default, the limit doesn't drop them
+	lines := o.convertToTimeDynatraceData(overloadSamples())
+	assert.Equal(t, []string{"k6.check.pass", "k6.checks"}, metricKeys(lines))
+
+	o.config.MaxSamplesPerFlush = null.IntFrom(4)
+	lines = o.convertToTimeDynatraceData(overloadSamples())
+	assert.Equal(t, []string{"k6.http_req_duration{200}", "k6.http_req_duration{500}", "k6.check.pass", "k6.checks"},
+		metricKeys(lines), "the best-effort vus are dropped first")
+}
@@ -0,0 +1,51 @@
+package dynatracewriter
+
+import (
+	"runtime"
+	"sync"
+
+	"go.k6.io/k6/metrics"
+)
+
+// minParallelSamples is the number of samples below which looking up the
+// series stays on the flushing goroutine, starting the workers would cost
+// more than it saves.
+const minParallelSamples = 10000
+
+// resolveSeries looks up the series of every sample of the containers, in
+// order, on all the CPUs. The workers only read the series cache, the new
+// series are cached by the sequential merge in convertSeriesSample, which
+// keeps the lines in the order of the samples.
+func (o *Output) resolveSeries(samplesContainers []metrics.SampleContainer) []*cachedSeries {
+	var samples []metrics.Sample
+	for _, samplesContainer := range samplesContainers {
+		samples = append(samples, samplesContainer.GetSamples()...)
+	}
+	series := make([]*cachedSeries, len(samples))
+
+	workers := runtime.GOMAXPROCS(0)
+	if len(samples) < minParallelSamples || workers < 2 {
+		for i, sample := range samples {
+			series[i] = o.lookupSeries(sample)
+		}
+		return series
+	}
+
+	chunk := (len(samples) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(samples); start += chunk {
+		end := start + chunk
+		if end > len(samples) {
+			end = len(samples)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				series[i] = o.lookupSeries(samples[i])
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return series
+}
@@ -0,0 +1,46 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+)
+
+func TestParallelConversion(t *testing.T) {
+	t.Parallel()
+
+	registry := metrics.NewRegistry()
+	metric := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	now := time.Now()
+	var containers []metrics.SampleContainer
+	for i := 0; i < 2*minParallelSamples; i += 2 {
+		var container metrics.Samples
+		for j := i; j < i+2; j++ {
+			container = append(container, metrics.Sample{
+				TimeSeries: metrics.TimeSeries{
+					Metric: metric,
+					Tags:   registry.RootTagSet().WithTagsFromMap(map[string]string{"url": fmt.Sprintf("/%d", j%500)}),
+				},
+				Time:  now,
+				Value: float64(j),
+			})
+		}
+		containers = append(containers, container)
+	}
+
+	parallel := newTestOutput(t, "http://localhost", nil).convertToTimeDynatraceData(containers)
+	require.Len(t, parallel, 2*minParallelSamples)
+
+	sequential := newTestOutput(t, "http://localhost", nil)
+	for i, m := range parallel {
+		sample := containers[i/2].GetSamples()[i%2]
+		expected, ok := sequential.convertSample(sample, now)
+		require.True(t, ok)
+		assert.Equal(t, expected.metricValue, m.metricValue)
+		assert.Equal(t, expected.metricDimensions, m.metricDimensions)
+	}
+}
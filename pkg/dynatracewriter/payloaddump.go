@@ -0,0 +1,46 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultPayloadDumpBytes caps the payloads logged at trace level.
+const defaultPayloadDumpBytes = 4096
+
+// truncatePayload returns the first maxLines lines of the payload, cut to
+// maxBytes, 0 meaning no limit, and whether it was truncated.
+func truncatePayload(payload string, maxBytes, maxLines int) (string, bool) {
+	truncated := false
+	if maxLines > 0 {
+		lines := strings.SplitAfterN(payload, "\n", maxLines+1)
+		if len(lines) > maxLines {
+			payload = strings.Join(lines[:maxLines], "")
+			truncated = true
+		}
+	}
+	if maxBytes > 0 && len(payload) > maxBytes {
+		payload = payload[:maxBytes]
+		truncated = true
+	}
+	return payload, truncated
+}
+
+// dumpPayload logs the beginning of an outgoing payload at trace level,
+// to see what was sent when lines are rejected.
+func (o *Output) dumpPayload(logger logrus.FieldLogger, payload string) {
+	traceLogger, ok := logger.(logrus.Ext1FieldLogger)
+	if !ok {
+		return
+	}
+	if entry, ok := logger.(*logrus.Entry); ok && !entry.Logger.IsLevelEnabled(logrus.TraceLevel) {
+		return
+	}
+	dump, truncated := truncatePayload(payload, int(o.config.PayloadDumpBytes.Int64), int(o.config.PayloadDumpLines.Int64))
+	if truncated {
+		dump += fmt.Sprintf("\n... (%d bytes truncated)", len(payload)-len(dump))
+	}
+	traceLogger.WithField("bytes", len(payload)).Trace("Dynatrace: payload\n" + dump)
+}
@@ -0,0 +1,56 @@
+package dynatracewriter
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestTruncatePayload(t *testing.T) {
+	t.Parallel()
+
+	payload := "k6.vus 1\nk6.vus 2\nk6.vus 3\n"
+	for name, tc := range map[string]struct {
+		maxBytes, maxLines int
+		expected           string
+		truncated          bool
+	}{
+		"no_limit":   {expected: payload},
+		"lines":      {maxLines: 2, expected: "k6.vus 1\nk6.vus 2\n", truncated: true},
+		"bytes":      {maxBytes: 5, expected: "k6.vu", truncated: true},
+		"both":       {maxBytes: 12, maxLines: 2, expected: "k6.vus 1\nk6.", truncated: true},
+		"large_caps": {maxBytes: 1000, maxLines: 10, expected: payload},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			dump, truncated := truncatePayload(payload, tc.maxBytes, tc.maxLines)
+			assert.Equal(t, tc.expected, dump)
+			assert.Equal(t, tc.truncated, truncated)
+		})
+	}
+}
+
+func TestDumpPayload(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.PayloadDumpLines = null.IntFrom(1)
+	})
+	logger, hook := test.NewNullLogger()
+
+	o.dumpPayload(logger.WithField("requestId", "id"), "k6.vus 1\nk6.vus 2\n")
+	assert.Nil(t, hook.LastEntry(), "the payload is only logged at trace level")
+
+	logger.SetLevel(logrus.TraceLevel)
+	o.dumpPayload(logger.WithField("requestId", "id"), "k6.vus 1\nk6.vus 2\n")
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, logrus.TraceLevel, entry.Level)
+	assert.Equal(t, "Dynatrace: payload\nk6.vus 1\n\n... (9 bytes truncated)", entry.Message)
+	assert.Equal(t, 18, entry.Data["bytes"])
+}
@@ -0,0 +1,77 @@
+package dynatracewriter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	methodTag   = "method"
+	subprotoTag = "subproto"
+
+	rpcServiceDimension = "rpc.service"
+	rpcMethodDimension  = "rpc.method"
+	rpcStatusDimension  = "rpc.status"
+	wsStatusDimension   = "ws.status"
+	wsSubprotoDimension = "ws.subprotocol"
+)
+
+// grpcCodes are the names of the gRPC status codes, by code.
+var grpcCodes = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED",
+	"NOT_FOUND", "ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED",
+	"INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+var rpcNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// protocolDimensions returns the dimensions of the gRPC and WebSocket
+// metrics, which are kept whatever the tag filters say: the service,
+// method and status name of gRPC requests, and the status and
+// subprotocol of WebSocket sessions.
+func protocolDimensions(sample metrics.Sample) map[string]string {
+	dims := make(map[string]string)
+	switch {
+	case strings.HasPrefix(sample.Metric.Name, "grpc_"):
+		if method, ok := sampleTag(sample, methodTag); ok {
+			service, name := splitRPCMethod(method)
+			dims[rpcServiceDimension] = service
+			dims[rpcMethodDimension] = name
+		}
+		if status, ok := sampleTag(sample, statusTag); ok {
+			dims[rpcStatusDimension] = grpcStatusName(status)
+		}
+	case strings.HasPrefix(sample.Metric.Name, "ws_"):
+		if status, ok := sampleTag(sample, statusTag); ok {
+			dims[wsStatusDimension] = status
+		}
+		if subproto, ok := sampleTag(sample, subprotoTag); ok && subproto != "" {
+			dims[wsSubprotoDimension] = subproto
+		}
+	}
+	return dims
+}
+
+// splitRPCMethod splits a full gRPC method, e.g. /pkg.Service/Method,
+// into its sanitized service and method names.
+func splitRPCMethod(method string) (string, string) {
+	method = strings.TrimPrefix(method, "/")
+	service, name := "", method
+	if i := strings.LastIndexByte(method, '/'); i >= 0 {
+		service, name = method[:i], method[i+1:]
+	}
+	return rpcNameRe.ReplaceAllString(service, "_"), rpcNameRe.ReplaceAllString(name, "_")
+}
+
+// grpcStatusName returns the name of a numeric gRPC status code.
+func grpcStatusName(status string) string {
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 0 || code >= len(grpcCodes) {
+		return status
+	}
+	return grpcCodes[code]
+}
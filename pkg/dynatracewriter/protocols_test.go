@@ -0,0 +1,49 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestProtocolDimensions(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.KeepTags = null.BoolFrom(false)
+	})
+
+	now := time.Now()
+	grpcTags := newTags(map[string]string{"method": "/shop.v1.Cart/Add Item", "status": "14"})
+	m, ok := o.convertSample(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: newMetric("grpc_req_duration", metrics.Trend, metrics.Time), Tags: grpcTags}, Time: now, Value: 1}, now)
+	require.True(t, ok)
+	assert.Equal(t, "shop.v1.Cart", m.metricDimensions[rpcServiceDimension])
+	assert.Equal(t, "Add_Item", m.metricDimensions[rpcMethodDimension])
+	assert.Equal(t, "UNAVAILABLE", m.metricDimensions[rpcStatusDimension])
+	assert.NotContains(t, m.metricDimensions, methodTag)
+
+	wsTags := newTags(map[string]string{"status": "101", "subproto": "graphql-ws"})
+	m, ok = o.convertSample(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: newMetric("ws_session_duration", metrics.Trend, metrics.Time), Tags: wsTags}, Time: now, Value: 1}, now)
+	require.True(t, ok)
+	assert.Equal(t, "101", m.metricDimensions[wsStatusDimension])
+	assert.Equal(t, "graphql-ws", m.metricDimensions[wsSubprotoDimension])
+}
+
+func TestSplitRPCMethod(t *testing.T) {
+	t.Parallel()
+
+	service, method := splitRPCMethod("/grpc.health.v1.Health/Check")
+	assert.Equal(t, "grpc.health.v1.Health", service)
+	assert.Equal(t, "Check", method)
+
+	service, method = splitRPCMethod("Check")
+	assert.Equal(t, "", service)
+	assert.Equal(t, "Check", method)
+
+	assert.Equal(t, "OK", grpcStatusName("0"))
+	assert.Equal(t, "42", grpcStatusName("42"))
+}
@@ -0,0 +1,118 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	relabelActionReplace = "replace"
+	relabelActionKeep    = "keep"
+	relabelActionDrop    = "drop"
+
+	// metricNameDimension addresses the metric key in relabel rules, like
+	// the __name__ label does in Prometheus.
+	metricNameDimension = "__name__"
+)
+
+// RelabelConfig reshapes a metric line before it is serialized, following
+// the semantics of Prometheus relabel_configs: the values of
+// SourceDimensions are joined with Separator and matched against Regex.
+type RelabelConfig struct {
+	SourceDimensions []string `json:"sourceDimensions"`
+	Separator        string   `json:"separator"`
+	Regex            string   `json:"regex"`
+	TargetDimension  string   `json:"targetDimension"`
+	Replacement      string   `json:"replacement"`
+	Action           string   `json:"action"`
+}
+
+type relabelRule struct {
+	RelabelConfig
+	re *regexp.Regexp
+}
+
+// relabeler applies the configured relabel rules in order.
+type relabeler struct {
+	rules []relabelRule
+}
+
+func newRelabeler(configs []RelabelConfig) (*relabeler, error) {
+	r := &relabeler{}
+	for i, c := range configs {
+		if c.Separator == "" {
+			c.Separator = ";"
+		}
+		if c.Regex == "" {
+			c.Regex = "(.*)"
+		}
+		if c.Action == "" {
+			c.Action = relabelActionReplace
+		}
+		// Prometheus' default replacement
+		if c.Replacement == "" && c.Action == relabelActionReplace {
+			c.Replacement = "$1"
+		}
+
+		switch c.Action {
+		case relabelActionReplace:
+			if c.TargetDimension == "" {
+				return nil, fmt.Errorf("relabel rule %d: targetDimension is required for the replace action", i)
+			}
+		case relabelActionKeep, relabelActionDrop:
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unknown action %q", i, c.Action)
+		}
+
+		re, err := regexp.Compile("^(?:" + c.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: invalid regex %q: %w", i, c.Regex, err)
+		}
+		r.rules = append(r.rules, relabelRule{RelabelConfig: c, re: re})
+	}
+	return r, nil
+}
+
+// apply relabels the metric in place and reports whether it must be kept.
+func (r *relabeler) apply(m *dynatraceMetric) bool {
+	for _, rule := range r.rules {
+		values := make([]string, 0, len(rule.SourceDimensions))
+		for _, dim := range rule.SourceDimensions {
+			if dim == metricNameDimension {
+				values = append(values, m.metricKeyName)
+			} else {
+				values = append(values, m.metricDimensions[dim])
+			}
+		}
+		value := strings.Join(values, rule.Separator)
+
+		switch rule.Action {
+		case relabelActionKeep:
+			if !rule.re.MatchString(value) {
+				return false
+			}
+		case relabelActionDrop:
+			if rule.re.MatchString(value) {
+				return false
+			}
+		case relabelActionReplace:
+			indexes := rule.re.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				continue
+			}
+			result := string(rule.re.ExpandString(nil, rule.Replacement, value, indexes))
+			switch {
+			case rule.TargetDimension == metricNameDimension:
+				if result != "" {
+					m.metricKeyName = result
+				}
+			case result == "":
+				delete(m.metricDimensions, rule.TargetDimension)
+			default:
+				m.metricDimensions[rule.TargetDimension] = result
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package dynatracewriter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelabeler(t *testing.T) {
+	t.Parallel()
+
+	metric := func() *dynatraceMetric {
+		return &dynatraceMetric{
+			metricKeyName:    "http_req_duration",
+			metricDimensions: map[string]string{"method": "GET", "status": "404", "scenario": "browse"},
+		}
+	}
+
+	r, err := newRelabeler([]RelabelConfig{
+		{SourceDimensions: []string{"status"}, Regex: "([0-9])..", TargetDimension: "status_class", Replacement: "${1}xx"},
+		{SourceDimensions: []string{"scenario"}, Regex: ".*", TargetDimension: "scenario", Replacement: ""},
+		{SourceDimensions: []string{metricNameDimension}, Regex: "http_(.*)", TargetDimension: metricNameDimension, Replacement: "web.$1"},
+	})
+	require.NoError(t, err)
+	m := metric()
+	assert.True(t, r.apply(m))
+	assert.Equal(t, "web.req_duration", m.metricKeyName)
+	assert.Equal(t, map[string]string{"method": "GET", "status": "404", "status_class": "4xx"}, m.metricDimensions)
+
+	r, err = newRelabeler([]RelabelConfig{
+		{SourceDimensions: []string{metricNameDimension, "method"}, Regex: "http_req_duration;GET", Action: relabelActionKeep},
+	})
+	require.NoError(t, err)
+	assert.True(t, r.apply(metric()))
+
+	r, err = newRelabeler([]RelabelConfig{
+		{SourceDimensions: []string{"status"}, Regex: "4..", Action: relabelActionDrop},
+	})
+	require.NoError(t, err)
+	assert.False(t, r.apply(metric()))
+
+	_, err = newRelabeler([]RelabelConfig{{Action: "hashmod"}})
+	assert.Error(t, err)
+	_, err = newRelabeler([]RelabelConfig{{SourceDimensions: []string{"a"}}})
+	assert.Error(t, err)
+}
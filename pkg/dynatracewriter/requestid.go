@@ -0,0 +1,66 @@
+package dynatracewriter
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// requestIDHeader carries the id of a request to Dynatrace, also logged
+// with every line about the request, to follow it across the retries and
+// in the ActiveGate logs.
+const requestIDHeader = "X-Request-ID"
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// do sends a request to Dynatrace with the given request id, and returns
+// the response with a logger carrying the id, the attempt, the number of
+// lines, the status and the latency of the request.
+func (o *Output) do(request *http.Request, requestID string, attempt, lines int) (*http.Response, logrus.FieldLogger, error) {
+	request.Header.Set(requestIDHeader, requestID)
+	logger := o.logger.WithFields(logrus.Fields{
+		"requestId": requestID,
+		"endpoint":  request.URL.Path,
+		"attempt":   attempt,
+	})
+	if lines > 0 {
+		logger = logger.WithField("lines", lines)
+	}
+
+	var timings *requestTimings
+	if o.config.DebugTransport.Bool {
+		request, timings = traceRequest(request)
+	}
+
+	o.live.requests.Add(1)
+	o.live.inFlight.Add(1)
+	start := time.Now()
+	response, err := o.client.Do(request)
+	o.live.inFlight.Add(-1)
+	logger = logger.WithField("latency", time.Since(start).String())
+	if timings != nil {
+		logger = logger.WithFields(timings.fields())
+	}
+	if err != nil {
+		return nil, logger, err
+	}
+	logger = logger.WithField("status", response.StatusCode)
+	if timings != nil {
+		logger.Info("Dynatrace: request timings")
+	} else {
+		logger.Debug("Dynatrace: request sent")
+	}
+	return response, logger, nil
+}
@@ -0,0 +1,72 @@
+package dynatracewriter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestNewRequestID(t *testing.T) {
+	t.Parallel()
+
+	id := newRequestID()
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+	assert.NotEqual(t, id, newRequestID())
+}
+
+func TestSendMetricsRequestID(t *testing.T) {
+	t.Parallel()
+
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(requestIDHeader)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, nil)
+	logger, hook := test.NewNullLogger()
+	o.logger = logger
+	o.sendMetrics([]dynatraceMetric{{metricKeyName: "k6.vus", metricValue: 1, metricType: metrics.Gauge}})
+
+	require.NotEmpty(t, received)
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, logrus.WarnLevel, entry.Level)
+	assert.Equal(t, received, entry.Data["requestId"])
+	assert.Equal(t, 1, entry.Data["attempt"])
+	assert.Equal(t, 1, entry.Data["lines"])
+	assert.Equal(t, http.StatusBadRequest, entry.Data["status"])
+	assert.Contains(t, entry.Data, "latency")
+}
+
+func TestDebugTransportTimings(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.InsecureSkipTLSVerify = null.BoolFrom(true)
+		c.DebugTransport = null.BoolFrom(true)
+	})
+	logger, hook := test.NewNullLogger()
+	o.logger = logger
+	require.NoError(t, o.postAPI(defaultDynatraceEventsEndPoint, "application/json", []byte("{}")))
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, "Dynatrace: request timings", entry.Message)
+	assert.Equal(t, logrus.InfoLevel, entry.Level)
+	for _, field := range []string{"dns", "connect", "tlsHandshake", "ttfb", "connReused"} {
+		assert.Contains(t, entry.Data, field)
+	}
+	assert.NotEqual(t, "0s", entry.Data["tlsHandshake"])
+}
@@ -0,0 +1,125 @@
+package dynatracewriter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxRetries          = 3
+	defaultMaxRetryElapsedTime = 30 * time.Second
+
+	// retryExhaustedDrop drops the lines of a request still failing once
+	// the retries are exhausted
+	retryExhaustedDrop = "drop"
+	// retryExhaustedSpool writes them to the spool directory, they are
+	// sent again by the next flushes
+	retryExhaustedSpool = "spool"
+
+	retryInitialBackoff = 500 * time.Millisecond
+	retryMaxBackoff     = 10 * time.Second
+)
+
+// defaultRetryOnStatusCodes are the answers of an overloaded or restarting
+// endpoint.
+var defaultRetryOnStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// parseStatusCodes parses the http status codes of a list option.
+func parseStatusCodes(values []string) ([]int, error) {
+	codes := make([]int, 0, len(values))
+	for _, value := range values {
+		code, err := strconv.Atoi(value)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid http status code %q", value)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// retryPolicy decides which failed requests are sent again and when.
+type retryPolicy struct {
+	maxRetries int
+	// maxElapsed bounds the time spent retrying a request, 0 for no bound
+	maxElapsed  time.Duration
+	statusCodes map[int]struct{}
+}
+
+func newRetryPolicy(conf *Config) (*retryPolicy, error) {
+	if conf.MaxRetries.Int64 < 0 {
+		return nil, fmt.Errorf("maxRetries can't be negative")
+	}
+	if conf.MaxRetryElapsedTime.Duration < 0 {
+		return nil, fmt.Errorf("maxRetryElapsedTime can't be negative")
+	}
+	switch conf.RetryExhaustedPolicy.String {
+	case retryExhaustedDrop, retryExhaustedSpool:
+	default:
+		return nil, fmt.Errorf("invalid retryExhaustedPolicy %q, expected %s or %s",
+			conf.RetryExhaustedPolicy.String, retryExhaustedDrop, retryExhaustedSpool)
+	}
+	p := &retryPolicy{
+		maxRetries:  int(conf.MaxRetries.Int64),
+		maxElapsed:  time.Duration(conf.MaxRetryElapsedTime.Duration),
+		statusCodes: make(map[int]struct{}),
+	}
+	for _, code := range conf.RetryOnStatusCodes {
+		p.statusCodes[code] = struct{}{}
+	}
+	return p, nil
+}
+
+// retryable reports whether a request failing with err or answered
+// response is worth sending again.
+func (p *retryPolicy) retryable(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	_, ok := p.statusCodes[response.StatusCode]
+	return ok
+}
+
+// allowed reports whether the budget allows another attempt after the
+// attempt, counted from 1, once waited for wait, elapsed since the first
+// one.
+func (p *retryPolicy) allowed(attempt int, elapsed, wait time.Duration) bool {
+	if attempt > p.maxRetries {
+		return false
+	}
+	return p.maxElapsed == 0 || elapsed+wait <= p.maxElapsed
+}
+
+// backoff returns how long to wait before the next attempt: the
+// Retry-After of the answer when it has one, else an exponential delay.
+func (p *retryPolicy) backoff(attempt int, response *http.Response) time.Duration {
+	if response != nil {
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	d := retryInitialBackoff << (attempt - 1)
+	if d > retryMaxBackoff || d <= 0 {
+		d = retryMaxBackoff
+	}
+	return d
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
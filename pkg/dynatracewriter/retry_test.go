@@ -0,0 +1,80 @@
+package dynatracewriter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestRetryOnStatusCodes(t *testing.T) {
+	t.Parallel()
+
+	var (
+		statuses = []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusAccepted}
+		attempts []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts = append(attempts, r.Header.Get(requestIDHeader))
+		status := statuses[0]
+		statuses = statuses[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, nil)
+	line := []dynatraceMetric{{metricKeyName: "k6.vus", metricValue: 1, metricType: metrics.Gauge}}
+	o.sendMetrics(line)
+	require.Len(t, attempts, 3)
+	assert.Equal(t, attempts[0], attempts[2], "the retries keep the request id")
+	assert.Equal(t, 2, o.totals.retries)
+	assert.Equal(t, 1, o.totals.linesSent)
+
+	// 502 is not retried when the list doesn't hold it
+	attempts, statuses = nil, []int{http.StatusBadGateway}
+	o = newTestOutput(t, server.URL, func(c *Config) {
+		c.RetryOnStatusCodes = []int{http.StatusServiceUnavailable}
+	})
+	o.sendMetrics(line)
+	assert.Len(t, attempts, 1)
+	assert.Equal(t, 1, o.totals.linesDropped)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.MaxRetries = null.IntFrom(2)
+	p, err := newRetryPolicy(&c)
+	require.NoError(t, err)
+
+	unavailable := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	assert.True(t, p.retryable(unavailable, nil))
+	assert.True(t, p.retryable(nil, assert.AnError))
+	assert.False(t, p.retryable(&http.Response{StatusCode: http.StatusBadRequest}, nil))
+	assert.True(t, p.allowed(2, time.Second, time.Second))
+	assert.False(t, p.allowed(3, time.Second, time.Second))
+	assert.False(t, p.allowed(1, 29*time.Second, 2*time.Second), "beyond maxRetryElapsedTime")
+
+	assert.Equal(t, retryInitialBackoff, p.backoff(1, unavailable))
+	assert.Equal(t, 4*retryInitialBackoff, p.backoff(3, nil))
+	assert.Equal(t, retryMaxBackoff, p.backoff(20, nil))
+	unavailable.Header.Set("Retry-After", "7")
+	assert.Equal(t, 7*time.Second, p.backoff(1, unavailable))
+
+	codes, err := parseStatusCodes([]string{"429", "503"})
+	require.NoError(t, err)
+	assert.Equal(t, []int{429, 503}, codes)
+	_, err = parseStatusCodes([]string{"abc"})
+	assert.Error(t, err)
+	_, err = parseStatusCodes([]string{"99"})
+	assert.Error(t, err)
+}
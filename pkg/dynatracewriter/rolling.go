@@ -0,0 +1,182 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+// rollingPrecision is the relative error of the rolling percentiles, the
+// values are counted in logarithmic bins so a window doesn't keep them all.
+const rollingPrecision = 0.01
+
+var (
+	rollingWindows = []struct {
+		name   string
+		length time.Duration
+	}{
+		{"1m", time.Minute},
+		{"5m", 5 * time.Minute},
+	}
+	rollingQuantiles = []struct {
+		name string
+		q    float64
+	}{
+		{"p50", 0.5},
+		{"p95", 0.95},
+		{"p99", 0.99},
+	}
+
+	rollingGamma = math.Log1p(rollingPrecision)
+)
+
+// rollingBin returns the logarithmic bin of a value, the values up to 0
+// share the lowest bin.
+func rollingBin(value float64) int {
+	if value <= 0 {
+		return math.MinInt32
+	}
+	return int(math.Ceil(math.Log(value) / rollingGamma))
+}
+
+// rollingBinValue returns the upper bound of a bin.
+func rollingBinValue(bin int) float64 {
+	if bin == math.MinInt32 {
+		return 0
+	}
+	return math.Exp(float64(bin) * rollingGamma)
+}
+
+// rollingBucket counts the values of a trend over a flush by bin.
+type rollingBucket struct {
+	at     time.Time
+	counts map[int]int
+}
+
+// rollingTrend holds the buckets of the last flushes of a trend, back to
+// the longest window.
+type rollingTrend struct {
+	time    bool
+	pending map[int]int
+	buckets []rollingBucket
+}
+
+// rollingTrends holds the rolling trends by k6 metric, they are only
+// touched by the flushing goroutine.
+type rollingTrends map[string]*rollingTrend
+
+// observeRolling counts the samples of the trends listed in
+// rollingPercentiles, whatever the metric filters.
+func (o *Output) observeRolling(sample metrics.Sample) {
+	if sample.Metric.Type != metrics.Trend || !containsString(o.config.RollingPercentiles, sample.Metric.Name) {
+		return
+	}
+	if o.rolling == nil {
+		o.rolling = make(rollingTrends)
+	}
+	trend, ok := o.rolling[sample.Metric.Name]
+	if !ok {
+		trend = &rollingTrend{time: sample.Metric.Contains == metrics.Time}
+		o.rolling[sample.Metric.Name] = trend
+	}
+	if trend.pending == nil {
+		trend.pending = make(map[int]int)
+	}
+	trend.pending[rollingBin(sample.Value)]++
+}
+
+// quantiles returns the quantiles of the values of the buckets since the
+// given time, false when there are none.
+func (t *rollingTrend) quantiles(since time.Time) ([]float64, bool) {
+	counts := make(map[int]int)
+	total := 0
+	for _, bucket := range t.buckets {
+		if !bucket.at.After(since) {
+			continue
+		}
+		for bin, count := range bucket.counts {
+			counts[bin] += count
+			total += count
+		}
+	}
+	if total == 0 {
+		return nil, false
+	}
+
+	bins := make([]int, 0, len(counts))
+	for bin := range counts {
+		bins = append(bins, bin)
+	}
+	sort.Ints(bins)
+
+	values := make([]float64, len(rollingQuantiles))
+	for i, quantile := range rollingQuantiles {
+		// nearest rank
+		rank := int(math.Ceil(quantile.q * float64(total)))
+		seen := 0
+		for _, bin := range bins {
+			seen += counts[bin]
+			if seen >= rank {
+				values[i] = rollingBinValue(bin)
+				break
+			}
+		}
+	}
+	return values, true
+}
+
+// rollingMetrics closes the buckets of the flush and returns the
+// k6.{metric}.p50/.p95/.p99 gauges of every rolling window, e.g.
+// k6.http_req_duration.p95.1m, sent every flush while the window holds
+// samples.
+func (o *Output) rollingMetrics(now time.Time) []dynatraceMetric {
+	if len(o.rolling) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(o.rolling))
+	for name := range o.rolling {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	longest := rollingWindows[len(rollingWindows)-1].length
+	var dynMetrics []dynatraceMetric
+	for _, name := range names {
+		trend := o.rolling[name]
+		if trend.pending != nil {
+			trend.buckets = append(trend.buckets, rollingBucket{at: now, counts: trend.pending})
+			trend.pending = nil
+		}
+		for len(trend.buckets) > 0 && !trend.buckets[0].at.After(now.Add(-longest)) {
+			trend.buckets = trend.buckets[1:]
+		}
+
+		unit, factor := "Unspecified", 1.0
+		if trend.time {
+			unit, factor = o.durationUnit.unit, o.durationUnit.factor
+		}
+		for _, window := range rollingWindows {
+			values, ok := trend.quantiles(now.Add(-window.length))
+			if !ok {
+				continue
+			}
+			for i, quantile := range rollingQuantiles {
+				dynMetrics = append(dynMetrics, dynatraceMetric{
+					metricKeyName: o.metricKey(name + "." + quantile.name + "." + window.name),
+					description: fmt.Sprintf("k6 %s %s over the last %s, estimated within %g%%",
+						name, quantile.name, window.name, rollingPrecision*100),
+					metricUnit:       unit,
+					metricDimensions: o.outputDimensions(),
+					metricValue:      values[i] * factor,
+					metricTimeStamp:  o.aggregateTimestamp(now),
+					metricType:       metrics.Gauge,
+				})
+			}
+		}
+	}
+	return dynMetrics
+}
@@ -0,0 +1,58 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestRollingPercentiles(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.RollingPercentiles = []string{"http_req_duration"}
+		c.DurationUnit = null.StringFrom("s")
+	})
+	duration := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	start := time.Now()
+	flush := func(now time.Time, values ...float64) []dynatraceMetric {
+		samples := make(metrics.Samples, len(values))
+		for i, value := range values {
+			samples[i] = metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: newTags(nil)}, Time: now, Value: value}
+		}
+		o.convertToTimeDynatraceData([]metrics.SampleContainer{samples})
+		return o.rollingMetrics(now)
+	}
+	values := func(from, to float64) []float64 {
+		var v []float64
+		for i := from; i <= to; i++ {
+			v = append(v, i)
+		}
+		return v
+	}
+
+	lines := flush(start, values(1, 100)...)
+	require.Len(t, lines, 6)
+	assert.Equal(t, "k6.http_req_duration.p50.1m", lines[0].metricKeyName)
+	assert.Equal(t, "k6.http_req_duration.p95.1m", lines[1].metricKeyName)
+	assert.Equal(t, "k6.http_req_duration.p99.5m", lines[5].metricKeyName)
+	assert.Equal(t, "Second", lines[1].metricUnit)
+	assert.Equal(t, "run", lines[1].metricDimensions[testRunIDDimension])
+	assert.InEpsilon(t, 0.095, lines[1].metricValue, rollingPrecision)
+
+	lines = flush(start.Add(2*time.Minute), values(901, 1000)...)
+	require.Len(t, lines, 6)
+	assert.InEpsilon(t, 0.95, lines[0].metricValue, rollingPrecision, "the 1m window only holds the last flush")
+	assert.InEpsilon(t, 0.1, lines[3].metricValue, rollingPrecision, "the 5m window holds both flushes")
+
+	lines = flush(start.Add(6 * time.Minute))
+	require.Len(t, lines, 3, "the windows are sent while they hold samples")
+	assert.Equal(t, "k6.http_req_duration.p50.5m", lines[0].metricKeyName)
+	assert.InEpsilon(t, 0.95, lines[0].metricValue, rollingPrecision)
+
+	assert.Empty(t, flush(start.Add(8*time.Minute)))
+}
@@ -0,0 +1,131 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	selfMonitoringPrefix = "output.dynatrace."
+	heartbeatMetricName  = "output.heartbeat"
+)
+
+// exportStats counts what the output exported since the last flush, for
+// the self-monitoring metrics. Like the spans, it is only touched by the
+// flushing goroutine.
+type exportStats struct {
+	flushDuration time.Duration
+	payloadBytes  int
+	linesSent     int
+	linesInvalid  int
+	linesDropped  int
+	retries       int
+	lastStatus    int
+}
+
+// since returns the log fields of what was exported since before, in
+// duration.
+func (s exportStats) since(before exportStats, duration time.Duration) logrus.Fields {
+	fields := logrus.Fields{
+		"lines":        s.linesSent - before.linesSent,
+		"linesInvalid": s.linesInvalid - before.linesInvalid,
+		"linesDropped": s.linesDropped - before.linesDropped,
+		"bytes":        s.payloadBytes - before.payloadBytes,
+		"retries":      s.retries - before.retries,
+		"duration":     duration.String(),
+	}
+	if s.payloadBytes != before.payloadBytes {
+		fields["status"] = s.lastStatus
+	}
+	return fields
+}
+
+// ingestResponse is the answer of the metrics ingest endpoint.
+type ingestResponse struct {
+	LinesOk      int `json:"linesOk"`
+	LinesInvalid int `json:"linesInvalid"`
+}
+
+// recordIngest counts a request to the metrics ingest endpoint from its
+// status and answer.
+func (s *exportStats) recordIngest(payloadBytes, lines, status int, body []byte) {
+	s.payloadBytes += payloadBytes
+	s.lastStatus = status
+	var answer ingestResponse
+	if json.Unmarshal(body, &answer) == nil && answer.LinesOk+answer.LinesInvalid > 0 {
+		s.linesSent += answer.LinesOk
+		s.linesInvalid += answer.LinesInvalid
+		return
+	}
+	if status >= 200 && status <= 299 {
+		s.linesSent += lines
+		return
+	}
+	s.linesDropped += lines
+}
+
+// selfMonitoringMetrics returns the k6.output.dynatrace.* metrics about the
+// previous flush, sent along with the samples of the current one, and
+// resets the counters.
+func (o *Output) selfMonitoringMetrics(now time.Time, queueDepth int) []dynatraceMetric {
+	if !o.config.SelfMonitoring.Bool {
+		return nil
+	}
+	s := o.stats
+	o.stats = exportStats{}
+
+	dims := o.outputDimensions()
+	metric := func(name, unit string, value float64, delta bool) dynatraceMetric {
+		return dynatraceMetric{
+			metricKeyName:    o.metricKey(selfMonitoringPrefix + name),
+			description:      "xk6-output-dynatrace self-monitoring",
+			metricUnit:       unit,
+			metricDimensions: addDimensions(nil, dims),
+			metricValue:      value,
+			metricTimeStamp:  o.aggregateTimestamp(now),
+			metricType:       metrics.Gauge,
+			delta:            delta,
+		}
+	}
+	return []dynatraceMetric{
+		metric("flush_duration", "MilliSecond", float64(s.flushDuration.Milliseconds()), false),
+		metric("queue_depth", "Count", float64(queueDepth), false),
+		metric("payload_bytes", "Byte", float64(s.payloadBytes), true),
+		metric("lines_sent", "Count", float64(s.linesSent), true),
+		metric("lines_invalid", "Count", float64(s.linesInvalid), true),
+		metric("lines_dropped", "Count", float64(s.linesDropped), true),
+		metric("retries", "Count", float64(s.retries), true),
+	}
+}
+
+// heartbeatMetric returns the k6.output.heartbeat gauge sent with every
+// flush, even without samples, so a gap in its series shows the export
+// stopped during the test.
+func (o *Output) heartbeatMetric(now time.Time) []dynatraceMetric {
+	if !o.config.Heartbeat.Bool {
+		return nil
+	}
+	return []dynatraceMetric{{
+		metricKeyName:    o.metricKey(heartbeatMetricName),
+		description:      "xk6-output-dynatrace heartbeat, sent with every flush",
+		metricUnit:       "Count",
+		metricDimensions: o.outputDimensions(),
+		metricValue:      1,
+		metricTimeStamp:  o.aggregateTimestamp(now),
+		metricType:       metrics.Gauge,
+	}}
+}
+
+// outputDimensions returns the dimensions of the metrics about the output
+// itself.
+func (o *Output) outputDimensions() map[string]string {
+	dims := addDimensions(nil, o.config.Dimensions)
+	dims[testRunIDDimension] = o.config.TestRunID.String
+	if o.instanceID != "" {
+		dims[instanceIDDimension] = o.instanceID
+	}
+	return dims
+}
@@ -0,0 +1,111 @@
+package dynatracewriter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestExportStatsRecordIngest(t *testing.T) {
+	t.Parallel()
+
+	var s exportStats
+	s.recordIngest(100, 10, http.StatusAccepted, []byte(`{"linesOk":8,"linesInvalid":2,"error":null}`))
+	s.recordIngest(50, 5, http.StatusAccepted, nil)
+	s.recordIngest(20, 3, http.StatusServiceUnavailable, []byte("unavailable"))
+	assert.Equal(t, exportStats{payloadBytes: 170, linesSent: 13, linesInvalid: 2, linesDropped: 3, lastStatus: 503}, s)
+}
+
+func TestSelfMonitoringMetrics(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"linesOk":1,"linesInvalid":0}`))
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.SelfMonitoring = null.BoolFrom(true)
+	})
+	vus := newMetric("vus", metrics.Gauge)
+	o.AddMetricSamples([]metrics.SampleContainer{metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: vus, Tags: newTags(nil)},
+		Time:       time.Now(),
+		Value:      1,
+	}})
+	o.flush()
+	o.flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, bodies, 2)
+	assert.Contains(t, bodies[0], "k6.output.dynatrace.queue_depth,")
+	lines := strings.Split(bodies[1], "\n")
+	assert.Contains(t, findLine(t, lines, "k6.output.dynatrace.lines_sent,"), " count,delta=1 ")
+	assert.Contains(t, findLine(t, lines, "k6.output.dynatrace.queue_depth,"), " 0 ")
+}
+
+// findLine returns the first metric line starting with prefix.
+func findLine(t *testing.T, lines []string, prefix string) string {
+	t.Helper()
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	t.Fatalf("no line starting with %s", prefix)
+	return ""
+}
+
+func TestHeartbeatMetric(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, nil)
+	o.flush()
+
+	mu.Lock()
+	require.Len(t, bodies, 1, "the heartbeat is sent without samples")
+	line := findLine(t, strings.Split(bodies[0], "\n"), "k6.output.heartbeat,")
+	mu.Unlock()
+	assert.Contains(t, line, `test_run_id="run"`)
+	assert.Contains(t, line, " 1 ")
+
+	o = newTestOutput(t, server.URL, func(c *Config) {
+		c.Heartbeat = null.BoolFrom(false)
+	})
+	o.flush()
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, bodies, 1)
+}
@@ -0,0 +1,131 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// exportFormatJSON posts the lines as indented JSON to the configured url,
+// to look at them with a local endpoint, Dynatrace doesn't accept it.
+const exportFormatJSON = "json"
+
+// serializer encodes the metric lines of a flush into the body of the
+// ingest request.
+type serializer interface {
+	// url returns where the body is posted.
+	url(conf *Config) string
+	// contentType returns the Content-Type of the body, empty to keep the
+	// configured header.
+	contentType() string
+	serialize(dynMetrics []dynatraceMetric) ([]byte, error)
+}
+
+func newSerializer(o *Output, format string) (serializer, error) {
+	switch format {
+	case exportFormatMint:
+		return mintSerializer{output: o}, nil
+	case exportFormatOTLP:
+		return &otlpSerializer{output: o}, nil
+	case exportFormatJSON:
+		return jsonSerializer{}, nil
+	}
+	return nil, validateExportFormat(format)
+}
+
+// mintSerializer writes the metric ingest lines, describing each metric
+// key until a request describing it is accepted.
+type mintSerializer struct {
+	output *Output
+}
+
+func (s mintSerializer) url(conf *Config) string { return conf.Url }
+
+func (s mintSerializer) contentType() string { return "" }
+
+func (s mintSerializer) serialize(dynMetrics []dynatraceMetric) ([]byte, error) {
+	buf := getPayloadBuffer(len(dynMetrics))
+	defer putPayloadBuffer(buf)
+	writePayload(buf, dynMetrics, s.output.undescribed())
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// undescribed returns a copy of the described metric keys, for a body to
+// mark the keys it describes without marking them described before the
+// request is accepted.
+func (o *Output) undescribed() map[string]struct{} {
+	described := make(map[string]struct{}, len(o.describedMetrics))
+	for key := range o.describedMetrics {
+		described[key] = struct{}{}
+	}
+	return described
+}
+
+// markDescribed records the metric keys of accepted lines as described,
+// their metadata line isn't sent again.
+func (o *Output) markDescribed(dynMetrics []dynatraceMetric) {
+	for i := range dynMetrics {
+		o.describedMetrics[dynMetrics[i].metricKeyName] = struct{}{}
+	}
+}
+
+// otlpSerializer writes an OTLP metrics export request, the delta metrics
+// cover the time since the previous export.
+type otlpSerializer struct {
+	output *Output
+}
+
+func (s *otlpSerializer) url(conf *Config) string {
+	return conf.apiUrl(defaultDynatraceOTLPEndPoint)
+}
+
+func (s *otlpSerializer) contentType() string { return "application/x-protobuf" }
+
+func (s *otlpSerializer) serialize(dynMetrics []dynatraceMetric) ([]byte, error) {
+	o := s.output
+	now := time.Now()
+	start := o.lastExport
+	if start.IsZero() {
+		start = o.started
+	}
+	o.lastExport = now
+
+	body, err := proto.Marshal(o.toOTLP(dynMetrics, start, now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize the OTLP metrics: %w", err)
+	}
+	return body, nil
+}
+
+// jsonLine is a metric line of the json export format.
+type jsonLine struct {
+	Metric     string            `json:"metric"`
+	Dimensions map[string]string `json:"dimensions,omitempty"`
+	Value      float64           `json:"value"`
+	Delta      bool              `json:"delta,omitempty"`
+	Unit       string            `json:"unit,omitempty"`
+	Timestamp  int64             `json:"timestamp,omitempty"`
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) url(conf *Config) string { return conf.Url }
+
+func (jsonSerializer) contentType() string { return "application/json" }
+
+func (jsonSerializer) serialize(dynMetrics []dynatraceMetric) ([]byte, error) {
+	lines := make([]jsonLine, len(dynMetrics))
+	for i, m := range dynMetrics {
+		lines[i] = jsonLine{
+			Metric:     m.metricKeyName,
+			Dimensions: m.metricDimensions,
+			Value:      m.metricValue,
+			Delta:      m.delta,
+			Unit:       m.metricUnit,
+			Timestamp:  m.metricTimeStamp,
+		}
+	}
+	return json.MarshalIndent(lines, "", "  ")
+}
@@ -0,0 +1,94 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+// captureSerializer records the lines instead of encoding them.
+type captureSerializer struct {
+	jsonSerializer
+	lines []dynatraceMetric
+}
+
+func (s *captureSerializer) serialize(dynMetrics []dynatraceMetric) ([]byte, error) {
+	s.lines = append(s.lines, dynMetrics...)
+	return s.jsonSerializer.serialize(dynMetrics)
+}
+
+func TestSerializer(t *testing.T) {
+	t.Parallel()
+
+	var (
+		contentType string
+		body        []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	dynMetrics := benchmarkMetrics(2)
+
+	o := newTestOutput(t, server.URL, nil)
+	capture := &captureSerializer{}
+	o.serializer = capture
+	o.sendMetrics(dynMetrics)
+	assert.Equal(t, dynMetrics, capture.lines)
+
+	o = newTestOutput(t, server.URL, func(c *Config) {
+		c.ExportFormat = null.StringFrom(exportFormatJSON)
+	})
+	o.sendMetrics(dynMetrics)
+	assert.Equal(t, "application/json", contentType)
+	var lines []jsonLine
+	require.NoError(t, json.Unmarshal(body, &lines))
+	require.Len(t, lines, 2)
+	assert.Equal(t, "k6.http_req_duration", lines[1].Metric)
+	assert.Equal(t, 1.25, lines[1].Value)
+	assert.Equal(t, "GET", lines[1].Dimensions["method"])
+
+	o = newTestOutput(t, server.URL, nil)
+	o.sendMetrics(dynMetrics)
+	assert.Equal(t, "text/plain; charset=utf-8", contentType)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(body)), "\n"), 2)
+	assert.Contains(t, string(body), `k6.http_req_duration,`)
+}
+
+func TestMetadataSentUntilAccepted(t *testing.T) {
+	t.Parallel()
+
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, nil)
+	line := dynatraceMetric{metricKeyName: "k6.vus", metricUnit: "Count", metricValue: 1, metricType: metrics.Gauge}
+	for i := 0; i < 3; i++ {
+		o.sendMetrics([]dynatraceMetric{line})
+	}
+
+	require.Len(t, bodies, 3)
+	assert.True(t, strings.HasPrefix(bodies[0], "#k6.vus gauge"))
+	assert.True(t, strings.HasPrefix(bodies[1], "#k6.vus gauge"), "the rejected request didn't describe the metric")
+	assert.False(t, strings.HasPrefix(bodies[2], "#"), "the accepted request described the metric")
+}
@@ -0,0 +1,108 @@
+package dynatracewriter
+
+import (
+	"bytes"
+
+	"go.k6.io/k6/metrics"
+)
+
+// defaultSeriesCacheSize bounds the series cache, which is emptied when it
+// is full.
+const defaultSeriesCacheSize = 100000
+
+// cachedSeries is the outcome of the dimension rules for a series: the
+// metric line without its value and time, with its serialized dimensions
+// and its series key.
+type cachedSeries struct {
+	template dynatraceMetric
+	// keep is false when the relabel rules drop the series
+	keep     bool
+	rendered string
+	key      string
+	// perSample is set when the dimensions hold sample metadata, e.g. the
+	// vu and iter of keepVuTag and keepIterTag, which differ for the other
+	// samples of the series
+	perSample bool
+}
+
+func newCachedSeries(template dynatraceMetric) *cachedSeries {
+	var buf bytes.Buffer
+	writeDimensions(&buf, template.metricDimensions)
+	return &cachedSeries{
+		template: template,
+		keep:     true,
+		rendered: buf.String(),
+		key:      seriesKey(template.metricKeyName, template.metricDimensions),
+	}
+}
+
+type seriesCacheKey struct {
+	metric *metrics.Metric
+	// k6 interns the tag sets, the same tags share the same set
+	tags *metrics.TagSet
+}
+
+// seriesCache saves running the dimension rules and serializing the
+// dimensions for every sample of a series already seen. It is only used
+// by the flushing goroutine.
+type seriesCache struct {
+	size    int
+	entries map[seriesCacheKey]*cachedSeries
+}
+
+func newSeriesCache(size int) *seriesCache {
+	return &seriesCache{size: size, entries: make(map[seriesCacheKey]*cachedSeries)}
+}
+
+// seriesMetadataKeys are the metadata the dimension rules may read, the
+// samples carrying them are not cached.
+var seriesMetadataKeys = append([]string{groupTag, methodTag, subprotoTag}, errorDimensionTags...)
+
+func cacheable(sample metrics.Sample) bool {
+	for _, key := range seriesMetadataKeys {
+		if _, ok := sample.Metadata[key]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *seriesCache) get(sample metrics.Sample) *cachedSeries {
+	if c == nil || c.size == 0 {
+		return nil
+	}
+	return c.entries[seriesCacheKey{metric: sample.Metric, tags: sample.Tags}]
+}
+
+func (c *seriesCache) put(sample metrics.Sample, series *cachedSeries) {
+	if c == nil || c.size == 0 || !cacheable(sample) || series.perSample {
+		return
+	}
+	key := seriesCacheKey{metric: sample.Metric, tags: sample.Tags}
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	if len(c.entries) >= c.size {
+		c.reset()
+	}
+	c.entries[key] = series
+}
+
+// reset empties the cache, e.g. when the cardinality limit starts
+// rewriting or dropping series.
+func (c *seriesCache) reset() {
+	if c == nil {
+		return
+	}
+	c.entries = make(map[seriesCacheKey]*cachedSeries)
+}
+
+// ownDimensions gives the metric its own copy of its dimensions, before
+// they are modified, since the ones of a cached series are shared.
+func (e *dynatraceMetric) ownDimensions() {
+	if e.cached == nil {
+		return
+	}
+	e.metricDimensions = addDimensions(make(map[string]string, len(e.metricDimensions)+1), e.metricDimensions)
+	e.cached = nil
+}
@@ -0,0 +1,94 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSeriesCache(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.TraceIDs = null.BoolFrom(true)
+	})
+	metric := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	tags := newTags(map[string]string{"url": "/a", "method": "GET"})
+	now := time.Now()
+
+	sample := func(value float64, metadata map[string]string) metrics.Sample {
+		return metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: tags},
+			Time:       now,
+			Value:      value,
+			Metadata:   metadata,
+		}
+	}
+
+	first, ok := o.convertSample(sample(12.5, nil), now)
+	require.True(t, ok)
+	second, ok := o.convertSample(sample(3, nil), now)
+	require.True(t, ok)
+	assert.Same(t, first.cached, second.cached)
+	assert.Equal(t, 3.0, second.metricValue)
+
+	uncached := second
+	uncached.cached = nil
+	assert.Equal(t, uncached.toText(), second.toText())
+
+	// the trace id of a sample doesn't leak into the cached series
+	traced, ok := o.convertSample(sample(1, map[string]string{traceIDTag: "abc"}), now)
+	require.True(t, ok)
+	assert.Equal(t, "abc", traced.metricDimensions[traceIDTag])
+	assert.NotContains(t, second.metricDimensions, traceIDTag)
+	assert.NotContains(t, second.toText(), "abc")
+
+	// the error dimensions read the metadata, these samples aren't cached
+	o.series.reset()
+	_, ok = o.convertSample(sample(1, map[string]string{statusTag: "500"}), now)
+	require.True(t, ok)
+	assert.Empty(t, o.series.entries)
+
+	o.series.reset()
+	_, ok = o.convertSample(sample(1, nil), now)
+	require.True(t, ok)
+	assert.Len(t, o.series.entries, 1)
+}
+
+func TestSeriesCacheLimit(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.MaxSeries = null.IntFrom(1)
+	})
+	metric := newMetric("http_reqs", metrics.Counter)
+	registry := metrics.NewRegistry()
+	now := time.Now()
+
+	convert := func(url string) dynatraceMetric {
+		m, ok := o.convertSample(metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: metric,
+				Tags:   registry.RootTagSet().WithTagsFromMap(map[string]string{"url": url}),
+			},
+			Time:  now,
+			Value: 1,
+		}, now)
+		require.True(t, ok)
+		return m
+	}
+
+	a := convert("/a")
+	assert.Len(t, o.series.entries, 1)
+
+	// the limit rewrites the dimensions of the new series, not the cached ones
+	b := convert("/b")
+	assert.Equal(t, otherDimensionValue, b.metricDimensions["url"])
+	assert.Equal(t, "/a", a.metricDimensions["url"])
+	assert.Empty(t, o.series.entries)
+	assert.Contains(t, b.toText(), `url="other"`)
+}
@@ -0,0 +1,123 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultDynatraceSloEndPoint = "/api/v2/slo"
+
+	defaultSloTarget    = 95.0
+	defaultSloWarning   = 97.5
+	defaultSloTimeframe = "-1w"
+)
+
+type slo struct {
+	Name             string  `json:"name"`
+	Description      string  `json:"description"`
+	MetricName       string  `json:"metricName"`
+	MetricExpression string  `json:"metricExpression"`
+	EvaluationType   string  `json:"evaluationType"`
+	Filter           string  `json:"filter"`
+	Target           float64 `json:"target"`
+	Warning          float64 `json:"warning"`
+	Timeframe        string  `json:"timeframe"`
+	Enabled          bool    `json:"enabled"`
+}
+
+type sloList struct {
+	Slo []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"slo"`
+}
+
+var sloMetricNameRe = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// newSlos returns an SLO per threshold, measuring the share of the time
+// the k6.threshold.{metric} gauge reported the threshold as passing.
+func (o *Output) newSlos() []slo {
+	o.thresholds.mu.Lock()
+	defer o.thresholds.mu.Unlock()
+
+	names := make([]string, 0, len(o.thresholds.thresholds))
+	for name := range o.thresholds.thresholds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []slo
+	for _, name := range names {
+		key := o.metricKey(thresholdMetricPrefix + parentMetricName(name))
+		for _, threshold := range o.thresholds.thresholds[name].Thresholds {
+			sloName := fmt.Sprintf("k6 %s %s", name, threshold.Source)
+			result = append(result, slo{
+				Name:        sloName,
+				Description: "Maintained by xk6-output-dynatrace from the k6 threshold " + threshold.Source,
+				MetricName:  strings.Trim(sloMetricNameRe.ReplaceAllString(strings.ToLower(sloName), "_"), "_"),
+				MetricExpression: fmt.Sprintf(`(100)*(%s:filter(and(eq(%s,"%s"),eq(%s,"%s"))):avg)`,
+					key, thresholdDimension, escapeSelector(threshold.Source), metricDimension, escapeSelector(name)),
+				EvaluationType: "AGGREGATE",
+				Target:         o.config.SloTarget.Float64,
+				Warning:        o.config.SloWarning.Float64,
+				Timeframe:      o.config.SloTimeframe.String,
+				Enabled:        true,
+			})
+		}
+	}
+	return result
+}
+
+// escapeSelector escapes the characters with a meaning in metric and SLO
+// selectors.
+func escapeSelector(s string) string {
+	return strings.NewReplacer(`~`, `~~`, `"`, `~"`, `)`, `~)`, `,`, `~,`).Replace(s)
+}
+
+// syncSlos creates the SLO of every threshold, or updates it if an SLO with
+// the same name exists already.
+func (o *Output) syncSlos() {
+	if !o.config.Slos.Bool {
+		return
+	}
+	if !o.config.ExportThresholds.Bool {
+		o.logger.Warn("Dynatrace: slos needs exportThresholds, the SLOs would have no data")
+		return
+	}
+
+	for _, s := range o.newSlos() {
+		if err := o.upsertSlo(s); err != nil {
+			o.logger.WithError(err).WithField("slo", s.Name).Warn("Dynatrace: failed to create the SLO")
+		}
+	}
+}
+
+func (o *Output) upsertSlo(s slo) error {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	selector := url.QueryEscape(fmt.Sprintf(`name("%s")`, escapeSelector(s.Name)))
+	response, err := o.callAPI(http.MethodGet, defaultDynatraceSloEndPoint+"?sloSelector="+selector, "", nil)
+	if err != nil {
+		return err
+	}
+	var existing sloList
+	if err := json.Unmarshal(response, &existing); err != nil {
+		return err
+	}
+	for _, e := range existing.Slo {
+		if e.Name == s.Name {
+			_, err := o.callAPI(http.MethodPut, defaultDynatraceSloEndPoint+"/"+url.PathEscape(e.ID), "application/json; charset=utf-8", body)
+			return err
+		}
+	}
+	return o.postAPI(defaultDynatraceSloEndPoint, "application/json; charset=utf-8", body)
+}
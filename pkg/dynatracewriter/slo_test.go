@@ -0,0 +1,76 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSyncSlos(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+		slos  = make(map[string]slo)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, req.Method+" "+req.URL.Path)
+
+		if req.Method == http.MethodGet {
+			selector := req.URL.Query().Get("sloSelector")
+			if strings.Contains(selector, "http_req_failed") {
+				fmt.Fprint(w, `{"slo":[{"id":"slo-1","name":"k6 http_req_failed rate<0.01"}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"slo":[]}`)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		var s slo
+		assert.NoError(t, json.Unmarshal(body, &s))
+		slos[s.Name] = s
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.Slos = null.BoolFrom(true)
+		c.SloTarget = null.FloatFrom(99)
+	})
+	o.SetThresholds(map[string]metrics.Thresholds{
+		"http_req_failed":   {Thresholds: []*metrics.Threshold{{Source: "rate<0.01"}}},
+		"http_req_duration": {Thresholds: []*metrics.Threshold{{Source: "p(95)<500"}}},
+	})
+	o.syncSlos()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"GET " + defaultDynatraceSloEndPoint,
+		"POST " + defaultDynatraceSloEndPoint,
+		"GET " + defaultDynatraceSloEndPoint,
+		"PUT " + defaultDynatraceSloEndPoint + "/slo-1",
+	}, calls)
+
+	require.Contains(t, slos, "k6 http_req_duration p(95)<500")
+	s := slos["k6 http_req_duration p(95)<500"]
+	assert.Equal(t, `(100)*(k6.threshold.http_req_duration:filter(and(eq(threshold,"p(95~)<500"),eq(metric,"http_req_duration"))):avg)`, s.MetricExpression)
+	assert.Equal(t, "k6_http_req_duration_p_95_500", s.MetricName)
+	assert.Equal(t, 99.0, s.Target)
+	assert.Equal(t, defaultSloWarning, s.Warning)
+	assert.Equal(t, defaultSloTimeframe, s.Timeframe)
+	assert.Contains(t, slos, "k6 http_req_failed rate<0.01")
+}
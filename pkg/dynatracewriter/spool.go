@@ -0,0 +1,157 @@
+package dynatracewriter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const spoolFileSuffix = ".batch"
+
+func defaultSpoolDir() string {
+	return filepath.Join(os.TempDir(), "xk6-output-dynatrace-spool")
+}
+
+// spoolBatch writes the body of a request whose retries are exhausted to
+// the spool directory, named after the time and its number of lines so
+// the batches are replayed in order.
+func (o *Output) spoolBatch(body []byte, lines int) (string, error) {
+	dir := o.config.SpoolDir.String
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%d-%d%s", time.Now().UnixNano(), lines, spoolFileSuffix))
+	// written aside first, a partial file is never replayed
+	if err := ioutil.WriteFile(name+".tmp", body, 0o600); err != nil {
+		return "", err
+	}
+	return name, os.Rename(name+".tmp", name)
+}
+
+// spooledBatches returns the files of the spool directory, oldest first.
+func (o *Output) spooledBatches() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(o.config.SpoolDir.String, "*"+spoolFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// spooledLines returns the number of lines of a spooled batch, from its
+// name.
+func spooledLines(name string) int {
+	base := strings.TrimSuffix(filepath.Base(name), spoolFileSuffix)
+	lines, _ := strconv.Atoi(base[strings.LastIndex(base, "-")+1:])
+	return lines
+}
+
+// replaySpool sends the spooled batches again, oldest first, until one
+// fails, the remaining ones wait for the next flush.
+func (o *Output) replaySpool(ctx context.Context) {
+	if o.config.RetryExhaustedPolicy.String != retryExhaustedSpool {
+		return
+	}
+	names, err := o.spooledBatches()
+	if err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to list the spooled batches")
+		return
+	}
+	for _, name := range names {
+		body, err := ioutil.ReadFile(name)
+		if err != nil {
+			o.logger.WithError(err).Warn("Dynatrace: failed to read a spooled batch")
+			return
+		}
+		hash := batchHash(body)
+		if o.accepted.contains(hash) {
+			// replayed already, the file could not be removed
+			if err := os.Remove(name); err != nil {
+				o.logger.WithError(err).Warn("Dynatrace: failed to remove a replayed batch")
+				return
+			}
+			continue
+		}
+		compressed, err := compressBody(body, o.compression)
+		if err != nil {
+			return
+		}
+		request, err := o.newIngestRequest(ctx, bytes.NewReader(compressed), o.compression)
+		if err != nil {
+			return
+		}
+		request.Header.Set(batchHashHeader, hash)
+		lines := spooledLines(name)
+		response, logger, err := o.do(request, newRequestID(), 1, lines)
+		if err != nil {
+			logger.WithError(err).Debug("Dynatrace: the spooled batches wait for the endpoint")
+			return
+		}
+		answer, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			logger.Debug("Dynatrace: the spooled batches wait for the endpoint")
+			return
+		}
+		o.stats.recordIngest(len(body), lines, response.StatusCode, answer)
+		o.totals.recordIngest(len(body), lines, response.StatusCode, answer)
+		o.accepted.add(hash)
+		if err := os.Remove(name); err != nil {
+			logger.WithError(err).Warn("Dynatrace: failed to remove a replayed batch")
+			return
+		}
+		logger.Info("Dynatrace: replayed a spooled batch")
+	}
+}
+
+// newIngestRequest returns a request posting the payload, compressed with
+// the encoding, with the configured headers.
+func (o *Output) newIngestRequest(ctx context.Context, payload io.Reader, encoding string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, o.serializer.url(o.config), payload)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range o.config.Headers {
+		request.Header.Set(key, value)
+	}
+	if contentType := o.serializer.contentType(); contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if encoding != "" && encoding != compressionNone {
+		request.Header.Set("Content-Encoding", encoding)
+	}
+	return request, nil
+}
+
+// spoolLines spools the lines of a request whose retries are exhausted,
+// body is nil when the request was streamed.
+func (o *Output) spoolLines(logger logrus.FieldLogger, dynMetrics []dynatraceMetric, body []byte, attempts int) error {
+	o.recordExport(false)
+	var err error
+	if body == nil {
+		body, err = o.serializer.serialize(dynMetrics)
+	}
+	var name string
+	if err == nil {
+		name, err = o.spoolBatch(body, len(dynMetrics))
+	}
+	if err != nil {
+		logger.WithError(err).Error("Dynatrace: failed to spool the lines, dropping them")
+		o.stats.linesDropped += len(dynMetrics)
+		o.totals.linesDropped += len(dynMetrics)
+		return err
+	}
+	logger.WithField("file", name).Warn("Dynatrace: the retries are exhausted, spooled the lines")
+	return fmt.Errorf("the retries are exhausted after %d attempts, spooled the lines to %s", attempts, name)
+}
@@ -0,0 +1,85 @@
+package dynatracewriter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestRetryExhaustedSpool(t *testing.T) {
+	t.Parallel()
+
+	var (
+		status   = http.StatusServiceUnavailable
+		received []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, string(body))
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.MaxRetries = null.IntFrom(1)
+		c.RetryExhaustedPolicy = null.StringFrom(retryExhaustedSpool)
+		c.SpoolDir = null.StringFrom(dir)
+	})
+	lines := []dynatraceMetric{
+		{metricKeyName: "k6.iterations", metricValue: 1, metricType: metrics.Counter, delta: true},
+		{metricKeyName: "k6.vus", metricValue: 2, metricType: metrics.Gauge},
+	}
+	err := o.sendMetricsContext(context.Background(), lines)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spooled")
+	assert.Len(t, received, 2)
+	assert.Zero(t, o.totals.linesDropped)
+
+	spooled, err := o.spooledBatches()
+	require.NoError(t, err)
+	require.Len(t, spooled, 1)
+	assert.Equal(t, 2, spooledLines(spooled[0]))
+
+	// the endpoint is still down, the batch waits
+	o.replaySpool(context.Background())
+	spooled, _ = o.spooledBatches()
+	assert.Len(t, spooled, 1)
+
+	status = http.StatusAccepted
+	o.replaySpool(context.Background())
+	spooled, _ = o.spooledBatches()
+	assert.Empty(t, spooled)
+	assert.Equal(t, received[0], received[len(received)-1])
+	assert.Equal(t, 2, o.totals.linesSent)
+}
+
+func TestMaxRetryElapsedTime(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.MaxRetryElapsedTime = types.NullDurationFrom(time.Second)
+	})
+	o.sendMetrics([]dynatraceMetric{{metricKeyName: "k6.vus", metricValue: 1, metricType: metrics.Gauge}})
+	// waiting 5s for the next attempt exceeds the 1s budget
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, 1, o.totals.linesDropped)
+}
@@ -0,0 +1,104 @@
+package dynatracewriter
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const statsVarName = "xk6-output-dynatrace"
+
+// liveStats are the counters of the running output, read concurrently by
+// the stats listener.
+type liveStats struct {
+	queueDepth   atomic.Int64
+	inFlight     atomic.Int64
+	requests     atomic.Int64
+	retries      atomic.Int64
+	linesSent    atomic.Int64
+	linesInvalid atomic.Int64
+	linesDropped atomic.Int64
+	bytes        atomic.Int64
+	flushes      atomic.Int64
+}
+
+func (s *liveStats) snapshot() map[string]int64 {
+	return map[string]int64{
+		"queueDepth":   s.queueDepth.Load(),
+		"inFlight":     s.inFlight.Load(),
+		"requests":     s.requests.Load(),
+		"retries":      s.retries.Load(),
+		"linesSent":    s.linesSent.Load(),
+		"linesInvalid": s.linesInvalid.Load(),
+		"linesDropped": s.linesDropped.Load(),
+		"bytes":        s.bytes.Load(),
+		"flushes":      s.flushes.Load(),
+	}
+}
+
+// store publishes the totals of the finished flush.
+func (s *liveStats) store(totals exportStats) {
+	s.flushes.Add(1)
+	s.retries.Store(int64(totals.retries))
+	s.linesSent.Store(int64(totals.linesSent))
+	s.linesInvalid.Store(int64(totals.linesInvalid))
+	s.linesDropped.Store(int64(totals.linesDropped))
+	s.bytes.Store(int64(totals.payloadBytes))
+}
+
+var (
+	publishStats sync.Once
+	// publishedStats are the stats of the last started output, expvar
+	// names can only be published once per process
+	publishedStats atomic.Pointer[liveStats]
+)
+
+// startStatsListener publishes the stats with expvar and, when statsAddress
+// is set, serves them on /debug/vars next to the pprof endpoints, to
+// follow long soak tests without verbose logging.
+func (o *Output) startStatsListener() error {
+	publishedStats.Store(&o.live)
+	publishStats.Do(func() {
+		expvar.Publish(statsVarName, expvar.Func(func() interface{} {
+			return publishedStats.Load().snapshot()
+		}))
+	})
+	if o.config.StatsAddress.String == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", o.config.StatsAddress.String)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	o.statsServer = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := o.statsServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			o.logger.WithError(err).Warn("Dynatrace: the stats listener stopped")
+		}
+	}()
+	o.logger.WithField("address", listener.Addr().String()).Info("Dynatrace: serving the export stats on /debug/vars")
+	return nil
+}
+
+func (o *Output) stopStatsListener() {
+	if o.statsServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = o.statsServer.Shutdown(ctx)
+}
@@ -0,0 +1,54 @@
+package dynatracewriter
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestStatsListener(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.StatsAddress = null.StringFrom("127.0.0.1:0")
+	})
+	require.NoError(t, o.startStatsListener())
+	defer o.stopStatsListener()
+	o.flush()
+
+	assert.NotNil(t, expvar.Get(statsVarName))
+	stats := o.live.snapshot()
+	assert.EqualValues(t, 1, stats["flushes"])
+	assert.EqualValues(t, 1, stats["requests"])
+	assert.EqualValues(t, 0, stats["inFlight"])
+	assert.EqualValues(t, 1, stats["linesSent"], "the heartbeat")
+}
+
+func TestStatsListenerServesVars(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.StatsAddress = null.StringFrom("127.0.0.1:0")
+	})
+	require.NoError(t, o.startStatsListener())
+	defer o.stopStatsListener()
+	o.live.queueDepth.Store(42)
+
+	recorder := httptest.NewRecorder()
+	o.statsServer.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var vars map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &vars))
+	require.Contains(t, vars, statsVarName)
+}
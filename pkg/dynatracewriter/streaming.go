@@ -0,0 +1,60 @@
+package dynatracewriter
+
+import "io"
+
+// streamChunkLines is the number of lines serialized at once into the
+// streamed body.
+const streamChunkLines = 1000
+
+// payloadStream is a compressed metric lines body, serialized while the
+// request sends it instead of building the whole payload first.
+type payloadStream struct {
+	*io.PipeReader
+	done    chan struct{}
+	written int
+}
+
+// streamPayload starts serializing the metrics into the returned body,
+// compressed with the encoding, by chunks of streamChunkLines lines.
+func (o *Output) streamPayload(dynatraceMetrics []dynatraceMetric, encoding string) *payloadStream {
+	reader, writer := io.Pipe()
+	s := &payloadStream{PipeReader: reader, done: make(chan struct{})}
+	// the keys are marked described by the flushing goroutine, once the
+	// request is accepted
+	described := o.undescribed()
+	go func() {
+		defer close(s.done)
+		buf := getPayloadBuffer(streamChunkLines)
+		defer putPayloadBuffer(buf)
+		compressor, err := newCompressor(writer, encoding)
+		if err == nil {
+			for start := 0; start < len(dynatraceMetrics) && err == nil; start += streamChunkLines {
+				end := start + streamChunkLines
+				if end > len(dynatraceMetrics) {
+					end = len(dynatraceMetrics)
+				}
+				buf.Reset()
+				writePayload(buf, dynatraceMetrics[start:end], described)
+				s.written += buf.Len()
+				_, err = compressor.Write(buf.Bytes())
+			}
+			// closed even when the request ended the body early, the zstd
+			// encoder holds goroutines and buffers until then
+			closeErr := compressor.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+		// a nil error ends the body with io.EOF
+		writer.CloseWithError(err)
+	}()
+	return s
+}
+
+// size stops the serialization, if the request ended before reading the
+// whole body, and returns the number of uncompressed bytes serialized.
+func (s *payloadStream) size() int {
+	s.PipeReader.Close()
+	<-s.done
+	return s.written
+}
@@ -0,0 +1,100 @@
+package dynatracewriter
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestStreamPayload(t *testing.T) {
+	t.Parallel()
+
+	var (
+		encoding string
+		received string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(gz)
+		received = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.StreamPayload = null.BoolFrom(true)
+		c.MaxLinesPerRequest = null.IntFrom(0)
+	})
+	dynMetrics := benchmarkMetrics(2*streamChunkLines + 1)
+	expected := generatePayload(dynMetrics, make(map[string]struct{}))
+	o.sendMetrics(dynMetrics)
+
+	assert.Equal(t, "gzip", encoding)
+	require.Equal(t, strings.Count(expected, "\n"), strings.Count(received, "\n"))
+	assert.Equal(t, len(expected), o.totals.payloadBytes)
+	assert.Equal(t, len(dynMetrics), o.totals.linesSent)
+}
+
+func TestStreamPayloadConnectionError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.StreamPayload = null.BoolFrom(true)
+		c.MaxLinesPerRequest = null.IntFrom(0)
+	})
+	// returns instead of blocking on the unread body
+	o.sendMetrics(benchmarkMetrics(3 * streamChunkLines))
+	assert.Equal(t, 3*streamChunkLines, o.totals.linesDropped)
+}
+
+func TestStreamPayloadRetry(t *testing.T) {
+	t.Parallel()
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(received) == 0 {
+			// answered before the body is read, the attempt stops its serialization
+			received = append(received, "")
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(gz)
+		received = append(received, string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.StreamPayload = null.BoolFrom(true)
+		c.MaxLinesPerRequest = null.IntFrom(0)
+	})
+	dynMetrics := benchmarkMetrics(2 * streamChunkLines)
+	expected := generatePayload(dynMetrics, make(map[string]struct{}))
+	o.sendMetrics(dynMetrics)
+
+	require.Len(t, received, 2)
+	assert.Equal(t, strings.Count(expected, "\n"), strings.Count(received[1], "\n"))
+	assert.Equal(t, len(dynMetrics), o.totals.linesSent)
+	assert.Equal(t, 1, o.totals.retries)
+}
@@ -0,0 +1,109 @@
+package dynatracewriter
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.k6.io/k6/metrics"
+)
+
+// submetric is a threshold submetric, e.g. http_req_duration{staticAsset:yes},
+// the samples of its parent metric having the selector tags.
+type submetric struct {
+	name     string
+	selector map[string]string
+}
+
+// newSubmetrics returns the submetrics of the thresholds by parent metric.
+func newSubmetrics(thresholds map[string]metrics.Thresholds) map[string][]submetric {
+	submetrics := make(map[string][]submetric)
+	for name := range thresholds {
+		selector := submetricSelector(name)
+		if len(selector) == 0 {
+			continue
+		}
+		parent := parentMetricName(name)
+		submetrics[parent] = append(submetrics[parent], submetric{name: name, selector: selector})
+	}
+	for _, subs := range submetrics {
+		sort.Slice(subs, func(i, j int) bool { return subs[i].name < subs[j].name })
+	}
+	return submetrics
+}
+
+func (s submetric) matches(sample metrics.Sample) bool {
+	for key, value := range s.selector {
+		if tag, ok := sampleTag(sample, key); !ok || tag != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchingSubmetrics returns the threshold submetrics the sample belongs to.
+func (s *thresholdState) matchingSubmetrics(sample metrics.Sample) []submetric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []submetric
+	for _, sub := range s.submetrics[sample.Metric.Name] {
+		if sub.matches(sample) {
+			matching = append(matching, sub)
+		}
+	}
+	return matching
+}
+
+// submetricDimensions returns the selector tags of the submetrics the
+// sample belongs to, kept as dimensions whatever the tag filters so the
+// submetric series don't merge into the ones of the parent metric.
+func (o *Output) submetricDimensions(sample metrics.Sample) map[string]string {
+	if !o.config.SubmetricDimensions.Bool {
+		return nil
+	}
+	var dims map[string]string
+	for _, sub := range o.thresholds.matchingSubmetrics(sample) {
+		dims = addDimensions(dims, sub.selector)
+	}
+	return dims
+}
+
+var submetricKeyRe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// submetricKeyName returns the metric name of a submetric, its parent
+// followed by its selector: http_req_duration{staticAsset:yes} becomes
+// http_req_duration.staticAsset_yes.
+func submetricKeyName(sub submetric) string {
+	keys := make([]string, 0, len(sub.selector))
+	for key := range sub.selector {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(parentMetricName(sub.name))
+	for _, key := range keys {
+		b.WriteByte('.')
+		b.WriteString(submetricKeyRe.ReplaceAllString(key+"_"+sub.selector[key], "_"))
+	}
+	return b.String()
+}
+
+// submetricLines returns a copy of the line of the sample under the name
+// of every submetric it belongs to, when submetricNames is set.
+func (o *Output) submetricLines(sample metrics.Sample, m dynatraceMetric) []dynatraceMetric {
+	if !o.config.SubmetricNames.Bool {
+		return nil
+	}
+	var lines []dynatraceMetric
+	for _, sub := range o.thresholds.matchingSubmetrics(sample) {
+		line := m
+		line.ownDimensions()
+		line.metricKeyName = o.metricKey(submetricKeyName(sub))
+		if o.limiter.admit(&line) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,66 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func submetricSamples() []metrics.SampleContainer {
+	now := time.Now()
+	duration := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	sample := func(tags map[string]string, value float64) metrics.Sample {
+		return metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: newTags(tags)}, Time: now, Value: value}
+	}
+	return []metrics.SampleContainer{metrics.Samples{
+		sample(map[string]string{"staticAsset": "yes", "status": "200"}, 10),
+		sample(map[string]string{"staticAsset": "no", "status": "200"}, 300),
+	}}
+}
+
+func TestSubmetricDimensions(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.TagsAsDimensions = []string{"status"}
+	})
+	o.SetThresholds(map[string]metrics.Thresholds{
+		"http_req_duration{staticAsset:yes}": {Thresholds: []*metrics.Threshold{{Source: "p(95)<100"}}},
+	})
+
+	lines := o.convertToTimeDynatraceData(submetricSamples())
+	require.Len(t, lines, 2)
+	assert.Equal(t, "k6.http_req_duration", lines[0].metricKeyName)
+	assert.Equal(t, "yes", lines[0].metricDimensions["staticAsset"], "the selector tags are kept as dimensions")
+	assert.NotContains(t, lines[1].metricDimensions, "staticAsset")
+
+	value, ok := o.thresholds.value("http_req_duration{staticAsset:yes}", "p(95)<100", time.Now())
+	require.True(t, ok)
+	assert.Equal(t, 10.0, value, "the submetric thresholds get their own samples")
+}
+
+func TestSubmetricNames(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.SubmetricNames = null.BoolFrom(true)
+	})
+	o.SetThresholds(map[string]metrics.Thresholds{
+		"http_req_duration{staticAsset:yes}":              {Thresholds: []*metrics.Threshold{{Source: "p(95)<100"}}},
+		`http_req_duration{status:"200",staticAsset:yes}`: {Thresholds: []*metrics.Threshold{{Source: "max<500"}}},
+	})
+
+	lines := o.convertToTimeDynatraceData(submetricSamples())
+	assert.Equal(t, []string{
+		"k6.http_req_duration{200}",
+		"k6.http_req_duration.staticAsset_yes{200}",
+		"k6.http_req_duration.staticAsset_yes.status_200{200}",
+		"k6.http_req_duration{200}",
+	}, metricKeys(lines))
+	assert.Equal(t, "yes", lines[1].metricDimensions["staticAsset"])
+	assert.Equal(t, lines[0].metricValue, lines[2].metricValue)
+}
@@ -0,0 +1,126 @@
+package dynatracewriter
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"go.k6.io/k6/metrics"
+)
+
+const summaryMetricPrefix = "summary."
+
+// summaryMetrics are the k6 metrics aggregated over the whole run for the
+// end-of-test summary.
+var summaryMetrics = map[string]struct{}{
+	"http_reqs":         {},
+	"http_req_failed":   {},
+	"http_req_duration": {},
+	"data_sent":         {},
+	"data_received":     {},
+	"checks":            {},
+}
+
+// testSummary aggregates the samples of the summary metrics over the run.
+type testSummary struct {
+	mu    sync.Mutex
+	sinks map[string]metrics.Sink
+}
+
+func (s *testSummary) observe(sample metrics.Sample) {
+	if _, ok := summaryMetrics[sample.Metric.Name]; !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sinks == nil {
+		s.sinks = make(map[string]metrics.Sink)
+	}
+	sink, ok := s.sinks[sample.Metric.Name]
+	if !ok {
+		sink = metrics.NewSink(sample.Metric.Type)
+		s.sinks[sample.Metric.Name] = sink
+	}
+	sink.Add(sample)
+}
+
+type summaryValue struct {
+	name  string
+	unit  string
+	value float64
+}
+
+// values returns the overall aggregates of the metrics seen during the run.
+func (s *testSummary) values() []summaryValue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []summaryValue
+	if sink, ok := s.sinks["http_reqs"].(*metrics.CounterSink); ok {
+		result = append(result, summaryValue{name: "requests", unit: "Count", value: sink.Value})
+	}
+	if sink, ok := s.sinks["http_req_failed"].(*metrics.RateSink); ok && sink.Total > 0 {
+		result = append(result, summaryValue{name: "error_rate", unit: "Ratio", value: float64(sink.Trues) / float64(sink.Total)})
+	}
+	if sink, ok := s.sinks["http_req_duration"].(*metrics.TrendSink); ok {
+		result = append(result, summaryValue{name: "http_req_duration_p95", unit: "MilliSecond", value: sink.P(0.95)})
+	}
+	if sink, ok := s.sinks["data_sent"].(*metrics.CounterSink); ok {
+		result = append(result, summaryValue{name: "data_sent", unit: "Byte", value: sink.Value})
+	}
+	if sink, ok := s.sinks["data_received"].(*metrics.CounterSink); ok {
+		result = append(result, summaryValue{name: "data_received", unit: "Byte", value: sink.Value})
+	}
+	if sink, ok := s.sinks["checks"].(*metrics.RateSink); ok && sink.Total > 0 {
+		result = append(result, summaryValue{name: "checks_pass_ratio", unit: "Ratio", value: float64(sink.Trues) / float64(sink.Total)})
+	}
+	return result
+}
+
+// sendSummary pushes the end-of-test aggregates both as k6.summary.*
+// metrics and as an event, making run-over-run comparisons easy.
+func (o *Output) sendSummary(now time.Time) {
+	if !o.config.Summary.Bool {
+		return
+	}
+
+	values := o.summary.values()
+	if len(values) == 0 {
+		return
+	}
+
+	dynMetrics := make([]dynatraceMetric, 0, len(values))
+	properties := o.testInfo.properties()
+	for _, v := range values {
+		// the test description makes the summary series self-describing
+		dims := addDimensions(o.testInfo.properties(), o.config.Dimensions)
+		dims[testRunIDDimension] = o.config.TestRunID.String
+		dynMetrics = append(dynMetrics, dynatraceMetric{
+			metricKeyName:    o.metricKey(summaryMetricPrefix + v.name),
+			description:      "k6 end-of-test summary",
+			metricUnit:       v.unit,
+			metricDimensions: dims,
+			metricValue:      v.value,
+			metricTimeStamp:  o.aggregateTimestamp(now),
+			metricType:       metrics.Gauge,
+		})
+		properties[v.name] = strconv.FormatFloat(v.value, 'f', -1, 64)
+	}
+	o.sendMetrics(dynMetrics)
+	if o.config.IngestMode.String == ingestModeLocal {
+		// the local listener only ingests metrics
+		return
+	}
+
+	event := dynatraceEvent{
+		EventType:  eventTypeCustomInfo,
+		Title:      "k6 load test summary",
+		StartTime:  o.started.UnixMilli(),
+		EndTime:    now.UnixMilli(),
+		Properties: properties,
+	}
+	if err := o.sendEvent(event); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to send the summary event")
+	}
+}
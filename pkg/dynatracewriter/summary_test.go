@@ -0,0 +1,47 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.k6.io/k6/metrics"
+)
+
+func TestTestSummaryValues(t *testing.T) {
+	t.Parallel()
+
+	var (
+		s        testSummary
+		now      = time.Now()
+		reqs     = newMetric("http_reqs", metrics.Counter)
+		failed   = newMetric("http_req_failed", metrics.Rate)
+		duration = newMetric("http_req_duration", metrics.Trend, metrics.Time)
+		checks   = newMetric("checks", metrics.Rate)
+		vus      = newMetric("vus", metrics.Gauge)
+	)
+
+	for i := 1; i <= 100; i++ {
+		s.observe(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: reqs}, Time: now, Value: 1})
+		s.observe(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration}, Time: now, Value: float64(i)})
+		failedValue := 0.0
+		if i%10 == 0 {
+			failedValue = 1
+		}
+		s.observe(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: failed}, Time: now, Value: failedValue})
+		s.observe(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: vus}, Time: now, Value: 10})
+	}
+	s.observe(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks}, Time: now, Value: 1})
+	s.observe(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: checks}, Time: now, Value: 0})
+
+	values := make(map[string]float64)
+	for _, v := range s.values() {
+		values[v.name] = v.value
+	}
+	assert.Equal(t, 100.0, values["requests"])
+	assert.Equal(t, 0.1, values["error_rate"])
+	assert.InDelta(t, 95, values["http_req_duration_p95"], 1)
+	assert.Equal(t, 0.5, values["checks_pass_ratio"])
+	assert.NotContains(t, values, "data_sent")
+	assert.Len(t, values, 4)
+}
@@ -0,0 +1,247 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.k6.io/k6/output"
+	"go.k6.io/k6/metrics"
+)
+
+const (
+	thresholdMetricPrefix = "threshold."
+	thresholdDimension    = "threshold"
+	metricDimension       = "metric"
+)
+
+var _ output.WithThresholds = new(Output)
+
+// thresholdState holds the thresholds of the test and evaluates them
+// against the samples the output receives.
+type thresholdState struct {
+	mu         sync.Mutex
+	thresholds map[string]metrics.Thresholds
+	// evaluated holds copies of the thresholds by metric, their LastFailed
+	// is set by evaluate: the engine sets the one of its own thresholds
+	// under a lock the output can't take
+	evaluated map[string]*metrics.Thresholds
+
+	// sinks aggregate the samples of the thresholded metrics so the value
+	// that crossed a threshold can be reported; the engine's own sinks
+	// can't be read safely from the output.
+	sinks   map[string]metrics.Sink
+	started time.Time
+	// failed holds the thresholds already reported as failing
+	failed map[string]bool
+	// bounds holds the numeric bounds of the trend thresholds by metric
+	bounds map[string][]thresholdBound
+	// submetrics holds the threshold submetrics by parent metric
+	submetrics map[string][]submetric
+}
+
+// observe aggregates the sample if its metric, or one of the submetrics it
+// belongs to, has thresholds.
+func (s *thresholdState) observe(sample metrics.Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.thresholds[sample.Metric.Name]; ok {
+		s.add(sample.Metric.Name, sample)
+	}
+	for _, sub := range s.submetrics[sample.Metric.Name] {
+		if sub.matches(sample) {
+			s.add(sub.name, sample)
+		}
+	}
+}
+
+func (s *thresholdState) add(name string, sample metrics.Sample) {
+	if s.sinks == nil {
+		s.sinks = make(map[string]metrics.Sink)
+		s.started = sample.Time
+	}
+	sink, ok := s.sinks[name]
+	if !ok {
+		sink = metrics.NewSink(sample.Metric.Type)
+		s.sinks[name] = sink
+	}
+	sink.Add(sample)
+}
+
+var (
+	thresholdAggregationRe = regexp.MustCompile(`^\s*([a-z]+(?:\(\s*[0-9.]+\s*\))?)`)
+	percentileRe           = regexp.MustCompile(`^p\(\s*([0-9.]+)\s*\)$`)
+)
+
+// value returns the current value of the aggregation used by the threshold
+// expression, e.g. the p(95) of "p(95)<200".
+func (s *thresholdState) value(metric, source string, now time.Time) (float64, bool) {
+	sink, ok := s.sinks[metric]
+	if !ok {
+		return 0, false
+	}
+	match := thresholdAggregationRe.FindStringSubmatch(source)
+	if match == nil {
+		return 0, false
+	}
+	aggregation := strings.ReplaceAll(match[1], " ", "")
+
+	if trend, ok := sink.(*metrics.TrendSink); ok {
+		if p := percentileRe.FindStringSubmatch(aggregation); p != nil {
+			pct, err := strconv.ParseFloat(p[1], 64)
+			if err != nil {
+				return 0, false
+			}
+			return trend.P(pct / 100), true
+		}
+	}
+	v, ok := sink.Format(now.Sub(s.started))[aggregation]
+	return v, ok
+}
+
+// newEvaluatedThresholds copies the thresholds to evaluate them, the
+// ones k6 can't parse are left out, k6 rejects them before the test.
+func newEvaluatedThresholds(thresholds map[string]metrics.Thresholds) map[string]*metrics.Thresholds {
+	evaluated := make(map[string]*metrics.Thresholds, len(thresholds))
+	for name, ts := range thresholds {
+		sources := make([]string, 0, len(ts.Thresholds))
+		for _, threshold := range ts.Thresholds {
+			sources = append(sources, threshold.Source)
+		}
+		copied := metrics.NewThresholds(sources)
+		if err := copied.Parse(); err != nil {
+			continue
+		}
+		evaluated[name] = &copied
+	}
+	return evaluated
+}
+
+// evaluate updates the state of the thresholds with the samples observed
+// so far, the thresholds of the metrics without samples pass. It must be
+// called with the lock held.
+func (s *thresholdState) evaluate(now time.Time) {
+	for name, ts := range s.evaluated {
+		sink, ok := s.sinks[name]
+		if !ok {
+			continue
+		}
+		// the sinks are the ones of metrics.NewSink, which Run knows
+		_, _ = ts.Run(sink, now.Sub(s.started))
+	}
+}
+
+// SetThresholds receives the thresholds defined in the script options.
+func (o *Output) SetThresholds(thresholds map[string]metrics.Thresholds) {
+	o.thresholds.mu.Lock()
+	defer o.thresholds.mu.Unlock()
+	o.thresholds.thresholds = thresholds
+	o.thresholds.evaluated = newEvaluatedThresholds(thresholds)
+	o.thresholds.bounds = newThresholdBounds(thresholds)
+	o.thresholds.submetrics = newSubmetrics(thresholds)
+}
+
+// thresholdMetrics returns a k6.threshold.{metric} gauge per threshold,
+// 1 while it is passing and 0 once it failed, with the threshold
+// expression as dimension.
+func (o *Output) thresholdMetrics(now time.Time) []dynatraceMetric {
+	if !o.config.ExportThresholds.Bool {
+		return nil
+	}
+
+	o.thresholds.mu.Lock()
+	defer o.thresholds.mu.Unlock()
+	o.thresholds.evaluate(now)
+
+	names := make([]string, 0, len(o.thresholds.evaluated))
+	for name := range o.thresholds.evaluated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []dynatraceMetric
+	for _, name := range names {
+		for _, threshold := range o.thresholds.evaluated[name].Thresholds {
+			value := 1.0
+			if threshold.LastFailed {
+				value = 0
+			}
+
+			dims := map[string]string{
+				thresholdDimension: threshold.Source,
+				metricDimension:    name,
+			}
+			dims = addDimensions(dims, o.config.Dimensions)
+			dims[testRunIDDimension] = o.config.TestRunID.String
+
+			result = append(result, dynatraceMetric{
+				metricKeyName:    o.metricKey(thresholdMetricPrefix + parentMetricName(name)),
+				description:      "k6 threshold state, 1 while passing and 0 once failed",
+				metricUnit:       "Unspecified",
+				metricDimensions: dims,
+				metricValue:      value,
+				metricTimeStamp:  o.aggregateTimestamp(now),
+				metricType:       metrics.Gauge,
+			})
+		}
+	}
+	return result
+}
+
+// reportThresholdFailures sends an event for every threshold which started
+// failing since the last flush.
+func (o *Output) reportThresholdFailures(now time.Time) {
+	if !o.config.ThresholdEvents.Bool {
+		return
+	}
+
+	var events []dynatraceEvent
+	o.thresholds.mu.Lock()
+	o.thresholds.evaluate(now)
+	if o.thresholds.failed == nil {
+		o.thresholds.failed = make(map[string]bool)
+	}
+	for name, thresholds := range o.thresholds.evaluated {
+		for _, threshold := range thresholds.Thresholds {
+			key := name + "|" + threshold.Source
+			if !threshold.LastFailed || o.thresholds.failed[key] {
+				continue
+			}
+			o.thresholds.failed[key] = true
+
+			properties := map[string]string{
+				thresholdDimension: threshold.Source,
+				metricDimension:    name,
+			}
+			if value, ok := o.thresholds.value(name, threshold.Source, now); ok {
+				properties["value"] = strconv.FormatFloat(value, 'f', -1, 64)
+			}
+			events = append(events, dynatraceEvent{
+				EventType:  o.config.ThresholdEventType.String,
+				Title:      fmt.Sprintf("k6 threshold crossed: %s %s", name, threshold.Source),
+				Properties: properties,
+			})
+		}
+	}
+	o.thresholds.mu.Unlock()
+
+	for _, event := range events {
+		if err := o.sendEvent(event); err != nil {
+			o.logger.WithError(err).Warn("Dynatrace: failed to send the threshold event")
+		}
+	}
+}
+
+// parentMetricName strips the tag selector of a submetric,
+// e.g. http_req_duration{status:200} becomes http_req_duration.
+func parentMetricName(name string) string {
+	if i := strings.IndexByte(name, '{'); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
@@ -0,0 +1,59 @@
+package dynatracewriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestThresholdMetrics(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.TestRunID = null.StringFrom("run")
+	o, err := newOutput(&c, logrus.New())
+	require.NoError(t, err)
+
+	o.SetThresholds(map[string]metrics.Thresholds{
+		"http_req_duration{status:200}": {Thresholds: []*metrics.Threshold{
+			{Source: "p(95)<200"},
+			{Source: "min<100"},
+		}},
+	})
+
+	now := time.Now()
+	metric := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	for _, v := range []float64{50, 300} {
+		o.thresholds.observe(metrics.Sample{
+			TimeSeries: metrics.TimeSeries{Metric: metric, Tags: newTags(map[string]string{"status": "200"})},
+			Time:       now,
+			Value:      v,
+		})
+	}
+	// the engine's state is not read, the output evaluates its own samples
+	o.thresholds.observe(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: metric, Tags: newTags(map[string]string{"status": "500"})},
+		Time:       now,
+		Value:      10,
+	})
+
+	dynMetrics := o.thresholdMetrics(now)
+	require.Len(t, dynMetrics, 2)
+	assert.Equal(t, "k6.threshold.http_req_duration", dynMetrics[0].metricKeyName)
+	assert.Equal(t, 0.0, dynMetrics[0].metricValue)
+	assert.Equal(t, map[string]string{
+		"threshold":   "p(95)<200",
+		"metric":      "http_req_duration{status:200}",
+		"test_run_id": "run",
+	}, dynMetrics[0].metricDimensions)
+	assert.Equal(t, 1.0, dynMetrics[1].metricValue)
+	assert.Equal(t, now.UnixMilli(), dynMetrics[1].metricTimeStamp)
+
+	o.config.ExportThresholds = null.BoolFrom(false)
+	assert.Empty(t, o.thresholdMetrics(now))
+}
@@ -0,0 +1,88 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	timestampPolicyClamp = "clamp"
+	timestampPolicyDrop  = "drop"
+
+	// Dynatrace accepts data points up to one hour in the past and ten
+	// minutes in the future; keep a minute of margin for the request to
+	// reach the endpoint.
+	timestampMaxAge    = time.Hour - time.Minute
+	timestampMaxFuture = 10*time.Minute - time.Minute
+)
+
+// timestampValidator keeps the line timestamps inside the ingest window,
+// clamping or dropping out of range data points, or removes them entirely
+// so that Dynatrace assigns the arrival time.
+type timestampValidator struct {
+	policy string
+	omit   bool
+
+	clamped int
+	dropped int
+}
+
+func newTimestampValidator(conf *Config) (*timestampValidator, error) {
+	policy := conf.TimestampPolicy.String
+	if policy != timestampPolicyClamp && policy != timestampPolicyDrop {
+		return nil, fmt.Errorf("invalid timestampPolicy %q, expected %q or %q",
+			policy, timestampPolicyClamp, timestampPolicyDrop)
+	}
+	return &timestampValidator{policy: policy, omit: conf.OmitTimestamps.Bool}, nil
+}
+
+// apply reports whether the metric can be sent, adjusting its timestamp
+// if needed.
+func (v *timestampValidator) apply(m *dynatraceMetric, now time.Time) bool {
+	if v.omit {
+		m.metricTimeStamp = 0
+		return true
+	}
+
+	oldest := now.Add(-timestampMaxAge).UnixMilli()
+	newest := now.Add(timestampMaxFuture).UnixMilli()
+	if m.metricTimeStamp >= oldest && m.metricTimeStamp <= newest {
+		return true
+	}
+
+	if v.policy == timestampPolicyDrop {
+		v.dropped++
+		return false
+	}
+
+	v.clamped++
+	if m.metricTimeStamp < oldest {
+		m.metricTimeStamp = oldest
+	} else {
+		m.metricTimeStamp = newest
+	}
+	return true
+}
+
+// report warns about the data points adjusted since the last report.
+func (v *timestampValidator) report(logger logrus.FieldLogger) {
+	if v.clamped > 0 {
+		logger.WithField("lines", v.clamped).Warn("Dynatrace: clamped timestamps outside of the ingest window")
+	}
+	if v.dropped > 0 {
+		logger.WithField("lines", v.dropped).Warn("Dynatrace: dropped lines with timestamps outside of the ingest window")
+	}
+	v.clamped, v.dropped = 0, 0
+}
+
+// aggregateTimestamp returns the timestamp of a line the output aggregates
+// itself over the flush, 0 to let Dynatrace assign the arrival time when
+// omitTimestamps or omitAggregateTimestamps is set.
+func (o *Output) aggregateTimestamp(now time.Time) int64 {
+	if o.config.OmitTimestamps.Bool || o.config.OmitAggregateTimestamps.Bool {
+		return 0
+	}
+	return now.UnixMilli()
+}
@@ -0,0 +1,80 @@
+package dynatracewriter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestTimestampValidator(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	at := func(d time.Duration) *dynatraceMetric {
+		return &dynatraceMetric{metricTimeStamp: now.Add(d).UnixMilli()}
+	}
+
+	c := NewConfig()
+	v, err := newTimestampValidator(&c)
+	require.NoError(t, err)
+
+	m := at(-time.Minute)
+	assert.True(t, v.apply(m, now))
+	assert.Equal(t, now.Add(-time.Minute).UnixMilli(), m.metricTimeStamp)
+
+	m = at(-2 * time.Hour)
+	assert.True(t, v.apply(m, now))
+	assert.Equal(t, now.Add(-timestampMaxAge).UnixMilli(), m.metricTimeStamp)
+
+	m = at(time.Hour)
+	assert.True(t, v.apply(m, now))
+	assert.Equal(t, now.Add(timestampMaxFuture).UnixMilli(), m.metricTimeStamp)
+	assert.Equal(t, 2, v.clamped)
+
+	c.TimestampPolicy = null.StringFrom(timestampPolicyDrop)
+	v, err = newTimestampValidator(&c)
+	require.NoError(t, err)
+	assert.False(t, v.apply(at(-2*time.Hour), now))
+	assert.True(t, v.apply(at(0), now))
+	assert.Equal(t, 1, v.dropped)
+
+	c.OmitTimestamps = null.BoolFrom(true)
+	v, err = newTimestampValidator(&c)
+	require.NoError(t, err)
+	m = at(-2 * time.Hour)
+	assert.True(t, v.apply(m, now))
+	assert.Equal(t, int64(0), m.metricTimeStamp)
+	assert.Equal(t, "k6.vus 1", (&dynatraceMetric{metricKeyName: "k6.vus", metricValue: 1}).toText())
+
+	c.TimestampPolicy = null.StringFrom("shift")
+	_, err = newTimestampValidator(&c)
+	assert.Error(t, err)
+}
+
+func TestOmitAggregateTimestamps(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	o := newTestOutput(t, "http://localhost", nil)
+	lines := o.heartbeatMetric(now)
+	require.Len(t, lines, 1)
+	assert.Equal(t, now.UnixMilli(), lines[0].metricTimeStamp)
+
+	o = newTestOutput(t, "http://localhost", func(c *Config) {
+		c.OmitAggregateTimestamps = null.BoolFrom(true)
+	})
+	lines = o.heartbeatMetric(now)
+	require.Len(t, lines, 1)
+	assert.Zero(t, lines[0].metricTimeStamp)
+	assert.True(t, strings.HasSuffix(lines[0].toText(), " 1"), "the line ends with its value")
+
+	o.instanceID = "runner-0"
+	aggregate, ok := o.instanceAggregate(dynatraceMetric{metricKeyName: "k6.vus", metricValue: 1, metricTimeStamp: now.UnixMilli(),
+		metricDimensions: map[string]string{instanceIDDimension: "runner-0"}})
+	require.True(t, ok)
+	assert.Zero(t, aggregate.metricTimeStamp)
+}
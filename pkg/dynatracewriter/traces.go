@@ -0,0 +1,143 @@
+package dynatracewriter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"go.k6.io/k6/metrics"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultDynatraceTracesEndPoint = "/api/v2/otlp/v1/traces"
+
+	traceIDTag = "trace_id"
+
+	// maxBufferedSpans bounds the spans kept between two flushes.
+	maxBufferedSpans = 10000
+)
+
+// observeSpan turns a request duration sample carrying the trace_id of the
+// propagated traceparent into a client span, so the request can be
+// followed to the server side PurePath.
+func (o *Output) observeSpan(sample metrics.Sample) {
+	if !o.config.Traces.Bool || sample.Metric.Name != "http_req_duration" {
+		return
+	}
+	rawTraceID, _ := sampleTag(sample, traceIDTag)
+	traceID, err := hex.DecodeString(rawTraceID)
+	if err != nil || len(traceID) != 16 {
+		return
+	}
+	tags := sampleTags(sample)
+	if len(o.spans) >= maxBufferedSpans {
+		o.droppedSpans++
+		return
+	}
+
+	spanID := make([]byte, 8)
+	if _, err := rand.Read(spanID); err != nil {
+		return
+	}
+
+	end := sample.GetTime()
+	start := end.Add(-time.Duration(sample.Value * float64(time.Millisecond)))
+	name := "HTTP " + tags["method"]
+	if tags[nameTag] != "" {
+		name += " " + tags[nameTag]
+	}
+
+	attributes := map[string]string{testRunIDDimension: o.config.TestRunID.String}
+	for tag, attribute := range map[string]string{
+		"method": "http.method", urlTag: "http.url", "status": "http.status_code",
+		"scenario": "k6.scenario", "group": "k6.group", "error_code": "k6.error_code",
+	} {
+		if value := tags[tag]; value != "" {
+			attributes[attribute] = value
+		}
+	}
+
+	status := &tracepb.Status{Code: tracepb.Status_STATUS_CODE_UNSET}
+	code, err := strconv.Atoi(tags["status"])
+	if err == nil && (code == 0 || code >= 400) || tags["error_code"] != "" {
+		status.Code = tracepb.Status_STATUS_CODE_ERROR
+	}
+
+	o.spans = append(o.spans, &tracepb.Span{
+		TraceId:           traceID,
+		SpanId:            spanID,
+		Name:              name,
+		Kind:              tracepb.Span_SPAN_KIND_CLIENT,
+		StartTimeUnixNano: uint64(start.UnixNano()),
+		EndTimeUnixNano:   uint64(end.UnixNano()),
+		Attributes:        otlpAttributes(attributes),
+		Status:            status,
+	})
+}
+
+// applyTraceID exports the trace_id of a traced sample: as a dimension of
+// the metric line, or, since the OTLP metrics are aggregated, as an
+// exemplar-style log record pointing at the trace.
+func (o *Output) applyTraceID(sample metrics.Sample, m *dynatraceMetric) {
+	if !o.config.TraceIDs.Bool {
+		return
+	}
+	traceID, ok := sampleTag(sample, traceIDTag)
+	if !ok || traceID == "" {
+		return
+	}
+
+	m.ownDimensions()
+	if o.config.ExportFormat.String != exportFormatOTLP {
+		m.metricDimensions[traceIDTag] = traceID
+		return
+	}
+
+	delete(m.metricDimensions, traceIDTag)
+	value := strconv.FormatFloat(m.metricValue, 'f', -1, 64)
+	record := o.newLogRecord(sample.GetTime(), "info", m.metricKeyName+" "+value)
+	for key, dim := range m.metricDimensions {
+		if _, ok := record[key]; !ok {
+			record[key] = dim
+		}
+	}
+	record[traceIDTag] = traceID
+	record[metricDimension] = m.metricKeyName
+	record["value"] = value
+	o.logs.add(record)
+}
+
+// sendSpans posts the spans observed since the last flush.
+func (o *Output) sendSpans() {
+	if o.droppedSpans > 0 {
+		o.logger.WithField("spans", o.droppedSpans).Warn("Dynatrace: span buffer full, dropped spans")
+		o.droppedSpans = 0
+	}
+	if len(o.spans) == 0 {
+		return
+	}
+	spans := o.spans
+	o.spans = nil
+
+	body, err := proto.Marshal(&coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: otlpResource(),
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Scope: &commonpb.InstrumentationScope{Name: otlpScopeName},
+				Spans: spans,
+			}},
+		}},
+	})
+	if err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to serialize the spans")
+		return
+	}
+	if err := o.postAPI(defaultDynatraceTracesEndPoint, "application/x-protobuf", body); err != nil {
+		o.logger.WithError(err).Warn("Dynatrace: failed to send the spans")
+	}
+}
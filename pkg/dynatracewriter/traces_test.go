@@ -0,0 +1,103 @@
+package dynatracewriter
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestSpanExport(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, defaultDynatraceTracesEndPoint, req.URL.Path)
+		body, _ := ioutil.ReadAll(req.Body)
+		request := &coltracepb.ExportTraceServiceRequest{}
+		assert.NoError(t, proto.Unmarshal(body, request))
+		received <- request
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, func(c *Config) {
+		c.Traces = null.BoolFrom(true)
+	})
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	duration := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	end := time.Now()
+	o.observeSpan(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: newTags(map[string]string{
+		"method": "GET", "url": "http://a/users/1", "name": "users", "status": "503", "trace_id": traceID,
+	})}, Time: end, Value: 250})
+	o.observeSpan(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: newTags(map[string]string{
+		"method": "GET", "status": "200",
+	})}, Time: end, Value: 10})
+	o.observeSpan(metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: newTags(map[string]string{
+		"method": "GET", "status": "200", "trace_id": "not-a-trace",
+	})}, Time: end, Value: 10})
+	require.Len(t, o.spans, 1)
+
+	o.sendSpans()
+	assert.Empty(t, o.spans)
+
+	request := <-received
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, traceID, hex.EncodeToString(span.TraceId))
+	assert.Len(t, span.SpanId, 8)
+	assert.Equal(t, "HTTP GET users", span.Name)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_CLIENT, span.Kind)
+	assert.Equal(t, uint64(250*time.Millisecond), span.EndTimeUnixNano-span.StartTimeUnixNano)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, span.Status.Code)
+
+	attributes := make(map[string]string)
+	for _, kv := range span.Attributes {
+		attributes[kv.Key] = kv.Value.GetStringValue()
+	}
+	assert.Equal(t, "http://a/users/1", attributes["http.url"])
+	assert.Equal(t, "503", attributes["http.status_code"])
+	assert.Equal(t, "run", attributes[testRunIDDimension])
+}
+
+func TestApplyTraceID(t *testing.T) {
+	t.Parallel()
+
+	duration := newMetric("http_req_duration", metrics.Trend, metrics.Time)
+	sample := metrics.Sample{TimeSeries: metrics.TimeSeries{Metric: duration, Tags: newTags(map[string]string{
+		"status": "200", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+	})}, Time: time.Now(), Value: 900}
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.TraceIDs = null.BoolFrom(true)
+		c.TagsAsDimensions = []string{"status"}
+	})
+	m, ok := o.convertSample(sample, time.Now())
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", m.metricDimensions[traceIDTag])
+
+	o = newTestOutput(t, "http://localhost", func(c *Config) {
+		c.TraceIDs = null.BoolFrom(true)
+		c.ExportFormat = null.StringFrom(exportFormatOTLP)
+	})
+	m, ok = o.convertSample(sample, time.Now())
+	require.True(t, ok)
+	assert.NotContains(t, m.metricDimensions, traceIDTag)
+	records, _ := o.logs.take()
+	require.Len(t, records, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", records[0][traceIDTag])
+	assert.Equal(t, "k6.http_req_duration", records[0][metricDimension])
+	assert.Equal(t, "900", records[0]["value"])
+	assert.Equal(t, "200", records[0]["status"])
+}
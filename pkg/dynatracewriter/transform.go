@@ -0,0 +1,147 @@
+package dynatracewriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// transformSpec is the content of the transformFile, which declares metric
+// and dimension transforms too complex to be set through env vars:
+//
+//	metrics:
+//	  http_req_duration:
+//	    name: loadtest.request.latency
+//	    unit: MilliSecond
+//	    tags:
+//	      keep: [url]
+//	  data_sent:
+//	    drop: true
+//	  orders_placed:
+//	    tags:
+//	      only: [scenario]
+//	dimensions:
+//	  rename:
+//	    scenario: test.scenario
+//	  static:
+//	    team: payments
+//	  drop: [vu, iter]
+//
+// Renames and static dimensions set through the regular configuration take
+// precedence over the ones declared in the file.
+type transformSpec struct {
+	Metrics    map[string]metricTransform `json:"metrics" yaml:"metrics"`
+	Dimensions dimensionTransform         `json:"dimensions" yaml:"dimensions"`
+}
+
+type metricTransform struct {
+	Name string     `json:"name" yaml:"name"`
+	Unit string     `json:"unit" yaml:"unit"`
+	Drop bool       `json:"drop" yaml:"drop"`
+	Tags *tagPolicy `json:"tags" yaml:"tags"`
+}
+
+// tagPolicy overrides the tag filters for the samples of a metric: only
+// replaces them with an allowlist, keep and drop add tags to and remove
+// tags from what they export.
+type tagPolicy struct {
+	Only []string `json:"only" yaml:"only"`
+	Keep []string `json:"keep" yaml:"keep"`
+	Drop []string `json:"drop" yaml:"drop"`
+}
+
+type dimensionTransform struct {
+	Rename map[string]string `json:"rename" yaml:"rename"`
+	Static map[string]string `json:"static" yaml:"static"`
+	Drop   []string          `json:"drop" yaml:"drop"`
+}
+
+// loadTransformFile reads and validates the transform file, an empty path
+// returns an empty spec.
+func loadTransformFile(path string) (*transformSpec, error) {
+	spec := &transformSpec{}
+	if path == "" {
+		return spec, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the transform file: %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(spec)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform file %s: %w", path, err)
+	}
+
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("invalid transform file %s: %w", path, err)
+	}
+	return spec, nil
+}
+
+func (t *transformSpec) validate() error {
+	for metric, transform := range t.Metrics {
+		if transform.Drop && (transform.Name != "" || transform.Unit != "") {
+			return fmt.Errorf("metric %q is dropped, it can not also be renamed or get a unit", metric)
+		}
+		if tags := transform.Tags; tags != nil && tags.Only != nil && len(tags.Keep) > 0 {
+			return fmt.Errorf("metric %q can not have both only and keep tags", metric)
+		}
+	}
+	for from, to := range t.Dimensions.Rename {
+		if strings.TrimSpace(to) == "" {
+			return fmt.Errorf("dimension %q can not be renamed to an empty name", from)
+		}
+	}
+	for key := range t.Dimensions.Static {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("static dimensions can not have an empty name")
+		}
+	}
+	return nil
+}
+
+func (t *transformSpec) dropMetric(name string) bool {
+	return t.Metrics[name].Drop
+}
+
+func (t *transformSpec) metricName(name string) (string, bool) {
+	renamed := t.Metrics[name].Name
+	return renamed, renamed != ""
+}
+
+func (t *transformSpec) metricUnit(name string) string {
+	return t.Metrics[name].Unit
+}
+
+func (t *transformSpec) tagPolicy(name string) *tagPolicy {
+	return t.Metrics[name].Tags
+}
+
+// applyDimensions drops and renames the sample dimensions in place.
+func (t *transformSpec) applyDimensions(tags map[string]string) map[string]string {
+	for _, key := range t.Dimensions.Drop {
+		delete(tags, key)
+	}
+	for from, to := range t.Dimensions.Rename {
+		if value, ok := tags[from]; ok {
+			delete(tags, from)
+			tags[to] = value
+		}
+	}
+	return tags
+}
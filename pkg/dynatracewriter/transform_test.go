@@ -0,0 +1,102 @@
+package dynatracewriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestLoadTransformFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	spec, err := loadTransformFile(write("transform.yaml", `
+metrics:
+  http_req_duration:
+    name: loadtest.request.latency
+    unit: MilliSecond
+  data_sent:
+    drop: true
+dimensions:
+  rename:
+    scenario: test.scenario
+  static:
+    team: payments
+  drop: [vu, iter]
+`))
+	require.NoError(t, err)
+	assert.True(t, spec.dropMetric("data_sent"))
+	assert.False(t, spec.dropMetric("http_req_duration"))
+	name, ok := spec.metricName("http_req_duration")
+	assert.True(t, ok)
+	assert.Equal(t, "loadtest.request.latency", name)
+	assert.Equal(t, "MilliSecond", spec.metricUnit("http_req_duration"))
+	assert.Equal(t, map[string]string{"test.scenario": "default", "status": "200"},
+		spec.applyDimensions(map[string]string{"scenario": "default", "status": "200", "vu": "1", "iter": "3"}))
+	assert.Equal(t, map[string]string{"team": "payments"}, spec.Dimensions.Static)
+
+	spec, err = loadTransformFile(write("transform.json", `{"metrics":{"vus":{"name":"users"}}}`))
+	require.NoError(t, err)
+	name, _ = spec.metricName("vus")
+	assert.Equal(t, "users", name)
+
+	_, err = loadTransformFile(write("unknown.yaml", "metric:\n  vus: {}\n"))
+	assert.Error(t, err)
+
+	_, err = loadTransformFile(write("conflict.yaml", "metrics:\n  vus:\n    drop: true\n    name: users\n"))
+	assert.Error(t, err)
+
+	_, err = loadTransformFile(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+
+	spec, err = loadTransformFile("")
+	require.NoError(t, err)
+	assert.False(t, spec.dropMetric("vus"))
+}
+
+func TestTagPolicy(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "transform.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+metrics:
+  http_req_duration:
+    tags:
+      keep: [url]
+      drop: [method]
+  orders_placed:
+    tags:
+      only: [scenario]
+`), 0o600))
+	spec, err := loadTransformFile(path)
+	require.NoError(t, err)
+
+	c := NewConfig()
+	c.KeepUrlTag = null.BoolFrom(false)
+	f, err := newTagFilter(&c)
+	require.NoError(t, err)
+	tags := func() map[string]string {
+		return map[string]string{"url": "http://a/", "method": "GET", "scenario": "default", "status": "200"}
+	}
+
+	assert.Equal(t, map[string]string{"url": "http://a/", "scenario": "default", "status": "200"},
+		f.applyPolicy(tags(), spec.tagPolicy("http_req_duration")))
+	assert.Equal(t, map[string]string{"scenario": "default"},
+		f.applyPolicy(tags(), spec.tagPolicy("orders_placed")))
+	assert.Equal(t, map[string]string{"method": "GET", "scenario": "default", "status": "200"},
+		f.applyPolicy(tags(), spec.tagPolicy("http_reqs")), "the other metrics follow the tag filters")
+
+	require.NoError(t, os.WriteFile(path, []byte("metrics:\n  vus:\n    tags:\n      only: [scenario]\n      keep: [url]\n"), 0o600))
+	_, err = loadTransformFile(path)
+	assert.Error(t, err)
+}
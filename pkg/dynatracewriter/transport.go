@@ -0,0 +1,168 @@
+package dynatracewriter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	networkFamilyAuto = "auto"
+	networkFamilyTCP4 = "tcp4"
+	networkFamilyTCP6 = "tcp6"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// lookupCipherSuites returns the ids of the named cipher suites, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Only the suites Go considers
+// secure are accepted. They apply to TLS 1.2, the TLS 1.3 suites are not
+// configurable.
+func lookupCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Doer sends the requests of the output to Dynatrace. *http.Client
+// implements it, tests and embedders can replace it, e.g. by a client of
+// an httptest server or a transport replaying recorded answers.
+type Doer interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+// SetDoer replaces the client sending the requests, it must be called
+// before the output starts.
+func (o *Output) SetDoer(doer Doer) {
+	o.client = doer
+}
+
+// closeIdleConnections releases the connections of the client, when it
+// keeps any.
+func (o *Output) closeIdleConnections() {
+	if closer, ok := o.client.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// newHTTPClient returns the client used for every request to Dynatrace,
+// verifying the server certificate against the system roots and the
+// configured CA certificate, unless InsecureSkipTLSVerify is set.
+func newHTTPClient(conf *Config) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: conf.InsecureSkipTLSVerify.Bool, //nolint:gosec // explicit opt-in
+		ServerName:         conf.ServerName.String,
+	}
+	if conf.TLSMinVersion.String != "" {
+		version, ok := tlsVersions[conf.TLSMinVersion.String]
+		if !ok {
+			return nil, fmt.Errorf("invalid tlsMinVersion %q, expected 1.2 or 1.3", conf.TLSMinVersion.String)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if len(conf.TLSCipherSuites) > 0 {
+		suites, err := lookupCipherSuites(conf.TLSCipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = suites
+	}
+
+	if conf.CACert.String != "" {
+		pem, err := os.ReadFile(conf.CACert.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA certificate file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the CA certificate file %s", conf.CACert.String)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.DialContext = newDialContext(conf)
+	// HTTP/2 is negotiated over TLS, the custom dialer and TLS config
+	// would disable it otherwise
+	transport.ForceAttemptHTTP2 = true
+	if conf.ForceHTTP1.Bool {
+		// a non-nil empty map disables HTTP/2, for the middleboxes
+		// breaking it
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &http.Client{
+		Timeout:   time.Duration(conf.Timeout.Duration),
+		Transport: transport,
+	}, nil
+}
+
+// newDialContext returns the dialer of the transport. A unix:// url sends
+// every request to its socket. Otherwise ConnectTo replaces
+// the address taken from the url, e.g. a PrivateLink endpoint, HostAliases
+// and DNSServer replace the resolution of its host, NetworkFamily restricts
+// it to IPv4 or IPv6. In every case the Host
+// header and the TLS hostname stay the ones of the url.
+func newDialContext(conf *Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if conf.DNSServer.String != "" {
+		dialer.Resolver = newResolver(conf.DNSServer.String)
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if conf.socketPath != "" {
+			return dialer.DialContext(ctx, "unix", conf.socketPath)
+		}
+		if conf.ConnectTo.String != "" {
+			addr = conf.ConnectTo.String
+		}
+		if family := conf.NetworkFamily.String; family != "" && family != networkFamilyAuto {
+			network = family
+		}
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			if ip, ok := conf.HostAliases[host]; ok {
+				addr = net.JoinHostPort(ip, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// newResolver returns a resolver querying the given DNS server, the port
+// defaults to 53.
+func newResolver(server string) *net.Resolver {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
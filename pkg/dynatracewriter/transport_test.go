@@ -0,0 +1,249 @@
+package dynatracewriter
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestHTTPClientVerifiesCertificates(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	c := NewConfig()
+	client, err := newHTTPClient(&c)
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err, "the self-signed certificate must be rejected by default")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0o600))
+	c.CACert = null.StringFrom(caFile)
+	client, err = newHTTPClient(&c)
+	require.NoError(t, err)
+	response, err := client.Get(server.URL)
+	require.NoError(t, err)
+	response.Body.Close()
+
+	c.CACert = null.StringFrom(filepath.Join(t.TempDir(), "missing.pem"))
+	_, err = newHTTPClient(&c)
+	assert.Error(t, err)
+}
+
+func TestInsecureSkipTLSVerifyWarning(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.ApiToken = null.StringFrom("token")
+	c.InsecureSkipTLSVerify = null.BoolFrom(true)
+	constructed, err := c.ConstructConfig()
+	require.NoError(t, err)
+
+	logger, hook := test.NewNullLogger()
+	_, err = newOutput(constructed, logger)
+	require.NoError(t, err)
+	require.NotNil(t, hook.LastEntry())
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Contains(t, hook.LastEntry().Message, "TLS certificate verification is DISABLED")
+}
+
+func TestHTTPClientTLSSettings(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.TLSMinVersion = null.StringFrom("1.3")
+	c.TLSCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+	client, err := newHTTPClient(&c)
+	require.NoError(t, err)
+	tlsConfig := client.Transport.(*http.Transport).TLSClientConfig
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+
+	c.TLSMinVersion = null.StringFrom("1.0")
+	_, err = newHTTPClient(&c)
+	assert.Error(t, err)
+
+	c.TLSMinVersion = null.StringFrom("1.2")
+	c.TLSCipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+	_, err = newHTTPClient(&c)
+	assert.Error(t, err)
+}
+
+func TestHTTPClientHTTP2(t *testing.T) {
+	t.Parallel()
+
+	var protocols []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protocols = append(protocols, r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	c := NewConfig()
+	c.InsecureSkipTLSVerify = null.BoolFrom(true)
+	client, err := newHTTPClient(&c)
+	require.NoError(t, err)
+	response, err := client.Get(server.URL)
+	require.NoError(t, err)
+	response.Body.Close()
+
+	c.ForceHTTP1 = null.BoolFrom(true)
+	client, err = newHTTPClient(&c)
+	require.NoError(t, err)
+	response, err = client.Get(server.URL)
+	require.NoError(t, err)
+	response.Body.Close()
+
+	assert.Equal(t, []string{"HTTP/2.0", "HTTP/1.1"}, protocols)
+}
+
+func TestHTTPClientConnectTo(t *testing.T) {
+	t.Parallel()
+
+	var host string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0o600))
+
+	c := NewConfig()
+	c.CACert = null.StringFrom(caFile)
+	// the test certificate is issued for example.com
+	c.ServerName = null.StringFrom("example.com")
+	c.ConnectTo = null.StringFrom(server.Listener.Addr().String())
+	client, err := newHTTPClient(&c)
+	require.NoError(t, err)
+	response, err := client.Get("https://vpce-tenant.dynatrace.internal/api/v2/metrics/ingest")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, "vpce-tenant.dynatrace.internal", host)
+}
+
+func TestHTTPClientHostAliases(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0o600))
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	c := NewConfig()
+	c.CACert = null.StringFrom(caFile)
+	// example.com is in the test certificate, the hostname stays verified
+	c.HostAliases = map[string]string{"example.com": "127.0.0.1"}
+	client, err := newHTTPClient(&c)
+	require.NoError(t, err)
+	response, err := client.Get("https://example.com:" + port)
+	require.NoError(t, err)
+	response.Body.Close()
+}
+
+func TestHTTPClientNetworkFamily(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	c := NewConfig()
+	client, err := newHTTPClient(&c)
+	require.NoError(t, err)
+	response, err := client.Get(server.URL)
+	require.NoError(t, err)
+	response.Body.Close()
+
+	// the test server listens on 127.0.0.1 only
+	c.NetworkFamily = null.StringFrom(networkFamilyTCP6)
+	client, err = newHTTPClient(&c)
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+}
+
+func TestHTTPClientUnixSocket(t *testing.T) {
+	t.Parallel()
+
+	socket := filepath.Join(t.TempDir(), "proxy.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	var path string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	c := NewConfig()
+	c.Url = "unix://" + socket
+	c.ApiToken = null.StringFrom("token")
+	constructed, err := c.ConstructConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost/api/v2/metrics/ingest", constructed.Url)
+
+	client, err := newHTTPClient(constructed)
+	require.NoError(t, err)
+	response, err := client.Post(constructed.Url, "text/plain", nil)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, "/api/v2/metrics/ingest", path)
+}
+
+// doerFunc turns a function into a Doer.
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestSetDoer(t *testing.T) {
+	t.Parallel()
+
+	var requests []*http.Request
+	o := newTestOutput(t, "https://abc12345.live.dynatrace.com", nil)
+	o.SetDoer(doerFunc(func(request *http.Request) (*http.Response, error) {
+		requests = append(requests, request)
+		return &http.Response{
+			StatusCode: http.StatusAccepted,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"linesOk":2,"linesInvalid":0}`)),
+		}, nil
+	}))
+
+	o.sendMetrics(benchmarkMetrics(2))
+	require.Len(t, requests, 1)
+	assert.Equal(t, "abc12345.live.dynatrace.com", requests[0].URL.Host)
+	assert.Equal(t, 2, o.totals.linesSent)
+
+	// the replaced client has no connections to release
+	o.closeIdleConnections()
+}
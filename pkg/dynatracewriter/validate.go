@@ -0,0 +1,158 @@
+package dynatracewriter
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	minFlushPeriod = time.Second
+	maxFlushPeriod = time.Minute
+)
+
+// apiTokenRe matches the Dynatrace API tokens, dt0c01.{public part}.{secret}.
+var apiTokenRe = regexp.MustCompile(`^dt0c01\.[A-Za-z0-9]{24}\.[A-Za-z0-9]{64}$`)
+
+// Validate checks the consolidated configuration before the test starts
+// and reports all of its problems at once.
+func (conf Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if u, err := url.Parse(conf.Url); err != nil {
+		add("url %q is not a valid url: %v", conf.Url, err)
+	} else if u.Scheme == "unix" {
+		if u.Path == "" {
+			add("url %q must name the socket, e.g. unix:///var/run/dynatrace-proxy.sock", conf.Url)
+		}
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("url %q must be an http, https or unix url, e.g. https://{environmentid}.live.dynatrace.com", conf.Url)
+	}
+
+	switch conf.IngestMode.String {
+	case ingestModeAPI, "":
+		if conf.Url == defaultDynatraceUrl {
+			add("url is not set, use K6_DYNATRACE_URL with the url of the Dynatrace environment")
+		}
+		if conf.ApiToken.String == "" {
+			add("apitoken is not set, use K6_DYNATRACE_APITOKEN with a token having the metrics.ingest scope")
+		} else if !apiTokenRe.MatchString(conf.ApiToken.String) {
+			add("apitoken doesn't look like a Dynatrace API token, expected dt0c01.{24 characters}.{64 characters}")
+		}
+	case ingestModeLocal:
+		if conf.ApiToken.String != "" {
+			add("apitoken is set but the %s ingest mode sends the metrics to the OneAgent without token, remove one of them", ingestModeLocal)
+		}
+		if features := conf.apiFeatures(); len(features) > 0 {
+			add("%s call the Dynatrace API, which the %s ingest mode doesn't reach, use the %s ingest mode or disable them",
+				strings.Join(features, ", "), ingestModeLocal, ingestModeAPI)
+		}
+	default:
+		add("invalid ingestMode %q, expected %s or %s", conf.IngestMode.String, ingestModeAPI, ingestModeLocal)
+	}
+
+	if flushPeriod := time.Duration(conf.FlushPeriod.Duration); flushPeriod < minFlushPeriod || flushPeriod > maxFlushPeriod {
+		add("flushPeriod %s must be between %s and %s", flushPeriod, minFlushPeriod, maxFlushPeriod)
+	}
+	if time.Duration(conf.Timeout.Duration) <= 0 {
+		add("timeout must be positive")
+	}
+	if err := validateExportFormat(conf.ExportFormat.String); err != nil {
+		add("%v", err)
+	} else if conf.StreamPayload.Bool && conf.ExportFormat.String != exportFormatMint {
+		add("streamPayload only applies to the %s exportFormat", exportFormatMint)
+	}
+	if _, ok := tlsVersions[conf.TLSMinVersion.String]; conf.TLSMinVersion.String != "" && !ok {
+		add("invalid tlsMinVersion %q, expected 1.2 or 1.3", conf.TLSMinVersion.String)
+	}
+	if _, err := lookupCipherSuites(conf.TLSCipherSuites); err != nil {
+		add("%v", err)
+	}
+	if conf.ConnectTo.String != "" {
+		if _, _, err := net.SplitHostPort(conf.ConnectTo.String); err != nil {
+			add("invalid connectTo %q, expected host:port", conf.ConnectTo.String)
+		}
+	}
+	if _, err := logrus.ParseLevel(conf.LogLevel.String); conf.LogLevel.String != "" && err != nil {
+		add("invalid logLevel %q, expected trace, debug, info, warn or error", conf.LogLevel.String)
+	}
+	if rate := conf.FailTestErrorRate.Float64; rate < 0 || rate > 1 {
+		add("failTestErrorRate %g must be between 0 and 1", rate)
+	}
+	if conf.FailTestConsecutiveFailures.Int64 < 0 {
+		add("failTestConsecutiveFailures can't be negative")
+	}
+	if conf.MaxRetries.Int64 < 0 {
+		add("maxRetries can't be negative")
+	}
+	if conf.MaxRetryElapsedTime.Duration < 0 {
+		add("maxRetryElapsedTime can't be negative")
+	}
+	switch conf.RetryExhaustedPolicy.String {
+	case "", retryExhaustedDrop, retryExhaustedSpool:
+	default:
+		add("invalid retryExhaustedPolicy %q, expected %s or %s", conf.RetryExhaustedPolicy.String, retryExhaustedDrop, retryExhaustedSpool)
+	}
+	if conf.MaxLinesPerRequest.Int64 < 0 {
+		add("maxLinesPerRequest can't be negative")
+	}
+	if conf.MaxBytesPerRequest.Int64 < 0 {
+		add("maxBytesPerRequest can't be negative")
+	}
+	switch conf.Compression.String {
+	case "", compressionNone, compressionGzip, compressionZstd:
+	default:
+		add("invalid compression %q, expected %s, %s or %s", conf.Compression.String, compressionNone, compressionGzip, compressionZstd)
+	}
+	if conf.MaxSamplesPerFlush.Int64 < 0 {
+		add("maxSamplesPerFlush can't be negative")
+	}
+	switch conf.SampleDropPolicy.String {
+	case "", sampleDropNewest, sampleDropRaw, sampleDropPriority:
+	default:
+		add("invalid sampleDropPolicy %q, expected %s, %s or %s", conf.SampleDropPolicy.String, sampleDropNewest, sampleDropRaw, sampleDropPriority)
+	}
+	if _, err := parseMetricSelectors(conf.MetricPriority); err != nil {
+		add("metricPriority: %v", err)
+	}
+	if _, err := parseMetricSelectors(conf.CriticalMetrics); err != nil {
+		add("criticalMetrics: %v", err)
+	}
+	if _, err := parseMetricSelectors(conf.BestEffortMetrics); err != nil {
+		add("bestEffortMetrics: %v", err)
+	}
+	if t := conf.BurnRateTarget.Float64; t < 0 || t >= 100 {
+		add("burnRateTarget must be a success percentage below 100, e.g. 99.5")
+	}
+	if conf.MaxMemoryBytes.Int64 < 0 {
+		add("maxMemoryBytes can't be negative")
+	}
+	if conf.StatsAddress.String != "" {
+		if _, _, err := net.SplitHostPort(conf.StatsAddress.String); err != nil {
+			add("invalid statsAddress %q, expected host:port", conf.StatsAddress.String)
+		}
+	}
+	switch conf.NetworkFamily.String {
+	case "", networkFamilyAuto, networkFamilyTCP4, networkFamilyTCP6:
+	default:
+		add("invalid networkFamily %q, expected %s, %s or %s", conf.NetworkFamily.String, networkFamilyTCP4, networkFamilyTCP6, networkFamilyAuto)
+	}
+	for host, ip := range conf.HostAliases {
+		if net.ParseIP(ip) == nil {
+			add("invalid hostAliases entry %s=%s, expected an IP address", host, ip)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid Dynatrace output configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package dynatracewriter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/lib/types"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	token := "dt0c01." + strings.Repeat("A", 24) + "." + strings.Repeat("B", 64)
+
+	c := NewConfig()
+	c.Url = "https://abc12345.live.dynatrace.com"
+	c.ApiToken = null.StringFrom(token)
+	assert.NoError(t, c.Validate())
+
+	c.IngestMode = null.StringFrom(ingestModeLocal)
+	c.ApiToken = null.String{}
+	assert.NoError(t, c.Validate())
+
+	c = NewConfig()
+	c.Url = "abc12345.live.dynatrace.com"
+	c.ApiToken = null.StringFrom("secret")
+	c.FlushPeriod = types.NullDurationFrom(100 * time.Millisecond)
+	err := c.Validate()
+	require.Error(t, err)
+	assert.Equal(t, "invalid Dynatrace output configuration:\n"+
+		`  - url "abc12345.live.dynatrace.com" must be an http, https or unix url, e.g. https://{environmentid}.live.dynatrace.com`+"\n"+
+		"  - apitoken doesn't look like a Dynatrace API token, expected dt0c01.{24 characters}.{64 characters}\n"+
+		"  - flushPeriod 100ms must be between 1s and 1m0s", err.Error())
+
+	c = NewConfig()
+	c.IngestMode = null.StringFrom(ingestModeLocal)
+	c.ApiToken = null.StringFrom(token)
+	err = c.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "apitoken is set but the local ingest mode")
+
+	c = NewConfig()
+	c.IngestMode = null.StringFrom(ingestModeLocal)
+	c.Summary = null.BoolFrom(true)
+	c.LifecycleEvents = null.BoolFrom(true)
+	c.ExportFormat = null.StringFrom(exportFormatOTLP)
+	err = c.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exportFormat otlp, lifecycleEvents call the Dynatrace API, which the local ingest mode doesn't reach")
+}
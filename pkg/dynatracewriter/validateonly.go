@@ -0,0 +1,117 @@
+package dynatracewriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+const redacted = "***"
+
+// ErrValidateOnly is returned by New once validateOnly checked the
+// configuration, so k6 stops before the test runs.
+var ErrValidateOnly = errors.New("dynatrace: validateOnly is set, the configuration is valid and the test is not run")
+
+var (
+	metricKeyRe    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,249}$`)
+	dimensionKeyRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.:-]{0,99}$`)
+)
+
+// redactedConfig returns the effective configuration as indented JSON,
+// without the API token.
+func redactedConfig(conf Config) (string, error) {
+	if conf.ApiToken.String != "" {
+		conf.ApiToken = null.StringFrom(redacted)
+	}
+	headers := make(map[string]string, len(conf.Headers))
+	for key, value := range conf.Headers {
+		if http.CanonicalHeaderKey(key) == "Authorization" {
+			value = redacted
+		}
+		headers[key] = value
+	}
+	conf.Headers = headers
+
+	b, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// checkSamplePayload converts a sample request duration with the configured
+// dimension rules and checks the resulting metric key and dimension keys
+// are accepted by the ingest API.
+func (o *Output) checkSamplePayload(now time.Time) error {
+	sample := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{Metric: newMetric("http_req_duration", metrics.Trend, metrics.Time)},
+		Time:       now,
+		Value:      1,
+	}
+	m, ok := o.convertSample(sample, now)
+	if !ok {
+		return nil
+	}
+	if !metricKeyRe.MatchString(m.metricKeyName) {
+		return fmt.Errorf("invalid metric key %q, check metricPrefix and the renames", m.metricKeyName)
+	}
+	for key := range m.metricDimensions {
+		if !dimensionKeyRe.MatchString(key) {
+			return fmt.Errorf("invalid dimension key %q, expected a letter followed by letters, digits or _.:-", key)
+		}
+	}
+	line := m.toText()
+	if err := validateLine(line); err != nil {
+		return fmt.Errorf("invalid metric line %q at %v", line, err)
+	}
+	return nil
+}
+
+// probeEndpoint sends an empty payload to the ingest endpoint, which
+// checks it can be reached and accepts the token without ingesting data.
+func (o *Output) probeEndpoint() error {
+	request, err := http.NewRequest(http.MethodPost, o.config.Url, bytes.NewReader(nil))
+	if err != nil {
+		return err
+	}
+	for key, value := range o.config.Headers {
+		request.Header.Set(key, value)
+	}
+	response, err := o.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("%s can't be reached: %w", o.config.Url, err)
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%s rejected the API token: %s", o.config.Url, response.Status)
+	case http.StatusNotFound:
+		return fmt.Errorf("%s is not a metrics ingest endpoint: %s", o.config.Url, response.Status)
+	}
+	return nil
+}
+
+// validateOnly checks the configuration against the environment, prints
+// the effective configuration, even in quiet mode, and returns, without
+// collecting metrics.
+func (o *Output) validateOnly() error {
+	if err := o.checkSamplePayload(time.Now()); err != nil {
+		return err
+	}
+	if err := o.probeEndpoint(); err != nil {
+		return err
+	}
+	conf, err := redactedConfig(*o.config)
+	if err != nil {
+		return err
+	}
+	o.summaryLogger.Info("Dynatrace: the configuration is valid\n" + conf)
+	return nil
+}
@@ -0,0 +1,98 @@
+package dynatracewriter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestValidateOnly(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		bodies []int64
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		bodies = append(bodies, r.ContentLength)
+		mu.Unlock()
+		if r.Header.Get("Authorization") != "Api-Token token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	o := newTestOutput(t, server.URL, nil)
+	require.NoError(t, o.validateOnly())
+	mu.Lock()
+	assert.Equal(t, []int64{0}, bodies)
+	mu.Unlock()
+
+	o.config.Headers["Authorization"] = "Api-Token other"
+	err := o.validateOnly()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected the API token")
+}
+
+func TestCheckSamplePayload(t *testing.T) {
+	t.Parallel()
+
+	o := newTestOutput(t, "http://localhost", func(c *Config) {
+		c.Dimensions = map[string]string{"team name": "checkout"}
+	})
+	err := o.checkSamplePayload(time.Now())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid dimension key "team name"`)
+
+	o = newTestOutput(t, "http://localhost", func(c *Config) {
+		c.MetricPrefix = null.StringFrom("1k6.")
+	})
+	assert.Error(t, o.checkSamplePayload(time.Now()))
+}
+
+func TestRedactedConfig(t *testing.T) {
+	t.Parallel()
+
+	c := NewConfig()
+	c.ApiToken = null.StringFrom("dt0c01.secret")
+	c.Headers = map[string]string{"authorization": "Api-Token dt0c01.secret", "X-Team": "checkout"}
+
+	conf, err := redactedConfig(c)
+	require.NoError(t, err)
+	assert.NotContains(t, conf, "dt0c01.secret")
+	assert.Contains(t, conf, `"X-Team": "checkout"`)
+	assert.Equal(t, "dt0c01.secret", c.ApiToken.String)
+}
+
+func TestValidateOnlyQuiet(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	c := NewConfig()
+	c.Url = server.URL
+	c.ApiToken = null.StringFrom("token")
+	c.Quiet = null.BoolFrom(true)
+	constructed, err := c.ConstructConfig()
+	require.NoError(t, err)
+	logger, hook := test.NewNullLogger()
+	o, err := newOutput(constructed, logger)
+	require.NoError(t, err)
+
+	require.NoError(t, o.validateOnly())
+	require.NotNil(t, hook.LastEntry(), "the quiet mode still prints the configuration")
+	assert.Contains(t, hook.LastEntry().Message, "the configuration is valid")
+}
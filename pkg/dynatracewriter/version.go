@@ -0,0 +1,36 @@
+package dynatracewriter
+
+import (
+	"runtime/debug"
+
+	"go.k6.io/k6/lib/consts"
+)
+
+const modulePath = "github.com/henrikrexed/xk6-output-dynatrace"
+
+// Version is the version of the extension, injected at build time with
+// XK6_BUILD_FLAGS='-ldflags=-X github.com/henrikrexed/xk6-output-dynatrace/pkg/dynatracewriter.Version=1.2.3'.
+// Without it, the version of the module in the k6 binary is used.
+var Version = ""
+
+// extensionVersion returns the version of the extension, "dev" for a
+// local build.
+func extensionVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath && dep.Version != "" && dep.Version != "(devel)" {
+				return dep.Version
+			}
+		}
+	}
+	return "dev"
+}
+
+// userAgent identifies the extension and the k6 version in the requests
+// to Dynatrace, e.g. xk6-output-dynatrace/v1.2.3 k6/v0.45.0.
+func userAgent() string {
+	return "xk6-output-dynatrace/" + extensionVersion() + " k6/v" + consts.Version
+}
@@ -0,0 +1,70 @@
+package dynatracewriter
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.k6.io/k6/metrics"
+)
+
+// Writer converts k6 samples into Dynatrace metric lines and sends them
+// with the configured transport, without k6 running it as an output, e.g.
+// from a custom harness or a script backfilling recorded samples:
+//
+//	w, err := dynatracewriter.NewWriter(conf, logger)
+//	...
+//	w.Add(samples)
+//	err = w.Flush(ctx)
+//
+// Its methods must not be called concurrently with Flush or Close.
+type Writer struct {
+	output *Output
+}
+
+// NewWriter validates the configuration and returns a writer using it,
+// conf usually starts from NewConfig.
+func NewWriter(conf Config, logger logrus.FieldLogger) (*Writer, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	newconfig, err := conf.ConstructConfig()
+	if err != nil {
+		return nil, err
+	}
+	o, err := newOutput(newconfig, logger)
+	if err != nil {
+		return nil, err
+	}
+	o.addSourceDimension()
+	o.started = time.Now()
+	return &Writer{output: o}, nil
+}
+
+// SetDoer replaces the client sending the requests.
+func (w *Writer) SetDoer(doer Doer) {
+	w.output.SetDoer(doer)
+}
+
+// AddPreSendHook adds a hook modifying the lines before they are sent.
+func (w *Writer) AddPreSendHook(hook PreSendHook) {
+	w.output.AddPreSendHook(hook)
+}
+
+// Add buffers the samples until the next Flush.
+func (w *Writer) Add(samples ...metrics.SampleContainer) {
+	w.output.AddMetricSamples(samples)
+}
+
+// Flush converts and sends the buffered samples, it returns the error of
+// the request when the metric lines couldn't be sent.
+func (w *Writer) Flush(ctx context.Context) error {
+	return w.output.flushContext(ctx)
+}
+
+// Close sends the remaining samples and releases the connections.
+func (w *Writer) Close() error {
+	err := w.Flush(context.Background())
+	w.output.closeIdleConnections()
+	return err
+}
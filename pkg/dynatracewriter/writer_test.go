@@ -0,0 +1,59 @@
+package dynatracewriter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+
+	status := http.StatusAccepted
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, string(body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	c := NewConfig()
+	c.Url = server.URL
+	c.ApiToken = null.StringFrom("dt0c01." + strings.Repeat("A", 24) + "." + strings.Repeat("B", 64))
+	c.TestRunID = null.StringFrom("backfill")
+	w, err := NewWriter(c, logrus.New())
+	require.NoError(t, err)
+
+	sample := metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: newMetric("vus", metrics.Gauge),
+			Tags:   newTags(map[string]string{"scenario": "default"}),
+		},
+		Time:  time.Now(),
+		Value: 10,
+	}
+	w.Add(metrics.Samples{sample})
+	require.NoError(t, w.Flush(context.Background()))
+	require.Len(t, received, 1)
+	assert.Contains(t, received[0], "k6.vus,")
+	assert.Contains(t, received[0], `test_run_id="backfill"`)
+	assert.Contains(t, received[0], `dt.metrics.source="k6"`)
+
+	status = http.StatusBadRequest
+	w.Add(metrics.Samples{sample})
+	assert.Error(t, w.Close())
+
+	_, err = NewWriter(NewConfig(), logrus.New())
+	assert.Error(t, err)
+}
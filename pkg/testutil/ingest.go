@@ -0,0 +1,194 @@
+// Package testutil provides a fake Dynatrace metrics ingest endpoint, to
+// test a configuration of the output end-to-end without a Dynatrace
+// environment.
+package testutil
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// IngestPath is the path of the metrics ingest API, the OneAgent local
+// endpoint /metrics/ingest is served as well.
+const IngestPath = "/api/v2/metrics/ingest"
+
+// lineRe matches a metric line: the key, the dimensions, the payload and
+// the optional timestamp, e.g.
+// k6.http_reqs,url="/a" count,delta=1 1700000000000
+var lineRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.:-]*` +
+	`(,[A-Za-z_][A-Za-z0-9_.:-]*="([^"\\]|\\.)*")*` +
+	` (count,delta=|gauge,)?[-+]?([0-9]*\.?[0-9]+([eE][-+]?[0-9]+)?|NaN|[-+]?Inf)` +
+	`( [0-9]+)?$`)
+
+// InvalidLine is a line the server rejected.
+type InvalidLine struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// IngestServer is an httptest server answering like the metrics ingest
+// API. It checks the line protocol of the lines it receives, records
+// them, and answers with the queued failures first.
+type IngestServer struct {
+	*httptest.Server
+
+	// Token, when set, is the only API token accepted
+	Token string
+
+	mu       sync.Mutex
+	lines    []string
+	invalid  []string
+	requests int
+	failures []int
+}
+
+// NewIngestServer starts a server, the caller closes it.
+func NewIngestServer() *IngestServer {
+	s := &IngestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Fail makes the next n requests fail with status, e.g. 429, 413 or 503.
+func (s *IngestServer) Fail(status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// Lines returns the valid metric lines received, without the metadata
+// lines.
+func (s *IngestServer) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+// InvalidLines returns the lines rejected for their syntax.
+func (s *IngestServer) InvalidLines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.invalid...)
+}
+
+// Requests returns the number of requests received, failed ones included.
+func (s *IngestServer) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Reset forgets the received lines and the queued failures.
+func (s *IngestServer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines, s.invalid, s.requests, s.failures = nil, nil, 0, nil
+}
+
+func (s *IngestServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	if r.URL.Path != IngestPath && r.URL.Path != "/metrics/ingest" {
+		writeError(w, http.StatusNotFound, "unknown endpoint "+r.URL.Path)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "expected POST")
+		return
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Api-Token "); r.URL.Path == IngestPath &&
+		(token == "" || s.Token != "" && token != s.Token) {
+		writeError(w, http.StatusUnauthorized, "missing or wrong API token")
+		return
+	}
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeError(w, status, http.StatusText(status))
+		return
+	}
+
+	var body io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid gzip body: "+err.Error())
+			return
+		}
+		defer gz.Close()
+		body = gz
+	case "zstd":
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid zstd body: "+err.Error())
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+
+	var (
+		ok      int
+		invalid []InvalidLine
+	)
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case lineRe.MatchString(line):
+			s.lines = append(s.lines, line)
+			ok++
+		default:
+			s.invalid = append(s.invalid, line)
+			invalid = append(invalid, InvalidLine{Line: number, Error: "invalid line protocol"})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	answer := map[string]interface{}{"linesOk": ok, "linesInvalid": len(invalid), "error": nil}
+	status := http.StatusAccepted
+	if len(invalid) > 0 {
+		status = http.StatusBadRequest
+		answer["error"] = map[string]interface{}{
+			"code":         status,
+			"message":      fmt.Sprintf("%d invalid lines", len(invalid)),
+			"invalidLines": invalid,
+		}
+	}
+	writeJSON(w, status, answer)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": message},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
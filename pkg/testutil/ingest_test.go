@@ -0,0 +1,102 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrikrexed/xk6-output-dynatrace/pkg/dynatracewriter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.k6.io/k6/metrics"
+	"gopkg.in/guregu/null.v3"
+)
+
+func post(t *testing.T, s *IngestServer, body string, gzipped bool) *http.Response {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if gzipped {
+		gz := gzip.NewWriter(&payload)
+		_, _ = gz.Write([]byte(body))
+		require.NoError(t, gz.Close())
+	} else {
+		payload.WriteString(body)
+	}
+	request, err := http.NewRequest(http.MethodPost, s.URL+IngestPath, &payload)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Api-Token secret")
+	if gzipped {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	response.Body.Close()
+	return response
+}
+
+func TestIngestServer(t *testing.T) {
+	t.Parallel()
+
+	s := NewIngestServer()
+	defer s.Close()
+
+	response := post(t, s, "#k6.vus gauge dt.meta.unit=Count\n"+
+		"k6.vus,scenario=\"default\" 10 1700000000000\n"+
+		"k6.http_reqs count,delta=1\n", false)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	assert.Equal(t, []string{`k6.vus,scenario="default" 10 1700000000000`, "k6.http_reqs count,delta=1"}, s.Lines())
+
+	response = post(t, s, "k6.vus,scenario=default 10\n", true)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assert.Equal(t, []string{"k6.vus,scenario=default 10"}, s.InvalidLines())
+
+	s.Fail(http.StatusTooManyRequests, 1)
+	s.Fail(http.StatusRequestEntityTooLarge, 1)
+	response = post(t, s, "k6.vus 1\n", false)
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+	assert.Equal(t, "1", response.Header.Get("Retry-After"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(t, s, "k6.vus 1\n", false).StatusCode)
+	assert.Equal(t, http.StatusAccepted, post(t, s, "k6.vus 1\n", false).StatusCode)
+	assert.Equal(t, 5, s.Requests())
+
+	s.Token = "other"
+	assert.Equal(t, http.StatusUnauthorized, post(t, s, "k6.vus 1\n", false).StatusCode)
+}
+
+func TestIngestServerWithWriter(t *testing.T) {
+	t.Parallel()
+
+	s := NewIngestServer()
+	defer s.Close()
+
+	conf := dynatracewriter.NewConfig()
+	conf.Url = s.URL
+	conf.ApiToken = null.StringFrom("dt0c01." + strings.Repeat("A", 24) + "." + strings.Repeat("B", 64))
+	conf.TestRunID = null.StringFrom("ci")
+	w, err := dynatracewriter.NewWriter(conf, logrus.New())
+	require.NoError(t, err)
+
+	registry := metrics.NewRegistry()
+	w.Add(metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: registry.MustNewMetric("vus", metrics.Gauge),
+			Tags:   registry.RootTagSet().With("scenario", "default"),
+		},
+		Time:  time.Now(),
+		Value: 10,
+	})
+	require.NoError(t, w.Flush(context.Background()))
+	assert.Empty(t, s.InvalidLines())
+
+	var found bool
+	for _, line := range s.Lines() {
+		found = found || strings.HasPrefix(line, "k6.vus,")
+	}
+	assert.True(t, found, "k6.vus line in %v", s.Lines())
+}